@@ -0,0 +1,255 @@
+// Package analytics aggregates closed trades (TradeSummary rows) into
+// performance statistics: overall and grouped by strategy, instrument and
+// time, with a cumulative equity curve and its drawdowns.
+package analytics
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go-backend/models"
+)
+
+// Stats describe a set of closed trades. Trades with zero net P&L count
+// as neither wins nor losses.
+type Stats struct {
+	Trades        int      `json:"trades"`
+	Wins          int      `json:"wins"`
+	Losses        int      `json:"losses"`
+	WinRate       float64  `json:"winRate"` // percent of trades
+	NetPnL        float64  `json:"netPnL"`
+	GrossProfit   float64  `json:"grossProfit"`
+	GrossLoss     float64  `json:"grossLoss"` // positive
+	TotalFees     float64  `json:"totalFees"`
+	ProfitFactor  *float64 `json:"profitFactor"` // nil without losses
+	AvgWin        float64  `json:"avgWin"`
+	AvgLoss       float64  `json:"avgLoss"` // positive
+	Payoff        *float64 `json:"payoff"`  // average win over average loss
+	Expectancy    float64  `json:"expectancy"`
+	LargestWin    float64  `json:"largestWin"`
+	LargestLoss   float64  `json:"largestLoss"` // most negative trade
+	MaxWinStreak  int      `json:"maxWinStreak"`
+	MaxLossStreak int      `json:"maxLossStreak"`
+	AvgHold       float64  `json:"avgHoldMinutes"`
+}
+
+// Group is the stats of one value of a grouping.
+type Group struct {
+	Key   string `json:"key"`
+	Label string `json:"label"`
+	Stats
+}
+
+// CurvePoint is cumulative P&L after a trade closed.
+type CurvePoint struct {
+	Time        time.Time `json:"time"`
+	TradeID     uuid.UUID `json:"tradeId"`
+	PnL         float64   `json:"pnl"`
+	Equity      float64   `json:"equity"` // capital plus cumulative P&L
+	Peak        float64   `json:"peak"`
+	Drawdown    float64   `json:"drawdown"`              // below the peak
+	DrawdownPct *float64  `json:"drawdownPct,omitempty"` // of the peak; needs capital
+}
+
+// Drawdown is the deepest peak-to-trough fall of the curve.
+type Drawdown struct {
+	Amount    float64    `json:"amount"`
+	Percent   *float64   `json:"percent,omitempty"`
+	PeakAt    *time.Time `json:"peakAt,omitempty"`
+	TroughAt  *time.Time `json:"troughAt,omitempty"`
+	Recovered *time.Time `json:"recoveredAt,omitempty"` // nil while still under the peak
+}
+
+// Report is the analytics of a set of trades.
+type Report struct {
+	Overall      Stats        `json:"overall"`
+	ByStrategy   []Group      `json:"byStrategy"`
+	ByInstrument []Group      `json:"byInstrument"`
+	ByWeekday    []Group      `json:"byWeekday"`
+	ByHour       []Group      `json:"byHour"`
+	ByMonth      []Group      `json:"byMonth"`
+	Equity       []CurvePoint `json:"equity"`
+	MaxDrawdown  Drawdown     `json:"maxDrawdown"`
+}
+
+// Options shape a report.
+type Options struct {
+	Capital    float64              // starting equity; 0 reports P&L only
+	Location   *time.Location       // for weekday, hour and month; nil is time.Local
+	Strategies map[uuid.UUID]string // strategy names for labels
+}
+
+// Analyze builds a report. Weekday and hour group trades by when they were
+// entered, months and the equity curve by when they closed.
+func Analyze(trades []models.TradeSummary, opts Options) *Report {
+	loc := opts.Location
+	if loc == nil {
+		loc = time.Local
+	}
+	sorted := make([]models.TradeSummary, len(trades))
+	copy(sorted, trades)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].ExitTime.Before(sorted[j].ExitTime) })
+
+	rep := &Report{Overall: compute(sorted)}
+	rep.ByStrategy = groupBy(sorted, func(t models.TradeSummary) (string, string) {
+		name := opts.Strategies[t.StrategyID]
+		if name == "" {
+			name = "Unassigned"
+			if t.StrategyID != uuid.Nil {
+				name = t.StrategyID.String()
+			}
+		}
+		return t.StrategyID.String(), name
+	}, byNet)
+	rep.ByInstrument = groupBy(sorted, func(t models.TradeSummary) (string, string) {
+		sym := strings.ToUpper(t.Instrument)
+		return sym, sym
+	}, byNet)
+	rep.ByWeekday = groupBy(sorted, func(t models.TradeSummary) (string, string) {
+		d := t.EntryTime.In(loc).Weekday()
+		// Monday first
+		return fmt.Sprint((int(d) + 6) % 7), d.String()
+	}, byKey)
+	rep.ByHour = groupBy(sorted, func(t models.TradeSummary) (string, string) {
+		h := t.EntryTime.In(loc).Hour()
+		return fmt.Sprintf("%02d", h), fmt.Sprintf("%02d:00-%02d:00", h, (h+1)%24)
+	}, byKey)
+	rep.ByMonth = groupBy(sorted, func(t models.TradeSummary) (string, string) {
+		m := t.ExitTime.In(loc)
+		return m.Format("2006-01"), m.Format("Jan 2006")
+	}, byKey)
+	rep.Equity, rep.MaxDrawdown = curve(sorted, opts.Capital)
+	return rep
+}
+
+// compute derives Stats from trades in exit order.
+func compute(trades []models.TradeSummary) Stats {
+	s := Stats{Trades: len(trades)}
+	winStreak, lossStreak := 0, 0
+	held := 0.0
+	for _, t := range trades {
+		p := t.NetPnL
+		s.NetPnL += p
+		s.TotalFees += t.TotalFees
+		held += t.ExitTime.Sub(t.EntryTime).Minutes()
+		switch {
+		case p > 0:
+			s.Wins++
+			s.GrossProfit += p
+			s.LargestWin = math.Max(s.LargestWin, p)
+			winStreak, lossStreak = winStreak+1, 0
+		case p < 0:
+			s.Losses++
+			s.GrossLoss -= p
+			s.LargestLoss = math.Min(s.LargestLoss, p)
+			winStreak, lossStreak = 0, lossStreak+1
+		default:
+			winStreak, lossStreak = 0, 0
+		}
+		s.MaxWinStreak = max(s.MaxWinStreak, winStreak)
+		s.MaxLossStreak = max(s.MaxLossStreak, lossStreak)
+	}
+	if s.Trades == 0 {
+		return s
+	}
+	n := float64(s.Trades)
+	s.WinRate = float64(s.Wins) / n * 100
+	s.Expectancy = s.NetPnL / n
+	s.AvgHold = held / n
+	if s.Wins > 0 {
+		s.AvgWin = s.GrossProfit / float64(s.Wins)
+	}
+	if s.Losses > 0 {
+		s.AvgLoss = s.GrossLoss / float64(s.Losses)
+		pf := s.GrossProfit / s.GrossLoss
+		s.ProfitFactor = &pf
+		if s.Wins > 0 {
+			payoff := s.AvgWin / s.AvgLoss
+			s.Payoff = &payoff
+		}
+	}
+	s.round()
+	return s
+}
+
+func (s *Stats) round() {
+	for _, v := range []*float64{&s.WinRate, &s.NetPnL, &s.GrossProfit, &s.GrossLoss, &s.TotalFees, &s.AvgWin,
+		&s.AvgLoss, &s.Expectancy, &s.LargestWin, &s.LargestLoss, &s.AvgHold, s.ProfitFactor, s.Payoff} {
+		if v != nil {
+			*v = round2(*v)
+		}
+	}
+}
+
+func round2(v float64) float64 { return math.Round(v*100) / 100 }
+
+// Orders for groups.
+var (
+	byKey = func(a, b Group) bool { return a.Key < b.Key }
+	byNet = func(a, b Group) bool { return a.NetPnL > b.NetPnL || a.NetPnL == b.NetPnL && a.Key < b.Key }
+)
+
+// groupBy splits trades (keeping their order) by key and computes each
+// group's stats.
+func groupBy(trades []models.TradeSummary, key func(models.TradeSummary) (string, string), less func(a, b Group) bool) []Group {
+	members := map[string][]models.TradeSummary{}
+	labels := map[string]string{}
+	for _, t := range trades {
+		k, label := key(t)
+		members[k] = append(members[k], t)
+		labels[k] = label
+	}
+	out := make([]Group, 0, len(members))
+	for k, ts := range members {
+		out = append(out, Group{Key: k, Label: labels[k], Stats: compute(ts)})
+	}
+	sort.Slice(out, func(i, j int) bool { return less(out[i], out[j]) })
+	return out
+}
+
+// curve is the equity after each trade, in exit order, and its deepest
+// drawdown. Percentages need a starting capital.
+func curve(trades []models.TradeSummary, capital float64) ([]CurvePoint, Drawdown) {
+	points := make([]CurvePoint, 0, len(trades))
+	equity, peak := capital, capital
+	var peakAt time.Time // zero while the peak is the starting capital
+	var worst Drawdown
+	worstPeak, trough := 0.0, -1
+	for i, t := range trades {
+		equity += t.NetPnL
+		if equity > peak {
+			peak, peakAt = equity, t.ExitTime
+		}
+		p := CurvePoint{Time: t.ExitTime, TradeID: t.ID, PnL: round2(t.NetPnL), Equity: round2(equity),
+			Peak: round2(peak), Drawdown: round2(peak - equity)}
+		if capital > 0 && peak > 0 {
+			pct := round2((peak - equity) / peak * 100)
+			p.DrawdownPct = &pct
+		}
+		points = append(points, p)
+
+		if dd := peak - equity; dd > worst.Amount {
+			at := t.ExitTime
+			worst = Drawdown{Amount: round2(dd), Percent: p.DrawdownPct, TroughAt: &at}
+			if !peakAt.IsZero() {
+				from := peakAt
+				worst.PeakAt = &from
+			}
+			worstPeak, trough = peak, i
+		}
+	}
+	if trough >= 0 {
+		for i := trough + 1; i < len(trades); i++ {
+			if points[i].Equity >= round2(worstPeak) {
+				at := points[i].Time
+				worst.Recovered = &at
+				break
+			}
+		}
+	}
+	return points, worst
+}
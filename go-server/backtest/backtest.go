@@ -0,0 +1,319 @@
+// Package backtest replays a compiled strategy script over historical bars
+// using the same script.Host contract as the paper and live runners.
+package backtest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+
+	"go-backend/charges"
+	"go-backend/script"
+	"go-backend/sizing"
+)
+
+// A run is bounded as a whole, not only per bar by the script limits: it
+// covers at most MaxBars bars and stops after Timeout.
+const (
+	MaxBars = 50000
+	Timeout = time.Minute
+)
+
+// ErrTooManyBars is returned for a range longer than MaxBars.
+var ErrTooManyBars = errors.New("too many bars for one backtest")
+
+// Config controls the simulated account.
+type Config struct {
+	InitialCapital    float64
+	CommissionPercent float64       // of notional, per fill; ignored when Charges is set
+	Charges           *charges.Plan // prices fills with Indian statutory charges in Segment
+	Segment           string
+	SlippagePercent   float64 // applied against the order on market fills
+	Limits            script.Limits
+	Sizing            *sizing.Params // rule behind size(); nil makes size() an error
+	LotSize           int
+}
+
+// Trade is one closed round trip (or the closed part of one).
+type Trade struct {
+	Side       string    `json:"side"` // LONG or SHORT
+	Quantity   float64   `json:"quantity"`
+	EntryPrice float64   `json:"entryPrice"`
+	ExitPrice  float64   `json:"exitPrice"`
+	EntryTime  time.Time `json:"entryTime"`
+	ExitTime   time.Time `json:"exitTime"`
+	PnL        float64   `json:"pnl"`
+	Fees       float64   `json:"fees"`
+}
+
+// EquityPoint is the account value at the close of a bar.
+type EquityPoint struct {
+	Time   time.Time `json:"time"`
+	Equity float64   `json:"equity"`
+}
+
+// Result summarises a run.
+type Result struct {
+	FinalCapital  float64       `json:"finalCapital"`
+	TotalPnl      float64       `json:"totalPnl"`
+	PercentReturn float64       `json:"percentReturn"`
+	SharpeRatio   float64       `json:"sharpeRatio"`
+	MaxDrawdown   float64       `json:"maxDrawdown"` // percent
+	WinRate       float64       `json:"winRate"`     // percent
+	ProfitFactor  float64       `json:"profitFactor"`
+	Trades        []Trade       `json:"trades"`
+	Equity        []EquityPoint `json:"equity"`
+	Logs          []string      `json:"logs"`
+	Errors        int           `json:"errors"` // bars skipped for a script error
+}
+
+type pendingOrder struct {
+	req script.OrderRequest
+}
+
+// sim is the script.Host used for backtests.
+type sim struct {
+	cfg      Config
+	bars     []script.Bar
+	cursor   int
+	cash     float64
+	qty      float64
+	avg      float64
+	opened   time.Time
+	openFees float64
+	pending  []pendingOrder
+	trades   []Trade
+	logs     []string
+}
+
+func (s *sim) Bars() []script.Bar { return s.bars[:s.cursor+1] }
+
+func (s *sim) Position() script.Position {
+	return script.Position{Quantity: s.qty, AvgPrice: s.avg}
+}
+
+func (s *sim) Equity() float64 {
+	return s.cash + s.qty*s.bars[s.cursor].Close
+}
+
+func (s *sim) PlaceOrder(req script.OrderRequest) error {
+	if req.OrderType == "LIMIT" {
+		s.pending = append(s.pending, pendingOrder{req: req})
+		return nil
+	}
+	bar := s.bars[s.cursor]
+	price := bar.Close
+	if req.Side == "BUY" {
+		price *= 1 + s.cfg.SlippagePercent/100
+	} else {
+		price *= 1 - s.cfg.SlippagePercent/100
+	}
+	s.fill(req.Side, req.Quantity, price, bar.Time)
+	return nil
+}
+
+func (s *sim) PositionSize(stop float64) (float64, error) {
+	if s.cfg.Sizing == nil {
+		return 0, fmt.Errorf("no position sizing rule for this strategy")
+	}
+	pnls := make([]float64, len(s.trades))
+	for i, t := range s.trades {
+		pnls[i] = t.PnL
+	}
+	res, err := sizing.Size(*s.cfg.Sizing, sizing.Market{
+		Equity:  s.Equity(),
+		Entry:   s.bars[s.cursor].Close,
+		Stop:    stop,
+		Bars:    s.Bars(),
+		LotSize: s.cfg.LotSize,
+		Stats:   sizing.StatsFromPnL(pnls),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return float64(res.Quantity), nil
+}
+
+func (s *sim) CancelAll() error {
+	s.pending = nil
+	return nil
+}
+
+func (s *sim) Log(line int, msg string) {
+	s.logs = append(s.logs, fmt.Sprintf("%s line %d: %s", s.bars[s.cursor].Time.Format(time.RFC3339), line, msg))
+}
+
+// fillPending fills resting limit orders that the new bar trades through.
+func (s *sim) fillPending() {
+	bar := s.bars[s.cursor]
+	rest := s.pending[:0]
+	for _, p := range s.pending {
+		switch {
+		case p.req.Side == "BUY" && bar.Low <= p.req.Price:
+			s.fill("BUY", p.req.Quantity, math.Min(bar.Open, p.req.Price), bar.Time)
+		case p.req.Side == "SELL" && bar.High >= p.req.Price:
+			s.fill("SELL", p.req.Quantity, math.Max(bar.Open, p.req.Price), bar.Time)
+		default:
+			rest = append(rest, p)
+		}
+	}
+	s.pending = rest
+}
+
+func (s *sim) fill(side string, qty, price float64, at time.Time) {
+	fee := qty * price * s.cfg.CommissionPercent / 100
+	if s.cfg.Charges != nil {
+		fee = charges.Compute(*s.cfg.Charges, s.cfg.Segment, side, qty, price).Total
+	}
+	signed := qty
+	if side == "SELL" {
+		signed = -qty
+	}
+	s.cash -= signed*price + fee
+
+	// Close against the existing position first.
+	if s.qty != 0 && (s.qty > 0) != (signed > 0) {
+		closing := math.Min(qty, math.Abs(s.qty))
+		dir := 1.0
+		tradeSide := "LONG"
+		if s.qty < 0 {
+			dir, tradeSide = -1, "SHORT"
+		}
+		share := closing / math.Abs(s.qty)
+		fees := s.openFees*share + fee*closing/qty
+		s.openFees -= s.openFees * share
+		s.trades = append(s.trades, Trade{
+			Side:       tradeSide,
+			Quantity:   closing,
+			EntryPrice: s.avg,
+			ExitPrice:  price,
+			EntryTime:  s.opened,
+			ExitTime:   at,
+			PnL:        (price-s.avg)*closing*dir - fees,
+			Fees:       fees,
+		})
+		s.qty += dir * -closing
+		qty -= closing
+		fee -= fee * closing / (closing + qty)
+		if s.qty == 0 {
+			s.avg = 0
+		}
+		if qty == 0 {
+			return
+		}
+		signed = qty
+		if side == "SELL" {
+			signed = -qty
+		}
+	}
+
+	// Open or add to a position.
+	if s.qty == 0 {
+		s.opened = at
+	}
+	total := math.Abs(s.qty) + qty
+	s.avg = (s.avg*math.Abs(s.qty) + price*qty) / total
+	s.qty += signed
+	s.openFees += fee
+}
+
+// Run executes prog over bars and returns the simulated account result.
+func Run(ctx context.Context, prog *script.Program, bars []script.Bar, cfg Config) (*Result, error) {
+	if cfg.InitialCapital <= 0 {
+		return nil, fmt.Errorf("initial capital must be positive")
+	}
+	if len(bars) > MaxBars {
+		return nil, fmt.Errorf("%w: %d, at most %d", ErrTooManyBars, len(bars), MaxBars)
+	}
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+	s := &sim{cfg: cfg, bars: bars, cash: cfg.InitialCapital}
+	inst := prog.NewInstance()
+	res := &Result{}
+
+	for i := range bars {
+		s.cursor = i
+		s.fillPending()
+		if err := inst.OnBar(ctx, s, cfg.Limits); err != nil {
+			if ctx.Err() != nil {
+				return nil, fmt.Errorf("backtest stopped at bar %d of %d: %w", i+1, len(bars), ctx.Err())
+			}
+			// A script error skips the bar, as it does for a deployed strategy.
+			s.logs = append(s.logs, fmt.Sprintf("%s error: %v", bars[i].Time.Format(time.RFC3339), err))
+			res.Errors++
+		}
+		res.Equity = append(res.Equity, EquityPoint{Time: bars[i].Time, Equity: s.Equity()})
+	}
+
+	res.Trades = s.trades
+	res.Logs = s.logs
+	summarise(res, cfg.InitialCapital)
+	return res, nil
+}
+
+func summarise(res *Result, initial float64) {
+	final := initial
+	if n := len(res.Equity); n > 0 {
+		final = res.Equity[n-1].Equity
+	}
+	res.FinalCapital = final
+	res.TotalPnl = final - initial
+	res.PercentReturn = res.TotalPnl / initial * 100
+
+	peak, maxDD := initial, 0.0
+	var returns []float64
+	prev := initial
+	for _, p := range res.Equity {
+		if p.Equity > peak {
+			peak = p.Equity
+		}
+		if dd := (peak - p.Equity) / peak * 100; dd > maxDD {
+			maxDD = dd
+		}
+		if prev != 0 {
+			returns = append(returns, (p.Equity-prev)/prev)
+		}
+		prev = p.Equity
+	}
+	res.MaxDrawdown = maxDD
+	res.SharpeRatio = sharpe(returns)
+
+	wins, grossWin, grossLoss := 0, 0.0, 0.0
+	for _, t := range res.Trades {
+		if t.PnL > 0 {
+			wins++
+			grossWin += t.PnL
+		} else {
+			grossLoss -= t.PnL
+		}
+	}
+	if len(res.Trades) > 0 {
+		res.WinRate = float64(wins) / float64(len(res.Trades)) * 100
+	}
+	if grossLoss > 0 {
+		res.ProfitFactor = grossWin / grossLoss
+	}
+}
+
+// sharpe annualises per-bar returns assuming 252 bars a year.
+func sharpe(returns []float64) float64 {
+	if len(returns) < 2 {
+		return 0
+	}
+	mean := 0.0
+	for _, r := range returns {
+		mean += r
+	}
+	mean /= float64(len(returns))
+	ss := 0.0
+	for _, r := range returns {
+		ss += (r - mean) * (r - mean)
+	}
+	sd := math.Sqrt(ss / float64(len(returns)-1))
+	if sd == 0 {
+		return 0
+	}
+	return mean / sd * math.Sqrt(252)
+}
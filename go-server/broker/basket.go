@@ -0,0 +1,319 @@
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/google/uuid"
+	"go-backend/ledger"
+	"go-backend/marketfeed"
+	"go-backend/models"
+	"gorm.io/gorm"
+)
+
+// SubmitBasket places a multi-leg order all or none. Every leg must pass the
+// pre-trade checks at its full size and have a venue before any is routed;
+// otherwise the basket and its legs are kept as REJECTED. Legs are then
+// placed buys first, so hedges are in place before the short legs. If the
+// venue refuses a leg, working siblings are cancelled and filled ones
+// unwound. Legs only need Instrument, Exchange, Side, OrderType, Price and
+// LegRatio; the rest is taken from the basket.
+func SubmitBasket(ctx context.Context, db *gorm.DB, reg *Registry, b *models.BasketOrder, legs []*models.Order) error {
+	if len(legs) < 2 {
+		return fmt.Errorf("a basket needs at least two legs")
+	}
+	if b.Quantity <= 0 {
+		return fmt.Errorf("quantity must be positive")
+	}
+	if b.ID == uuid.Nil {
+		b.ID = uuid.New()
+	}
+	b.Status = models.BasketStatusOpen
+	for i, o := range legs {
+		if o.LegRatio <= 0 {
+			return fmt.Errorf("leg %d: ratio must be positive", i+1)
+		}
+		if o.ID == uuid.Nil {
+			o.ID = uuid.New()
+		}
+		if o.OrderID == "" {
+			o.OrderID = "ORD-" + o.ID.String()
+		}
+		o.BasketID = &b.ID
+		o.UserID = b.UserID
+		o.StrategyID = b.StrategyID
+		o.DeploymentID = b.DeploymentID
+		o.BrokerID = b.BrokerID
+		o.IsPaper = b.IsPaper
+		o.Quantity = o.LegRatio * b.Quantity
+		o.Status = models.OrderStatusOpen
+	}
+
+	venues := make([]Broker, len(legs))
+	var failed error
+	for i, o := range legs {
+		want := o.Quantity
+		err := reg.preTrade(ctx, o)
+		if err == nil && o.Quantity != want {
+			err = fmt.Errorf("leg %s would be downsized to %d: %s", o.Instrument, o.Quantity, o.RiskReason)
+			o.Quantity = want
+		}
+		if err == nil {
+			venues[i], err = reg.For(o)
+		}
+		if err != nil {
+			var rej *RejectError
+			if errors.As(err, &rej) {
+				o.RiskLimitID = rej.LimitID
+			}
+			o.RiskReason = err.Error()
+			failed = fmt.Errorf("leg %s: %w", o.Instrument, err)
+			break
+		}
+	}
+	if failed != nil {
+		b.Status = models.BasketStatusRejected
+		b.Reason = failed.Error()
+		for _, o := range legs {
+			o.Status = models.OrderStatusRejected
+			if o.RiskReason == "" {
+				o.RiskReason = "basket rejected: " + b.Reason
+			}
+		}
+	}
+	if err := createBasket(db, b, legs); err != nil {
+		return err
+	}
+	if failed != nil {
+		return failed
+	}
+
+	order := make([]int, len(legs))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool {
+		return strings.EqualFold(legs[order[i]].Side, "BUY") && !strings.EqualFold(legs[order[j]].Side, "BUY")
+	})
+	for n, i := range order {
+		o := legs[i]
+		if err := venues[i].PlaceOrder(ctx, o); err != nil {
+			o.Status = models.OrderStatusRejected
+			db.Model(o).Update("status", o.Status)
+			failed = fmt.Errorf("%s rejected leg %s: %w", venues[i].Name(), o.Instrument, err)
+			// legs not yet sent never reach the venue
+			for _, j := range order[n+1:] {
+				legs[j].Status = models.OrderStatusCancelled
+				db.Model(legs[j]).Update("status", legs[j].Status)
+			}
+			break
+		}
+		if o.BrokerOrderID != "" {
+			db.Model(o).Update("broker_order_id", o.BrokerOrderID)
+		}
+	}
+	if failed != nil {
+		if err := unwind(ctx, db, reg, b, failed.Error()); err != nil {
+			return fmt.Errorf("%w; unwind: %v", failed, err)
+		}
+		return failed
+	}
+	return RefreshBasket(db, b.ID)
+}
+
+func createBasket(db *gorm.DB, b *models.BasketOrder, legs []*models.Order) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Legs").Create(b).Error; err != nil {
+			return err
+		}
+		for _, o := range legs {
+			if err := tx.Create(o).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// CancelBasket cancels the basket's working legs and, when unwindFills is
+// set, reverses the quantity its legs have filled.
+func CancelBasket(ctx context.Context, db *gorm.DB, reg *Registry, b *models.BasketOrder, unwindFills bool) error {
+	if b.IsTerminal() {
+		return fmt.Errorf("basket is already %s", b.Status)
+	}
+	if unwindFills {
+		return unwind(ctx, db, reg, b, "cancelled and unwound by user")
+	}
+	if err := cancelLegs(ctx, db, reg, b.ID); err != nil {
+		return err
+	}
+	b.Status = models.BasketStatusCancelled
+	b.Reason = "cancelled by user"
+	return db.Model(b).Updates(map[string]interface{}{"status": b.Status, "reason": b.Reason}).Error
+}
+
+func cancelLegs(ctx context.Context, db *gorm.DB, reg *Registry, basketID uuid.UUID) error {
+	var working []models.Order
+	if err := db.Where("basket_id = ? AND status IN ?", basketID,
+		[]string{models.OrderStatusOpen, models.OrderStatusPartiallyFilled}).Find(&working).Error; err != nil {
+		return err
+	}
+	var errs []string
+	for i := range working {
+		if err := Cancel(ctx, db, reg, &working[i]); err != nil {
+			errs = append(errs, fmt.Sprintf("cancel %s: %v", working[i].Instrument, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// unwind marks the basket UNWOUND, cancels its working legs and closes what
+// they filled with market exit orders linked to the basket.
+func unwind(ctx context.Context, db *gorm.DB, reg *Registry, b *models.BasketOrder, reason string) error {
+	// terminal first, so fills of the exits do not move the basket's status
+	b.Status = models.BasketStatusUnwound
+	b.Reason = reason
+	if err := db.Model(b).Updates(map[string]interface{}{"status": b.Status, "reason": b.Reason}).Error; err != nil {
+		return err
+	}
+
+	var errs []string
+	if err := cancelLegs(ctx, db, reg, b.ID); err != nil {
+		errs = append(errs, err.Error())
+	}
+	var filled []models.Order
+	if err := db.Where("basket_id = ? AND leg_ratio > 0 AND filled_qty > 0", b.ID).Find(&filled).Error; err != nil {
+		return err
+	}
+	for _, leg := range filled {
+		side := "SELL"
+		if strings.EqualFold(leg.Side, "SELL") {
+			side = "BUY"
+		}
+		parent := leg.ID
+		exit := models.Order{
+			UserID:        leg.UserID,
+			Instrument:    leg.Instrument,
+			Exchange:      leg.Exchange,
+			Quantity:      leg.FilledQty,
+			Price:         leg.Price,
+			OrderType:     "MARKET",
+			Side:          side,
+			StrategyID:    leg.StrategyID,
+			IsExitOrder:   true,
+			ParentOrderID: &parent,
+			BasketID:      &b.ID,
+			DeploymentID:  leg.DeploymentID,
+			BrokerID:      leg.BrokerID,
+			IsPaper:       leg.IsPaper,
+		}
+		if err := Submit(ctx, db, reg, &exit); err != nil {
+			errs = append(errs, fmt.Sprintf("unwind %s: %v", leg.Instrument, err))
+		}
+	}
+	if len(errs) > 0 {
+		b.Reason += "; " + strings.Join(errs, "; ")
+		db.Model(b).Update("reason", b.Reason)
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// RefreshBasket derives a working basket's status from its legs.
+func RefreshBasket(db *gorm.DB, basketID uuid.UUID) error {
+	var b models.BasketOrder
+	if err := db.First(&b, "id = ?", basketID).Error; err != nil {
+		return err
+	}
+	if b.IsTerminal() {
+		return nil
+	}
+	var legs []models.Order
+	if err := db.Where("basket_id = ? AND leg_ratio > 0", basketID).Find(&legs).Error; err != nil {
+		return err
+	}
+	status := models.BasketStatusFilled
+	anyFilled := false
+	for _, o := range legs {
+		if o.FilledQty > 0 {
+			anyFilled = true
+		}
+		if o.Status != models.OrderStatusFilled {
+			status = models.BasketStatusOpen
+		}
+	}
+	if status == models.BasketStatusOpen && anyFilled {
+		status = models.BasketStatusPartiallyFilled
+	}
+	if status == b.Status {
+		return nil
+	}
+	return db.Model(&b).Update("status", status).Error
+}
+
+// TrackBaskets returns a FillListener that keeps basket statuses in step
+// with their legs' fills.
+func TrackBaskets(db *gorm.DB) FillListener {
+	return func(order *models.Order, _ *models.Transaction) {
+		if order.BasketID != nil && order.LegRatio > 0 {
+			RefreshBasket(db, *order.BasketID)
+		}
+	}
+}
+
+// LegPnL is one instrument's share of a basket's P&L.
+type LegPnL struct {
+	Instrument string  `json:"instrument"`
+	Quantity   float64 `json:"quantity"` // net open quantity
+	AvgPrice   float64 `json:"avgPrice"`
+	LastPrice  float64 `json:"lastPrice"`
+	Realized   float64 `json:"realized"` // after fees
+	Unrealized float64 `json:"unrealized"`
+	Fees       float64 `json:"fees"`
+}
+
+// BasketPnL is the combined P&L of a basket's legs and unwinds.
+type BasketPnL struct {
+	Realized   float64  `json:"realized"`
+	Unrealized float64  `json:"unrealized"`
+	Fees       float64  `json:"fees"`
+	Total      float64  `json:"total"`
+	Legs       []LegPnL `json:"legs"`
+}
+
+// ComputeBasketPnL books the basket's fills, marking open quantity to the
+// feed's last price, or the average price when there is none.
+func ComputeBasketPnL(db *gorm.DB, feed *marketfeed.Hub, basketID uuid.UUID) (*BasketPnL, error) {
+	fills, err := ledger.LoadFills(db, func(q *gorm.DB) *gorm.DB {
+		return q.Where("orders.basket_id = ?", basketID)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("load fills: %w", err)
+	}
+	out := &BasketPnL{Legs: []LegPnL{}}
+	for _, p := range ledger.Positions(fills) {
+		leg := LegPnL{Instrument: p.Instrument, Quantity: p.Quantity, AvgPrice: p.AvgPrice,
+			LastPrice: p.AvgPrice, Realized: p.Realized, Fees: p.Fees}
+		if feed != nil {
+			if last, ok := feed.LastPrice(p.Instrument); ok {
+				leg.LastPrice = last
+			}
+		}
+		if p.Quantity != 0 {
+			leg.Unrealized = p.Unrealized(leg.LastPrice)
+		}
+		out.Realized += leg.Realized
+		out.Unrealized += leg.Unrealized
+		out.Fees += leg.Fees
+		out.Legs = append(out.Legs, leg)
+	}
+	sort.Slice(out.Legs, func(i, j int) bool { return out.Legs[i].Instrument < out.Legs[j].Instrument })
+	out.Total = out.Realized + out.Unrealized
+	return out, nil
+}
@@ -0,0 +1,296 @@
+// Package broker routes orders to execution venues: the built-in paper
+// broker, or a live adapter registered for a broker connection ID.
+package broker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go-backend/models"
+	"gorm.io/gorm"
+)
+
+// Broker is an execution venue. PlaceOrder must not block on the fill;
+// executions are reported through a FillRecorder whenever they happen.
+type Broker interface {
+	Name() string
+	PlaceOrder(ctx context.Context, o *models.Order) error
+	CancelOrder(ctx context.Context, o *models.Order) error
+}
+
+// FillListener is notified after a fill has been persisted.
+type FillListener func(order *models.Order, tx *models.Transaction)
+
+// FillRecorder persists executions as Transaction rows and keeps the parent
+// order's status and filled quantity in step.
+type FillRecorder struct {
+	DB *gorm.DB
+	// Charges, when set, prices each fill before it is persisted.
+	Charges func(order *models.Order, tx *models.Transaction)
+
+	mu        sync.RWMutex
+	listeners []FillListener
+}
+
+// OnFill registers fn to run after every recorded fill.
+func (r *FillRecorder) OnFill(fn FillListener) {
+	r.mu.Lock()
+	r.listeners = append(r.listeners, fn)
+	r.mu.Unlock()
+}
+
+// Record books qty at price against order. txID is the venue's execution id;
+// an id is generated when the venue has none.
+func (r *FillRecorder) Record(order *models.Order, qty int, price float64, at time.Time, txID string) (*models.Transaction, error) {
+	if txID == "" {
+		txID = "FILL-" + uuid.NewString()
+	}
+	tx := models.Transaction{
+		ID:         uuid.New(),
+		TxID:       txID,
+		OrderID:    order.ID,
+		FillPrice:  price,
+		Quantity:   qty,
+		ExecutedAt: at,
+		StrategyID: order.StrategyID,
+		Instrument: order.Instrument,
+		IsEntry:    !order.IsExitOrder,
+	}
+	if r.Charges != nil {
+		r.Charges(order, &tx)
+	}
+
+	err := r.DB.Transaction(func(db *gorm.DB) error {
+		if err := db.Create(&tx).Error; err != nil {
+			return err
+		}
+		order.FilledQty += qty
+		order.Status = models.OrderStatusPartiallyFilled
+		if order.FilledQty >= order.Quantity {
+			order.Status = models.OrderStatusFilled
+		}
+		return db.Model(order).Updates(map[string]interface{}{
+			"filled_qty": order.FilledQty,
+			"status":     order.Status,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	listeners := r.listeners
+	r.mu.RUnlock()
+	for _, fn := range listeners {
+		fn(order, &tx)
+	}
+	return &tx, nil
+}
+
+// PreTradeCheck vets an order before it is routed. It may reduce
+// o.Quantity; returning an error rejects the order.
+type PreTradeCheck func(ctx context.Context, o *models.Order) error
+
+// RejectError is returned by a PreTradeCheck that blocks an order because of
+// a risk limit.
+type RejectError struct {
+	LimitID *uint
+	Reason  string
+}
+
+func (e *RejectError) Error() string { return e.Reason }
+
+// Registry resolves the broker an order should be routed to.
+type Registry struct {
+	Paper *Paper
+
+	mu        sync.RWMutex
+	live      map[uint]Broker
+	owners    map[uint]uuid.UUID // user each live connection belongs to
+	checks    []PreTradeCheck
+	cancelled []func(*models.Order)
+	holdStop  func(*models.Order) error
+}
+
+func NewRegistry(paper *Paper) *Registry {
+	return &Registry{Paper: paper, live: map[uint]Broker{}, owners: map[uint]uuid.UUID{}}
+}
+
+// Register installs the live adapter for owner's broker connection.
+func (r *Registry) Register(brokerID uint, owner uuid.UUID, b Broker) {
+	r.mu.Lock()
+	r.live[brokerID] = b
+	r.owners[brokerID] = owner
+	r.mu.Unlock()
+}
+
+// Owns reports whether brokerID is a registered connection of userID.
+func (r *Registry) Owns(userID uuid.UUID, brokerID uint) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	owner, ok := r.owners[brokerID]
+	return ok && owner == userID
+}
+
+// Use adds a check every order must pass before it is routed. Checks run in
+// the order they were added.
+func (r *Registry) Use(check PreTradeCheck) {
+	r.mu.Lock()
+	r.checks = append(r.checks, check)
+	r.mu.Unlock()
+}
+
+func (r *Registry) preTrade(ctx context.Context, o *models.Order) error {
+	r.mu.RLock()
+	checks := r.checks
+	r.mu.RUnlock()
+	for _, check := range checks {
+		if err := check(ctx, o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// OnCancel registers fn to run after Cancel has cancelled an order.
+func (r *Registry) OnCancel(fn func(*models.Order)) {
+	r.mu.Lock()
+	r.cancelled = append(r.cancelled, fn)
+	r.mu.Unlock()
+}
+
+// HoldStops installs fn to take stop orders routed to venues that are not a
+// StopBroker. Submit stores such orders as PENDING and hands them to fn.
+func (r *Registry) HoldStops(fn func(*models.Order) error) {
+	r.mu.Lock()
+	r.holdStop = fn
+	r.mu.Unlock()
+}
+
+// route runs the pre-trade checks and resolves o's venue. A check's reason
+// for refusing the order is recorded on o.
+func (r *Registry) route(ctx context.Context, o *models.Order) (Broker, error) {
+	if err := r.preTrade(ctx, o); err != nil {
+		var rej *RejectError
+		if errors.As(err, &rej) {
+			o.RiskLimitID = rej.LimitID
+		}
+		o.RiskReason = err.Error()
+		return nil, err
+	}
+	return r.For(o)
+}
+
+// For returns the venue for order: the paper broker for paper orders,
+// otherwise the adapter registered for order.BrokerID, which must be a
+// connection of the order's user.
+func (r *Registry) For(order *models.Order) (Broker, error) {
+	if order.IsPaper {
+		return r.Paper, nil
+	}
+	if order.BrokerID == nil {
+		return nil, fmt.Errorf("order %s has no broker", order.OrderID)
+	}
+	r.mu.RLock()
+	b, ok := r.live[*order.BrokerID]
+	owner := r.owners[*order.BrokerID]
+	r.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("no broker adapter registered for broker %d", *order.BrokerID)
+	}
+	if owner != order.UserID {
+		return nil, fmt.Errorf("broker %d is not a connection of the order's user", *order.BrokerID)
+	}
+	return b, nil
+}
+
+// Submit runs the pre-trade checks, persists a new order and hands it to its
+// broker. It is the only way orders reach a venue. Orders that are blocked or
+// refused are kept with status REJECTED so there is a record of the attempt.
+func Submit(ctx context.Context, db *gorm.DB, reg *Registry, o *models.Order) error {
+	if o.ID == uuid.Nil {
+		o.ID = uuid.New()
+	}
+	if o.OrderID == "" {
+		o.OrderID = "ORD-" + o.ID.String()
+	}
+	o.Status = models.OrderStatusOpen
+
+	b, routeErr := reg.route(ctx, o)
+	var hold func(*models.Order) error
+	if routeErr == nil && o.IsStop() {
+		if sb, ok := b.(StopBroker); !ok || !sb.SupportsStops() {
+			reg.mu.RLock()
+			hold = reg.holdStop
+			reg.mu.RUnlock()
+			if hold == nil {
+				routeErr = fmt.Errorf("%s does not support %s orders", b.Name(), o.OrderType)
+				o.RiskReason = routeErr.Error()
+			}
+		}
+	}
+	if routeErr != nil {
+		o.Status = models.OrderStatusRejected
+	} else if hold != nil {
+		o.Status = models.OrderStatusPending
+	}
+	if err := db.Create(o).Error; err != nil {
+		return err
+	}
+	if routeErr != nil {
+		return routeErr
+	}
+	if hold != nil {
+		return hold(o)
+	}
+
+	if err := b.PlaceOrder(ctx, o); err != nil {
+		o.Status = models.OrderStatusRejected
+		db.Model(o).Update("status", o.Status)
+		return fmt.Errorf("%s rejected order: %w", b.Name(), err)
+	}
+	if o.BrokerOrderID != "" {
+		db.Model(o).Update("broker_order_id", o.BrokerOrderID)
+	}
+	return nil
+}
+
+// Cancel asks the order's broker to cancel it and marks it CANCELLED. Orders
+// the server still holds never reached a venue. Exits waiting on an order
+// that filled nothing are cancelled with it.
+func Cancel(ctx context.Context, db *gorm.DB, reg *Registry, o *models.Order) error {
+	if o.IsTerminal() {
+		return nil
+	}
+	if o.Status != models.OrderStatusPending {
+		b, err := reg.For(o)
+		if err != nil {
+			return err
+		}
+		if err := b.CancelOrder(ctx, o); err != nil {
+			return err
+		}
+	}
+	o.Status = models.OrderStatusCancelled
+	if err := db.Model(o).Update("status", o.Status).Error; err != nil {
+		return err
+	}
+	if o.FilledQty == 0 {
+		if err := db.Model(&models.Order{}).Where("parent_order_id = ? AND status = ?", o.ID, models.OrderStatusPending).
+			Update("status", models.OrderStatusCancelled).Error; err != nil {
+			return err
+		}
+	}
+
+	reg.mu.RLock()
+	listeners := reg.cancelled
+	reg.mu.RUnlock()
+	for _, fn := range listeners {
+		fn(o)
+	}
+	return nil
+}
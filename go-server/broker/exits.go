@@ -0,0 +1,476 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go-backend/marketfeed"
+	"go-backend/models"
+	"gorm.io/gorm"
+)
+
+// StopBroker is implemented by venues that hold stop and trailing stop
+// orders themselves. Stops for any other venue are held by Exits.
+type StopBroker interface {
+	SupportsStops() bool
+}
+
+// ModifyBroker is implemented by venues that can change the quantity of a
+// working order. Orders at any other venue are cancelled and replaced.
+type ModifyBroker interface {
+	ModifyOrder(ctx context.Context, o *models.Order) error
+}
+
+// Exits links exit orders to what they exit. Exits of a bracket wait as
+// PENDING until their entry fills and then go live for the filled quantity;
+// a fill on any order of an OCO group shrinks the rest of the group to what
+// is left of it, and cancels them once it has filled completely. Stops
+// for venues without native support stay with the server, which trails them
+// against the feed and sends a MARKET order once they trigger.
+type Exits struct {
+	DB      *gorm.DB
+	Brokers *Registry
+	Feed    *marketfeed.Hub
+
+	mu   sync.Mutex
+	held map[uuid.UUID]*models.Order // stops waiting for their trigger
+}
+
+// NewExits creates the manager and registers it to hold stops Submit cannot
+// route and to arm exits when an entry is cancelled.
+func NewExits(db *gorm.DB, reg *Registry, feed *marketfeed.Hub) *Exits {
+	x := &Exits{DB: db, Brokers: reg, Feed: feed, held: map[uuid.UUID]*models.Order{}}
+	reg.HoldStops(x.hold)
+	reg.OnCancel(x.OnCancel)
+	return x
+}
+
+// BracketSpec describes a bracket's exits. Target is the take-profit limit
+// price; Stop the stop-loss trigger. With a trail the stop is a trailing
+// stop and Stop, when set, is its initial trigger.
+type BracketSpec struct {
+	Target       float64 `json:"target"`
+	Stop         float64 `json:"stop"`
+	TrailAmount  float64 `json:"trailAmount"`
+	TrailPercent float64 `json:"trailPercent"`
+}
+
+// Bracket submits entry with a target and/or stop that form an OCO group.
+// The exits are stored before the entry is routed, so an entry that fills at
+// once still finds them; they are cancelled if the entry is refused.
+func (x *Exits) Bracket(ctx context.Context, entry *models.Order, spec BracketSpec) ([]*models.Order, error) {
+	trailing := spec.TrailAmount > 0 || spec.TrailPercent > 0
+	if spec.Target <= 0 && spec.Stop <= 0 && !trailing {
+		return nil, fmt.Errorf("a bracket needs a target, a stop or a trail")
+	}
+	if spec.Target > 0 && spec.Stop > 0 {
+		buy := strings.EqualFold(entry.Side, "BUY")
+		if buy && spec.Target <= spec.Stop || !buy && spec.Target >= spec.Stop {
+			return nil, fmt.Errorf("target must be on the profit side of the stop")
+		}
+	}
+	if entry.ID == uuid.Nil {
+		entry.ID = uuid.New()
+	}
+
+	var exits []*models.Order
+	if spec.Target > 0 {
+		o := exitOf(entry, "LIMIT")
+		o.Price = spec.Target
+		exits = append(exits, o)
+	}
+	if spec.Stop > 0 || trailing {
+		o := exitOf(entry, models.OrderTypeStop)
+		o.TriggerPrice = spec.Stop
+		if trailing {
+			o.OrderType = models.OrderTypeTrailingStop
+			o.TrailAmount, o.TrailPercent = spec.TrailAmount, spec.TrailPercent
+		}
+		exits = append(exits, o)
+	}
+	group := uuid.New()
+	err := x.DB.Transaction(func(tx *gorm.DB) error {
+		for _, o := range exits {
+			o.OCOGroupID = &group
+			if err := tx.Create(o).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := Submit(ctx, x.DB, x.Brokers, entry); err != nil {
+		for _, o := range exits {
+			o.Status = models.OrderStatusCancelled
+			x.DB.Model(o).Update("status", o.Status)
+		}
+		return exits, err
+	}
+	// reload: a fill during Submit may already have armed them
+	for _, o := range exits {
+		x.DB.First(o, "id = ?", o.ID)
+	}
+	return exits, nil
+}
+
+// exitOf builds a PENDING exit of entry's full quantity.
+func exitOf(entry *models.Order, orderType string) *models.Order {
+	side := "SELL"
+	if strings.EqualFold(entry.Side, "SELL") {
+		side = "BUY"
+	}
+	id := uuid.New()
+	parent := entry.ID
+	return &models.Order{
+		ID:            id,
+		OrderID:       "ORD-" + id.String(),
+		UserID:        entry.UserID,
+		Instrument:    entry.Instrument,
+		Exchange:      entry.Exchange,
+		Quantity:      entry.Quantity,
+		OrderType:     orderType,
+		Side:          side,
+		Status:        models.OrderStatusPending,
+		StrategyID:    entry.StrategyID,
+		IsExitOrder:   true,
+		ParentOrderID: &parent,
+		DeploymentID:  entry.DeploymentID,
+		BrokerID:      entry.BrokerID,
+		IsPaper:       entry.IsPaper,
+	}
+}
+
+// OCO places orders as a one-cancels-other group through Submit. If one is
+// refused, those already placed are cancelled.
+func (x *Exits) OCO(ctx context.Context, orders []*models.Order) error {
+	if len(orders) < 2 {
+		return fmt.Errorf("an OCO group needs at least two orders")
+	}
+	group := uuid.New()
+	for _, o := range orders {
+		if err := validateStop(o); err != nil {
+			return err
+		}
+		o.OCOGroupID = &group
+	}
+
+	for i, o := range orders {
+		if err := Submit(ctx, x.DB, x.Brokers, o); err != nil {
+			for _, placed := range orders[:i] {
+				Cancel(ctx, x.DB, x.Brokers, placed)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+func validateStop(o *models.Order) error {
+	switch o.OrderType {
+	case models.OrderTypeStop:
+		if o.TriggerPrice <= 0 {
+			return fmt.Errorf("stop orders need a trigger price")
+		}
+	case models.OrderTypeTrailingStop:
+		if o.TrailAmount <= 0 && o.TrailPercent <= 0 {
+			return fmt.Errorf("trailing stops need a trail amount or percent")
+		}
+	}
+	return nil
+}
+
+// OnFill is a FillListener: it shrinks the rest of the order's OCO group to
+// the quantity the order has left, cancelling them once it has filled
+// completely, and arms the exits of an entry that has filled completely.
+func (x *Exits) OnFill(order *models.Order, _ *models.Transaction) {
+	ctx := context.Background()
+	if order.OCOGroupID != nil {
+		var siblings []models.Order
+		if err := x.DB.Where("oco_group_id = ? AND id <> ? AND status IN ?", *order.OCOGroupID, order.ID,
+			[]string{models.OrderStatusOpen, models.OrderStatusPartiallyFilled, models.OrderStatusPending}).
+			Find(&siblings).Error; err != nil {
+			log.Printf("exits: load OCO group of %s: %v", order.OrderID, err)
+		}
+		left := order.Quantity - order.FilledQty
+		if order.Status == models.OrderStatusFilled {
+			left = 0
+		}
+		for i := range siblings {
+			if err := x.resize(ctx, &siblings[i], siblings[i].FilledQty+left); err != nil {
+				log.Printf("exits: resize %s after %s filled: %v", siblings[i].OrderID, order.OrderID, err)
+			}
+		}
+	}
+	if order.Status == models.OrderStatusFilled {
+		x.armChildren(ctx, order)
+	}
+}
+
+// resize sets the quantity of a working order, cancelling it when qty leaves
+// nothing to fill. Held and waiting orders change in place; a live order is
+// modified at its venue, or cancelled and replaced by one for the rest when
+// the venue cannot modify orders.
+func (x *Exits) resize(ctx context.Context, o *models.Order, qty int) error {
+	if qty >= o.Quantity {
+		return nil
+	}
+	if qty <= o.FilledQty {
+		return Cancel(ctx, x.DB, x.Brokers, o)
+	}
+	if o.Status == models.OrderStatusPending {
+		x.mu.Lock()
+		if h, ok := x.held[o.ID]; ok {
+			h.Quantity = qty
+		}
+		x.mu.Unlock()
+		o.Quantity = qty
+		return x.DB.Model(o).Update("quantity", qty).Error
+	}
+
+	b, err := x.Brokers.For(o)
+	if err != nil {
+		return err
+	}
+	if mb, ok := b.(ModifyBroker); ok {
+		prev := o.Quantity
+		o.Quantity = qty
+		if err := mb.ModifyOrder(ctx, o); err != nil {
+			o.Quantity = prev
+			return fmt.Errorf("%s refused to modify order: %w", b.Name(), err)
+		}
+		return x.DB.Model(o).Update("quantity", qty).Error
+	}
+
+	rest := *o
+	if err := Cancel(ctx, x.DB, x.Brokers, o); err != nil {
+		return err
+	}
+	rest.ID, rest.OrderID, rest.BrokerOrderID = uuid.Nil, "", ""
+	rest.Quantity, rest.FilledQty = qty-o.FilledQty, 0
+	rest.PlacedAt, rest.UpdatedAt = time.Time{}, time.Time{}
+	rest.RiskLimitID, rest.RiskReason = nil, ""
+	return Submit(ctx, x.DB, x.Brokers, &rest)
+}
+
+// OnCancel arms the exits of an entry cancelled after a partial fill, for
+// the quantity that filled.
+func (x *Exits) OnCancel(order *models.Order) {
+	x.drop(order.ID)
+	if order.FilledQty > 0 {
+		x.armChildren(context.Background(), order)
+	}
+}
+
+func (x *Exits) armChildren(ctx context.Context, parent *models.Order) {
+	var children []models.Order
+	if err := x.DB.Where("parent_order_id = ? AND status = ? AND triggered_at IS NULL", parent.ID, models.OrderStatusPending).
+		Find(&children).Error; err != nil {
+		log.Printf("exits: load exits of %s: %v", parent.OrderID, err)
+		return
+	}
+	for i := range children {
+		o := &children[i]
+		o.Quantity = parent.FilledQty
+		if err := x.arm(ctx, o); err != nil {
+			log.Printf("exits: arm %s: %v", o.OrderID, err)
+		}
+	}
+}
+
+// arm makes a live exit of o: stops the venue cannot hold stay with the
+// server, everything else is routed.
+func (x *Exits) arm(ctx context.Context, o *models.Order) error {
+	if o.IsStop() && !x.native(o) {
+		return x.hold(o)
+	}
+	return x.release(ctx, o, false)
+}
+
+func (x *Exits) native(o *models.Order) bool {
+	b, err := x.Brokers.For(o)
+	if err != nil {
+		return false
+	}
+	sb, ok := b.(StopBroker)
+	return ok && sb.SupportsStops()
+}
+
+// hold keeps a stop until the feed triggers it.
+func (x *Exits) hold(o *models.Order) error {
+	if o.OrderType == models.OrderTypeTrailingStop && x.Feed != nil {
+		if last, ok := x.Feed.LastPrice(o.Instrument); ok {
+			trail(o, last)
+		}
+	}
+	if err := x.DB.Model(o).Updates(map[string]interface{}{
+		"quantity":      o.Quantity,
+		"trigger_price": o.TriggerPrice,
+	}).Error; err != nil {
+		return err
+	}
+	x.mu.Lock()
+	x.held[o.ID] = o
+	x.mu.Unlock()
+	return nil
+}
+
+func (x *Exits) drop(id uuid.UUID) {
+	x.mu.Lock()
+	delete(x.held, id)
+	x.mu.Unlock()
+}
+
+// release runs the pre-trade checks on a PENDING order and sends it to its
+// venue. A triggered stop goes to a venue without native stops as MARKET.
+func (x *Exits) release(ctx context.Context, o *models.Order, triggered bool) error {
+	updates := map[string]interface{}{"quantity": o.Quantity}
+	if triggered {
+		now := time.Now()
+		o.TriggeredAt = &now
+		o.OrderType = "MARKET"
+		updates["triggered_at"] = now
+		updates["order_type"] = o.OrderType
+	}
+
+	b, err := x.Brokers.route(ctx, o)
+	if err != nil {
+		o.Status = models.OrderStatusRejected
+		updates["status"] = o.Status
+		updates["risk_reason"] = o.RiskReason
+		updates["risk_limit_id"] = o.RiskLimitID
+		x.DB.Model(o).Updates(updates)
+		return err
+	}
+	// OPEN is stored first: a venue may fill the order before PlaceOrder returns
+	o.Status = models.OrderStatusOpen
+	updates["status"] = o.Status
+	if err := x.DB.Model(o).Updates(updates).Error; err != nil {
+		return err
+	}
+	if err := b.PlaceOrder(ctx, o); err != nil {
+		o.Status = models.OrderStatusRejected
+		x.DB.Model(o).Update("status", o.Status)
+		return fmt.Errorf("%s rejected order: %w", b.Name(), err)
+	}
+	if o.BrokerOrderID != "" {
+		x.DB.Model(o).Update("broker_order_id", o.BrokerOrderID)
+	}
+	return nil
+}
+
+// trail moves a trailing stop's trigger towards price; it never moves back.
+// It reports whether the trigger moved.
+func trail(o *models.Order, price float64) bool {
+	dist := o.TrailAmount
+	if o.TrailPercent > 0 {
+		dist = price * o.TrailPercent / 100
+	}
+	if strings.EqualFold(o.Side, "SELL") {
+		if next := price - dist; next > o.TriggerPrice {
+			o.TriggerPrice = next
+			return true
+		}
+		return false
+	}
+	if next := price + dist; o.TriggerPrice <= 0 || next < o.TriggerPrice {
+		o.TriggerPrice = next
+		return true
+	}
+	return false
+}
+
+// Restore holds the stops that were armed before a restart: those without
+// an entry, or whose entry has filled.
+func (x *Exits) Restore() error {
+	var pending []models.Order
+	if err := x.DB.Where("status = ? AND order_type IN ?", models.OrderStatusPending,
+		[]string{models.OrderTypeStop, models.OrderTypeTrailingStop}).Find(&pending).Error; err != nil {
+		return err
+	}
+	for i := range pending {
+		o := &pending[i]
+		if o.ParentOrderID != nil {
+			var parent models.Order
+			if err := x.DB.First(&parent, "id = ?", *o.ParentOrderID).Error; err != nil || parent.FilledQty == 0 ||
+				parent.Status != models.OrderStatusFilled && parent.Status != models.OrderStatusCancelled {
+				continue
+			}
+		}
+		if !x.native(o) {
+			x.mu.Lock()
+			x.held[o.ID] = o
+			x.mu.Unlock()
+		}
+	}
+	return nil
+}
+
+// OnBar triggers held stops the bar traded through and trails the rest.
+func (x *Exits) OnBar(u marketfeed.Update) {
+	type move struct {
+		id    uuid.UUID
+		price float64
+	}
+	var hits []*models.Order
+	var moves []move
+
+	x.mu.Lock()
+	for id, o := range x.held {
+		if !strings.EqualFold(o.Instrument, u.Symbol) {
+			continue
+		}
+		sell := strings.EqualFold(o.Side, "SELL")
+		if o.TriggerPrice > 0 && (sell && u.Bar.Low <= o.TriggerPrice || !sell && u.Bar.High >= o.TriggerPrice) {
+			hits = append(hits, o)
+			delete(x.held, id)
+			continue
+		}
+		if o.OrderType == models.OrderTypeTrailingStop {
+			best := u.Bar.High
+			if !sell {
+				best = u.Bar.Low
+			}
+			if trail(o, best) {
+				moves = append(moves, move{id, o.TriggerPrice})
+			}
+		}
+	}
+	x.mu.Unlock()
+
+	for _, m := range moves {
+		x.DB.Model(&models.Order{}).Where("id = ? AND status = ?", m.id, models.OrderStatusPending).
+			Update("trigger_price", m.price)
+	}
+	for _, o := range hits {
+		// it may have been cancelled since it was held
+		var current models.Order
+		if err := x.DB.First(&current, "id = ?", o.ID).Error; err != nil || current.Status != models.OrderStatusPending {
+			continue
+		}
+		if err := x.release(context.Background(), o, true); err != nil {
+			log.Printf("exits: release triggered stop %s: %v", o.OrderID, err)
+		}
+	}
+}
+
+// Run manages held stops against every bar on the feed until ctx ends.
+func (x *Exits) Run(ctx context.Context) {
+	updates, stop := x.Feed.Subscribe("", "")
+	defer stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case u := <-updates:
+			x.OnBar(u)
+		}
+	}
+}
@@ -0,0 +1,122 @@
+package broker
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go-backend/marketfeed"
+	"go-backend/models"
+)
+
+// Paper is a simulated broker. Market orders fill immediately at the last
+// price seen on the feed; limit orders rest until a bar trades through them.
+type Paper struct {
+	Fills *FillRecorder
+	Feed  *marketfeed.Hub
+
+	mu      sync.Mutex
+	resting map[uuid.UUID]*models.Order
+}
+
+func NewPaper(fills *FillRecorder, feed *marketfeed.Hub) *Paper {
+	return &Paper{Fills: fills, Feed: feed, resting: map[uuid.UUID]*models.Order{}}
+}
+
+func (p *Paper) Name() string { return "paper" }
+
+func (p *Paper) PlaceOrder(ctx context.Context, o *models.Order) error {
+	if o.Quantity <= 0 {
+		return fmt.Errorf("quantity must be positive")
+	}
+	o.BrokerOrderID = "PAPER-" + o.ID.String()
+
+	if strings.EqualFold(o.OrderType, "LIMIT") {
+		p.mu.Lock()
+		p.resting[o.ID] = o
+		p.mu.Unlock()
+		return nil
+	}
+
+	price, ok := p.Feed.LastPrice(o.Instrument)
+	if !ok {
+		if o.Price <= 0 {
+			return fmt.Errorf("no market price available for %s", o.Instrument)
+		}
+		price = o.Price
+	}
+	_, err := p.Fills.Record(o, o.Quantity-o.FilledQty, price, time.Now(), "")
+	return err
+}
+
+func (p *Paper) CancelOrder(ctx context.Context, o *models.Order) error {
+	p.mu.Lock()
+	delete(p.resting, o.ID)
+	p.mu.Unlock()
+	return nil
+}
+
+// ModifyOrder changes the quantity of a resting limit order. Market orders
+// fill as they are placed, so there is nothing else to modify.
+func (p *Paper) ModifyOrder(ctx context.Context, o *models.Order) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if r, ok := p.resting[o.ID]; ok {
+		r.Quantity = o.Quantity
+	}
+	return nil
+}
+
+// Restore puts open paper limit orders back on the book after a restart.
+func (p *Paper) Restore(orders []models.Order) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i := range orders {
+		o := orders[i]
+		if o.IsPaper && !o.IsTerminal() && strings.EqualFold(o.OrderType, "LIMIT") {
+			p.resting[o.ID] = &o
+		}
+	}
+}
+
+// OnBar fills resting limit orders the bar traded through.
+func (p *Paper) OnBar(u marketfeed.Update) {
+	p.mu.Lock()
+	var hits []*models.Order
+	for id, o := range p.resting {
+		if !strings.EqualFold(o.Instrument, u.Symbol) {
+			continue
+		}
+		buy := strings.EqualFold(o.Side, "BUY")
+		if buy && u.Bar.Low <= o.Price || !buy && u.Bar.High >= o.Price {
+			hits = append(hits, o)
+			delete(p.resting, id)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, o := range hits {
+		price := o.Price
+		if buy := strings.EqualFold(o.Side, "BUY"); buy && u.Bar.Open < price || !buy && u.Bar.Open > price {
+			price = u.Bar.Open // gapped through the limit
+		}
+		p.Fills.Record(o, o.Quantity-o.FilledQty, price, u.Bar.Time, "")
+	}
+}
+
+// Run matches resting orders against every bar on the feed until ctx ends.
+func (p *Paper) Run(ctx context.Context) {
+	updates, stop := p.Feed.Subscribe("", "")
+	defer stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case u := <-updates:
+			p.OnBar(u)
+		}
+	}
+}
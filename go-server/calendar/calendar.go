@@ -0,0 +1,452 @@
+// Package calendar knows when Indian exchanges trade: regular session hours
+// per exchange, holidays, special sessions such as Muhurat trading, and
+// early closes, the last three loaded from a file.
+package calendar
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go-backend/models"
+)
+
+// Session is one trading window, as "15:04" times in the calendar's zone.
+type Session struct {
+	Open  string `json:"open"`
+	Close string `json:"close"`
+}
+
+// DefaultHours are the regular sessions. Derivative segments follow their
+// parent exchange unless listed.
+var DefaultHours = map[string]Session{
+	"NSE":   {"09:15", "15:30"},
+	"BSE":   {"09:15", "15:30"},
+	"NFO":   {"09:15", "15:30"},
+	"BFO":   {"09:15", "15:30"},
+	"CDS":   {"09:00", "17:00"},
+	"BCD":   {"09:00", "17:00"},
+	"MCX":   {"09:00", "23:30"},
+	"NCDEX": {"09:00", "17:00"},
+}
+
+// DefaultExchange is assumed for orders and symbols that do not name one.
+const DefaultExchange = "NSE"
+
+// parents are the exchanges whose holidays a segment shares unless an
+// entry names the segment itself.
+var parents = map[string]string{"NFO": "NSE", "CDS": "NSE", "BFO": "BSE", "BCD": "BSE"}
+
+// Day is an entry in a calendar file. Without Exchanges it applies to every
+// exchange.
+type Day struct {
+	Date      string   `json:"date"` // 2006-01-02
+	Name      string   `json:"name"`
+	Exchanges []string `json:"exchanges,omitempty"`
+	Open      string   `json:"open,omitempty"`  // special sessions
+	Close     string   `json:"close,omitempty"` // special sessions and early closes
+}
+
+// File is the calendar file format:
+//
+//	{
+//	  "timezone": "Asia/Kolkata",
+//	  "hours": {"MCX": {"open": "09:00", "close": "23:55"}},
+//	  "holidays": [{"date": "2025-03-14", "name": "Holi"}],
+//	  "specialSessions": [{"date": "2025-10-21", "name": "Muhurat trading", "open": "13:45", "close": "14:45"}],
+//	  "earlyCloses": [{"date": "2025-12-31", "name": "Year end", "close": "13:00", "exchanges": ["MCX"]}]
+//	}
+//
+// Special sessions replace the day's regular session, even on a weekend or
+// holiday; hours override DefaultHours.
+type File struct {
+	Timezone        string             `json:"timezone,omitempty"`
+	Hours           map[string]Session `json:"hours,omitempty"`
+	Holidays        []Day              `json:"holidays"`
+	SpecialSessions []Day              `json:"specialSessions"`
+	EarlyCloses     []Day              `json:"earlyCloses"`
+}
+
+type override struct {
+	name    string
+	closed  bool
+	session Session
+}
+
+// Calendar answers market-hours questions. It is safe for concurrent use
+// and can be reloaded while in use.
+type Calendar struct {
+	mu    sync.RWMutex
+	loc   *time.Location
+	hours map[string]Session
+	days  map[string]map[string]override // date -> exchange ("" for all) -> override
+	file  File
+	path  string
+}
+
+// New returns a calendar with the default hours and no holidays: every
+// weekday is a trading day.
+func New() *Calendar {
+	c := &Calendar{}
+	c.apply(File{}, "")
+	return c
+}
+
+// Load reads a calendar file. An empty path gives New().
+func Load(path string) (*Calendar, error) {
+	c := New()
+	if path == "" {
+		return c, nil
+	}
+	return c, c.Reload(path)
+}
+
+// Reload replaces the calendar with the contents of path, or of the file it
+// was last loaded from when path is empty. On error the calendar is
+// unchanged.
+func (c *Calendar) Reload(path string) error {
+	if path == "" {
+		c.mu.RLock()
+		path = c.path
+		c.mu.RUnlock()
+		if path == "" {
+			return fmt.Errorf("no calendar file configured")
+		}
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var f File
+	if err := json.Unmarshal(data, &f); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	if err := validate(&f); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	c.apply(f, path)
+	return nil
+}
+
+func validate(f *File) error {
+	if f.Timezone != "" {
+		if _, err := time.LoadLocation(f.Timezone); err != nil {
+			return err
+		}
+	}
+	for ex, s := range f.Hours {
+		if _, _, err := bounds(s); err != nil {
+			return fmt.Errorf("hours %s: %w", ex, err)
+		}
+	}
+	check := func(kind string, days []Day, open, close bool) error {
+		for _, d := range days {
+			if _, err := time.Parse("2006-01-02", d.Date); err != nil {
+				return fmt.Errorf("%s: invalid date %q", kind, d.Date)
+			}
+			if open && d.Open == "" || close && d.Close == "" {
+				return fmt.Errorf("%s %s: open and close times are required", kind, d.Date)
+			}
+			for _, t := range []string{d.Open, d.Close} {
+				if _, err := clock(t); t != "" && err != nil {
+					return fmt.Errorf("%s %s: %w", kind, d.Date, err)
+				}
+			}
+		}
+		return nil
+	}
+	if err := check("holiday", f.Holidays, false, false); err != nil {
+		return err
+	}
+	if err := check("special session", f.SpecialSessions, true, true); err != nil {
+		return err
+	}
+	return check("early close", f.EarlyCloses, false, true)
+}
+
+func (c *Calendar) apply(f File, path string) {
+	loc := ist()
+	if f.Timezone != "" {
+		loc, _ = time.LoadLocation(f.Timezone)
+	}
+	hours := map[string]Session{}
+	for ex, s := range DefaultHours {
+		hours[ex] = s
+	}
+	for ex, s := range f.Hours {
+		hours[strings.ToUpper(ex)] = s
+	}
+
+	days := map[string]map[string]override{}
+	set := func(d Day, fn func(ex string, o override) override) {
+		if days[d.Date] == nil {
+			days[d.Date] = map[string]override{}
+		}
+		exs := d.Exchanges
+		if len(exs) == 0 {
+			exs = []string{""}
+		}
+		for _, ex := range exs {
+			ex = strings.ToUpper(ex)
+			days[d.Date][ex] = fn(ex, days[d.Date][ex])
+		}
+	}
+	// Early closes keep the regular open; special sessions win over both.
+	// An early close for one exchange must not reopen a day its parent
+	// exchange or every exchange is closed, as day stops at the first entry.
+	for _, d := range f.Holidays {
+		set(d, func(string, override) override { return override{name: d.Name, closed: true} })
+	}
+	for _, d := range f.EarlyCloses {
+		set(d, func(ex string, _ override) override {
+			for _, k := range []string{ex, parents[ex], ""} {
+				if h := days[d.Date][k]; h.closed {
+					return h
+				}
+			}
+			return override{name: d.Name, session: Session{Close: d.Close}}
+		})
+	}
+	for _, d := range f.SpecialSessions {
+		set(d, func(string, override) override {
+			return override{name: d.Name, session: Session{Open: d.Open, Close: d.Close}}
+		})
+	}
+
+	c.mu.Lock()
+	c.loc, c.hours, c.days, c.file, c.path = loc, hours, days, f, path
+	c.mu.Unlock()
+}
+
+// ist is Asia/Kolkata, or a fixed +05:30 zone when tzdata is missing.
+func ist() *time.Location {
+	if loc, err := time.LoadLocation("Asia/Kolkata"); err == nil {
+		return loc
+	}
+	return time.FixedZone("IST", 5*3600+1800)
+}
+
+// Location is the zone session times are given in.
+func (c *Calendar) Location() *time.Location {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.loc
+}
+
+func clock(s string) (time.Duration, error) {
+	t, err := time.Parse("15:04", s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute, nil
+}
+
+func bounds(s Session) (open, close time.Duration, err error) {
+	if open, err = clock(s.Open); err != nil {
+		return
+	}
+	if close, err = clock(s.Close); err != nil {
+		return
+	}
+	if close <= open {
+		err = fmt.Errorf("session %s-%s closes before it opens", s.Open, s.Close)
+	}
+	return
+}
+
+// Status is what the calendar says about one exchange on one date.
+type Status struct {
+	Exchange string    `json:"exchange"`
+	Date     string    `json:"date"`
+	Trading  bool      `json:"trading"`
+	Open     time.Time `json:"open,omitempty"`
+	Close    time.Time `json:"close,omitempty"`
+	Reason   string    `json:"reason,omitempty"` // holiday, special session or early close name; "weekend"
+}
+
+// day resolves exchange's session on the calendar date of t.
+func (c *Calendar) day(exchange string, t time.Time) Status {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	ex := strings.ToUpper(exchange)
+	if ex == "" {
+		ex = DefaultExchange
+	}
+	t = t.In(c.loc)
+	date := t.Format("2006-01-02")
+	st := Status{Exchange: ex, Date: date}
+
+	regular, ok := c.hours[ex]
+	if !ok {
+		if p, has := parents[ex]; has {
+			regular = c.hours[p]
+		} else {
+			regular = c.hours[DefaultExchange]
+		}
+	}
+	session := regular
+	weekend := t.Weekday() == time.Saturday || t.Weekday() == time.Sunday
+
+	o, found := c.days[date][ex]
+	if !found {
+		if p, has := parents[ex]; has {
+			o, found = c.days[date][p]
+		}
+	}
+	if !found {
+		o, found = c.days[date][""]
+	}
+	switch {
+	case found && o.closed:
+		st.Reason = o.name
+		return st
+	case found && o.session.Open != "": // special session
+		session = o.session
+		st.Reason = o.name
+	case weekend:
+		st.Reason = "weekend"
+		return st
+	case found:
+		session.Close = o.session.Close
+		st.Reason = o.name
+	}
+
+	open, close, err := bounds(session)
+	if err != nil {
+		return st
+	}
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, c.loc)
+	st.Trading = true
+	st.Open, st.Close = midnight.Add(open), midnight.Add(close)
+	return st
+}
+
+// Status reports exchange's session on the date of t.
+func (c *Calendar) Status(exchange string, t time.Time) Status { return c.day(exchange, t) }
+
+// IsTradingDay reports whether exchange has a session on the date of day.
+func (c *Calendar) IsTradingDay(exchange string, day time.Time) bool {
+	return c.day(exchange, day).Trading
+}
+
+// SessionBounds returns exchange's open and close on the date of t; ok is
+// false when it does not trade that day.
+func (c *Calendar) SessionBounds(exchange string, t time.Time) (open, close time.Time, ok bool) {
+	st := c.day(exchange, t)
+	return st.Open, st.Close, st.Trading
+}
+
+// IsOpen reports whether exchange is in session at t.
+func (c *Calendar) IsOpen(exchange string, t time.Time) bool {
+	open, close, ok := c.SessionBounds(exchange, t)
+	return ok && !t.Before(open) && t.Before(close)
+}
+
+// maxLookahead bounds the search for the next session.
+const maxLookahead = 366
+
+// NextOpen returns t while exchange is in session, otherwise the start of
+// its next session. The zero time means no session within a year.
+func (c *Calendar) NextOpen(exchange string, t time.Time) time.Time {
+	for i := 0; i < maxLookahead; i++ {
+		open, close, ok := c.SessionBounds(exchange, t.AddDate(0, 0, i))
+		if !ok || !close.After(t) {
+			continue
+		}
+		if open.After(t) {
+			return open
+		}
+		return t
+	}
+	return time.Time{}
+}
+
+// NextClose returns the end of the session exchange is in at t, or of the
+// next one.
+func (c *Calendar) NextClose(exchange string, t time.Time) time.Time {
+	for i := 0; i < maxLookahead; i++ {
+		_, close, ok := c.SessionBounds(exchange, t.AddDate(0, 0, i))
+		if ok && close.After(t) {
+			return close
+		}
+	}
+	return time.Time{}
+}
+
+// PreviousTradingDay returns the last trading day of exchange before the
+// date of day, at midnight.
+func (c *Calendar) PreviousTradingDay(exchange string, day time.Time) time.Time {
+	loc := c.Location()
+	d := day.In(loc)
+	d = time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, loc)
+	for i := 0; i < maxLookahead; i++ {
+		d = d.AddDate(0, 0, -1)
+		if c.IsTradingDay(exchange, d) {
+			return d
+		}
+	}
+	return time.Time{}
+}
+
+// TradingDays returns a func reporting exchange's trading days, for the
+// TradingDay and Skip hooks of jobs and reports.
+func (c *Calendar) TradingDays(exchange string) func(time.Time) bool {
+	return func(d time.Time) bool { return c.IsTradingDay(exchange, d) }
+}
+
+// Year lists the holidays, special sessions and early closes loaded for
+// year, in date order.
+func (c *Calendar) Year(year int) File {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	prefix := fmt.Sprintf("%04d-", year)
+	pick := func(days []Day) []Day {
+		out := []Day{}
+		for _, d := range days {
+			if strings.HasPrefix(d.Date, prefix) {
+				out = append(out, d)
+			}
+		}
+		sort.Slice(out, func(i, j int) bool { return out[i].Date < out[j].Date })
+		return out
+	}
+	hours := make(map[string]Session, len(c.hours))
+	for ex, h := range c.hours {
+		hours[ex] = h
+	}
+	return File{
+		Timezone:        c.loc.String(),
+		Hours:           hours,
+		Holidays:        pick(c.file.Holidays),
+		SpecialSessions: pick(c.file.SpecialSessions),
+		EarlyCloses:     pick(c.file.EarlyCloses),
+	}
+}
+
+// Check is a broker pre-trade check that refuses live orders while the
+// order's exchange is closed. Paper orders are exempt so strategies can be
+// exercised against replayed data, and so are stop orders the server holds
+// until their trigger.
+func (c *Calendar) Check(ctx context.Context, o *models.Order) error {
+	if o.IsPaper || o.IsStop() {
+		return nil
+	}
+	now := time.Now()
+	if c.IsOpen(o.Exchange, now) {
+		return nil
+	}
+	ex := strings.ToUpper(o.Exchange)
+	if ex == "" {
+		ex = DefaultExchange
+	}
+	if next := c.NextOpen(ex, now); !next.IsZero() {
+		return fmt.Errorf("%s is closed; it next opens %s", ex, next.Format("Mon 02 Jan 15:04"))
+	}
+	return fmt.Errorf("%s is closed", ex)
+}
@@ -0,0 +1,127 @@
+package calendar
+
+import (
+	"testing"
+	"time"
+)
+
+func testCalendar(t *testing.T) *Calendar {
+	t.Helper()
+	f := File{
+		Holidays: []Day{
+			{Date: "2025-03-14", Name: "Holi", Exchanges: []string{"NSE", "BSE"}},
+			{Date: "2025-08-15", Name: "Independence Day"},
+		},
+		SpecialSessions: []Day{
+			{Date: "2025-02-01", Name: "Budget day", Exchanges: []string{"NSE"}, Open: "09:15", Close: "15:30"},
+			{Date: "2025-10-21", Name: "Muhurat trading", Open: "13:45", Close: "14:45"},
+		},
+		EarlyCloses: []Day{
+			{Date: "2025-12-31", Name: "Year end", Exchanges: []string{"MCX"}, Close: "13:00"},
+			// neither may reopen a day closed by a holiday
+			{Date: "2025-03-14", Name: "Derivatives early close", Exchanges: []string{"NFO"}, Close: "13:00"},
+			{Date: "2025-08-15", Name: "Commodities early close", Exchanges: []string{"MCX"}, Close: "13:00"},
+		},
+	}
+	if err := validate(&f); err != nil {
+		t.Fatal(err)
+	}
+	c := New()
+	c.apply(f, "")
+	return c
+}
+
+func TestIsOpen(t *testing.T) {
+	c := testCalendar(t)
+	at := func(date, clock string) time.Time {
+		v, err := time.ParseInLocation("2006-01-02 15:04", date+" "+clock, c.Location())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+
+	tests := []struct {
+		name     string
+		exchange string
+		t        time.Time
+		want     bool
+	}{
+		{"weekday session", "NSE", at("2025-01-06", "10:00"), true},
+		{"before the open", "NSE", at("2025-01-06", "09:14"), false},
+		{"at the open", "NSE", at("2025-01-06", "09:15"), true},
+		{"at the close", "NSE", at("2025-01-06", "15:30"), false},
+		{"default exchange", "", at("2025-01-06", "10:00"), true},
+		{"segment follows its parent", "NFO", at("2025-01-06", "10:00"), true},
+		{"commodity evening", "MCX", at("2025-01-06", "20:00"), true},
+		{"weekend", "NSE", at("2025-01-04", "10:00"), false},
+		{"special session on a weekend", "NSE", at("2025-02-01", "10:00"), true},
+		{"special session for another exchange", "MCX", at("2025-02-01", "10:00"), false},
+		{"muhurat session", "NSE", at("2025-10-21", "14:00"), true},
+		{"outside the muhurat session", "NSE", at("2025-10-21", "10:00"), false},
+		{"holiday", "NSE", at("2025-03-14", "10:00"), false},
+		{"segment shares its parent's holiday", "CDS", at("2025-03-14", "10:00"), false},
+		{"holiday for other exchanges", "MCX", at("2025-03-14", "10:00"), true},
+		{"early close does not reopen the parent's holiday", "NFO", at("2025-03-14", "10:00"), false},
+		{"early close does not reopen a holiday for all", "MCX", at("2025-08-15", "10:00"), false},
+		{"before the early close", "MCX", at("2025-12-31", "12:59"), true},
+		{"after the early close", "MCX", at("2025-12-31", "13:00"), false},
+		{"early close for other exchanges", "NSE", at("2025-12-31", "14:00"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.IsOpen(tt.exchange, tt.t); got != tt.want {
+				t.Errorf("IsOpen(%q, %s) = %v, want %v", tt.exchange, tt.t, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNextOpen(t *testing.T) {
+	c := testCalendar(t)
+	at := func(date, clock string) time.Time {
+		v, _ := time.ParseInLocation("2006-01-02 15:04", date+" "+clock, c.Location())
+		return v
+	}
+
+	tests := []struct {
+		name string
+		t    time.Time
+		want time.Time
+	}{
+		{"in session", at("2025-01-06", "11:00"), at("2025-01-06", "11:00")},
+		{"before the open", at("2025-01-06", "08:00"), at("2025-01-06", "09:15")},
+		{"over the weekend", at("2025-01-03", "16:00"), at("2025-01-06", "09:15")},
+		{"over a holiday and the weekend", at("2025-03-13", "16:00"), at("2025-03-17", "09:15")},
+		{"into a special session", at("2025-01-31", "16:00"), at("2025-02-01", "09:15")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := c.NextOpen("NSE", tt.t); !got.Equal(tt.want) {
+				t.Errorf("NextOpen(%s) = %s, want %s", tt.t, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPreviousTradingDay(t *testing.T) {
+	c := testCalendar(t)
+	day := func(s string) time.Time {
+		v, _ := time.ParseInLocation("2006-01-02", s, c.Location())
+		return v
+	}
+
+	tests := []struct {
+		day, want string
+	}{
+		{"2025-01-07", "2025-01-06"},
+		{"2025-01-06", "2025-01-03"},
+		{"2025-03-17", "2025-03-13"},
+		{"2025-02-03", "2025-02-01"},
+	}
+	for _, tt := range tests {
+		if got := c.PreviousTradingDay("NSE", day(tt.day)); !got.Equal(day(tt.want)) {
+			t.Errorf("PreviousTradingDay(%s) = %s, want %s", tt.day, got.Format("2006-01-02"), tt.want)
+		}
+	}
+}
@@ -0,0 +1,197 @@
+// Package charges computes Indian trading costs per fill: brokerage from a
+// broker plan, and the statutory STT/CTT, exchange transaction charges,
+// SEBI turnover fees, stamp duty and GST. Live fills and backtests use the
+// same Compute so simulated and real costs match.
+package charges
+
+import (
+	"math"
+	"strings"
+
+	"go-backend/options"
+)
+
+// Segments charges are levied on.
+const (
+	EquityDelivery   = "equity-delivery"
+	EquityIntraday   = "equity-intraday"
+	Futures          = "futures"
+	Options          = "options"
+	CurrencyFutures  = "currency-futures"
+	CurrencyOptions  = "currency-options"
+	CommodityFutures = "commodity-futures"
+	CommodityOptions = "commodity-options"
+)
+
+// Segments lists every segment, in display order.
+var Segments = []string{EquityDelivery, EquityIntraday, Futures, Options,
+	CurrencyFutures, CurrencyOptions, CommodityFutures, CommodityOptions}
+
+// Order products, as brokers name them.
+const (
+	ProductDelivery = "CNC"  // equity held overnight
+	ProductIntraday = "MIS"  // squared off the same day
+	ProductNormal   = "NRML" // derivatives carried overnight
+)
+
+// SegmentRates are the statutory charges of a segment, in percent of
+// turnover (of premium for options). STT is CTT on commodities.
+type SegmentRates struct {
+	STTBuy   float64 `json:"sttBuy"`
+	STTSell  float64 `json:"sttSell"`
+	Exchange float64 `json:"exchange"`
+	Stamp    float64 `json:"stamp"` // buy side only
+}
+
+// Rates are the NSE/MCX rates in force from October 2024. They are
+// variables so a deployment can track rate changes without a release.
+var Rates = map[string]SegmentRates{
+	EquityDelivery:   {STTBuy: 0.1, STTSell: 0.1, Exchange: 0.00297, Stamp: 0.015},
+	EquityIntraday:   {STTSell: 0.025, Exchange: 0.00297, Stamp: 0.003},
+	Futures:          {STTSell: 0.02, Exchange: 0.00173, Stamp: 0.002},
+	Options:          {STTSell: 0.1, Exchange: 0.03503, Stamp: 0.003},
+	CurrencyFutures:  {Exchange: 0.00035, Stamp: 0.0001},
+	CurrencyOptions:  {Exchange: 0.0311, Stamp: 0.0001},
+	CommodityFutures: {STTSell: 0.01, Exchange: 0.0021, Stamp: 0.002},
+	CommodityOptions: {STTSell: 0.05, Exchange: 0.0418, Stamp: 0.003},
+}
+
+var (
+	SEBIPercent = 0.0001 // ₹10 per crore
+	GSTPercent  = 18.0   // on brokerage, exchange and SEBI charges
+)
+
+// Fee is a brokerage schedule: Flat plus Percent of turnover, bounded by
+// Min and Max when they are set.
+type Fee struct {
+	Percent float64 `json:"percent"`
+	Flat    float64 `json:"flat"`
+	Min     float64 `json:"min,omitempty"`
+	Max     float64 `json:"max,omitempty"`
+}
+
+func (f Fee) amount(turnover float64) float64 {
+	v := f.Flat + turnover*f.Percent/100
+	if f.Max > 0 && v > f.Max {
+		v = f.Max
+	}
+	if v < f.Min {
+		v = f.Min
+	}
+	return v
+}
+
+// Plan is a broker's brokerage per segment; segments it leaves out are
+// free.
+type Plan struct {
+	Name      string         `json:"name"`
+	Brokerage map[string]Fee `json:"brokerage"`
+}
+
+// Presets are common retail plans. "discount" is the default.
+var Presets = map[string]Plan{
+	"discount": {Name: "discount", Brokerage: map[string]Fee{
+		EquityIntraday: {Percent: 0.03, Max: 20}, Futures: {Percent: 0.03, Max: 20}, Options: {Flat: 20},
+		CurrencyFutures: {Percent: 0.03, Max: 20}, CurrencyOptions: {Flat: 20},
+		CommodityFutures: {Percent: 0.03, Max: 20}, CommodityOptions: {Flat: 20},
+	}},
+	"flat-20": {Name: "flat-20", Brokerage: map[string]Fee{
+		EquityDelivery: {Flat: 20}, EquityIntraday: {Flat: 20}, Futures: {Flat: 20}, Options: {Flat: 20},
+		CurrencyFutures: {Flat: 20}, CurrencyOptions: {Flat: 20}, CommodityFutures: {Flat: 20}, CommodityOptions: {Flat: 20},
+	}},
+	"full-service": {Name: "full-service", Brokerage: map[string]Fee{
+		EquityDelivery: {Percent: 0.5}, EquityIntraday: {Percent: 0.05}, Futures: {Percent: 0.05}, Options: {Flat: 100},
+		CurrencyFutures: {Percent: 0.05}, CurrencyOptions: {Flat: 50}, CommodityFutures: {Percent: 0.05}, CommodityOptions: {Flat: 100},
+	}},
+	"zero": {Name: "zero", Brokerage: map[string]Fee{}},
+}
+
+// DefaultPlan is used when a user has not configured one.
+const DefaultPlan = "discount"
+
+// SegmentOf places a fill in its segment from the order's exchange,
+// instrument and product. Equity without the intraday product is delivery.
+func SegmentOf(exchange, instrument, product string) string {
+	ex := strings.ToUpper(exchange)
+	if i := strings.Index(instrument, ":"); i > 0 {
+		if ex == "" {
+			ex = strings.ToUpper(instrument[:i])
+		}
+	}
+	ct, err := options.ParseSymbol(instrument)
+	derivative := err == nil
+	option := derivative && ct.IsOption()
+
+	switch {
+	case ex == "CDS" || ex == "BCD":
+		if option {
+			return CurrencyOptions
+		}
+		return CurrencyFutures
+	case ex == "MCX" || ex == "NCDEX":
+		if option {
+			return CommodityOptions
+		}
+		return CommodityFutures
+	case derivative || ex == "NFO" || ex == "BFO":
+		if option {
+			return Options
+		}
+		return Futures
+	case strings.EqualFold(product, ProductIntraday):
+		return EquityIntraday
+	}
+	return EquityDelivery
+}
+
+// Breakdown is the cost of one fill. Taxes is everything but brokerage,
+// matching the split of Transaction.Brokerage and Transaction.Taxes.
+type Breakdown struct {
+	Segment   string  `json:"segment"`
+	Turnover  float64 `json:"turnover"`
+	Brokerage float64 `json:"brokerage"`
+	STT       float64 `json:"stt"` // CTT on commodities
+	Exchange  float64 `json:"exchange"`
+	SEBI      float64 `json:"sebi"`
+	Stamp     float64 `json:"stamp"`
+	GST       float64 `json:"gst"`
+	Taxes     float64 `json:"taxes"`
+	Total     float64 `json:"total"`
+}
+
+// Compute prices a fill of qty at price on side under plan.
+func Compute(plan Plan, segment, side string, qty, price float64) Breakdown {
+	return ComputeFill(plan, segment, side, qty, price, Booked{})
+}
+
+// Booked is what earlier fills of the same order have already been charged.
+type Booked struct {
+	Turnover  float64
+	Brokerage float64
+}
+
+// ComputeFill prices a later fill of an order that already booked prior.
+// Brokerage is levied per order, so the fill pays what the order's whole
+// turnover so far costs less what its earlier fills paid: a flat fee is
+// charged once and a capped one stops at the cap. Taxes are per fill.
+func ComputeFill(plan Plan, segment, side string, qty, price float64, prior Booked) Breakdown {
+	b := Breakdown{Segment: segment, Turnover: round2(math.Abs(qty * price))}
+	rates := Rates[segment]
+	buy := !strings.EqualFold(side, "SELL")
+
+	b.Brokerage = round2(math.Max(plan.Brokerage[segment].amount(prior.Turnover+b.Turnover)-prior.Brokerage, 0))
+	if buy {
+		b.STT = round2(b.Turnover * rates.STTBuy / 100)
+		b.Stamp = round2(b.Turnover * rates.Stamp / 100)
+	} else {
+		b.STT = round2(b.Turnover * rates.STTSell / 100)
+	}
+	b.Exchange = round2(b.Turnover * rates.Exchange / 100)
+	b.SEBI = round2(b.Turnover * SEBIPercent / 100)
+	b.GST = round2((b.Brokerage + b.Exchange + b.SEBI) * GSTPercent / 100)
+	b.Taxes = round2(b.STT + b.Exchange + b.SEBI + b.Stamp + b.GST)
+	b.Total = round2(b.Brokerage + b.Taxes)
+	return b
+}
+
+func round2(v float64) float64 { return math.Round(v*100) / 100 }
@@ -0,0 +1,95 @@
+package charges
+
+import "testing"
+
+func TestSegmentOf(t *testing.T) {
+	tests := []struct {
+		exchange, instrument, product string
+		want                          string
+	}{
+		{"NSE", "RELIANCE", "CNC", EquityDelivery},
+		{"NSE", "RELIANCE", "", EquityDelivery},
+		{"NSE", "RELIANCE", "mis", EquityIntraday},
+		{"", "NFO:NIFTY25JANFUT", "NRML", Futures},
+		{"NFO", "NIFTY25JAN24000CE", "MIS", Options},
+		{"", "NIFTY2510924000PE", "", Options},
+		{"CDS", "USDINR25JANFUT", "", CurrencyFutures},
+		{"CDS", "USDINR25JAN84CE", "", CurrencyOptions},
+		{"MCX", "CRUDEOIL25JANFUT", "", CommodityFutures},
+		{"", "MCX:CRUDEOIL25JAN6500CE", "", CommodityOptions},
+	}
+	for _, tt := range tests {
+		if got := SegmentOf(tt.exchange, tt.instrument, tt.product); got != tt.want {
+			t.Errorf("SegmentOf(%q, %q, %q) = %q, want %q", tt.exchange, tt.instrument, tt.product, got, tt.want)
+		}
+	}
+}
+
+func TestCompute(t *testing.T) {
+	discount := Presets["discount"]
+	tests := []struct {
+		name    string
+		segment string
+		side    string
+		qty     float64
+		price   float64
+		want    Breakdown
+	}{
+		{
+			// 0.03% of 1,00,000 is 30, capped at 20
+			name: "intraday buy", segment: EquityIntraday, side: "BUY", qty: 100, price: 1000,
+			want: Breakdown{Segment: EquityIntraday, Turnover: 100000, Brokerage: 20, Exchange: 2.97, SEBI: 0.1,
+				Stamp: 3, GST: 4.15, Taxes: 10.22, Total: 30.22},
+		},
+		{
+			name: "intraday sell", segment: EquityIntraday, side: "SELL", qty: 100, price: 1000,
+			want: Breakdown{Segment: EquityIntraday, Turnover: 100000, Brokerage: 20, STT: 25, Exchange: 2.97, SEBI: 0.1,
+				GST: 4.15, Taxes: 32.22, Total: 52.22},
+		},
+		{
+			// the discount plan charges no brokerage on delivery
+			name: "delivery buy", segment: EquityDelivery, side: "BUY", qty: 10, price: 100,
+			want: Breakdown{Segment: EquityDelivery, Turnover: 1000, STT: 1, Exchange: 0.03, Stamp: 0.15,
+				GST: 0.01, Taxes: 1.19, Total: 1.19},
+		},
+		{
+			name: "options sell", segment: Options, side: "SELL", qty: 50, price: 100,
+			want: Breakdown{Segment: Options, Turnover: 5000, Brokerage: 20, STT: 5, Exchange: 1.75, SEBI: 0.01,
+				GST: 3.92, Taxes: 10.68, Total: 30.68},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Compute(discount, tt.segment, tt.side, tt.qty, tt.price); got != tt.want {
+				t.Errorf("got %+v\nwant %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+// Brokerage is per order: later fills pay only what the order's turnover so
+// far adds on top of what earlier fills were charged.
+func TestComputeFillBrokerage(t *testing.T) {
+	discount := Presets["discount"]
+	tests := []struct {
+		name    string
+		segment string
+		turn    float64 // turnover of this fill, as qty 1 at this price
+		prior   Booked
+		want    float64
+	}{
+		{"first fill", EquityIntraday, 10000, Booked{}, 3},
+		{"below the cap", EquityIntraday, 10000, Booked{Turnover: 10000, Brokerage: 3}, 3},
+		{"reaches the cap", EquityIntraday, 50000, Booked{Turnover: 50000, Brokerage: 15}, 5},
+		{"past the cap", EquityIntraday, 50000, Booked{Turnover: 100000, Brokerage: 20}, 0},
+		{"flat fee once", Options, 500, Booked{Turnover: 500, Brokerage: 20}, 0},
+		{"free segment", EquityDelivery, 10000, Booked{}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ComputeFill(discount, tt.segment, "BUY", 1, tt.turn, tt.prior).Brokerage; got != tt.want {
+				t.Errorf("brokerage = %g, want %g", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package charges
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/google/uuid"
+	"go-backend/models"
+	"gorm.io/gorm"
+)
+
+// Service resolves users' charge plans and prices their fills.
+type Service struct {
+	DB *gorm.DB
+}
+
+func NewService(db *gorm.DB) *Service {
+	return &Service{DB: db}
+}
+
+// Resolve turns a stored plan into a Plan: the preset's fees, with the
+// plan's own per-segment fees on top.
+func Resolve(p *models.ChargePlan) (Plan, error) {
+	base := Presets[DefaultPlan]
+	if p.Preset != "" {
+		var ok bool
+		if base, ok = Presets[p.Preset]; !ok {
+			return Plan{}, fmt.Errorf("unknown preset %q", p.Preset)
+		}
+	}
+	plan := Plan{Name: p.Name, Brokerage: map[string]Fee{}}
+	for seg, f := range base.Brokerage {
+		plan.Brokerage[seg] = f
+	}
+	if len(p.Brokerage) > 0 && string(p.Brokerage) != "null" {
+		var own map[string]Fee
+		if err := json.Unmarshal(p.Brokerage, &own); err != nil {
+			return Plan{}, fmt.Errorf("invalid brokerage: %w", err)
+		}
+		for seg, f := range own {
+			if _, ok := Rates[seg]; !ok {
+				return Plan{}, fmt.Errorf("unknown segment %q", seg)
+			}
+			plan.Brokerage[seg] = f
+		}
+	}
+	return plan, nil
+}
+
+// PlanFor returns the plan for the user's fills through brokerID: one bound
+// to the broker, else the user's catch-all, else the default preset.
+func (s *Service) PlanFor(userID uuid.UUID, brokerID *uint) Plan {
+	q := s.DB.Where("user_id = ?", userID)
+	if brokerID != nil {
+		q = q.Where("broker_id = ? OR broker_id IS NULL", *brokerID).
+			Order("broker_id IS NULL") // bound plans first
+	} else {
+		q = q.Where("broker_id IS NULL")
+	}
+	var stored models.ChargePlan
+	if err := q.Order("id").First(&stored).Error; err == nil {
+		if plan, err := Resolve(&stored); err == nil {
+			return plan
+		}
+	}
+	return Presets[DefaultPlan]
+}
+
+// Estimate prices a fill of order without booking it.
+func (s *Service) Estimate(order *models.Order, qty int, price float64) Breakdown {
+	plan := s.PlanFor(order.UserID, order.BrokerID)
+	seg := SegmentOf(order.Exchange, order.Instrument, order.Product)
+	return Compute(plan, seg, order.Side, float64(qty), price)
+}
+
+// Apply fills in tx's brokerage and taxes from its order, net of the
+// brokerage the order's earlier fills booked. It is a broker.FillRecorder
+// hook and leaves costs a venue already reported alone.
+func (s *Service) Apply(order *models.Order, tx *models.Transaction) {
+	if tx.Brokerage != 0 || tx.Taxes != 0 {
+		return
+	}
+	var prior Booked
+	if err := s.DB.Model(&models.Transaction{}).
+		Select("COALESCE(SUM(ABS(fill_price * quantity)), 0) AS turnover, COALESCE(SUM(brokerage), 0) AS brokerage").
+		Where("order_id = ? AND id <> ?", order.ID, tx.ID).Scan(&prior).Error; err != nil {
+		prior = Booked{}
+	}
+	plan := s.PlanFor(order.UserID, order.BrokerID)
+	seg := SegmentOf(order.Exchange, order.Instrument, order.Product)
+	b := ComputeFill(plan, seg, order.Side, float64(tx.Quantity), tx.FillPrice, prior)
+	tx.Brokerage = b.Brokerage
+	tx.Taxes = b.Taxes
+}
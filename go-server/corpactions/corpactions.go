@@ -0,0 +1,346 @@
+// Package corpactions applies splits, bonuses and dividends: it back-adjusts
+// stored bars, restates open positions in the transaction ledger and records
+// dividend cash per holding.
+package corpactions
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go-backend/ledger"
+	"go-backend/models"
+	"gorm.io/gorm"
+)
+
+// ErrNotPending is returned when applying an action twice.
+var ErrNotPending = errors.New("corporate action is not pending")
+
+// Processor applies corporate actions.
+type Processor struct {
+	DB *gorm.DB
+}
+
+func NewProcessor(db *gorm.DB) *Processor {
+	return &Processor{DB: db}
+}
+
+// Validate checks a new action and normalises its symbol and type.
+func Validate(a *models.CorporateAction) error {
+	a.Symbol = strings.ToUpper(strings.TrimSpace(a.Symbol))
+	a.Exchange = strings.ToUpper(strings.TrimSpace(a.Exchange))
+	a.Type = strings.ToUpper(strings.TrimSpace(a.Type))
+	if a.Symbol == "" || a.ExDate.IsZero() {
+		return errors.New("symbol and exDate are required")
+	}
+	switch a.Type {
+	case models.CorporateActionSplit, models.CorporateActionBonus:
+		if a.NewShares <= 0 || a.OldShares <= 0 {
+			return errors.New("newShares and oldShares must be positive")
+		}
+		if a.Type == models.CorporateActionSplit && a.NewShares == a.OldShares {
+			return errors.New("a split must change the share count")
+		}
+	case models.CorporateActionDividend:
+		if a.Dividend <= 0 {
+			return errors.New("dividend must be positive")
+		}
+	default:
+		return fmt.Errorf("type must be %s, %s or %s", models.CorporateActionSplit,
+			models.CorporateActionBonus, models.CorporateActionDividend)
+	}
+	return nil
+}
+
+// Multiplier is how many shares one share held before the ex-date becomes.
+// Dividends do not change the share count.
+func Multiplier(a *models.CorporateAction) float64 {
+	switch a.Type {
+	case models.CorporateActionSplit:
+		return a.NewShares / a.OldShares
+	case models.CorporateActionBonus:
+		return (a.NewShares + a.OldShares) / a.OldShares
+	}
+	return 1
+}
+
+// addedShares is how many whole shares a split or bonus adds to a holding
+// of qty, which is negative when short. Fractional entitlements are settled in
+// cash by the company, not booked here.
+func addedShares(a *models.CorporateAction, qty float64) int {
+	held := math.Abs(qty)
+	return int(math.Floor(held*Multiplier(a) - held + 1e-9))
+}
+
+// symbols are the spellings stored bars and fills may use for a's symbol.
+func symbols(a *models.CorporateAction) []string {
+	out := []string{a.Symbol}
+	if a.Exchange != "" {
+		out = append(out, a.Exchange+":"+a.Symbol)
+	}
+	return out
+}
+
+// priceFactor is the multiplier for prices before the ex-date. A dividend
+// lowers them by its share of the last close before the ex-date.
+func (p *Processor) priceFactor(a *models.CorporateAction) (float64, error) {
+	if a.Type != models.CorporateActionDividend {
+		return 1 / Multiplier(a), nil
+	}
+	var last []models.MarketData
+	err := p.DB.Where("symbol IN ? AND timestamp < ?", symbols(a), a.ExDate).
+		Order("timestamp DESC").Limit(1).Find(&last).Error
+	if err != nil {
+		return 0, err
+	}
+	if len(last) == 0 || last[0].Close <= a.Dividend {
+		return 1, nil // nothing stored to adjust against
+	}
+	return (last[0].Close - a.Dividend) / last[0].Close, nil
+}
+
+// Apply applies a pending action whose ex-date has arrived: it adjusts the
+// symbol's bars, books the shares a split or bonus added to every open
+// holding, records dividend cash, and marks the action APPLIED. It is all
+// or nothing.
+func (p *Processor) Apply(id uint, now time.Time) (*models.CorporateAction, error) {
+	var a models.CorporateAction
+	err := p.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.First(&a, id).Error; err != nil {
+			return err
+		}
+		if a.Status != models.CorporateActionPending {
+			return ErrNotPending
+		}
+		if a.ExDate.After(now) {
+			return fmt.Errorf("ex-date %s has not arrived", a.ExDate.Format("2006-01-02"))
+		}
+
+		txp := &Processor{DB: tx}
+		factor, err := txp.priceFactor(&a)
+		if err != nil {
+			return err
+		}
+		a.PriceFactor = factor
+		if err := txp.adjustBars(&a); err != nil {
+			return err
+		}
+		if err := txp.adjustHoldings(&a); err != nil {
+			return err
+		}
+		a.Status = models.CorporateActionApplied
+		a.AppliedAt = &now
+		return tx.Save(&a).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// adjustBars multiplies the factors of a's symbol's bars before its ex-date.
+func (p *Processor) adjustBars(a *models.CorporateAction) error {
+	return p.DB.Model(&models.MarketData{}).
+		Where("symbol IN ? AND timestamp < ?", symbols(a), a.ExDate).
+		Updates(map[string]interface{}{
+			"adj_factor":    gorm.Expr("COALESCE(adj_factor, 1) * ?", a.PriceFactor),
+			"volume_factor": gorm.Expr("COALESCE(volume_factor, 1) * ?", Multiplier(a)),
+		}).Error
+}
+
+// Readjust recomputes the factors of symbol's bars from its applied actions,
+// e.g. after older bars were backfilled.
+func (p *Processor) Readjust(symbol string) error {
+	symbol = strings.ToUpper(strings.TrimSpace(symbol))
+	if i := strings.Index(symbol, ":"); i > 0 {
+		symbol = symbol[i+1:]
+	}
+	var actions []models.CorporateAction
+	if err := p.DB.Where("symbol = ? AND status = ?", symbol, models.CorporateActionApplied).
+		Order("ex_date").Find(&actions).Error; err != nil {
+		return err
+	}
+	return p.DB.Transaction(func(tx *gorm.DB) error {
+		all := append([]string{symbol}, exchangePrefixed(actions, symbol)...)
+		if err := tx.Model(&models.MarketData{}).Where("symbol IN ?", all).
+			Updates(map[string]interface{}{"adj_factor": 1, "volume_factor": 1}).Error; err != nil {
+			return err
+		}
+		txp := &Processor{DB: tx}
+		for i := range actions {
+			if err := txp.adjustBars(&actions[i]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func exchangePrefixed(actions []models.CorporateAction, symbol string) []string {
+	seen := map[string]bool{}
+	var out []string
+	for _, a := range actions {
+		if a.Exchange != "" && !seen[a.Exchange] {
+			seen[a.Exchange] = true
+			out = append(out, a.Exchange+":"+symbol)
+		}
+	}
+	return out
+}
+
+// Backfilled readjusts symbol when bars from before one of its applied
+// ex-dates were stored after the action was applied.
+func (p *Processor) Backfilled(symbol string, earliest time.Time) error {
+	sym := strings.ToUpper(strings.TrimSpace(symbol))
+	if i := strings.Index(sym, ":"); i > 0 {
+		sym = sym[i+1:]
+	}
+	var n int64
+	if err := p.DB.Model(&models.CorporateAction{}).
+		Where("symbol = ? AND status = ? AND ex_date > ?", sym, models.CorporateActionApplied, earliest).
+		Count(&n).Error; err != nil || n == 0 {
+		return err
+	}
+	return p.Readjust(sym)
+}
+
+type holdingKey struct {
+	user       uuid.UUID
+	strategy   uuid.UUID
+	deployment uint
+}
+
+// adjustHoldings restates every position open in a's symbol going into the
+// ex-date, per user, strategy and deployment.
+func (p *Processor) adjustHoldings(a *models.CorporateAction) error {
+	fills, err := ledger.LoadFills(p.DB, func(q *gorm.DB) *gorm.DB {
+		return q.Where("UPPER(transactions.instrument) IN ? AND transactions.executed_at < ?", symbols(a), a.ExDate)
+	})
+	if err != nil {
+		return err
+	}
+	groups := map[holdingKey][]ledger.Fill{}
+	var order []holdingKey
+	for _, f := range fills {
+		k := holdingKey{user: f.UserID, strategy: f.StrategyID}
+		if f.DeploymentID != nil {
+			k.deployment = *f.DeploymentID
+		}
+		if _, ok := groups[k]; !ok {
+			order = append(order, k)
+		}
+		groups[k] = append(groups[k], f)
+	}
+
+	for _, k := range order {
+		pos := &ledger.Position{}
+		var last ledger.Fill
+		for _, f := range groups[k] {
+			pos.Apply(f)
+			last = f
+		}
+		if pos.Quantity == 0 {
+			continue
+		}
+		entry := models.CorporateActionEntry{
+			CorporateActionID: a.ID,
+			UserID:            k.user,
+			StrategyID:        k.strategy,
+			DeploymentID:      last.DeploymentID,
+			Instrument:        last.Instrument,
+			Type:              a.Type,
+			Quantity:          pos.Quantity,
+			ExDate:            a.ExDate,
+		}
+		if a.Type == models.CorporateActionDividend {
+			entry.Amount = math.Round(pos.Quantity*a.Dividend*100) / 100
+		} else {
+			entry.QuantityDelta = addedShares(a, pos.Quantity)
+			if entry.QuantityDelta > 0 {
+				id, err := p.bookShares(a, last, pos.Quantity > 0, entry.QuantityDelta)
+				if err != nil {
+					return err
+				}
+				entry.OrderID = &id
+			}
+		}
+		if err := p.DB.Create(&entry).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// bookShares records the shares added to a holding as a filled adjustment
+// order at price zero, so average cost falls by the split ratio and
+// realised P&L is untouched. A short position owes the shares instead.
+func (p *Processor) bookShares(a *models.CorporateAction, last ledger.Fill, long bool, qty int) (uuid.UUID, error) {
+	var parent models.Order
+	if err := p.DB.First(&parent, "id = ?", last.OrderID).Error; err != nil {
+		return uuid.Nil, err
+	}
+	side := "BUY"
+	if !long {
+		side = "SELL"
+	}
+	o := models.Order{
+		ID:           uuid.New(),
+		OrderID:      fmt.Sprintf("CA-%d-%s", a.ID, uuid.NewString()[:8]),
+		UserID:       last.UserID,
+		Instrument:   last.Instrument,
+		Exchange:     last.Exchange,
+		Quantity:     qty,
+		OrderType:    models.OrderTypeAdjustment,
+		Side:         side,
+		Status:       models.OrderStatusFilled,
+		StrategyID:   last.StrategyID,
+		DeploymentID: last.DeploymentID,
+		BrokerID:     parent.BrokerID,
+		IsPaper:      parent.IsPaper,
+		FilledQty:    qty,
+		Product:      parent.Product,
+	}
+	if err := p.DB.Create(&o).Error; err != nil {
+		return uuid.Nil, err
+	}
+	tx := models.Transaction{
+		ID:         uuid.New(),
+		TxID:       "CA-" + uuid.NewString(),
+		OrderID:    o.ID,
+		Quantity:   qty,
+		ExecutedAt: a.ExDate,
+		StrategyID: last.StrategyID,
+		Instrument: last.Instrument,
+	}
+	return o.ID, p.DB.Create(&tx).Error
+}
+
+// Run applies every pending action whose ex-date has arrived. It is a
+// jobs.Func, scheduled before the open so the day starts adjusted.
+func (p *Processor) Run(ctx context.Context, day time.Time) error {
+	end := day.AddDate(0, 0, 1)
+	var due []models.CorporateAction
+	if err := p.DB.Where("status = ? AND ex_date < ?", models.CorporateActionPending, end).
+		Order("ex_date, id").Find(&due).Error; err != nil {
+		return err
+	}
+	failed := 0
+	for _, a := range due {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if _, err := p.Apply(a.ID, time.Now()); err != nil {
+			log.Printf("corporate action %d (%s %s): %v", a.ID, a.Type, a.Symbol, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d corporate actions failed", failed, len(due))
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package corpactions
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"go-backend/ledger"
+	"go-backend/models"
+)
+
+func TestValidate(t *testing.T) {
+	exDate := time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name    string
+		action  models.CorporateAction
+		wantErr bool
+	}{
+		{"split", models.CorporateAction{Symbol: " reliance ", Type: "split", NewShares: 2, OldShares: 1, ExDate: exDate}, false},
+		{"bonus one for one", models.CorporateAction{Symbol: "INFY", Type: "BONUS", NewShares: 1, OldShares: 1, ExDate: exDate}, false},
+		{"dividend", models.CorporateAction{Symbol: "TCS", Type: "DIVIDEND", Dividend: 10, ExDate: exDate}, false},
+		{"no symbol", models.CorporateAction{Type: "DIVIDEND", Dividend: 10, ExDate: exDate}, true},
+		{"no ex-date", models.CorporateAction{Symbol: "TCS", Type: "DIVIDEND", Dividend: 10}, true},
+		{"split that changes nothing", models.CorporateAction{Symbol: "INFY", Type: "SPLIT", NewShares: 1, OldShares: 1, ExDate: exDate}, true},
+		{"zero ratio", models.CorporateAction{Symbol: "INFY", Type: "BONUS", NewShares: 1, ExDate: exDate}, true},
+		{"zero dividend", models.CorporateAction{Symbol: "TCS", Type: "DIVIDEND", ExDate: exDate}, true},
+		{"unknown type", models.CorporateAction{Symbol: "TCS", Type: "MERGER", ExDate: exDate}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := tt.action
+			if err := Validate(&a); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateNormalises(t *testing.T) {
+	a := models.CorporateAction{Symbol: " reliance ", Exchange: "nse", Type: " split", NewShares: 2, OldShares: 1,
+		ExDate: time.Date(2025, 1, 6, 0, 0, 0, 0, time.UTC)}
+	if err := Validate(&a); err != nil {
+		t.Fatal(err)
+	}
+	if a.Symbol != "RELIANCE" || a.Exchange != "NSE" || a.Type != models.CorporateActionSplit {
+		t.Errorf("got %q %q %q", a.Symbol, a.Exchange, a.Type)
+	}
+	if got := symbols(&a); len(got) != 2 || got[1] != "NSE:RELIANCE" {
+		t.Errorf("symbols = %v", got)
+	}
+}
+
+func TestSharesAndPrices(t *testing.T) {
+	tests := []struct {
+		name       string
+		typ        string
+		new, old   float64
+		held       float64
+		multiplier float64
+		added      int
+	}{
+		{"2:1 split", models.CorporateActionSplit, 2, 1, 10, 2, 10},
+		{"5:1 split short", models.CorporateActionSplit, 5, 1, -3, 5, 12},
+		{"1:2 bonus", models.CorporateActionBonus, 1, 2, 10, 1.5, 5},
+		{"1:2 bonus with a fraction", models.CorporateActionBonus, 1, 2, 7, 1.5, 3},
+		{"1:1 bonus", models.CorporateActionBonus, 1, 1, 4, 2, 4},
+		{"3:2 split", models.CorporateActionSplit, 3, 2, 3, 1.5, 1},
+		{"dividend", models.CorporateActionDividend, 0, 0, 10, 1, 0},
+	}
+	p := &Processor{}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &models.CorporateAction{Type: tt.typ, NewShares: tt.new, OldShares: tt.old}
+			if got := Multiplier(a); math.Abs(got-tt.multiplier) > 1e-9 {
+				t.Errorf("Multiplier = %g, want %g", got, tt.multiplier)
+			}
+			if got := addedShares(a, tt.held); got != tt.added {
+				t.Errorf("addedShares(%g) = %d, want %d", tt.held, got, tt.added)
+			}
+			if tt.typ == models.CorporateActionDividend {
+				return
+			}
+			if f, err := p.priceFactor(a); err != nil || math.Abs(f-1/tt.multiplier) > 1e-9 {
+				t.Errorf("priceFactor = %g, %v, want %g", f, err, 1/tt.multiplier)
+			}
+		})
+	}
+}
+
+// The added shares are booked as a fill at price zero, which must scale the
+// average cost by the price factor and leave realised P&L alone.
+func TestAddedSharesRestateCost(t *testing.T) {
+	a := &models.CorporateAction{Type: models.CorporateActionSplit, NewShares: 2, OldShares: 1}
+	var pos ledger.Position
+	pos.Apply(ledger.Fill{Instrument: "INFY", Side: "BUY", Quantity: 10, Price: 1500})
+	pos.Apply(ledger.Fill{Instrument: "INFY", Side: "BUY", Quantity: float64(addedShares(a, pos.Quantity))})
+	if pos.Quantity != 20 || pos.AvgPrice != 750 || pos.Realized != 0 {
+		t.Errorf("after the split got %+v, want 20 at 750 with nothing realised", pos)
+	}
+}
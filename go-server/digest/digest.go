@@ -0,0 +1,201 @@
+// Package digest emails users who opted into performance reports a daily,
+// weekly or monthly summary of their P&L, best and worst strategies and
+// risk breaches. Each send is recorded as a ReportDelivery so no digest is
+// mailed twice.
+package digest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/mail"
+	"os"
+	"time"
+
+	"github.com/google/uuid"
+	"go-backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DefaultMaxAttempts bounds how often a failed digest is retried.
+const DefaultMaxAttempts = 3
+
+// Service builds and sends digests.
+type Service struct {
+	DB          *gorm.DB
+	Mail        Transport // nil disables sending
+	From        string
+	MaxAttempts int
+
+	// TradingDay decides when weekly and monthly periods are complete.
+	// Nil means weekdays.
+	TradingDay func(time.Time) bool
+}
+
+// NewService sends through mail from MAIL_FROM.
+func NewService(db *gorm.DB, mail Transport) *Service {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "reports@localhost"
+	}
+	return &Service{DB: db, Mail: mail, From: from, MaxAttempts: DefaultMaxAttempts}
+}
+
+func (s *Service) tradingDay(d time.Time) bool {
+	if s.TradingDay != nil {
+		return s.TradingDay(d)
+	}
+	return d.Weekday() != time.Saturday && d.Weekday() != time.Sunday
+}
+
+// Recipient is a user opted into digests.
+type Recipient struct {
+	UserID    uuid.UUID
+	Email     string
+	Name      string
+	Frequency string
+}
+
+// recipients are the users with both email notifications and performance
+// reports turned on.
+func (s *Service) recipients() ([]Recipient, error) {
+	var out []Recipient
+	err := s.DB.Table("users").
+		Select("users.id AS user_id, users.email, COALESCE(NULLIF(users.full_name, ''), users.username) AS name, notification_preferences.report_frequency AS frequency").
+		Joins("JOIN notification_preferences ON notification_preferences.user_id = users.id").
+		Where("users.deleted_at IS NULL AND users.email <> '' AND notification_preferences.email_notifications AND notification_preferences.performance_reports").
+		Scan(&out).Error
+	return out, err
+}
+
+// Run sends every opted-in user the digest of their frequency that is due
+// after day's session. It is a jobs.Func.
+func (s *Service) Run(ctx context.Context, day time.Time) error {
+	if s.Mail == nil {
+		return nil
+	}
+	users, err := s.recipients()
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, u := range users {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		kind := u.Frequency
+		if !ValidKind(kind) {
+			kind = models.ReportWeekly
+		}
+		p, err := Due(kind, day, s.tradingDay)
+		if err == nil {
+			_, err = s.Deliver(ctx, u, p)
+		}
+		if err != nil {
+			log.Printf("performance digest: user %s: %v", u.UserID, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d digests failed", failed, len(users))
+	}
+	return nil
+}
+
+// Deliver sends u the digest for p unless it was already sent, is being
+// sent, was skipped as empty, or has failed MaxAttempts times; it returns
+// nil without sending then. The delivery row is claimed before sending.
+func (s *Service) Deliver(ctx context.Context, u Recipient, p Period) (*models.ReportDelivery, error) {
+	if s.Mail == nil {
+		return nil, errors.New("no mail transport configured")
+	}
+	d, err := s.claim(u, p)
+	if d == nil || err != nil {
+		return nil, err
+	}
+
+	status, sendErr := s.send(ctx, u, p)
+	updates := map[string]any{"status": status, "error": ""}
+	switch status {
+	case models.ReportSent:
+		now := time.Now()
+		updates["sent_at"] = &now
+		d.SentAt = &now
+	case models.ReportFailed:
+		updates["error"] = sendErr.Error()
+		d.Error = sendErr.Error()
+	}
+	d.Status = status
+	if err := s.DB.Model(d).Updates(updates).Error; err != nil {
+		return d, err
+	}
+	return d, sendErr
+}
+
+// claim inserts the delivery row for u and p, or takes over a failed one
+// with attempts left. It returns nil when another run owns the period.
+func (s *Service) claim(u Recipient, p Period) (*models.ReportDelivery, error) {
+	d := &models.ReportDelivery{UserID: u.UserID, Period: p.Kind, PeriodStart: p.Start, PeriodEnd: p.End,
+		Email: u.Email, Status: models.ReportSending, Attempts: 1}
+	res := s.DB.Clauses(clause.OnConflict{DoNothing: true}).Create(d)
+	if res.Error != nil {
+		return nil, res.Error
+	}
+	if res.RowsAffected == 1 {
+		return d, nil
+	}
+
+	maxAttempts := s.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = DefaultMaxAttempts
+	}
+	key := s.DB.Where("user_id = ? AND period = ? AND period_start = ?", u.UserID, p.Kind, p.Start)
+	res = key.Session(&gorm.Session{}).Model(&models.ReportDelivery{}).
+		Where("status = ? AND attempts < ?", models.ReportFailed, maxAttempts).
+		Updates(map[string]any{"status": models.ReportSending, "attempts": gorm.Expr("attempts + 1"), "email": u.Email})
+	if res.Error != nil || res.RowsAffected == 0 {
+		return nil, res.Error
+	}
+	d = &models.ReportDelivery{}
+	if err := key.Session(&gorm.Session{}).First(d).Error; err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// send builds and mails the digest, returning the delivery status.
+func (s *Service) send(ctx context.Context, u Recipient, p Period) (string, error) {
+	dg, err := Build(s.DB, u.UserID, u.Name, p)
+	if err != nil {
+		return models.ReportFailed, err
+	}
+	if dg.Empty() {
+		return models.ReportSkipped, nil
+	}
+	msg, err := s.Message(dg, u.Email)
+	if err != nil {
+		return models.ReportFailed, err
+	}
+	if err := s.Mail.Send(ctx, msg); err != nil {
+		return models.ReportFailed, err
+	}
+	return models.ReportSent, nil
+}
+
+// Message renders dg as an email to.
+func (s *Service) Message(dg *Digest, to string) (Message, error) {
+	html, err := dg.HTML()
+	if err != nil {
+		return Message{}, err
+	}
+	text, err := dg.Text()
+	if err != nil {
+		return Message{}, err
+	}
+	if dg.Name != "" {
+		to = (&mail.Address{Name: dg.Name, Address: to}).String()
+	}
+	return Message{From: s.From, To: to, Subject: dg.Subject(), HTML: html, Text: text}, nil
+}
@@ -0,0 +1,191 @@
+package digest
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Message is one email with HTML and plain-text bodies.
+type Message struct {
+	From    string
+	To      string
+	Subject string
+	HTML    string
+	Text    string
+}
+
+// Transport delivers messages.
+type Transport interface {
+	Send(ctx context.Context, m Message) error
+}
+
+// Bytes renders m as a multipart/alternative MIME message.
+func (m Message) Bytes(now time.Time) ([]byte, error) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for _, part := range []struct{ typ, content string }{{"text/plain", m.Text}, {"text/html", m.HTML}} {
+		pw, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.typ + "; charset=utf-8"},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qw := quotedprintable.NewWriter(pw)
+		if _, err := qw.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		qw.Close()
+	}
+	mw.Close()
+
+	id := make([]byte, 12)
+	rand.Read(id)
+	domain := "localhost"
+	if i := strings.LastIndex(m.From, "@"); i >= 0 {
+		domain = strings.Trim(m.From[i+1:], "> ")
+	}
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\nMessage-ID: <%s@%s>\r\n",
+		m.From, m.To, mime.QEncoding.Encode("utf-8", m.Subject), now.Format(time.RFC1123Z), hex.EncodeToString(id), domain)
+	fmt.Fprintf(&out, "MIME-Version: 1.0\r\nContent-Type: multipart/alternative; boundary=%q\r\n\r\n", mw.Boundary())
+	out.Write(body.Bytes())
+	return out.Bytes(), nil
+}
+
+// SMTP sends through a mail server, upgrading to TLS when it offers
+// STARTTLS. Username may be empty for relays that need no login.
+type SMTP struct {
+	Addr     string // host:port
+	Username string
+	Password string
+}
+
+func (s *SMTP) Send(ctx context.Context, m Message) error {
+	msg, err := m.Bytes(time.Now())
+	if err != nil {
+		return err
+	}
+	var auth smtp.Auth
+	if s.Username != "" {
+		host, _, err := net.SplitHostPort(s.Addr)
+		if err != nil {
+			return fmt.Errorf("smtp address: %w", err)
+		}
+		auth = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	done := make(chan error, 1)
+	go func() { done <- smtp.SendMail(s.Addr, auth, address(m.From), []string{address(m.To)}, msg) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// address is the bare address of "Name <user@host>".
+func address(s string) string {
+	if i := strings.LastIndex(s, "<"); i >= 0 {
+		return strings.TrimSuffix(s[i+1:], ">")
+	}
+	return strings.TrimSpace(s)
+}
+
+// FileSink keeps messages locally instead of sending them, for development
+// and tests: each as a .eml file when Path is a directory, or appended to
+// an mbox when Path ends in .mbox.
+type FileSink struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+func (f *FileSink) Send(ctx context.Context, m Message) error {
+	now := time.Now()
+	msg, err := m.Bytes(now)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if strings.HasSuffix(f.Path, ".mbox") {
+		if err := os.MkdirAll(filepath.Dir(f.Path), 0o755); err != nil {
+			return err
+		}
+		mbox, err := os.OpenFile(f.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return err
+		}
+		defer mbox.Close()
+		// mboxrd: quote body lines that would read as a new message.
+		body := strings.ReplaceAll(string(msg), "\r\n", "\n")
+		body = strings.ReplaceAll(body, "\nFrom ", "\n>From ")
+		_, err = fmt.Fprintf(mbox, "From %s %s\n%s\n\n", address(m.From), now.UTC().Format(time.ANSIC), body)
+		return err
+	}
+
+	if err := os.MkdirAll(f.Path, 0o755); err != nil {
+		return err
+	}
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	name := fmt.Sprintf("%s-%s-%s.eml", now.Format("20060102T150405"), safeName(address(m.To)), hex.EncodeToString(suffix))
+	return os.WriteFile(filepath.Join(f.Path, name), msg, 0o644)
+}
+
+func safeName(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '.' || r == '-' {
+			return r
+		}
+		return '_'
+	}, s)
+}
+
+// TransportFromEnv configures delivery from MAIL_TRANSPORT ("smtp" or
+// "file"), SMTP_ADDR, SMTP_USERNAME, SMTP_PASSWORD and MAIL_SINK. Without
+// MAIL_TRANSPORT it picks SMTP when SMTP_ADDR is set, then the file sink
+// when MAIL_SINK is; with neither it returns nil and no mail is sent.
+func TransportFromEnv() (Transport, error) {
+	kind := strings.ToLower(os.Getenv("MAIL_TRANSPORT"))
+	if kind == "" {
+		switch {
+		case os.Getenv("SMTP_ADDR") != "":
+			kind = "smtp"
+		case os.Getenv("MAIL_SINK") != "":
+			kind = "file"
+		default:
+			return nil, nil
+		}
+	}
+	switch kind {
+	case "smtp":
+		if os.Getenv("SMTP_ADDR") == "" {
+			return nil, errors.New("MAIL_TRANSPORT=smtp needs SMTP_ADDR")
+		}
+		return &SMTP{Addr: os.Getenv("SMTP_ADDR"), Username: os.Getenv("SMTP_USERNAME"), Password: os.Getenv("SMTP_PASSWORD")}, nil
+	case "file":
+		if os.Getenv("MAIL_SINK") == "" {
+			return nil, errors.New("MAIL_TRANSPORT=file needs MAIL_SINK")
+		}
+		return &FileSink{Path: os.Getenv("MAIL_SINK")}, nil
+	}
+	return nil, fmt.Errorf("unknown MAIL_TRANSPORT %q", kind)
+}
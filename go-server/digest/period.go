@@ -0,0 +1,68 @@
+package digest
+
+import (
+	"fmt"
+	"time"
+
+	"go-backend/models"
+)
+
+// Period is the span a digest covers, End exclusive.
+type Period struct {
+	Kind  string    `json:"kind"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Label names the period for subjects and headings.
+func (p Period) Label() string {
+	switch p.Kind {
+	case models.ReportDaily:
+		return p.Start.Format("Mon 2 Jan 2006")
+	case models.ReportWeekly:
+		return "week of " + p.Start.Format("2 Jan 2006")
+	}
+	return p.Start.Format("January 2006")
+}
+
+// ValidKind reports whether kind is a digest frequency.
+func ValidKind(kind string) bool {
+	return kind == models.ReportDaily || kind == models.ReportWeekly || kind == models.ReportMonthly
+}
+
+// PeriodOf is the period of kind containing t, in t's location. Weeks start
+// on Monday.
+func PeriodOf(kind string, t time.Time) (Period, error) {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	p := Period{Kind: kind}
+	switch kind {
+	case models.ReportDaily:
+		p.Start, p.End = day, day.AddDate(0, 0, 1)
+	case models.ReportWeekly:
+		p.Start = day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+		p.End = p.Start.AddDate(0, 0, 7)
+	case models.ReportMonthly:
+		p.Start = time.Date(day.Year(), day.Month(), 1, 0, 0, 0, 0, day.Location())
+		p.End = p.Start.AddDate(0, 1, 0)
+	default:
+		return Period{}, fmt.Errorf("unknown report period %q", kind)
+	}
+	return p, nil
+}
+
+// Due is the latest period of kind that is complete after day's session: the
+// period containing day when no trading day of it remains, else the one
+// before. Weekly and monthly digests therefore go out on the last trading
+// day of the week or month, and a run missed then is made up by the next.
+func Due(kind string, day time.Time, tradingDay func(time.Time) bool) (Period, error) {
+	p, err := PeriodOf(kind, day)
+	if err != nil {
+		return p, err
+	}
+	for d := day.AddDate(0, 0, 1); d.Before(p.End); d = d.AddDate(0, 0, 1) {
+		if tradingDay(d) {
+			return PeriodOf(kind, p.Start.AddDate(0, 0, -1))
+		}
+	}
+	return p, nil
+}
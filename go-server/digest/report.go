@@ -0,0 +1,275 @@
+package digest
+
+import (
+	"bytes"
+	"fmt"
+	htmltemplate "html/template"
+	"math"
+	"strconv"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/google/uuid"
+	"go-backend/analytics"
+	"go-backend/models"
+	"gorm.io/gorm"
+)
+
+// topStrategies is how many best and worst strategies a digest lists.
+const topStrategies = 3
+
+// Breach is a risk limit crossing into breach during the period.
+type Breach struct {
+	At        time.Time `json:"at"`
+	Limit     string    `json:"limit"`
+	Metric    string    `json:"metric"`
+	Threshold float64   `json:"threshold"`
+	Value     float64   `json:"value"`
+	Action    string    `json:"action"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// Halt is a kill switch engaged during the period.
+type Halt struct {
+	At     time.Time `json:"at"`
+	Global bool      `json:"global"`
+	Reason string    `json:"reason"`
+}
+
+// Digest is one user's performance over a period.
+type Digest struct {
+	Name        string                `json:"name"`
+	Period      Period                `json:"period"`
+	GeneratedAt time.Time             `json:"generatedAt"`
+	Stats       analytics.Stats       `json:"stats"`
+	Best        []analytics.Group     `json:"best"`  // profitable strategies, best first
+	Worst       []analytics.Group     `json:"worst"` // losing strategies, worst first
+	Portfolio   *models.PortfolioRisk `json:"portfolio,omitempty"`
+	Breaches    []Breach              `json:"breaches"`
+	Halts       []Halt                `json:"halts"`
+}
+
+// Empty reports a period with nothing to tell.
+func (d *Digest) Empty() bool {
+	return d.Stats.Trades == 0 && len(d.Breaches) == 0 && len(d.Halts) == 0 && d.Portfolio == nil
+}
+
+// Build gathers userID's closed trades, risk breaches, kill switch
+// engagements and latest portfolio snapshot within p.
+func Build(db *gorm.DB, userID uuid.UUID, name string, p Period) (*Digest, error) {
+	d := &Digest{Name: name, Period: p, GeneratedAt: time.Now(), Breaches: []Breach{}, Halts: []Halt{}}
+	loc := p.Start.Location()
+
+	var trades []models.TradeSummary
+	if err := db.Where("user_id = ? AND exit_time >= ? AND exit_time < ?", userID, p.Start, p.End).
+		Find(&trades).Error; err != nil {
+		return nil, err
+	}
+	var strategies []models.Strategy
+	if err := db.Select("id", "name").Where("user_id = ?", userID).Find(&strategies).Error; err != nil {
+		return nil, err
+	}
+	names := make(map[uuid.UUID]string, len(strategies))
+	for _, s := range strategies {
+		names[s.ID] = s.Name
+	}
+	rep := analytics.Analyze(trades, analytics.Options{Location: loc, Strategies: names})
+	d.Stats = rep.Overall
+	for _, g := range rep.ByStrategy {
+		if g.NetPnL > 0 && len(d.Best) < topStrategies {
+			d.Best = append(d.Best, g)
+		}
+	}
+	for i := len(rep.ByStrategy) - 1; i >= 0; i-- {
+		if g := rep.ByStrategy[i]; g.NetPnL < 0 && len(d.Worst) < topStrategies {
+			d.Worst = append(d.Worst, g)
+		}
+	}
+
+	var events []struct {
+		models.RiskEvent
+		LimitName string
+	}
+	if err := db.Table("risk_events").
+		Select("risk_events.*, risk_limits.name AS limit_name").
+		Joins("LEFT JOIN risk_limits ON risk_limits.id = risk_events.risk_limit_id").
+		Where("risk_events.user_id = ? AND risk_events.to_status = ? AND risk_events.created_at >= ? AND risk_events.created_at < ?",
+			userID, models.RiskStatusBreach, p.Start, p.End).
+		Order("risk_events.created_at").Scan(&events).Error; err != nil {
+		return nil, err
+	}
+	for _, e := range events {
+		b := Breach{At: e.CreatedAt.In(loc), Limit: e.LimitName, Metric: e.Metric, Threshold: e.Threshold, Value: e.Value, Action: e.Action}
+		if e.ActionError != nil {
+			b.Error = *e.ActionError
+		}
+		d.Breaches = append(d.Breaches, b)
+	}
+
+	var halts []models.KillSwitchEvent
+	if err := db.Where("(user_id = ? OR user_id IS NULL) AND action = ? AND created_at >= ? AND created_at < ?",
+		userID, models.KillSwitchEngage, p.Start, p.End).Order("created_at").Find(&halts).Error; err != nil {
+		return nil, err
+	}
+	for _, h := range halts {
+		d.Halts = append(d.Halts, Halt{At: h.CreatedAt.In(loc), Global: h.UserID == nil, Reason: h.Reason})
+	}
+
+	var snaps []models.PortfolioRisk
+	if err := db.Where("user_id = ? AND date >= ? AND date < ?", userID, p.Start, p.End).
+		Order("date DESC").Limit(1).Find(&snaps).Error; err != nil {
+		return nil, err
+	}
+	if len(snaps) > 0 {
+		d.Portfolio = &snaps[0]
+	}
+	return d, nil
+}
+
+// Subject is the email subject line.
+func (d *Digest) Subject() string {
+	kind := strings.ToUpper(d.Period.Kind[:1]) + d.Period.Kind[1:]
+	return fmt.Sprintf("%s performance digest: %s, net %s", kind, d.Period.Label(), inr(d.Stats.NetPnL))
+}
+
+// HTML renders the digest as an HTML email body.
+func (d *Digest) HTML() (string, error) {
+	var b bytes.Buffer
+	err := htmlDigest.Execute(&b, d)
+	return b.String(), err
+}
+
+// Text renders the plain-text alternative.
+func (d *Digest) Text() (string, error) {
+	var b bytes.Buffer
+	err := textDigest.Execute(&b, d)
+	return b.String(), err
+}
+
+// inr formats v as rupees with Indian digit grouping: -₹12,34,567.89.
+func inr(v float64) string {
+	sign := ""
+	if v < 0 {
+		sign, v = "-", -v
+	}
+	s := strconv.FormatFloat(math.Round(v*100)/100, 'f', 2, 64)
+	whole, frac := s[:len(s)-3], s[len(s)-3:]
+	if len(whole) > 3 {
+		head, tail := whole[:len(whole)-3], whole[len(whole)-3:]
+		var groups []string
+		for len(head) > 2 {
+			groups = append([]string{head[len(head)-2:]}, groups...)
+			head = head[:len(head)-2]
+		}
+		groups = append([]string{head}, groups...)
+		whole = strings.Join(groups, ",") + "," + tail
+	}
+	return sign + "₹" + whole + frac
+}
+
+var funcs = map[string]any{
+	"inr":  inr,
+	"pct":  func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) + "%" },
+	"num":  func(v float64) string { return strconv.FormatFloat(v, 'f', -1, 64) },
+	"time": func(t time.Time) string { return t.Format("2 Jan 15:04") },
+	"loss": func(v float64) bool { return v < 0 },
+	"ratio": func(v *float64) string {
+		if v == nil {
+			return "-"
+		}
+		return strconv.FormatFloat(*v, 'f', 2, 64)
+	},
+	"title": func(s string) string {
+		if s == "" {
+			return s
+		}
+		return strings.ToUpper(s[:1]) + s[1:]
+	},
+	"orDash": func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	},
+	"hasRisk": func(d *Digest) bool { return len(d.Breaches) > 0 || len(d.Halts) > 0 },
+}
+
+var htmlDigest = htmltemplate.Must(htmltemplate.New("digest").Funcs(funcs).Parse(`<!DOCTYPE html>
+<html><body style="margin:0;padding:24px;background:#f4f5f7;font-family:Helvetica,Arial,sans-serif;color:#1f2933">
+<table width="100%" cellpadding="0" cellspacing="0" style="max-width:640px;margin:auto;background:#fff;border-radius:6px">
+<tr><td style="padding:24px">
+<h2 style="margin:0 0 4px">{{title .Period.Kind}} performance digest</h2>
+<div style="color:#616e7c">{{.Period.Label}}{{if .Name}} &middot; {{.Name}}{{end}}</div>
+
+<h3 style="margin:24px 0 8px">P&amp;L</h3>
+{{with .Stats}}{{if .Trades}}
+<div style="font-size:28px;font-weight:bold;color:{{if loss .NetPnL}}#c62828{{else}}#2e7d32{{end}}">{{inr .NetPnL}}</div>
+<table cellpadding="4" style="margin-top:8px;font-size:14px">
+<tr><td>Closed trades</td><td><b>{{.Trades}}</b> ({{.Wins}} won, {{.Losses}} lost)</td></tr>
+<tr><td>Win rate</td><td><b>{{pct .WinRate}}</b></td></tr>
+<tr><td>Profit factor</td><td><b>{{ratio .ProfitFactor}}</b></td></tr>
+<tr><td>Largest win / loss</td><td><b>{{inr .LargestWin}}</b> / <b>{{inr .LargestLoss}}</b></td></tr>
+<tr><td>Fees</td><td><b>{{inr .TotalFees}}</b></td></tr>
+</table>
+{{else}}<p>No trades were closed in this period.</p>{{end}}{{end}}
+
+{{with .Portfolio}}
+<h3 style="margin:24px 0 8px">Portfolio on {{.Date.Format "2 Jan"}}</h3>
+<table cellpadding="4" style="font-size:14px">
+<tr><td>Value</td><td><b>{{inr .TotalValue}}</b></td></tr>
+<tr><td>Day / week / month</td><td><b>{{pct .DailyChange}}</b> / <b>{{pct .WeeklyChange}}</b> / <b>{{pct .MonthlyChange}}</b></td></tr>
+<tr><td>Drawdown (max)</td><td><b>{{pct .CurrentDrawdown}}</b> ({{pct .MaxDrawdown}})</td></tr>
+</table>
+{{end}}
+
+{{if or .Best .Worst}}
+<h3 style="margin:24px 0 8px">Strategies</h3>
+<table cellpadding="6" cellspacing="0" width="100%" style="font-size:14px;border-collapse:collapse">
+<tr style="background:#f4f5f7;text-align:left"><th>Strategy</th><th>Trades</th><th>Win rate</th><th style="text-align:right">Net</th></tr>
+{{range .Best}}<tr><td>{{.Label}}</td><td>{{.Trades}}</td><td>{{pct .WinRate}}</td><td style="text-align:right;color:#2e7d32">{{inr .NetPnL}}</td></tr>
+{{end}}{{range .Worst}}<tr><td>{{.Label}}</td><td>{{.Trades}}</td><td>{{pct .WinRate}}</td><td style="text-align:right;color:#c62828">{{inr .NetPnL}}</td></tr>
+{{end}}</table>
+{{end}}
+
+<h3 style="margin:24px 0 8px">Risk</h3>
+{{if hasRisk .}}
+{{if .Halts}}<p style="color:#c62828"><b>Trading was halted:</b></p><ul>
+{{range .Halts}}<li>{{time .At}} &middot; {{if .Global}}platform kill switch{{else}}your kill switch{{end}}{{if .Reason}}: {{.Reason}}{{end}}</li>
+{{end}}</ul>{{end}}
+{{if .Breaches}}<table cellpadding="6" cellspacing="0" width="100%" style="font-size:14px;border-collapse:collapse">
+<tr style="background:#f4f5f7;text-align:left"><th>When</th><th>Limit</th><th>Value / threshold</th><th>Action</th></tr>
+{{range .Breaches}}<tr><td>{{time .At}}</td><td>{{orDash .Limit}} ({{.Metric}})</td><td>{{num .Value}} / {{num .Threshold}}</td><td>{{orDash .Action}}{{if .Error}} <span style="color:#c62828">failed: {{.Error}}</span>{{end}}</td></tr>
+{{end}}</table>{{end}}
+{{else}}<p>No risk limits were breached.</p>{{end}}
+
+<p style="margin-top:32px;font-size:12px;color:#9aa5b1">You receive this because performance reports are on in your notification settings. Turn them off there to stop these emails.</p>
+</td></tr></table>
+</body></html>
+`))
+
+var textDigest = texttemplate.Must(texttemplate.New("digest").Funcs(funcs).Parse(`{{title .Period.Kind}} performance digest - {{.Period.Label}}
+{{with .Stats}}
+P&L
+{{if .Trades}}Net: {{inr .NetPnL}}
+Closed trades: {{.Trades}} ({{.Wins}} won, {{.Losses}} lost), win rate {{pct .WinRate}}
+Profit factor: {{ratio .ProfitFactor}}
+Largest win / loss: {{inr .LargestWin}} / {{inr .LargestLoss}}
+Fees: {{inr .TotalFees}}
+{{else}}No trades were closed in this period.
+{{end}}{{end}}{{with .Portfolio}}
+Portfolio on {{.Date.Format "2 Jan"}}: {{inr .TotalValue}}
+Change day / week / month: {{pct .DailyChange}} / {{pct .WeeklyChange}} / {{pct .MonthlyChange}}
+Drawdown: {{pct .CurrentDrawdown}} (max {{pct .MaxDrawdown}})
+{{end}}{{if or .Best .Worst}}
+Strategies
+{{range .Best}}  {{.Label}}: {{inr .NetPnL}} over {{.Trades}} trades
+{{end}}{{range .Worst}}  {{.Label}}: {{inr .NetPnL}} over {{.Trades}} trades
+{{end}}{{end}}
+Risk
+{{if hasRisk .}}{{range .Halts}}  {{time .At}} trading halted by {{if .Global}}the platform kill switch{{else}}your kill switch{{end}}{{if .Reason}}: {{.Reason}}{{end}}
+{{end}}{{range .Breaches}}  {{time .At}} {{orDash .Limit}} ({{.Metric}}) breached: {{num .Value}} against {{num .Threshold}}{{if .Action}}, action {{.Action}}{{end}}{{if .Error}} failed: {{.Error}}{{end}}
+{{end}}{{else}}No risk limits were breached.
+{{end}}
+You receive this because performance reports are on in your notification settings.
+`))
@@ -0,0 +1,588 @@
+// Package execution works large orders with TWAP, VWAP and iceberg
+// algorithms, slicing a models.AlgoOrder into child Orders over time.
+package execution
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go-backend/broker"
+	"go-backend/marketfeed"
+	"go-backend/models"
+	"gorm.io/gorm"
+)
+
+// Defaults for algo orders.
+const (
+	DefaultInterval   = 60 // seconds between TWAP and VWAP slices
+	DefaultDuration   = 30 * time.Minute
+	DefaultVolumeDays = 20 // history behind VWAP volume curves
+	DefaultTick       = time.Second
+)
+
+var ErrNotRunning = errors.New("algo order is not running")
+
+// Engine sends the slices of running algo orders. State lives in the
+// AlgoOrder rows; the engine keeps what it derives from them (VWAP curves,
+// traded volume) in memory and rebuilds it from them and the stored bars on
+// Restore.
+type Engine struct {
+	DB         *gorm.DB
+	Brokers    *broker.Registry
+	Feed       *marketfeed.Hub
+	VolumeDays int
+	Tick       time.Duration
+
+	mu      sync.Mutex
+	running map[uuid.UUID]*run
+	own     map[uuid.UUID]bool // children the engine itself is cancelling
+}
+
+type run struct {
+	algo   *models.AlgoOrder
+	curve  []float64 // VWAP: cumulative share of the quantity due after each slice
+	volume float64   // traded since the start, for participation caps
+}
+
+// NewEngine creates the engine and registers it with reg so that a child
+// cancelled from outside, by a user or the kill switch, stops its schedule.
+func NewEngine(db *gorm.DB, reg *broker.Registry, feed *marketfeed.Hub) *Engine {
+	e := &Engine{DB: db, Brokers: reg, Feed: feed, VolumeDays: DefaultVolumeDays, Tick: DefaultTick,
+		running: map[uuid.UUID]*run{}, own: map[uuid.UUID]bool{}}
+	reg.OnCancel(e.OnCancel)
+	return e
+}
+
+// Start validates a, fills defaults, records the arrival price and begins
+// working it.
+func (e *Engine) Start(a *models.AlgoOrder) error {
+	a.Algo = strings.ToLower(strings.TrimSpace(a.Algo))
+	a.Side = strings.ToUpper(a.Side)
+	switch {
+	case a.Algo != models.AlgoTWAP && a.Algo != models.AlgoVWAP && a.Algo != models.AlgoIceberg:
+		return fmt.Errorf("algo must be %s, %s or %s", models.AlgoTWAP, models.AlgoVWAP, models.AlgoIceberg)
+	case a.Instrument == "":
+		return fmt.Errorf("instrument is required")
+	case a.Side != "BUY" && a.Side != "SELL":
+		return fmt.Errorf("side must be BUY or SELL")
+	case a.Quantity <= 0:
+		return fmt.Errorf("quantity must be positive")
+	case a.MaxParticipation < 0 || a.MaxParticipation > 100:
+		return fmt.Errorf("maxParticipation must be between 0 and 100")
+	case a.Algo == models.AlgoIceberg && (a.VisibleQty <= 0 || a.VisibleQty > a.Quantity):
+		return fmt.Errorf("an iceberg needs a visible quantity between 1 and the order quantity")
+	}
+
+	now := time.Now()
+	if a.StartAt.IsZero() || a.StartAt.Before(now) {
+		a.StartAt = now
+	}
+	if a.Algo != models.AlgoIceberg {
+		if a.Interval <= 0 {
+			a.Interval = DefaultInterval
+		}
+		if a.EndAt.IsZero() {
+			a.EndAt = a.StartAt.Add(DefaultDuration)
+		}
+		if !a.EndAt.After(a.StartAt) {
+			return fmt.Errorf("endAt must be after startAt")
+		}
+	}
+	if a.ID == uuid.Nil {
+		a.ID = uuid.New()
+	}
+	a.Status = models.AlgoStatusRunning
+	if e.Feed != nil {
+		if p, ok := e.Feed.LastPrice(a.Instrument); ok {
+			a.ArrivalPrice = p
+		}
+	}
+	if a.ArrivalPrice == 0 {
+		a.ArrivalPrice = a.LimitPrice
+	}
+
+	r, err := e.prepare(a)
+	if err != nil {
+		return err
+	}
+	if err := e.DB.Omit("Children").Create(a).Error; err != nil {
+		return err
+	}
+	e.mu.Lock()
+	e.running[a.ID] = r
+	e.mu.Unlock()
+	return nil
+}
+
+func (e *Engine) prepare(a *models.AlgoOrder) (*run, error) {
+	r := &run{algo: a}
+	if a.Algo == models.AlgoVWAP {
+		curve, err := e.volumeCurve(a)
+		if err != nil {
+			return nil, err
+		}
+		r.curve = curve
+	}
+	if a.MaxParticipation > 0 {
+		volume, err := e.tradedSince(a)
+		if err != nil {
+			return nil, err
+		}
+		r.volume = volume
+	}
+	return r, nil
+}
+
+// tradedSince is the volume stored for a's instrument since it started, so
+// a run restored after a restart keeps its participation cap. Each
+// timeframe covers the same trading, so the largest total is taken rather
+// than their sum.
+func (e *Engine) tradedSince(a *models.AlgoOrder) (float64, error) {
+	var totals []struct {
+		Timeframe string
+		Volume    float64
+	}
+	if err := e.DB.Model(&models.MarketData{}).Select("timeframe, SUM(volume) AS volume").
+		Where("UPPER(symbol) = ? AND timestamp >= ?", strings.ToUpper(a.Instrument), a.StartAt).
+		Group("timeframe").Scan(&totals).Error; err != nil {
+		return 0, fmt.Errorf("load traded volume: %w", err)
+	}
+	volume := 0.0
+	for _, t := range totals {
+		volume = math.Max(volume, t.Volume)
+	}
+	return volume, nil
+}
+
+// slices is the number of TWAP or VWAP slices in the window.
+func slices(a *models.AlgoOrder) int {
+	n := int(math.Ceil(a.EndAt.Sub(a.StartAt).Seconds() / float64(a.Interval)))
+	if n < 1 {
+		n = 1
+	}
+	return n
+}
+
+// volumeCurve spreads a VWAP order over its slices in proportion to the
+// volume the instrument traded in the same time-of-day buckets over the
+// last VolumeDays days. Without intraday history the curve is flat (TWAP).
+func (e *Engine) volumeCurve(a *models.AlgoOrder) ([]float64, error) {
+	n := slices(a)
+	weights := make([]float64, n)
+	window := a.EndAt.Sub(a.StartAt)
+	if window < 24*time.Hour {
+		var bars []struct {
+			Timestamp time.Time
+			Volume    float64
+		}
+		from := a.StartAt.AddDate(0, 0, -e.VolumeDays)
+		if err := e.DB.Model(&models.MarketData{}).Select("timestamp, volume").
+			Where("UPPER(symbol) = ? AND timestamp >= ? AND timestamp < ?", strings.ToUpper(a.Instrument), from, a.StartAt).
+			Scan(&bars).Error; err != nil {
+			return nil, fmt.Errorf("load volume history: %w", err)
+		}
+		startOfDay := timeOfDay(a.StartAt)
+		for _, b := range bars {
+			offset := timeOfDay(b.Timestamp) - startOfDay
+			if offset < 0 {
+				offset += 24 * time.Hour
+			}
+			if offset >= window {
+				continue
+			}
+			weights[int(offset/(time.Duration(a.Interval)*time.Second))%n] += b.Volume
+		}
+	}
+
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	curve := make([]float64, n)
+	cum := 0.0
+	for i, w := range weights {
+		if total > 0 {
+			cum += w / total
+		} else {
+			cum = float64(i+1) / float64(n)
+		}
+		curve[i] = cum
+	}
+	curve[n-1] = 1
+	return curve, nil
+}
+
+func timeOfDay(t time.Time) time.Duration {
+	t = t.In(time.Local)
+	return time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute + time.Duration(t.Second())*time.Second
+}
+
+// due is how much more should have been sent by now.
+func (r *run) due(now time.Time, working int) int {
+	a := r.algo
+	remaining := a.Quantity - a.SentQty
+	var qty int
+	switch a.Algo {
+	case models.AlgoIceberg:
+		if working > 0 {
+			return 0
+		}
+		// a slice that expired part-filled is sent again
+		qty = a.VisibleQty
+		remaining = a.Quantity - a.FilledQty
+	default:
+		n := slices(a)
+		k := int(now.Sub(a.StartAt)/(time.Duration(a.Interval)*time.Second)) + 1
+		if k > n {
+			k = n
+		}
+		share := float64(k) / float64(n)
+		if r.curve != nil {
+			share = r.curve[k-1]
+		}
+		qty = int(math.Floor(float64(a.Quantity)*share+1e-9)) - a.SentQty
+	}
+	if qty > remaining {
+		qty = remaining
+	}
+	if a.MaxParticipation > 0 {
+		allowed := int(math.Floor(r.volume*a.MaxParticipation/100)) - a.SentQty
+		if a.Algo == models.AlgoIceberg {
+			allowed = int(math.Floor(r.volume*a.MaxParticipation/100)) - a.FilledQty
+		}
+		if qty > allowed {
+			qty = allowed
+		}
+	}
+	return qty
+}
+
+// Run sends due slices every Tick and counts traded volume for
+// participation caps until ctx ends.
+func (e *Engine) Run(ctx context.Context) {
+	updates, stop := e.Feed.Subscribe("", "")
+	defer stop()
+	ticker := time.NewTicker(e.Tick)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case u := <-updates:
+			e.mu.Lock()
+			for _, r := range e.running {
+				if strings.EqualFold(r.algo.Instrument, u.Symbol) && !u.Bar.Time.Before(r.algo.StartAt) {
+					r.volume += u.Bar.Volume
+				}
+			}
+			e.mu.Unlock()
+		case now := <-ticker.C:
+			e.step(ctx, now)
+		}
+	}
+}
+
+func (e *Engine) step(ctx context.Context, now time.Time) {
+	e.mu.Lock()
+	runs := make([]*run, 0, len(e.running))
+	for _, r := range e.running {
+		runs = append(runs, r)
+	}
+	e.mu.Unlock()
+
+	for _, r := range runs {
+		if err := e.advance(ctx, r, now); err != nil {
+			log.Printf("execution: algo order %s: %v", r.algo.ID, err)
+		}
+	}
+}
+
+// advance sends r's next slice if one is due and ends the schedule when its
+// window is over.
+func (e *Engine) advance(ctx context.Context, r *run, now time.Time) error {
+	e.mu.Lock()
+	a := *r.algo
+	e.mu.Unlock()
+	if a.Status != models.AlgoStatusRunning || now.Before(a.StartAt) {
+		return nil
+	}
+
+	var working []models.Order
+	if err := e.DB.Where("algo_order_id = ? AND status IN ?", a.ID,
+		[]string{models.OrderStatusOpen, models.OrderStatusPartiallyFilled}).Find(&working).Error; err != nil {
+		return err
+	}
+	if a.Algo != models.AlgoIceberg && !now.Before(a.EndAt) && (a.SentQty >= a.Quantity && len(working) == 0 ||
+		now.After(a.EndAt.Add(time.Duration(a.Interval)*time.Second))) {
+		// one interval of grace for the last slice, then what is left expires
+		e.cancelChildren(ctx, working)
+		return e.finish(a.ID, models.AlgoStatusExpired, "window ended before the order filled")
+	}
+
+	e.mu.Lock()
+	qty := r.due(now, len(working))
+	e.mu.Unlock()
+	if qty <= 0 {
+		return nil
+	}
+	return e.send(ctx, r, qty)
+}
+
+func (e *Engine) send(ctx context.Context, r *run, qty int) error {
+	e.mu.Lock()
+	a := r.algo
+	child := models.Order{
+		UserID:       a.UserID,
+		Instrument:   a.Instrument,
+		Exchange:     a.Exchange,
+		Quantity:     qty,
+		Price:        a.LimitPrice,
+		OrderType:    "MARKET",
+		Side:         a.Side,
+		StrategyID:   a.StrategyID,
+		IsExitOrder:  a.IsExitOrder,
+		DeploymentID: a.DeploymentID,
+		BrokerID:     a.BrokerID,
+		IsPaper:      a.IsPaper,
+		AlgoOrderID:  &a.ID,
+	}
+	if a.LimitPrice > 0 {
+		child.OrderType = "LIMIT"
+	}
+	// counted as sent before Submit: a paper fill arrives before it returns
+	a.SentQty += qty
+	sent := a.SentQty
+	e.mu.Unlock()
+
+	if err := e.DB.Model(&models.AlgoOrder{}).Where("id = ?", a.ID).Update("sent_qty", sent).Error; err != nil {
+		return err
+	}
+	if err := broker.Submit(ctx, e.DB, e.Brokers, &child); err != nil {
+		e.mu.Lock()
+		a.SentQty -= qty
+		e.mu.Unlock()
+		e.DB.Model(&models.AlgoOrder{}).Where("id = ?", a.ID).Update("sent_qty", sent-qty)
+		e.cancelAll(ctx, a.ID)
+		return e.finish(a.ID, models.AlgoStatusFailed, "slice refused: "+err.Error())
+	}
+	return nil
+}
+
+// OnFill is a FillListener that books child fills on their algo order.
+func (e *Engine) OnFill(order *models.Order, tx *models.Transaction) {
+	if order.AlgoOrderID == nil {
+		return
+	}
+	e.mu.Lock()
+	r, ok := e.running[*order.AlgoOrderID]
+	var a *models.AlgoOrder
+	if ok {
+		a = r.algo
+	} else {
+		a = &models.AlgoOrder{}
+		if err := e.DB.First(a, "id = ?", *order.AlgoOrderID).Error; err != nil {
+			e.mu.Unlock()
+			log.Printf("execution: load algo order %s: %v", *order.AlgoOrderID, err)
+			return
+		}
+	}
+	filled := a.FilledQty + tx.Quantity
+	a.AvgFillPrice = (a.AvgFillPrice*float64(a.FilledQty) + tx.FillPrice*float64(tx.Quantity)) / float64(filled)
+	a.FilledQty = filled
+	if a.ArrivalPrice == 0 {
+		a.ArrivalPrice = tx.FillPrice
+	}
+	a.SlippageBps = Slippage(a.Side, a.ArrivalPrice, a.AvgFillPrice)
+	done := a.Status == models.AlgoStatusRunning && a.FilledQty >= a.Quantity
+	updates := map[string]interface{}{
+		"filled_qty":     a.FilledQty,
+		"avg_fill_price": a.AvgFillPrice,
+		"arrival_price":  a.ArrivalPrice,
+		"slippage_bps":   a.SlippageBps,
+	}
+	e.mu.Unlock()
+
+	if err := e.DB.Model(&models.AlgoOrder{}).Where("id = ?", a.ID).Updates(updates).Error; err != nil {
+		log.Printf("execution: book fill on algo order %s: %v", a.ID, err)
+	}
+	if done {
+		e.finish(a.ID, models.AlgoStatusCompleted, "")
+	}
+}
+
+// Slippage is avg against arrival in basis points, positive when worse for
+// side.
+func Slippage(side string, arrival, avg float64) float64 {
+	if arrival <= 0 || avg <= 0 {
+		return 0
+	}
+	bps := (avg - arrival) / arrival * 10000
+	if strings.EqualFold(side, "SELL") {
+		bps = -bps
+	}
+	return math.Round(bps*100) / 100
+}
+
+// OnCancel stops the schedule of a child cancelled by anyone but the
+// engine.
+func (e *Engine) OnCancel(order *models.Order) {
+	if order.AlgoOrderID == nil {
+		return
+	}
+	e.mu.Lock()
+	own := e.own[order.ID]
+	delete(e.own, order.ID)
+	_, running := e.running[*order.AlgoOrderID]
+	e.mu.Unlock()
+	if own || !running {
+		return
+	}
+	e.cancelAll(context.Background(), *order.AlgoOrderID)
+	e.finish(*order.AlgoOrderID, models.AlgoStatusCancelled, "slice "+order.OrderID+" was cancelled")
+}
+
+// Cancel stops a running algo order and cancels its working slices.
+func (e *Engine) Cancel(ctx context.Context, id uuid.UUID, reason string) error {
+	e.mu.Lock()
+	_, running := e.running[id]
+	e.mu.Unlock()
+	if !running {
+		return ErrNotRunning
+	}
+	if reason == "" {
+		reason = "cancelled by user"
+	}
+	// stop first so no new slice goes out while the working ones are cancelled
+	if err := e.finish(id, models.AlgoStatusCancelled, reason); err != nil {
+		return err
+	}
+	return e.cancelAll(ctx, id)
+}
+
+func (e *Engine) cancelAll(ctx context.Context, id uuid.UUID) error {
+	var working []models.Order
+	if err := e.DB.Where("algo_order_id = ? AND status IN ?", id,
+		[]string{models.OrderStatusOpen, models.OrderStatusPartiallyFilled}).Find(&working).Error; err != nil {
+		return err
+	}
+	return e.cancelChildren(ctx, working)
+}
+
+func (e *Engine) cancelChildren(ctx context.Context, working []models.Order) error {
+	var errs []string
+	for i := range working {
+		e.mu.Lock()
+		e.own[working[i].ID] = true
+		e.mu.Unlock()
+		if err := broker.Cancel(ctx, e.DB, e.Brokers, &working[i]); err != nil {
+			errs = append(errs, fmt.Sprintf("cancel %s: %v", working[i].OrderID, err))
+			e.mu.Lock()
+			delete(e.own, working[i].ID)
+			e.mu.Unlock()
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// finish moves a running algo order to a final status; later calls are
+// no-ops.
+func (e *Engine) finish(id uuid.UUID, status, reason string) error {
+	e.mu.Lock()
+	r, ok := e.running[id]
+	if !ok {
+		e.mu.Unlock()
+		return nil
+	}
+	if r.algo.FilledQty >= r.algo.Quantity {
+		status, reason = models.AlgoStatusCompleted, ""
+	}
+	r.algo.Status, r.algo.Reason = status, reason
+	delete(e.running, id)
+	e.mu.Unlock()
+	return e.DB.Model(&models.AlgoOrder{}).Where("id = ?", id).
+		Updates(map[string]interface{}{"status": status, "reason": reason}).Error
+}
+
+// Restore resumes the algo orders that were running before a restart.
+func (e *Engine) Restore() error {
+	var algos []models.AlgoOrder
+	if err := e.DB.Where("status = ?", models.AlgoStatusRunning).Find(&algos).Error; err != nil {
+		return err
+	}
+	for i := range algos {
+		r, err := e.prepare(&algos[i])
+		if err != nil {
+			return err
+		}
+		e.mu.Lock()
+		e.running[algos[i].ID] = r
+		e.mu.Unlock()
+	}
+	return nil
+}
+
+// Policy is a deployment's execution setting, read from the "execution" key
+// of its Metadata. Orders of at least MinQuantity are worked by Algo.
+type Policy struct {
+	Algo             string  `json:"algo"`
+	MinQuantity      int     `json:"minQuantity"`
+	DurationMinutes  int     `json:"durationMinutes"`
+	IntervalSeconds  int     `json:"intervalSeconds"`
+	VisibleQuantity  int     `json:"visibleQuantity"`
+	MaxParticipation float64 `json:"maxParticipation"`
+}
+
+// PolicyOf reads d's execution policy; ok is false when it has none.
+func PolicyOf(d *models.DeployedStrategy) (Policy, bool) {
+	var meta struct {
+		Execution *Policy `json:"execution"`
+	}
+	if len(d.Metadata) == 0 || json.Unmarshal(d.Metadata, &meta) != nil || meta.Execution == nil || meta.Execution.Algo == "" {
+		return Policy{}, false
+	}
+	return *meta.Execution, true
+}
+
+// Slice works a deployment's market order with the deployment's execution
+// policy. It reports false, leaving the order alone, when the deployment
+// has no policy or the order is below its MinQuantity.
+func (e *Engine) Slice(ctx context.Context, d *models.DeployedStrategy, o *models.Order) (bool, error) {
+	p, ok := PolicyOf(d)
+	if !ok || o.Quantity < p.MinQuantity || !strings.EqualFold(o.OrderType, "MARKET") {
+		return false, nil
+	}
+	a := &models.AlgoOrder{
+		UserID:           o.UserID,
+		Algo:             p.Algo,
+		Instrument:       o.Instrument,
+		Exchange:         o.Exchange,
+		Side:             o.Side,
+		Quantity:         o.Quantity,
+		Interval:         p.IntervalSeconds,
+		VisibleQty:       p.VisibleQuantity,
+		MaxParticipation: p.MaxParticipation,
+		StrategyID:       o.StrategyID,
+		DeploymentID:     o.DeploymentID,
+		BrokerID:         o.BrokerID,
+		IsPaper:          o.IsPaper,
+		IsExitOrder:      o.IsExitOrder,
+	}
+	if p.DurationMinutes > 0 {
+		a.EndAt = time.Now().Add(time.Duration(p.DurationMinutes) * time.Minute)
+	}
+	if err := e.Start(a); err != nil {
+		return false, err
+	}
+	return true, nil
+}
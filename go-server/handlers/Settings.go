@@ -51,6 +51,14 @@ func (h *SettingsHandler) StoreNotiPref(w http.ResponseWriter, r *http.Request)
         return
     }
 
+    // Digest frequency is optional; an empty value keeps the current one
+    switch input.ReportFrequency {
+    case "", models.ReportDaily, models.ReportWeekly, models.ReportMonthly:
+    default:
+        http.Error(w, "reportFrequency must be daily, weekly or monthly", http.StatusBadRequest)
+        return
+    }
+
     // Lookup user to confirm existence (optional)
     var user models.User
     if err := h.DB.First(&user, "id = ?", userID).Error; err != nil {
@@ -71,6 +79,7 @@ func (h *SettingsHandler) StoreNotiPref(w http.ResponseWriter, r *http.Request)
             TradingAlerts:      input.TradingAlerts,
             MarketUpdates:      input.MarketUpdates,
             PerformanceReports: input.PerformanceReports,
+            ReportFrequency:    input.ReportFrequency,
             CreatedAt:          time.Now(),
             UpdatedAt:          time.Now(),
         }
@@ -84,6 +93,9 @@ func (h *SettingsHandler) StoreNotiPref(w http.ResponseWriter, r *http.Request)
         prefs.TradingAlerts = input.TradingAlerts
         prefs.MarketUpdates = input.MarketUpdates
         prefs.PerformanceReports = input.PerformanceReports
+        if input.ReportFrequency != "" {
+            prefs.ReportFrequency = input.ReportFrequency
+        }
         prefs.UpdatedAt = time.Now()
 
         if err := h.DB.Save(&prefs).Error; err != nil {
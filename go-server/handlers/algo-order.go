@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/sessions"
+	"go-backend/execution"
+	"go-backend/models"
+	"gorm.io/gorm"
+)
+
+type AlgoOrderHandler struct {
+	DB     *gorm.DB
+	Store  sessions.Store
+	Engine *execution.Engine
+}
+
+// GET /algo-orders - the user's algo orders, newest first
+func (h *AlgoOrderHandler) GetAlgoOrders(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+
+	var algos []models.AlgoOrder
+	if err := h.DB.Where("user_id = ?", userID).Order("created_at DESC").Find(&algos).Error; err != nil {
+		http.Error(w, "Failed to fetch algo orders", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(algos)
+}
+
+// SliceReport is one child order's execution against the arrival price.
+type SliceReport struct {
+	OrderID     string    `json:"orderId"`
+	Status      string    `json:"status"`
+	Quantity    int       `json:"quantity"`
+	FilledQty   int       `json:"filledQty"`
+	AvgPrice    float64   `json:"avgPrice"`
+	SlippageBps float64   `json:"slippageBps"`
+	PlacedAt    time.Time `json:"placedAt"`
+}
+
+type AlgoOrderResponse struct {
+	models.AlgoOrder
+	Slices []SliceReport `json:"slices"`
+}
+
+// GET /algo-orders/{id} - one algo order with each slice's fills and
+// slippage against the arrival price
+func (h *AlgoOrderHandler) GetAlgoOrder(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+	a, ok := h.algoFromPath(w, r, userID)
+	if !ok {
+		return
+	}
+
+	var fills []struct {
+		OrderID  uuid.UUID
+		Quantity int
+		Notional float64
+	}
+	if err := h.DB.Model(&models.Transaction{}).
+		Select("order_id, SUM(quantity) AS quantity, SUM(quantity * fill_price) AS notional").
+		Where("order_id IN (?)", h.DB.Model(&models.Order{}).Select("id").Where("algo_order_id = ?", a.ID)).
+		Group("order_id").Scan(&fills).Error; err != nil {
+		http.Error(w, "Failed to fetch fills", http.StatusInternalServerError)
+		return
+	}
+	avg := map[uuid.UUID]float64{}
+	for _, f := range fills {
+		if f.Quantity > 0 {
+			avg[f.OrderID] = f.Notional / float64(f.Quantity)
+		}
+	}
+
+	resp := AlgoOrderResponse{AlgoOrder: *a, Slices: []SliceReport{}}
+	for _, c := range a.Children {
+		resp.Slices = append(resp.Slices, SliceReport{
+			OrderID:     c.OrderID,
+			Status:      c.Status,
+			Quantity:    c.Quantity,
+			FilledQty:   c.FilledQty,
+			AvgPrice:    avg[c.ID],
+			SlippageBps: execution.Slippage(a.Side, a.ArrivalPrice, avg[c.ID]),
+			PlacedAt:    c.PlacedAt,
+		})
+	}
+	resp.Children = nil
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *AlgoOrderHandler) algoFromPath(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (*models.AlgoOrder, bool) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/algo-orders/"), "/"), "/")
+	id, err := uuid.Parse(parts[0])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return nil, false
+	}
+	var a models.AlgoOrder
+	if err := h.DB.Preload("Children", func(db *gorm.DB) *gorm.DB { return db.Order("placed_at") }).
+		First(&a, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.NotFound(w, r)
+		} else {
+			http.Error(w, "Failed to fetch algo order", http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+	return &a, true
+}
+
+type AlgoOrderRequest struct {
+	Algo             string    `json:"algo"`
+	Instrument       string    `json:"instrument"`
+	Exchange         string    `json:"exchange"`
+	Side             string    `json:"side"`
+	Quantity         int       `json:"quantity"`
+	LimitPrice       float64   `json:"limitPrice"`
+	StartAt          time.Time `json:"startAt"`
+	EndAt            time.Time `json:"endAt"`
+	IntervalSeconds  int       `json:"intervalSeconds"`
+	VisibleQuantity  int       `json:"visibleQuantity"`
+	MaxParticipation float64   `json:"maxParticipation"`
+	StrategyID       uuid.UUID `json:"strategyId"`
+	BrokerID         *uint     `json:"brokerId,omitempty"` // nil places paper orders
+	IsExitOrder      bool      `json:"isExitOrder"`
+}
+
+// POST /algo-orders - start working an order with TWAP, VWAP or iceberg
+func (h *AlgoOrderHandler) CreateAlgoOrder(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+	var req AlgoOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	a := models.AlgoOrder{
+		UserID:           userID,
+		Algo:             req.Algo,
+		Instrument:       req.Instrument,
+		Exchange:         req.Exchange,
+		Side:             req.Side,
+		Quantity:         req.Quantity,
+		LimitPrice:       req.LimitPrice,
+		StartAt:          req.StartAt,
+		EndAt:            req.EndAt,
+		Interval:         req.IntervalSeconds,
+		VisibleQty:       req.VisibleQuantity,
+		MaxParticipation: req.MaxParticipation,
+		StrategyID:       req.StrategyID,
+		BrokerID:         req.BrokerID,
+		IsPaper:          req.BrokerID == nil,
+		IsExitOrder:      req.IsExitOrder,
+	}
+	if err := h.Engine.Start(&a); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(a)
+}
+
+// POST /algo-orders/{id}/cancel - stop the schedule and cancel its working
+// slices
+func (h *AlgoOrderHandler) CancelAlgoOrder(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+	a, ok := h.algoFromPath(w, r, userID)
+	if !ok {
+		return
+	}
+	if err := h.Engine.Cancel(r.Context(), a.ID, ""); err != nil {
+		if errors.Is(err, execution.ErrNotRunning) {
+			http.Error(w, "Algo order is already "+a.Status, http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if a, ok = h.algoFromPath(w, r, userID); !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(a)
+}
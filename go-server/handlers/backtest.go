@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/sessions"
+	"go-backend/backtest"
+	"go-backend/charges"
+	"go-backend/marketfeed"
+	"go-backend/models"
+	"go-backend/script"
+	"go-backend/sizing"
+	"gorm.io/gorm"
+)
+
+type BacktestHandler struct {
+	DB      *gorm.DB
+	Store   sessions.Store
+	Sizing  *sizing.Service
+	Charges *charges.Service
+}
+
+type BacktestRequest struct {
+	StrategyID        uuid.UUID `json:"strategyId"`
+	StrategyVersion   int       `json:"strategyVersion"` // 0 runs the latest version
+	StartDate         time.Time `json:"startDate"`
+	EndDate           time.Time `json:"endDate"`
+	InitialCapital    float64   `json:"initialCapital"`
+	CommissionPercent float64   `json:"commissionPercent"`
+	SlippagePercent   float64   `json:"slippagePercent"`
+	// Product picks the charges segment (CNC, MIS or NRML). Without a
+	// commission the user's charge plan prices each fill.
+	Product string `json:"product,omitempty"`
+	// PriceAdjustment is "adjusted" (the default) to run on bars
+	// back-adjusted for corporate actions, or "raw" for prices as traded.
+	PriceAdjustment string `json:"priceAdjustment,omitempty"`
+}
+
+// POST /backtests - run a pinned strategy version over stored market data
+func (h *BacktestHandler) CreateBacktest(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+
+	var req BacktestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.InitialCapital <= 0 {
+		http.Error(w, "initialCapital must be positive", http.StatusBadRequest)
+		return
+	}
+
+	version, err := pinStrategyVersion(h.DB, req.StrategyID, userID, req.StrategyVersion)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.Error(w, "Strategy or strategy version not found", http.StatusNotFound)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	prog, err := script.Compile(version.Code)
+	if err != nil {
+		writeScriptErrors(w, err.(script.ErrorList))
+		return
+	}
+
+	load := marketfeed.AdjustedHistory
+	switch strings.ToLower(req.PriceAdjustment) {
+	case "", "adjusted":
+		req.PriceAdjustment = "adjusted"
+	case "raw":
+		req.PriceAdjustment = "raw"
+		load = marketfeed.History
+	default:
+		http.Error(w, "priceAdjustment must be adjusted or raw", http.StatusBadRequest)
+		return
+	}
+	bars, err := load(h.DB, version.Symbol, version.Timeframe, req.StartDate, req.EndDate)
+	if err != nil {
+		http.Error(w, "Failed to load market data", http.StatusInternalServerError)
+		return
+	}
+	if len(bars) == 0 {
+		http.Error(w, "No market data for "+version.Symbol+" "+version.Timeframe+" in range", http.StatusUnprocessableEntity)
+		return
+	}
+	if len(bars) > backtest.MaxBars {
+		http.Error(w, fmt.Sprintf("The range has %d bars; a backtest covers at most %d, narrow it", len(bars), backtest.MaxBars),
+			http.StatusUnprocessableEntity)
+		return
+	}
+
+	record := models.Backtest{
+		ID:                uuid.New(),
+		UserID:            userID,
+		StrategyID:        version.StrategyID,
+		StrategyVersion:   version.Version,
+		Symbol:            version.Symbol,
+		Timeframe:         version.Timeframe,
+		StartDate:         bars[0].Time,
+		EndDate:           bars[len(bars)-1].Time,
+		InitialCapital:    req.InitialCapital,
+		CommissionPercent: req.CommissionPercent,
+		SlippagePercent:   req.SlippagePercent,
+		PriceAdjustment:   req.PriceAdjustment,
+		Status:            "completed",
+	}
+
+	cfg := backtest.Config{
+		InitialCapital:    req.InitialCapital,
+		CommissionPercent: req.CommissionPercent,
+		SlippagePercent:   req.SlippagePercent,
+		LotSize:           sizing.LotSize("", version.Symbol),
+	}
+	if req.CommissionPercent == 0 && h.Charges != nil {
+		plan := h.Charges.PlanFor(userID, nil)
+		cfg.Charges = &plan
+		cfg.Segment = charges.SegmentOf("", version.Symbol, req.Product)
+	}
+	if h.Sizing != nil {
+		if rule, err := h.Sizing.Rule(userID, version.StrategyID); err == nil {
+			params := sizing.FromRule(rule)
+			cfg.Sizing = &params
+		}
+	}
+
+	result, err := backtest.Run(r.Context(), prog, bars, cfg)
+	if err != nil {
+		msg := err.Error()
+		record.Status = "failed"
+		record.ErrorMessage = &msg
+		record.FinalCapital = req.InitialCapital
+	} else {
+		record.FinalCapital = result.FinalCapital
+		record.TotalPnl = result.TotalPnl
+		record.PercentReturn = result.PercentReturn
+		record.SharpeRatio = &result.SharpeRatio
+		record.MaxDrawdown = &result.MaxDrawdown
+		record.WinRate = &result.WinRate
+		record.ProfitFactor = &result.ProfitFactor
+		record.Trades = len(result.Trades)
+		record.Equity, _ = json.Marshal(result.Equity)
+		record.TradesData, _ = json.Marshal(result.Trades)
+		if result.Errors > 0 {
+			msg := fmt.Sprintf("%d bars skipped for script errors", result.Errors)
+			record.ErrorMessage = &msg
+		}
+	}
+
+	if err := h.DB.Create(&record).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(record)
+}
+
+// GET /backtests - list the user's backtests, optionally for one strategy
+func (h *BacktestHandler) GetBacktests(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+
+	q := h.DB.Where("user_id = ?", userID)
+	if s := r.URL.Query().Get("strategyId"); s != "" {
+		strategyID, err := uuid.Parse(s)
+		if err != nil {
+			http.Error(w, "Invalid strategyId", http.StatusBadRequest)
+			return
+		}
+		q = q.Where("strategy_id = ?", strategyID)
+	}
+
+	var backtests []models.Backtest
+	if err := q.Order("created_at DESC").Find(&backtests).Error; err != nil {
+		http.Error(w, "Failed to fetch backtests", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(backtests)
+}
+
+// GET /backtests/{id} - get a single backtest
+func (h *BacktestHandler) GetBacktest(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+
+	idStr := strings.TrimPrefix(r.URL.Path, "/backtests/")
+	id, err := uuid.Parse(idStr)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+
+	var record models.Backtest
+	if err := h.DB.First(&record, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.NotFound(w, r)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(record)
+}
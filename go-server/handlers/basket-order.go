@@ -0,0 +1,211 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/sessions"
+	"go-backend/broker"
+	"go-backend/marketfeed"
+	"go-backend/models"
+	"gorm.io/gorm"
+)
+
+type BasketOrderHandler struct {
+	DB      *gorm.DB
+	Store   sessions.Store
+	Brokers *broker.Registry
+	Feed    *marketfeed.Hub
+}
+
+// basketFromPath loads the user's basket named by /baskets/{id}[/...].
+func (h *BasketOrderHandler) basketFromPath(w http.ResponseWriter, r *http.Request, userID uuid.UUID) (*models.BasketOrder, bool) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/baskets/"), "/"), "/")
+	id, err := uuid.Parse(parts[0])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return nil, false
+	}
+	var b models.BasketOrder
+	if err := h.DB.Preload("Legs", func(db *gorm.DB) *gorm.DB { return db.Order("placed_at") }).
+		First(&b, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.NotFound(w, r)
+		} else {
+			http.Error(w, "Failed to fetch basket", http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+	return &b, true
+}
+
+// GET /baskets - the user's multi-leg orders with their legs, newest first
+func (h *BasketOrderHandler) GetBaskets(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+
+	var baskets []models.BasketOrder
+	if err := h.DB.Preload("Legs", func(db *gorm.DB) *gorm.DB { return db.Order("placed_at") }).
+		Where("user_id = ?", userID).Order("created_at DESC").Find(&baskets).Error; err != nil {
+		http.Error(w, "Failed to fetch baskets", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(baskets)
+}
+
+type BasketResponse struct {
+	models.BasketOrder
+	PnL *broker.BasketPnL `json:"pnl"`
+}
+
+// GET /baskets/{id} - one basket with leg statuses and combined P&L
+func (h *BasketOrderHandler) GetBasket(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+	b, ok := h.basketFromPath(w, r, userID)
+	if !ok {
+		return
+	}
+	pnl, err := broker.ComputeBasketPnL(h.DB, h.Feed, b.ID)
+	if err != nil {
+		http.Error(w, "Failed to compute basket P&L", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BasketResponse{BasketOrder: *b, PnL: pnl})
+}
+
+type BasketLegRequest struct {
+	Instrument string  `json:"instrument"`
+	Exchange   string  `json:"exchange"`
+	Side       string  `json:"side"`
+	OrderType  string  `json:"orderType"`
+	Price      float64 `json:"price"`
+	Ratio      int     `json:"ratio"` // units per basket unit, e.g. lot size x lots
+}
+
+type BasketRequest struct {
+	Name       string             `json:"name"`
+	Kind       string             `json:"kind"`
+	Quantity   int                `json:"quantity"`
+	StrategyID uuid.UUID          `json:"strategyId"`
+	BrokerID   *uint              `json:"brokerId,omitempty"` // nil places paper orders
+	Legs       []BasketLegRequest `json:"legs"`
+}
+
+// POST /baskets - place a multi-leg order all or none
+func (h *BasketOrderHandler) CreateBasket(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+	var req BasketRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Quantity == 0 {
+		req.Quantity = 1
+	}
+
+	b := models.BasketOrder{
+		UserID:     userID,
+		Name:       req.Name,
+		Kind:       req.Kind,
+		Quantity:   req.Quantity,
+		StrategyID: req.StrategyID,
+		BrokerID:   req.BrokerID,
+		IsPaper:    req.BrokerID == nil,
+	}
+	legs := make([]*models.Order, len(req.Legs))
+	for i, l := range req.Legs {
+		side := strings.ToUpper(l.Side)
+		if l.Instrument == "" || (side != "BUY" && side != "SELL") {
+			http.Error(w, "Each leg needs an instrument and a side of BUY or SELL", http.StatusBadRequest)
+			return
+		}
+		orderType := strings.ToUpper(l.OrderType)
+		if orderType == "" {
+			orderType = "MARKET"
+		}
+		legs[i] = &models.Order{
+			Instrument: l.Instrument,
+			Exchange:   l.Exchange,
+			Side:       side,
+			OrderType:  orderType,
+			Price:      l.Price,
+			LegRatio:   l.Ratio,
+		}
+	}
+
+	err := broker.SubmitBasket(r.Context(), h.DB, h.Brokers, &b, legs)
+	for _, o := range legs {
+		b.Legs = append(b.Legs, *o)
+	}
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		if b.CreatedAt.IsZero() {
+			// invalid before anything was stored
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+			return
+		}
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": err.Error(), "basket": b})
+		return
+	}
+	// fills may have moved the basket on
+	var fresh models.BasketOrder
+	if h.DB.First(&fresh, "id = ?", b.ID).Error == nil {
+		b.Status = fresh.Status
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(b)
+}
+
+// POST /baskets/{id}/cancel - cancel working legs; {"unwind": true} also
+// closes what the legs have filled
+func (h *BasketOrderHandler) CancelBasket(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+	b, ok := h.basketFromPath(w, r, userID)
+	if !ok {
+		return
+	}
+	var req struct {
+		Unwind bool `json:"unwind"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	if b.IsTerminal() {
+		http.Error(w, "Basket is already "+b.Status, http.StatusConflict)
+		return
+	}
+	if err := broker.CancelBasket(r.Context(), h.DB, h.Brokers, b, req.Unwind); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if b, ok = h.basketFromPath(w, r, userID); !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(b)
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"go-backend/calendar"
+)
+
+type CalendarHandler struct {
+	Store    sessions.Store
+	Calendar *calendar.Calendar
+}
+
+type MarketStatusResponse struct {
+	calendar.Status
+	At        time.Time `json:"at"`
+	IsOpen    bool      `json:"isOpen"`
+	NextOpen  time.Time `json:"nextOpen"`
+	NextClose time.Time `json:"nextClose"`
+}
+
+// GET /calendar/status?exchange=NSE&at=2025-10-21T14:00:00+05:30 - whether
+// the exchange is open, today's session and the next open and close
+func (h *CalendarHandler) GetStatus(w http.ResponseWriter, r *http.Request) {
+	if _, ok := sessionUser(h.Store, w, r); !ok {
+		return
+	}
+	q := r.URL.Query()
+	at := time.Now()
+	if s := q.Get("at"); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil {
+			http.Error(w, "at must be an RFC 3339 time", http.StatusBadRequest)
+			return
+		}
+		at = t
+	}
+	exchange := q.Get("exchange")
+
+	resp := MarketStatusResponse{
+		Status:    h.Calendar.Status(exchange, at),
+		At:        at.In(h.Calendar.Location()),
+		IsOpen:    h.Calendar.IsOpen(exchange, at),
+		NextOpen:  h.Calendar.NextOpen(exchange, at),
+		NextClose: h.Calendar.NextClose(exchange, at),
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// GET /calendar/holidays?year=2025 - holidays, special sessions and early
+// closes for a year, with the regular session hours
+func (h *CalendarHandler) GetHolidays(w http.ResponseWriter, r *http.Request) {
+	if _, ok := sessionUser(h.Store, w, r); !ok {
+		return
+	}
+	year := time.Now().In(h.Calendar.Location()).Year()
+	if s := r.URL.Query().Get("year"); s != "" {
+		y, err := strconv.Atoi(s)
+		if err != nil {
+			http.Error(w, "Invalid year", http.StatusBadRequest)
+			return
+		}
+		year = y
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(h.Calendar.Year(year))
+}
+
+// POST /calendar/reload - re-read the calendar file after it was edited
+func (h *CalendarHandler) Reload(w http.ResponseWriter, r *http.Request) {
+	if _, ok := sessionUser(h.Store, w, r); !ok {
+		return
+	}
+	if err := h.Calendar.Reload(""); err != nil {
+		http.Error(w, "Failed to reload calendar: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
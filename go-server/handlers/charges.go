@@ -0,0 +1,222 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/sessions"
+	"go-backend/charges"
+	"go-backend/models"
+	"gorm.io/gorm"
+)
+
+type ChargesHandler struct {
+	DB      *gorm.DB
+	Store   sessions.Store
+	Charges *charges.Service
+}
+
+// GET /charge-plans - list the user's charge plans
+func (h *ChargesHandler) GetPlans(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+
+	var plans []models.ChargePlan
+	if err := h.DB.Where("user_id = ?", userID).Order("id").Find(&plans).Error; err != nil {
+		http.Error(w, "Failed to fetch charge plans", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(plans)
+}
+
+// POST /charge-plans - create a charge plan
+func (h *ChargesHandler) CreatePlan(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+
+	var plan models.ChargePlan
+	if err := json.NewDecoder(r.Body).Decode(&plan); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if plan.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if _, err := charges.Resolve(&plan); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	plan.ID = 0
+	plan.UserID = userID
+
+	if err := h.DB.Create(&plan).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(plan)
+}
+
+func (h *ChargesHandler) ownedPlan(w http.ResponseWriter, r *http.Request) (*models.ChargePlan, bool) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return nil, false
+	}
+	id, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(r.URL.Path, "/charge-plans/"), "/"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	var plan models.ChargePlan
+	if err := h.DB.First(&plan, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.NotFound(w, r)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+	return &plan, true
+}
+
+// PUT /charge-plans/{id} - update a charge plan
+func (h *ChargesHandler) UpdatePlan(w http.ResponseWriter, r *http.Request) {
+	existing, ok := h.ownedPlan(w, r)
+	if !ok {
+		return
+	}
+
+	var updated models.ChargePlan
+	if err := json.NewDecoder(r.Body).Decode(&updated); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if _, err := charges.Resolve(&updated); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	updated.ID = existing.ID
+	updated.UserID = existing.UserID
+	updated.CreatedAt = existing.CreatedAt
+	if updated.Name == "" {
+		updated.Name = existing.Name
+	}
+
+	if err := h.DB.Save(&updated).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// DELETE /charge-plans/{id} - delete a charge plan
+func (h *ChargesHandler) DeletePlan(w http.ResponseWriter, r *http.Request) {
+	plan, ok := h.ownedPlan(w, r)
+	if !ok {
+		return
+	}
+	if err := h.DB.Delete(plan).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /charges/presets - built-in brokerage plans and the statutory rates
+func (h *ChargesHandler) GetPresets(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"default":     charges.DefaultPlan,
+		"presets":     charges.Presets,
+		"segments":    charges.Segments,
+		"rates":       charges.Rates,
+		"sebiPercent": charges.SEBIPercent,
+		"gstPercent":  charges.GSTPercent,
+	})
+}
+
+type ChargesEstimateRequest struct {
+	Instrument string  `json:"instrument"`
+	Exchange   string  `json:"exchange"`
+	Product    string  `json:"product"`
+	Side       string  `json:"side"`
+	Quantity   int     `json:"quantity"`
+	Price      float64 `json:"price"`
+	ExitPrice  float64 `json:"exitPrice,omitempty"` // prices the closing leg too
+	BrokerID   *uint   `json:"brokerId,omitempty"`
+}
+
+type ChargesEstimateResponse struct {
+	Entry     charges.Breakdown  `json:"entry"`
+	Exit      *charges.Breakdown `json:"exit,omitempty"`
+	Total     float64            `json:"total"`
+	GrossPnL  *float64           `json:"grossPnl,omitempty"`
+	NetPnL    *float64           `json:"netPnl,omitempty"`
+	Breakeven float64            `json:"breakevenPoints"` // price move that covers the charges
+}
+
+// POST /charges/estimate - price a fill, or a round trip when exitPrice is
+// given, under the user's charge plan
+func (h *ChargesHandler) Estimate(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+	var req ChargesEstimateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	side := strings.ToUpper(req.Side)
+	if req.Instrument == "" || req.Quantity <= 0 || req.Price <= 0 || (side != "BUY" && side != "SELL") {
+		http.Error(w, "instrument, a positive quantity and price and a side of BUY or SELL are required", http.StatusBadRequest)
+		return
+	}
+
+	order := models.Order{
+		UserID:     userID,
+		Instrument: req.Instrument,
+		Exchange:   req.Exchange,
+		Product:    strings.ToUpper(req.Product),
+		Side:       side,
+		BrokerID:   req.BrokerID,
+	}
+	resp := ChargesEstimateResponse{Entry: h.Charges.Estimate(&order, req.Quantity, req.Price)}
+	resp.Total = resp.Entry.Total
+	if req.ExitPrice > 0 {
+		order.Side = "SELL"
+		dir := 1.0
+		if side == "SELL" {
+			order.Side, dir = "BUY", -1
+		}
+		exit := h.Charges.Estimate(&order, req.Quantity, req.ExitPrice)
+		resp.Exit = &exit
+		resp.Total += exit.Total
+		gross := (req.ExitPrice - req.Price) * float64(req.Quantity) * dir
+		net := gross - resp.Total
+		resp.GrossPnL, resp.NetPnL = &gross, &net
+	}
+	// a round trip costs roughly twice the entry when no exit is given
+	cost := resp.Total
+	if resp.Exit == nil {
+		cost *= 2
+	}
+	resp.Breakeven = cost / float64(req.Quantity)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
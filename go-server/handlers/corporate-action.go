@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/sessions"
+	"go-backend/corpactions"
+	"go-backend/models"
+	"gorm.io/gorm"
+)
+
+type CorporateActionHandler struct {
+	DB        *gorm.DB
+	Store     sessions.Store
+	Processor *corpactions.Processor
+	// Admins may record, apply and delete actions: applying one adjusts the
+	// shared bars and books into every holder's ledger, and cannot be undone.
+	Admins map[uuid.UUID]bool
+}
+
+// GET /corporate-actions?symbol=&status= - corporate actions, latest ex-date
+// first
+func (h *CorporateActionHandler) GetActions(w http.ResponseWriter, r *http.Request) {
+	if _, ok := sessionUser(h.Store, w, r); !ok {
+		return
+	}
+	q := h.DB.Order("ex_date DESC, id DESC")
+	if s := r.URL.Query().Get("symbol"); s != "" {
+		q = q.Where("symbol = ?", strings.ToUpper(s))
+	}
+	if s := r.URL.Query().Get("status"); s != "" {
+		q = q.Where("status = ?", strings.ToUpper(s))
+	}
+
+	var actions []models.CorporateAction
+	if err := q.Find(&actions).Error; err != nil {
+		http.Error(w, "Failed to fetch corporate actions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(actions)
+}
+
+// POST /corporate-actions - record a split, bonus or dividend; it is applied
+// on its ex-date. Admins only.
+func (h *CorporateActionHandler) CreateAction(w http.ResponseWriter, r *http.Request) {
+	if _, ok := sessionAdmin(h.Store, h.Admins, w, r, "Only administrators can record corporate actions"); !ok {
+		return
+	}
+	var a models.CorporateAction
+	if err := json.NewDecoder(r.Body).Decode(&a); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := corpactions.Validate(&a); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	a.ID = 0
+	a.Status = models.CorporateActionPending
+	a.PriceFactor = 0
+	a.AppliedAt = nil
+
+	if err := h.DB.Create(&a).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(a)
+}
+
+type CorporateActionResponse struct {
+	models.CorporateAction
+	Entries []models.CorporateActionEntry `json:"entries"` // the user's holdings it adjusted
+}
+
+func (h *CorporateActionHandler) actionFromPath(w http.ResponseWriter, r *http.Request) (*models.CorporateAction, bool) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/corporate-actions/"), "/"), "/")
+	id, err := strconv.Atoi(parts[0])
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return nil, false
+	}
+	var a models.CorporateAction
+	if err := h.DB.First(&a, id).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.NotFound(w, r)
+		} else {
+			http.Error(w, "Failed to fetch corporate action", http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+	return &a, true
+}
+
+// GET /corporate-actions/{id} - one action with what it did to the user's
+// holdings
+func (h *CorporateActionHandler) GetAction(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+	a, ok := h.actionFromPath(w, r)
+	if !ok {
+		return
+	}
+
+	resp := CorporateActionResponse{CorporateAction: *a, Entries: []models.CorporateActionEntry{}}
+	if err := h.DB.Where("corporate_action_id = ? AND user_id = ?", a.ID, userID).
+		Order("id").Find(&resp.Entries).Error; err != nil {
+		http.Error(w, "Failed to fetch entries", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// POST /corporate-actions/{id}/apply - apply a pending action now instead of
+// waiting for the morning job. Admins only.
+func (h *CorporateActionHandler) ApplyAction(w http.ResponseWriter, r *http.Request) {
+	if _, ok := sessionAdmin(h.Store, h.Admins, w, r, "Only administrators can apply corporate actions"); !ok {
+		return
+	}
+	a, ok := h.actionFromPath(w, r)
+	if !ok {
+		return
+	}
+	applied, err := h.Processor.Apply(a.ID, time.Now())
+	if err != nil {
+		if errors.Is(err, corpactions.ErrNotPending) {
+			http.Error(w, "Corporate action is already "+a.Status, http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(applied)
+}
+
+// DELETE /corporate-actions/{id} - drop an action that has not been applied.
+// Admins only.
+func (h *CorporateActionHandler) DeleteAction(w http.ResponseWriter, r *http.Request) {
+	if _, ok := sessionAdmin(h.Store, h.Admins, w, r, "Only administrators can delete corporate actions"); !ok {
+		return
+	}
+	a, ok := h.actionFromPath(w, r)
+	if !ok {
+		return
+	}
+	if a.Status != models.CorporateActionPending {
+		http.Error(w, "Applied corporate actions cannot be deleted", http.StatusConflict)
+		return
+	}
+	if err := h.DB.Delete(a).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /corporate-actions/entries?type=DIVIDEND&from=&to= - the user's
+// dividend cash and share adjustments, latest first
+func (h *CorporateActionHandler) GetEntries(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+	q := h.DB.Where("user_id = ?", userID).Order("ex_date DESC, id DESC")
+	query := r.URL.Query()
+	if s := query.Get("type"); s != "" {
+		q = q.Where("type = ?", strings.ToUpper(s))
+	}
+	for _, p := range []struct{ name, cond string }{{"from", "ex_date >= ?"}, {"to", "ex_date <= ?"}} {
+		if s := query.Get(p.name); s != "" {
+			t, err := time.Parse(time.RFC3339, s)
+			if err != nil {
+				http.Error(w, "Invalid "+p.name+", expected RFC3339", http.StatusBadRequest)
+				return
+			}
+			q = q.Where(p.cond, t)
+		}
+	}
+
+	var entries []models.CorporateActionEntry
+	if err := q.Find(&entries).Error; err != nil {
+		http.Error(w, "Failed to fetch entries", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"go-backend/models"
+	"go-backend/runner"
+	"gorm.io/gorm"
+)
+
+type DeploymentTransitionRequest struct {
+	Reason string `json:"reason"`
+}
+
+// deploymentIDFromPath splits /deploy-strategy/{id}/... into the id and the
+// remaining path segments.
+func deploymentIDFromPath(path string) (uint, []string, error) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(path, "/deploy-strategy/"), "/"), "/")
+	id, err := strconv.ParseUint(parts[0], 10, 64)
+	return uint(id), parts[1:], err
+}
+
+// ownedDeployment loads the deployment in the URL and checks it belongs to
+// the session user, writing the HTTP error itself when it does not.
+func (h *DeployStrategyHandler) ownedDeployment(w http.ResponseWriter, r *http.Request) (*models.DeployedStrategy, uuid.UUID, []string, bool) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return nil, uuid.Nil, nil, false
+	}
+
+	id, rest, err := deploymentIDFromPath(r.URL.Path)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return nil, uuid.Nil, nil, false
+	}
+
+	var deployed models.DeployedStrategy
+	if err := h.DB.First(&deployed, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.NotFound(w, r)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return nil, uuid.Nil, nil, false
+	}
+	return &deployed, userID, rest, true
+}
+
+// POST /deploy-strategy/{id}/pause|resume|stop|square-off - change the
+// lifecycle state of a deployment. Body: {"reason": "..."} (optional)
+func (h *DeployStrategyHandler) TransitionDeployedStrategy(w http.ResponseWriter, r *http.Request) {
+	deployed, userID, rest, ok := h.ownedDeployment(w, r)
+	if !ok {
+		return
+	}
+	if len(rest) != 1 || !runner.IsValidAction(rest[0]) {
+		http.NotFound(w, r)
+		return
+	}
+
+	var req DeploymentTransitionRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	updated, err := h.Runner.Transition(r.Context(), deployed.ID, rest[0], runner.UserActor(userID), req.Reason)
+	if err != nil {
+		switch {
+		case errors.Is(err, runner.ErrInvalidTransition), errors.Is(err, runner.ErrHalted):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case updated != nil:
+			// The state changed but the follow-up (e.g. flattening) failed.
+			http.Error(w, err.Error(), http.StatusBadGateway)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// GET /deploy-strategy/{id}/events - audit trail of lifecycle transitions
+func (h *DeployStrategyHandler) GetDeploymentEvents(w http.ResponseWriter, r *http.Request) {
+	deployed, _, _, ok := h.ownedDeployment(w, r)
+	if !ok {
+		return
+	}
+
+	var events []models.DeploymentEvent
+	if err := h.DB.Where("deployment_id = ?", deployed.ID).Order("created_at DESC").Find(&events).Error; err != nil {
+		http.Error(w, "Failed to fetch deployment events", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
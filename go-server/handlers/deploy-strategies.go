@@ -2,9 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"go-backend/models"
+	"go-backend/runner"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"gorm.io/gorm"
 
@@ -14,31 +17,15 @@ import (
 )
 
 type DeployStrategyHandler struct {
-	DB    *gorm.DB
-	Store sessions.Store
+	DB     *gorm.DB
+	Store  sessions.Store
+	Runner *runner.Supervisor
 }
 //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 /// GET /deploy-strategies - list all deployed strategies for the user
 func (h *DeployStrategyHandler) GetDeployedStrategies(w http.ResponseWriter, r *http.Request) {
-	session, err := h.Store.Get(r, "Go-session-id")
-	if err != nil {
-		http.Error(w, "Failed to get session", http.StatusInternalServerError)
-		return
-	}
-
-	var userID uuid.UUID
-
-	switch v := session.Values["user_id"].(type) {
-	case string:
-		userID, err = uuid.Parse(v)
-		if err != nil {
-			http.Error(w, "Invalid user ID in session", http.StatusInternalServerError)
-			return
-		}
-	case uuid.UUID:
-		userID = v
-	default:
-		http.Error(w, "User not authenticated", http.StatusUnauthorized)
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
 		return
 	}
 
@@ -54,20 +41,8 @@ func (h *DeployStrategyHandler) GetDeployedStrategies(w http.ResponseWriter, r *
  ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 // GET /deploy-strategies/{id} - get a single deployed strategy
 func (h *DeployStrategyHandler) GetDeployedStrategy(w http.ResponseWriter, r *http.Request) {
-	idStr := r.URL.Path[len("/deploy-strategy/"):]
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
-		return
-	}
-
-	var deployed models.DeployedStrategy
-	if err := h.DB.First(&deployed, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			http.NotFound(w, r)
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+	deployed, _, _, ok := h.ownedDeployment(w, r)
+	if !ok {
 		return
 	}
 
@@ -77,6 +52,7 @@ func (h *DeployStrategyHandler) GetDeployedStrategy(w http.ResponseWriter, r *ht
 /////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 type DeployStrategyRequest struct {
     StrategyID      string `json:"strategyId"`
+    StrategyVersion int    `json:"strategyVersion"` // 0 pins the latest version
     BrokerID        string `json:"brokerId"`
     Name            string `json:"name"`
     LotMultiplier   string `json:"lotMultiplier"`
@@ -84,26 +60,36 @@ type DeployStrategyRequest struct {
     TradingType     string `json:"tradingType"`
 }
 
+// validDeployment returns why d cannot be saved, or "" when it can. Create
+// and update both check the deployment as it would be stored
+func validDeployment(d *models.DeployedStrategy) string {
+	switch {
+	case d.Multiplier() <= 0:
+		return "Invalid lotMultiplier"
+	case d.Capital() <= 0:
+		return "Invalid capitalDeployed"
+	case !strings.EqualFold(d.TradingType, "paper") && !strings.EqualFold(d.TradingType, "live"):
+		return "tradingType must be paper or live"
+	}
+	return ""
+}
 
-func (h *DeployStrategyHandler) CreateDeployedStrategy(w http.ResponseWriter, r *http.Request) {
-    session, err := h.Store.Get(r, "Go-session-id")
-    if err != nil {
-        http.Error(w, "Failed to get session", http.StatusInternalServerError)
-        return
-    }
+// DeployStrategyUpdateRequest carries the fields a PUT changes; omitted
+// fields keep their value
+type DeployStrategyUpdateRequest struct {
+    StrategyID      *string `json:"strategyId"` // must match; the strategy cannot change
+    StrategyVersion *int    `json:"strategyVersion"`
+    BrokerID        *string `json:"brokerId"`
+    Name            *string `json:"name"`
+    LotMultiplier   *string `json:"lotMultiplier"`
+    CapitalDeployed *string `json:"capitalDeployed"`
+    TradingType     *string `json:"tradingType"`
+}
 
-    var userID uuid.UUID
-    switch v := session.Values["user_id"].(type) {
-    case string:
-        userID, err = uuid.Parse(v)
-        if err != nil {
-            http.Error(w, "Invalid user ID in session", http.StatusInternalServerError)
-            return
-        }
-    case uuid.UUID:
-        userID = v
-    default:
-        http.Error(w, "User not authenticated", http.StatusUnauthorized)
+
+func (h *DeployStrategyHandler) CreateDeployedStrategy(w http.ResponseWriter, r *http.Request) {
+    userID, ok := sessionUser(h.Store, w, r)
+    if !ok {
         return
     }
 
@@ -127,9 +113,21 @@ func (h *DeployStrategyHandler) CreateDeployedStrategy(w http.ResponseWriter, r
         return
     }
 
+    // Pin the exact code being deployed so later edits cannot change it
+    version, err := pinStrategyVersion(h.DB, strategyUUID, userID, req.StrategyVersion)
+    if err != nil {
+        if err == gorm.ErrRecordNotFound {
+            http.Error(w, "Strategy or strategy version not found", http.StatusNotFound)
+        } else {
+            http.Error(w, err.Error(), http.StatusInternalServerError)
+        }
+        return
+    }
+
     // Step 3: Create the deployed strategy object
     deployedStrategy := models.DeployedStrategy{
         StrategyID:      strategyUUID,
+        StrategyVersion: version.Version,
         UserID:          userID,
         BrokerID:        uint(brokerID),
         Name:            req.Name,
@@ -140,11 +138,23 @@ func (h *DeployStrategyHandler) CreateDeployedStrategy(w http.ResponseWriter, r
         CurrentPnl:      0,
         PercentPnl:      0,
     }
+    if msg := validDeployment(&deployedStrategy); msg != "" {
+        http.Error(w, msg, http.StatusBadRequest)
+        return
+    }
+
+    if h.Runner != nil && h.Runner.Halted != nil && h.Runner.Halted(userID) {
+        http.Error(w, runner.ErrHalted.Error(), http.StatusConflict)
+        return
+    }
 
     if err := h.DB.Create(&deployedStrategy).Error; err != nil {
         http.Error(w, err.Error(), http.StatusInternalServerError)
         return
     }
+    if h.Runner != nil {
+        h.Runner.Launch(deployedStrategy)
+    }
 
     w.Header().Set("Content-Type", "application/json")
     w.WriteHeader(http.StatusCreated)
@@ -152,37 +162,108 @@ func (h *DeployStrategyHandler) CreateDeployedStrategy(w http.ResponseWriter, r
 }
 
 ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
-// PUT /deploy-strategies/{id} - update an existing deployed strategy
+// PUT /deploy-strategies/{id} - update an existing deployed strategy. Only
+// the fields sent change; strategyVersion re-pins the deployment to another
+// version of the same strategy, and a running worker restarts with the new
+// settings
 func (h *DeployStrategyHandler) UpdateDeployedStrategy(w http.ResponseWriter, r *http.Request) {
-	idStr := r.URL.Path[len("/deploy-strategy/"):]
-	id, err := strconv.Atoi(idStr)
-	if err != nil {
-		http.Error(w, "Invalid ID", http.StatusBadRequest)
+	existing, userID, rest, ok := h.ownedDeployment(w, r)
+	if !ok {
 		return
 	}
-
-	var existing models.DeployedStrategy
-	if err := h.DB.First(&existing, id).Error; err != nil {
-		if err == gorm.ErrRecordNotFound {
-			http.NotFound(w, r)
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+	if len(rest) != 0 {
+		http.NotFound(w, r)
 		return
 	}
 
-	var updated models.DeployedStrategy
-	if err := json.NewDecoder(r.Body).Decode(&updated); err != nil {
+	var req DeployStrategyUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	if req.StrategyID != nil && *req.StrategyID != existing.StrategyID.String() {
+		http.Error(w, "strategyId cannot change; deploy the other strategy instead", http.StatusBadRequest)
+		return
+	}
 
-	updated.ID = existing.ID // maintain same ID
-	if err := h.DB.Save(&updated).Error; err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	updates := map[string]interface{}{}
+	next := *existing
+	if req.Name != nil {
+		updates["name"] = *req.Name
+	}
+	if req.BrokerID != nil {
+		brokerID, err := strconv.ParseUint(*req.BrokerID, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid brokerId", http.StatusBadRequest)
+			return
+		}
+		updates["broker_id"] = uint(brokerID)
+	}
+	if req.LotMultiplier != nil {
+		next.LotMultiplier = *req.LotMultiplier
+		updates["lot_multiplier"] = *req.LotMultiplier
+	}
+	if req.CapitalDeployed != nil {
+		next.CapitalDeployed = *req.CapitalDeployed
+		updates["capital_deployed"] = *req.CapitalDeployed
+	}
+	if req.TradingType != nil {
+		next.TradingType = *req.TradingType
+		updates["trading_type"] = *req.TradingType
+	}
+	if msg := validDeployment(&next); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
 		return
 	}
 
+	var repin *models.DeploymentEvent
+	if req.StrategyVersion != nil && *req.StrategyVersion != existing.StrategyVersion {
+		version, err := pinStrategyVersion(h.DB, existing.StrategyID, userID, *req.StrategyVersion)
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				http.Error(w, "Strategy version not found", http.StatusNotFound)
+			} else {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+		if version.Version != existing.StrategyVersion {
+			updates["strategy_version"] = version.Version
+			repin = &models.DeploymentEvent{
+				DeploymentID: existing.ID,
+				Action:       runner.ActionRepin,
+				FromStatus:   existing.Status,
+				ToStatus:     existing.Status,
+				ActorID:      &userID,
+				Source:       "user",
+				Reason:       fmt.Sprintf("re-pinned from version %d to %d", existing.StrategyVersion, version.Version),
+			}
+		}
+	}
+
+	if len(updates) > 0 {
+		err := h.DB.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(existing).Updates(updates).Error; err != nil {
+				return err
+			}
+			if repin != nil {
+				return tx.Create(repin).Error
+			}
+			return nil
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if err := h.DB.First(existing, existing.ID).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if h.Runner != nil {
+			h.Runner.Reload(*existing)
+		}
+	}
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(updated)
+	json.NewEncoder(w).Encode(existing)
 }
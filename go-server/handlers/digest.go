@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"go-backend/digest"
+	"go-backend/models"
+	"gorm.io/gorm"
+)
+
+type DigestHandler struct {
+	DB      *gorm.DB
+	Store   sessions.Store
+	Digests *digest.Service
+}
+
+// GET /reports/digests - performance digests sent or attempted, newest first
+func (h *DigestHandler) ListDeliveries(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+	deliveries := []models.ReportDelivery{}
+	if err := h.DB.Where("user_id = ?", userID).Order("period_start DESC, period").Limit(100).
+		Find(&deliveries).Error; err != nil {
+		http.Error(w, "Failed to load digests", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(deliveries)
+}
+
+// GET /reports/digests/preview?period=daily|weekly|monthly&date=&format=html|json -
+// the digest of the period containing date (today by default) as it would be
+// emailed; nothing is sent or recorded
+func (h *DigestHandler) Preview(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+	var user models.User
+	if err := h.DB.Preload("NotificationPreferences").First(&user, "id = ?", userID).Error; err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	q := r.URL.Query()
+	kind := q.Get("period")
+	if kind == "" {
+		kind = user.NotificationPreferences.ReportFrequency
+	}
+	if kind == "" {
+		kind = models.ReportWeekly
+	}
+	if !digest.ValidKind(kind) {
+		http.Error(w, "period must be daily, weekly or monthly", http.StatusBadRequest)
+		return
+	}
+	day := time.Now()
+	if s := q.Get("date"); s != "" {
+		var err error
+		if day, err = parseDay(s); err != nil {
+			http.Error(w, "Invalid date, expected YYYY-MM-DD or RFC3339", http.StatusBadRequest)
+			return
+		}
+	}
+	period, err := digest.PeriodOf(kind, day)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	name := user.FullName
+	if name == "" {
+		name = user.Username
+	}
+	dg, err := digest.Build(h.DB, userID, name, period)
+	if err != nil {
+		http.Error(w, "Failed to build digest", http.StatusInternalServerError)
+		return
+	}
+	switch strings.ToLower(q.Get("format")) {
+	case "", "html":
+		body, err := dg.HTML()
+		if err != nil {
+			http.Error(w, "Failed to render digest", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(body))
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(dg)
+	default:
+		http.Error(w, "format must be html or json", http.StatusBadRequest)
+	}
+}
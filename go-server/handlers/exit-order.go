@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/sessions"
+	"go-backend/broker"
+	"go-backend/models"
+	"gorm.io/gorm"
+)
+
+type ExitOrderHandler struct {
+	DB    *gorm.DB
+	Store sessions.Store
+	Exits *broker.Exits
+}
+
+type BracketOrderRequest struct {
+	Instrument string    `json:"instrument"`
+	Exchange   string    `json:"exchange"`
+	Quantity   int       `json:"quantity"`
+	Price      float64   `json:"price"`
+	OrderType  string    `json:"orderType"`
+	Side       string    `json:"side"`
+	StrategyID uuid.UUID `json:"strategyId"`
+	BrokerID   *uint     `json:"brokerId,omitempty"` // nil places paper orders
+	broker.BracketSpec
+}
+
+type BracketOrderResponse struct {
+	Entry models.Order    `json:"entry"`
+	Exits []*models.Order `json:"exits"`
+}
+
+// POST /orders/bracket - place an entry with a target and a stop or trailing
+// stop that go live once it fills
+func (h *ExitOrderHandler) CreateBracket(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+	var req BracketOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	side := strings.ToUpper(req.Side)
+	if req.Instrument == "" || req.Quantity <= 0 || (side != "BUY" && side != "SELL") {
+		http.Error(w, "instrument, a positive quantity and a side of BUY or SELL are required", http.StatusBadRequest)
+		return
+	}
+	orderType := strings.ToUpper(req.OrderType)
+	if orderType == "" {
+		orderType = "MARKET"
+	}
+
+	entry := models.Order{
+		UserID:     userID,
+		Instrument: req.Instrument,
+		Exchange:   req.Exchange,
+		Quantity:   req.Quantity,
+		Price:      req.Price,
+		OrderType:  orderType,
+		Side:       side,
+		StrategyID: req.StrategyID,
+		BrokerID:   req.BrokerID,
+		IsPaper:    req.BrokerID == nil,
+	}
+	exits, err := h.Exits.Bracket(r.Context(), &entry, req.BracketSpec)
+	if err != nil {
+		if exits == nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeOrderRejected(w, &entry, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(BracketOrderResponse{Entry: entry, Exits: exits})
+}
+
+type OCOLegRequest struct {
+	OrderType    string  `json:"orderType"` // LIMIT, STOP or TRAILING_STOP
+	Price        float64 `json:"price"`
+	TriggerPrice float64 `json:"triggerPrice"`
+	TrailAmount  float64 `json:"trailAmount"`
+	TrailPercent float64 `json:"trailPercent"`
+}
+
+type OCOOrderRequest struct {
+	Instrument string    `json:"instrument"`
+	Exchange   string    `json:"exchange"`
+	Quantity   int       `json:"quantity"`
+	Side       string    `json:"side"`
+	StrategyID uuid.UUID `json:"strategyId"`
+	BrokerID   *uint     `json:"brokerId,omitempty"`
+	// IsExitOrder defaults to true: OCO pairs usually protect a position.
+	IsExitOrder *bool           `json:"isExitOrder,omitempty"`
+	Legs        []OCOLegRequest `json:"legs"`
+}
+
+// POST /orders/oco - place orders on one instrument where a fill on one
+// cancels the others, e.g. a target and a stop for an open position
+func (h *ExitOrderHandler) CreateOCO(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+	var req OCOOrderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	side := strings.ToUpper(req.Side)
+	if req.Instrument == "" || req.Quantity <= 0 || (side != "BUY" && side != "SELL") {
+		http.Error(w, "instrument, a positive quantity and a side of BUY or SELL are required", http.StatusBadRequest)
+		return
+	}
+	isExit := req.IsExitOrder == nil || *req.IsExitOrder
+
+	orders := make([]*models.Order, len(req.Legs))
+	for i, l := range req.Legs {
+		orders[i] = &models.Order{
+			UserID:       userID,
+			Instrument:   req.Instrument,
+			Exchange:     req.Exchange,
+			Quantity:     req.Quantity,
+			Price:        l.Price,
+			OrderType:    strings.ToUpper(l.OrderType),
+			Side:         side,
+			StrategyID:   req.StrategyID,
+			IsExitOrder:  isExit,
+			BrokerID:     req.BrokerID,
+			IsPaper:      req.BrokerID == nil,
+			TriggerPrice: l.TriggerPrice,
+			TrailAmount:  l.TrailAmount,
+			TrailPercent: l.TrailPercent,
+		}
+	}
+	if err := h.Exits.OCO(r.Context(), orders); err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": err.Error(), "orders": orders})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(orders)
+}
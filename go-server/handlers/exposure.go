@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/gorilla/sessions"
+	"go-backend/models"
+	"go-backend/portfolio"
+	"gorm.io/gorm"
+)
+
+type ExposureHandler struct {
+	DB        *gorm.DB
+	Store     sessions.Store
+	Exposures *portfolio.Exposures
+}
+
+// GET /exposures - recompute and store the user's market and sector exposures
+func (h *ExposureHandler) GetExposures(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+
+	report, err := h.Exposures.Refresh(userID)
+	if err != nil {
+		http.Error(w, "Failed to compute exposures", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// GET /exposures/markets - stored market exposures
+func (h *ExposureHandler) GetMarketExposures(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+
+	rows := []models.MarketExposure{}
+	if err := h.DB.Where("user_id = ?", userID).Order("gross DESC").Find(&rows).Error; err != nil {
+		http.Error(w, "Failed to fetch market exposures", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rows)
+}
+
+// GET /exposures/sectors - stored sector exposures with their cap status
+func (h *ExposureHandler) GetSectorExposures(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+
+	rows := []models.SectorExposure{}
+	if err := h.DB.Where("user_id = ?", userID).Order("gross DESC").Find(&rows).Error; err != nil {
+		http.Error(w, "Failed to fetch sector exposures", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rows)
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/sessions"
+	"go-backend/instruments"
+	"gorm.io/gorm"
+)
+
+type InstrumentHandler struct {
+	DB          *gorm.DB
+	Store       sessions.Store
+	Instruments *instruments.Resolver
+	// Admins may import dumps: the master is shared, and every user's
+	// orders, sizing and symbols depend on it.
+	Admins map[uuid.UUID]bool
+}
+
+const (
+	defaultSearchLimit = 20
+	maxSearchLimit     = 100
+	maxImportBytes     = 256 << 20 // full broker dumps run to tens of MB
+)
+
+// GET /instruments/search?q=NIFTY&exchange=NFO&type=CE&limit=20 - prefix
+// search over trading symbols and names
+func (h *InstrumentHandler) Search(w http.ResponseWriter, r *http.Request) {
+	if _, ok := sessionUser(h.Store, w, r); !ok {
+		return
+	}
+	q := r.URL.Query()
+	limit := defaultSearchLimit
+	if s := q.Get("limit"); s != "" {
+		n, err := strconv.Atoi(s)
+		if err != nil || n <= 0 {
+			http.Error(w, "limit must be a positive integer", http.StatusBadRequest)
+			return
+		}
+		limit = min(n, maxSearchLimit)
+	}
+
+	found, err := h.Instruments.Search(q.Get("q"), q.Get("exchange"), q.Get("type"), limit)
+	if err != nil {
+		http.Error(w, "Failed to search instruments", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(found)
+}
+
+// GET /instruments/resolve?symbol=NSE:NIFTY 50&exchange= - the instrument a
+// symbol, alias or broker token refers to
+func (h *InstrumentHandler) Resolve(w http.ResponseWriter, r *http.Request) {
+	if _, ok := sessionUser(h.Store, w, r); !ok {
+		return
+	}
+	q := r.URL.Query()
+	in, err := h.Instruments.Resolve(q.Get("symbol"), q.Get("exchange"))
+	if err != nil {
+		if errors.Is(err, instruments.ErrUnknown) {
+			http.Error(w, "Unknown instrument "+strconv.Quote(q.Get("symbol")), http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to resolve instrument", http.StatusInternalServerError)
+		return
+	}
+	if err := h.DB.Model(in).Association("Tokens").Find(&in.Tokens); err != nil {
+		http.Error(w, "Failed to fetch broker tokens", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(in)
+}
+
+// POST /instruments/import?format=zerodha|upstox|generic&broker= - load a
+// broker instrument dump, sent as a multipart "file" or as the CSV body.
+// Admins only.
+func (h *InstrumentHandler) Import(w http.ResponseWriter, r *http.Request) {
+	if _, ok := sessionAdmin(h.Store, h.Admins, w, r, "Only administrators can import instruments"); !ok {
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxImportBytes)
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "Missing file: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	q := r.URL.Query()
+	res, err := instruments.Load(h.DB, body, strings.ToLower(q.Get("format")), strings.ToLower(q.Get("broker")))
+	h.Instruments.Invalidate()
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": err.Error(), "result": res})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
+
+// normalizeSymbol rewrites a user-entered symbol to its trading symbol,
+// answering 400 for symbols the instrument master does not list. A nil
+// resolver leaves the symbol as entered.
+func normalizeSymbol(w http.ResponseWriter, res *instruments.Resolver, symbol string) (string, bool) {
+	if res == nil {
+		return symbol, true
+	}
+	sym, _, err := res.Normalize(symbol, "")
+	if err != nil {
+		status := http.StatusBadRequest
+		if !errors.Is(err, instruments.ErrUnknown) && strings.TrimSpace(symbol) != "" {
+			status = http.StatusInternalServerError
+		}
+		http.Error(w, err.Error(), status)
+		return "", false
+	}
+	return sym, true
+}
@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/sessions"
+	"go-backend/killswitch"
+	"go-backend/models"
+	"gorm.io/gorm"
+)
+
+type KillSwitchHandler struct {
+	DB     *gorm.DB
+	Store  sessions.Store
+	Switch *killswitch.Switch
+	Admins map[uuid.UUID]bool // may engage and re-arm the global switch
+}
+
+type KillSwitchRequest struct {
+	Reason    string `json:"reason"`
+	SquareOff bool   `json:"squareOff"`
+	Global    bool   `json:"global"`
+}
+
+type KillSwitchResponse struct {
+	User    *models.KillSwitch  `json:"user"`
+	Global  *models.KillSwitch  `json:"global"`
+	Halted  bool                `json:"halted"`
+	Summary *killswitch.Summary `json:"summary,omitempty"`
+}
+
+// target decodes the request and resolves which switch it is for: the
+// caller's own, or the global one for admins.
+func (h *KillSwitchHandler) target(w http.ResponseWriter, r *http.Request) (uuid.UUID, *uuid.UUID, *KillSwitchRequest, bool) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return uuid.Nil, nil, nil, false
+	}
+	var req KillSwitchRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return uuid.Nil, nil, nil, false
+	}
+	if req.Reason == "" {
+		http.Error(w, "reason is required", http.StatusBadRequest)
+		return uuid.Nil, nil, nil, false
+	}
+	if req.Global {
+		if !h.Admins[userID] {
+			http.Error(w, "Only administrators can use the global kill switch", http.StatusForbidden)
+			return uuid.Nil, nil, nil, false
+		}
+		return userID, nil, &req, true
+	}
+	return userID, &userID, &req, true
+}
+
+func (h *KillSwitchHandler) respond(w http.ResponseWriter, userID uuid.UUID, summary *killswitch.Summary) {
+	resp := KillSwitchResponse{Halted: h.Switch.Engaged(userID), Summary: summary}
+	var err error
+	if resp.User, err = h.Switch.State(&userID); err == nil {
+		resp.Global, err = h.Switch.State(nil)
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch kill switch state", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// GET /kill-switch - state of the caller's switch and the global switch
+func (h *KillSwitchHandler) GetKillSwitch(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+	h.respond(w, userID, nil)
+}
+
+// POST /kill-switch/engage - halt trading. Body: {"reason", "squareOff", "global"}
+func (h *KillSwitchHandler) Engage(w http.ResponseWriter, r *http.Request) {
+	actor, scope, req, ok := h.target(w, r)
+	if !ok {
+		return
+	}
+
+	_, summary, err := h.Switch.Engage(r.Context(), scope, actor, req.Reason, req.SquareOff)
+	if err != nil {
+		if errors.Is(err, killswitch.ErrEngaged) {
+			http.Error(w, err.Error(), http.StatusConflict)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	h.respond(w, actor, summary)
+}
+
+// POST /kill-switch/arm - re-enable trading. Body: {"reason", "global"}
+func (h *KillSwitchHandler) Arm(w http.ResponseWriter, r *http.Request) {
+	actor, scope, req, ok := h.target(w, r)
+	if !ok {
+		return
+	}
+
+	if _, err := h.Switch.Arm(scope, actor, req.Reason); err != nil {
+		if errors.Is(err, killswitch.ErrNotEngaged) {
+			http.Error(w, err.Error(), http.StatusConflict)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	h.respond(w, actor, nil)
+}
+
+// GET /kill-switch/events?global=true - audit trail, newest first; the global
+// one is for administrators only
+func (h *KillSwitchHandler) GetEvents(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+
+	scope := &userID
+	if r.URL.Query().Get("global") == "true" {
+		if !h.Admins[userID] {
+			http.Error(w, "Only administrators can view the global kill switch audit trail", http.StatusForbidden)
+			return
+		}
+		scope = nil
+	}
+	events, err := h.Switch.Events(scope)
+	if err != nil {
+		http.Error(w, "Failed to fetch kill switch events", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
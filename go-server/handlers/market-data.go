@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/sessions"
+	"go-backend/corpactions"
+	"go-backend/instruments"
+	"go-backend/marketfeed"
+	"go-backend/models"
+	"go-backend/script"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+type MarketDataHandler struct {
+	DB    *gorm.DB
+	Store sessions.Store
+	Feed  *marketfeed.Hub
+	// Feeders may ingest bars: published bars move paper fills, stops and
+	// live strategies, so ordinary users cannot post them.
+	Feeders map[uuid.UUID]bool
+	// Actions readjusts symbols when bars older than an applied corporate
+	// action are stored.
+	Actions *corpactions.Processor
+	// Instruments stores and looks bars up under canonical trading symbols.
+	Instruments *instruments.Resolver
+}
+
+// POST /market-data?backfill=true - store bars and publish new ones to
+// running strategies. Accepts a single bar or an array; a bar that already
+// exists is replaced. Feeders only. Bars older than the latest stored one,
+// a symbol's first load and anything sent with backfill=true are stored
+// without being published.
+func (h *MarketDataHandler) IngestMarketData(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+	if !h.Feeders[userID] {
+		http.Error(w, "Only market data feeders can ingest bars", http.StatusForbidden)
+		return
+	}
+	backfill, _ := strconv.ParseBool(r.URL.Query().Get("backfill"))
+
+	var raw json.RawMessage
+	if err := json.NewDecoder(r.Body).Decode(&raw); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var bars []models.MarketData
+	if len(raw) > 0 && raw[0] == '[' {
+		if err := json.Unmarshal(raw, &bars); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	} else {
+		var bar models.MarketData
+		if err := json.Unmarshal(raw, &bar); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		bars = append(bars, bar)
+	}
+
+	for i := range bars {
+		b := &bars[i]
+		b.ID = 0
+		if b.Symbol == "" || b.Timeframe == "" || b.Timestamp.IsZero() {
+			http.Error(w, "symbol, timeframe and timestamp are required", http.StatusBadRequest)
+			return
+		}
+		if b.High < b.Low {
+			http.Error(w, "high must not be below low", http.StatusBadRequest)
+			return
+		}
+		if b.Symbol, ok = normalizeSymbol(w, h.Instruments, b.Symbol); !ok {
+			return
+		}
+	}
+	if len(bars) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	// The newest stored bar per series decides which bars are live
+	type series struct{ symbol, timeframe string }
+	stored := map[series]time.Time{}
+	batchLatest := map[series]time.Time{}
+	for _, b := range bars {
+		k := series{b.Symbol, b.Timeframe}
+		if b.Timestamp.After(batchLatest[k]) {
+			batchLatest[k] = b.Timestamp
+		}
+		if _, ok := stored[k]; ok || backfill {
+			continue
+		}
+		var latest []time.Time
+		if err := h.DB.Model(&models.MarketData{}).Where("symbol = ? AND timeframe = ?", b.Symbol, b.Timeframe).
+			Order("timestamp DESC").Limit(1).Pluck("timestamp", &latest).Error; err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		stored[k] = time.Time{}
+		if len(latest) > 0 {
+			stored[k] = latest[0]
+		}
+	}
+
+	err := h.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "symbol"}, {Name: "timeframe"}, {Name: "timestamp"}},
+		DoUpdates: clause.AssignmentColumns([]string{"open", "high", "low", "close", "volume"}),
+	}).Create(&bars).Error
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if h.Actions != nil {
+		earliest := map[string]time.Time{}
+		for _, b := range bars {
+			if t, ok := earliest[b.Symbol]; !ok || b.Timestamp.Before(t) {
+				earliest[b.Symbol] = b.Timestamp
+			}
+		}
+		for sym, t := range earliest {
+			if err := h.Actions.Backfilled(sym, t); err != nil {
+				http.Error(w, "Stored bars but failed to adjust them: "+err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+	}
+
+	published := 0
+	if h.Feed != nil && !backfill {
+		sort.SliceStable(bars, func(i, j int) bool { return bars[i].Timestamp.Before(bars[j].Timestamp) })
+		for _, b := range bars {
+			k := series{b.Symbol, b.Timeframe}
+			latest := stored[k]
+			if latest.IsZero() {
+				// A first load is history; only its newest bar is live
+				latest = batchLatest[k]
+			}
+			if b.Timestamp.Before(latest) {
+				continue
+			}
+			if h.Feed.Publish(b.Symbol, b.Timeframe, script.Bar{
+				Time: b.Timestamp, Open: b.Open, High: b.High, Low: b.Low, Close: b.Close, Volume: b.Volume,
+			}) {
+				published++
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]int{"stored": len(bars), "published": published})
+}
+
+// GET /market-data?symbol=&timeframe=&from=&to=&adjusted=true - stored
+// bars, oldest first; adjusted back-adjusts them for corporate actions
+func (h *MarketDataHandler) GetMarketData(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	symbol, timeframe := q.Get("symbol"), q.Get("timeframe")
+	if symbol == "" || timeframe == "" {
+		http.Error(w, "symbol and timeframe are required", http.StatusBadRequest)
+		return
+	}
+	symbol, ok := normalizeSymbol(w, h.Instruments, symbol)
+	if !ok {
+		return
+	}
+
+	var from, to time.Time
+	var err error
+	if s := q.Get("from"); s != "" {
+		if from, err = time.Parse(time.RFC3339, s); err != nil {
+			http.Error(w, "Invalid from, expected RFC3339", http.StatusBadRequest)
+			return
+		}
+	}
+	if s := q.Get("to"); s != "" {
+		if to, err = time.Parse(time.RFC3339, s); err != nil {
+			http.Error(w, "Invalid to, expected RFC3339", http.StatusBadRequest)
+			return
+		}
+	}
+
+	load := marketfeed.History
+	if adjusted, _ := strconv.ParseBool(q.Get("adjusted")); adjusted {
+		load = marketfeed.AdjustedHistory
+	}
+	bars, err := load(h.DB, symbol, timeframe, from, to)
+	if err != nil {
+		http.Error(w, "Failed to fetch market data", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(bars)
+}
@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/sessions"
+	"go-backend/models"
+	"go-backend/options"
+	"gorm.io/gorm"
+)
+
+type OptionsHandler struct {
+	DB    *gorm.DB
+	Store sessions.Store
+	Chain *options.Chain
+	Book  *options.Book
+}
+
+type OptionPriceRequest struct {
+	options.Params
+	// MarketPrice, when set, is solved for implied volatility and the
+	// greeks are computed at it.
+	MarketPrice float64 `json:"marketPrice"`
+}
+
+type OptionPriceResponse struct {
+	Price  float64        `json:"price"`
+	Vol    float64        `json:"vol"`
+	Greeks options.Greeks `json:"greeks"`
+}
+
+// POST /options/price - theoretical price and greeks, or implied volatility
+// from a market price
+func (h *OptionsHandler) Price(w http.ResponseWriter, r *http.Request) {
+	if _, ok := sessionUser(h.Store, w, r); !ok {
+		return
+	}
+	var req OptionPriceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if err := req.Params.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.MarketPrice > 0 {
+		iv, err := options.ImpliedVol(req.Params, req.MarketPrice)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+		req.Vol = iv
+	}
+	price, greeks := options.Compute(req.Params)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(OptionPriceResponse{Price: price, Vol: req.Vol, Greeks: greeks})
+}
+
+// GET /options/chain?underlying=&expiry=&model= - the option chain of the
+// nearest or given expiry with implied volatility and greeks per strike
+func (h *OptionsHandler) GetChain(w http.ResponseWriter, r *http.Request) {
+	if _, ok := sessionUser(h.Store, w, r); !ok {
+		return
+	}
+	q := r.URL.Query()
+	underlying := strings.TrimSpace(q.Get("underlying"))
+	if underlying == "" {
+		http.Error(w, "underlying is required", http.StatusBadRequest)
+		return
+	}
+	var expiry time.Time
+	if s := q.Get("expiry"); s != "" {
+		t, err := parseDay(s)
+		if err != nil {
+			http.Error(w, "Invalid expiry", http.StatusBadRequest)
+			return
+		}
+		expiry = t
+	}
+
+	chain, err := h.Chain.Compute(underlying, expiry, q.Get("model"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(chain)
+}
+
+type PayoffRequest struct {
+	options.PayoffConfig
+	// Underlying looks up the spot when Spot is not given.
+	Underlying string        `json:"underlying"`
+	Legs       []options.Leg `json:"legs"`
+}
+
+// POST /options/payoff - P&L curves of a multi-leg strategy at expiry and
+// at T+n days
+func (h *OptionsHandler) Payoff(w http.ResponseWriter, r *http.Request) {
+	if _, ok := sessionUser(h.Store, w, r); !ok {
+		return
+	}
+	var req PayoffRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Spot <= 0 && req.Underlying != "" {
+		sym := options.SpotSymbol(req.Underlying)
+		prices, err := options.LastPrices(h.DB, h.Chain.Feed, []string{sym})
+		if err != nil {
+			http.Error(w, "Failed to fetch spot price", http.StatusInternalServerError)
+			return
+		}
+		req.Spot = prices[strings.ToUpper(sym)]
+	}
+	if req.Rate == 0 {
+		req.Rate = h.Chain.Rate
+	}
+
+	report, err := options.Payoff(req.Legs, req.PayoffConfig)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+type NetGreeksResponse struct {
+	Account    *options.BookGreeks   `json:"account,omitempty"`
+	Strategies []*options.BookGreeks `json:"strategies"`
+}
+
+// GET /options/greeks?strategyId= - net greeks of open positions for the
+// account and each deployed strategy, or for one strategy
+func (h *OptionsHandler) GetNetGreeks(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+
+	resp := NetGreeksResponse{Strategies: []*options.BookGreeks{}}
+	var strategies []uuid.UUID
+	if s := r.URL.Query().Get("strategyId"); s != "" {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			http.Error(w, "Invalid strategyId", http.StatusBadRequest)
+			return
+		}
+		strategies = []uuid.UUID{id}
+	} else {
+		account, err := h.Book.Compute(userID, nil)
+		if err != nil {
+			http.Error(w, "Failed to compute greeks", http.StatusInternalServerError)
+			return
+		}
+		resp.Account = account
+		if err := h.DB.Model(&models.DeployedStrategy{}).
+			Where("user_id = ? AND status <> ?", userID, models.DeploymentStatusStopped).
+			Distinct("strategy_id").Pluck("strategy_id", &strategies).Error; err != nil {
+			http.Error(w, "Failed to fetch deployed strategies", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	for i := range strategies {
+		book, err := h.Book.Compute(userID, &strategies[i])
+		if err != nil {
+			http.Error(w, "Failed to compute greeks", http.StatusInternalServerError)
+			return
+		}
+		resp.Strategies = append(resp.Strategies, book)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
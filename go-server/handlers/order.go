@@ -5,6 +5,7 @@ import (
     "net/http"
     "strings"
 
+    "go-backend/broker"
     "go-backend/models"
     "github.com/google/uuid"
     "github.com/gorilla/sessions"
@@ -12,32 +13,16 @@ import (
 )
 
 type OrderHandler struct {
-    DB    *gorm.DB
-    Store sessions.Store
+    DB      *gorm.DB
+    Store   sessions.Store
+    Brokers *broker.Registry
 }
 
 //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 /// GET /orders - list all orders for the user
 func (h *OrderHandler) GetOrders(w http.ResponseWriter, r *http.Request) {
-    session, err := h.Store.Get(r, "Go-session-id")
-    if err != nil {
-        http.Error(w, "Failed to get session", http.StatusInternalServerError)
-        return
-    }
-
-    var userID uuid.UUID
-
-    switch v := session.Values["user_id"].(type) {
-    case string:
-        userID, err = uuid.Parse(v)
-        if err != nil {
-            http.Error(w, "Invalid user ID in session", http.StatusInternalServerError)
-            return
-        }
-    case uuid.UUID:
-        userID = v
-    default:
-        http.Error(w, "User not authenticated", http.StatusUnauthorized)
+    userID, ok := sessionUser(h.Store, w, r)
+    if !ok {
         return
     }
 
@@ -89,28 +74,14 @@ type OrderRequest struct {
     StrategyID    uuid.UUID  `json:"strategyId"`
     IsExitOrder   bool       `json:"isExitOrder"`
     ParentOrderID *uuid.UUID `json:"parentOrderId,omitempty"`
+    BrokerID      *uint      `json:"brokerId,omitempty"` // nil places a paper order
+    Product       string     `json:"product,omitempty"`  // CNC, MIS or NRML
 }
 
-// POST /orders - create a new order
+// POST /orders - place a new order through the pre-trade checks and broker
 func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
-    session, err := h.Store.Get(r, "Go-session-id")
-    if err != nil {
-        http.Error(w, "Failed to get session", http.StatusInternalServerError)
-        return
-    }
-
-    var userID uuid.UUID
-    switch v := session.Values["user_id"].(type) {
-    case string:
-        userID, err = uuid.Parse(v)
-        if err != nil {
-            http.Error(w, "Invalid user ID in session", http.StatusInternalServerError)
-            return
-        }
-    case uuid.UUID:
-        userID = v
-    default:
-        http.Error(w, "User not authenticated", http.StatusUnauthorized)
+    userID, ok := sessionUser(h.Store, w, r)
+    if !ok {
         return
     }
 
@@ -130,18 +101,16 @@ func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
         Price:         req.Price,
         OrderType:     req.OrderType,
         Side:          req.Side,
-        Status:        req.Status,
         StrategyID:    req.StrategyID,
         IsExitOrder:   req.IsExitOrder,
         ParentOrderID: req.ParentOrderID,
+        BrokerID:      req.BrokerID,
+        IsPaper:       req.BrokerID == nil,
+        Product:       strings.ToUpper(req.Product),
     }
 
-    if order.Status == "" {
-        order.Status = "OPEN"
-    }
-
-    if err := h.DB.Create(&order).Error; err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
+    if err := broker.Submit(r.Context(), h.DB, h.Brokers, &order); err != nil {
+        writeOrderRejected(w, &order, err)
         return
     }
 
@@ -150,6 +119,22 @@ func (h *OrderHandler) CreateOrder(w http.ResponseWriter, r *http.Request) {
     json.NewEncoder(w).Encode(order)
 }
 
+// writeOrderRejected reports an order that did not reach its broker. Orders
+// saved as REJECTED are returned so the caller can see which limit blocked it.
+func writeOrderRejected(w http.ResponseWriter, order *models.Order, err error) {
+    w.Header().Set("Content-Type", "application/json")
+    if order.Status != models.OrderStatusRejected {
+        w.WriteHeader(http.StatusInternalServerError)
+        json.NewEncoder(w).Encode(map[string]string{"error": err.Error()})
+        return
+    }
+    w.WriteHeader(http.StatusUnprocessableEntity)
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "error": err.Error(),
+        "order": order,
+    })
+}
+
 ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 // PUT /orders/{id} - update an existing order
 func (h *OrderHandler) UpdateOrder(w http.ResponseWriter, r *http.Request) {
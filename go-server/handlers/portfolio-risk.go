@@ -0,0 +1,59 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"go-backend/models"
+	"gorm.io/gorm"
+)
+
+type PortfolioRiskHandler struct {
+	DB    *gorm.DB
+	Store sessions.Store
+}
+
+// parseDay accepts a plain date or an RFC3339 timestamp.
+func parseDay(s string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, s)
+}
+
+// GET /portfolio-risk?from=&to= - daily risk snapshots, oldest first
+func (h *PortfolioRiskHandler) GetPortfolioRisk(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+
+	q := h.DB.Where("user_id = ?", userID)
+	if s := r.URL.Query().Get("from"); s != "" {
+		from, err := parseDay(s)
+		if err != nil {
+			http.Error(w, "Invalid from, expected YYYY-MM-DD or RFC3339", http.StatusBadRequest)
+			return
+		}
+		q = q.Where("date >= ?", from.Format("2006-01-02"))
+	}
+	if s := r.URL.Query().Get("to"); s != "" {
+		to, err := parseDay(s)
+		if err != nil {
+			http.Error(w, "Invalid to, expected YYYY-MM-DD or RFC3339", http.StatusBadRequest)
+			return
+		}
+		q = q.Where("date <= ?", to.Format("2006-01-02"))
+	}
+
+	snapshots := []models.PortfolioRisk{}
+	if err := q.Order("date").Find(&snapshots).Error; err != nil {
+		http.Error(w, "Failed to fetch portfolio risk", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshots)
+}
@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/sessions"
+	"go-backend/models"
+	"go-backend/sizing"
+	"gorm.io/gorm"
+)
+
+type PositionSizingHandler struct {
+	DB     *gorm.DB
+	Store  sessions.Store
+	Sizing *sizing.Service
+}
+
+func validSizingRule(rule *models.PositionSizingRule) string {
+	switch rule.Method {
+	case sizing.MethodFixedQuantity:
+		if rule.FixedQuantity <= 0 {
+			return "fixedQuantity must be positive"
+		}
+	case sizing.MethodFixed, sizing.MethodPercentEquity, sizing.MethodRiskBased, sizing.MethodVolatility:
+		if rule.RiskPerTrade <= 0 {
+			return "riskPerTrade must be positive"
+		}
+	case sizing.MethodKelly:
+	default:
+		return "method must be fixed-quantity, fixed, percent-equity, risk-based, volatility or kelly"
+	}
+	if rule.Name == "" {
+		return "name is required"
+	}
+	if rule.MaxPositionSize < 0 {
+		return "maxPositionSize must not be negative"
+	}
+	return ""
+}
+
+// GET /position-sizing/rules - list the user's sizing rules
+func (h *PositionSizingHandler) GetRules(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+
+	var rules []models.PositionSizingRule
+	if err := h.DB.Where("user_id = ?", userID).Order("id").Find(&rules).Error; err != nil {
+		http.Error(w, "Failed to fetch position sizing rules", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rules)
+}
+
+// POST /position-sizing/rules - create a sizing rule
+func (h *PositionSizingHandler) CreateRule(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+
+	// Active unless the request says otherwise. The column has no gorm
+	// default, which would also turn an explicit false into true.
+	rule := models.PositionSizingRule{IsActive: true}
+	if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if msg := validSizingRule(&rule); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	rule.ID = 0
+	rule.UserID = userID
+	if rule.Strategy == "" {
+		rule.Strategy = "All Strategies"
+	}
+
+	if err := h.DB.Create(&rule).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rule)
+}
+
+func (h *PositionSizingHandler) ownedRule(w http.ResponseWriter, r *http.Request) (*models.PositionSizingRule, bool) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return nil, false
+	}
+	id, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(r.URL.Path, "/position-sizing/rules/"), "/"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	var rule models.PositionSizingRule
+	if err := h.DB.First(&rule, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.NotFound(w, r)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+	return &rule, true
+}
+
+// PUT /position-sizing/rules/{id} - update a sizing rule
+func (h *PositionSizingHandler) UpdateRule(w http.ResponseWriter, r *http.Request) {
+	existing, ok := h.ownedRule(w, r)
+	if !ok {
+		return
+	}
+
+	var updated models.PositionSizingRule
+	if err := json.NewDecoder(r.Body).Decode(&updated); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if msg := validSizingRule(&updated); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	updated.ID = existing.ID
+	updated.UserID = existing.UserID
+	updated.CreatedAt = existing.CreatedAt
+	if updated.Strategy == "" {
+		updated.Strategy = existing.Strategy
+	}
+
+	if err := h.DB.Save(&updated).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// DELETE /position-sizing/rules/{id} - delete a sizing rule
+func (h *PositionSizingHandler) DeleteRule(w http.ResponseWriter, r *http.Request) {
+	rule, ok := h.ownedRule(w, r)
+	if !ok {
+		return
+	}
+	if err := h.DB.Delete(rule).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// PositionSizingPreviewRequest describes a hypothetical entry. The rule is
+// taken from RuleID, else from Params, else the user's rule for StrategyID.
+type PositionSizingPreviewRequest struct {
+	RuleID     *uint          `json:"ruleId"`
+	Params     *sizing.Params `json:"params"`
+	StrategyID uuid.UUID      `json:"strategyId"`
+	Symbol     string         `json:"symbol"`
+	Exchange   string         `json:"exchange"`
+	Timeframe  string         `json:"timeframe"`
+	Entry      float64        `json:"entry"`
+	Stop       float64        `json:"stop"`
+	Equity     float64        `json:"equity"`
+	ATR        float64        `json:"atr"`     // overrides the ATR from stored bars
+	WinRate    float64        `json:"winRate"` // percent; with payoff, overrides backtest stats
+	Payoff     float64        `json:"payoff"`
+}
+
+type PositionSizingPreviewResponse struct {
+	Rule   *models.PositionSizingRule `json:"rule,omitempty"`
+	Params sizing.Params              `json:"params"`
+	Stats  *sizing.Stats              `json:"stats,omitempty"`
+	Result *sizing.Result             `json:"result"`
+}
+
+// POST /position-sizing/preview - show the size a rule gives an entry and stop
+func (h *PositionSizingHandler) Preview(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+
+	var req PositionSizingPreviewRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var resp PositionSizingPreviewResponse
+	switch {
+	case req.RuleID != nil:
+		var rule models.PositionSizingRule
+		if err := h.DB.First(&rule, "id = ? AND user_id = ?", *req.RuleID, userID).Error; err != nil {
+			http.Error(w, "Position sizing rule not found", http.StatusNotFound)
+			return
+		}
+		resp.Rule = &rule
+	case req.Params != nil:
+		resp.Params = *req.Params
+	default:
+		rule, err := h.Sizing.Rule(userID, req.StrategyID)
+		if err != nil {
+			http.Error(w, "No active position sizing rule", http.StatusNotFound)
+			return
+		}
+		resp.Rule = rule
+	}
+	if resp.Rule != nil {
+		resp.Params = sizing.FromRule(resp.Rule)
+	}
+
+	if req.Entry <= 0 && req.Symbol != "" {
+		req.Entry, _ = h.Sizing.LastPrice(req.Symbol)
+	}
+	market := sizing.Market{
+		Equity:  req.Equity,
+		Entry:   req.Entry,
+		Stop:    req.Stop,
+		ATR:     req.ATR,
+		LotSize: sizing.LotSize(req.Exchange, req.Symbol),
+	}
+	if market.ATR <= 0 && req.Symbol != "" && req.Timeframe != "" {
+		var err error
+		if market.Bars, err = h.Sizing.Bars(resp.Params, req.Symbol, req.Timeframe); err != nil {
+			http.Error(w, "Failed to load market data", http.StatusInternalServerError)
+			return
+		}
+	}
+	if req.WinRate > 0 && req.Payoff > 0 {
+		market.Stats = &sizing.Stats{WinRate: req.WinRate / 100, Payoff: req.Payoff, Trades: 1}
+	} else if req.StrategyID != uuid.Nil {
+		market.Stats = h.Sizing.StrategyStats(userID, req.StrategyID)
+	}
+	resp.Stats = market.Stats
+
+	res, err := sizing.Size(resp.Params, market)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	resp.Result = res
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
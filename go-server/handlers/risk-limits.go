@@ -0,0 +1,261 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/sessions"
+	"go-backend/instruments"
+	"go-backend/models"
+	"gorm.io/gorm"
+)
+
+type RiskLimitHandler struct {
+	DB          *gorm.DB
+	Store       sessions.Store
+	Instruments *instruments.Resolver
+}
+
+// sessionUser returns the logged-in user, writing the HTTP error itself when
+// there is none.
+func sessionUser(store sessions.Store, w http.ResponseWriter, r *http.Request) (uuid.UUID, bool) {
+	session, err := store.Get(r, "Go-session-id")
+	if err != nil {
+		http.Error(w, "Failed to get session", http.StatusInternalServerError)
+		return uuid.Nil, false
+	}
+
+	switch v := session.Values["user_id"].(type) {
+	case string:
+		userID, err := uuid.Parse(v)
+		if err != nil {
+			http.Error(w, "Invalid user ID in session", http.StatusInternalServerError)
+			return uuid.Nil, false
+		}
+		return userID, true
+	case uuid.UUID:
+		return v, true
+	}
+	http.Error(w, "User not authenticated", http.StatusUnauthorized)
+	return uuid.Nil, false
+}
+
+// sessionAdmin returns the logged-in user when admins lists them, answering
+// 403 with what they were denied otherwise.
+func sessionAdmin(store sessions.Store, admins map[uuid.UUID]bool, w http.ResponseWriter, r *http.Request, denied string) (uuid.UUID, bool) {
+	userID, ok := sessionUser(store, w, r)
+	if !ok {
+		return uuid.Nil, false
+	}
+	if !admins[userID] {
+		http.Error(w, denied, http.StatusForbidden)
+		return uuid.Nil, false
+	}
+	return userID, true
+}
+
+// validRiskLimit checks the fields every limit needs.
+func validRiskLimit(l *models.RiskLimit) string {
+	switch {
+	case l.Name == "" || l.Metric == "":
+		return "name and metric are required"
+	case !models.RiskMetrics[l.Metric]:
+		return "unknown metric " + strconv.Quote(l.Metric)
+	case l.Type != models.RiskTypeAccount && l.Type != models.RiskTypeStrategy && l.Type != models.RiskTypePosition:
+		return "type must be account, strategy or position"
+	case l.Metric == models.RiskMetricAllowedInstruments && strings.TrimSpace(l.AllowedInstruments) == "":
+		return "allowedInstruments is required for the allowed instruments metric"
+	case l.Metric != models.RiskMetricAllowedInstruments && l.Threshold <= 0:
+		return "threshold must be positive"
+	}
+	switch l.Action {
+	case models.RiskActionNotify, models.RiskActionReduce, models.RiskActionPause, models.RiskActionBlock, models.RiskActionExit:
+		return ""
+	}
+	return "action must be notify, reduce, pause, block or exit"
+}
+
+// normalizeAllowed rewrites an allow-list to canonical trading symbols so it
+// matches orders the instrument master has normalized.
+func (h *RiskLimitHandler) normalizeAllowed(w http.ResponseWriter, l *models.RiskLimit) bool {
+	if l.Metric != models.RiskMetricAllowedInstruments {
+		return true
+	}
+	var symbols []string
+	for _, s := range strings.Split(l.AllowedInstruments, ",") {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		sym, ok := normalizeSymbol(w, h.Instruments, strings.ToUpper(strings.TrimSpace(s)))
+		if !ok {
+			return false
+		}
+		symbols = append(symbols, sym)
+	}
+	l.AllowedInstruments = strings.Join(symbols, ",")
+	return true
+}
+
+// GET /risk-limits - list the user's risk limits
+func (h *RiskLimitHandler) GetRiskLimits(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+
+	var limits []models.RiskLimit
+	if err := h.DB.Where("user_id = ?", userID).Order("id").Find(&limits).Error; err != nil {
+		http.Error(w, "Failed to fetch risk limits", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(limits)
+}
+
+// POST /risk-limits - create a risk limit
+func (h *RiskLimitHandler) CreateRiskLimit(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+
+	// Active unless the request says otherwise. The column has no gorm
+	// default, which would also turn an explicit false into true.
+	limit := models.RiskLimit{IsActive: true}
+	if err := json.NewDecoder(r.Body).Decode(&limit); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if msg := validRiskLimit(&limit); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	if !h.normalizeAllowed(w, &limit) {
+		return
+	}
+	limit.ID = 0
+	limit.UserID = userID
+	limit.CurrentValue = nil
+	limit.Status = models.RiskStatusSafe
+
+	if err := h.DB.Create(&limit).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(limit)
+}
+
+func (h *RiskLimitHandler) ownedRiskLimit(w http.ResponseWriter, r *http.Request) (*models.RiskLimit, bool) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return nil, false
+	}
+	id, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(r.URL.Path, "/risk-limits/"), "/"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	var limit models.RiskLimit
+	if err := h.DB.First(&limit, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.NotFound(w, r)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+	return &limit, true
+}
+
+// GET /risk-limits/{id} - get a single risk limit
+func (h *RiskLimitHandler) GetRiskLimit(w http.ResponseWriter, r *http.Request) {
+	limit, ok := h.ownedRiskLimit(w, r)
+	if !ok {
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(limit)
+}
+
+// PUT /risk-limits/{id} - update a risk limit
+func (h *RiskLimitHandler) UpdateRiskLimit(w http.ResponseWriter, r *http.Request) {
+	existing, ok := h.ownedRiskLimit(w, r)
+	if !ok {
+		return
+	}
+
+	var updated models.RiskLimit
+	if err := json.NewDecoder(r.Body).Decode(&updated); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if msg := validRiskLimit(&updated); msg != "" {
+		http.Error(w, msg, http.StatusBadRequest)
+		return
+	}
+	if !h.normalizeAllowed(w, &updated) {
+		return
+	}
+	// Measured fields are owned by the risk engine
+	updated.ID = existing.ID
+	updated.UserID = existing.UserID
+	updated.CurrentValue = existing.CurrentValue
+	updated.Status = existing.Status
+	updated.CreatedAt = existing.CreatedAt
+
+	if err := h.DB.Save(&updated).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// DELETE /risk-limits/{id} - delete a risk limit
+func (h *RiskLimitHandler) DeleteRiskLimit(w http.ResponseWriter, r *http.Request) {
+	limit, ok := h.ownedRiskLimit(w, r)
+	if !ok {
+		return
+	}
+	if err := h.DB.Delete(limit).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GET /risk-events?limitId= - breach and recovery events, newest first
+func (h *RiskLimitHandler) GetRiskEvents(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+
+	q := h.DB.Where("user_id = ?", userID)
+	if s := r.URL.Query().Get("limitId"); s != "" {
+		limitID, err := strconv.Atoi(s)
+		if err != nil {
+			http.Error(w, "Invalid limitId", http.StatusBadRequest)
+			return
+		}
+		q = q.Where("risk_limit_id = ?", limitID)
+	}
+
+	var events []models.RiskEvent
+	if err := q.Order("created_at DESC").Limit(500).Find(&events).Error; err != nil {
+		http.Error(w, "Failed to fetch risk events", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(events)
+}
@@ -3,8 +3,9 @@ package handlers
 import (
     "encoding/json"
     "net/http" 
-    "strconv"
+    "go-backend/instruments"
 	"go-backend/models"
+    "go-backend/script"
     "gorm.io/gorm"
     // "fmt"
 	"github.com/gorilla/sessions"
@@ -16,6 +17,7 @@ import (
 type StrategyHandler struct {
     DB *gorm.DB
     Store sessions.Store
+    Instruments *instruments.Resolver
 }
 
 // GET /strategies - list all strategies
@@ -29,17 +31,21 @@ type StrategyHandler struct {
 //     json.NewEncoder(w).Encode(strategies)
 // }
 
-// GET /strategies/{id} - get a single strategy
+// GET /strategies/{id} - get one of the user's strategies
 func (h *StrategyHandler) GetStrategy(w http.ResponseWriter, r *http.Request) {
+    userID, ok := sessionUser(h.Store, w, r)
+    if !ok {
+        return
+    }
     idStr := r.URL.Path[len("/strategies/"):] // crude way without mux
-    id, err := strconv.Atoi(idStr)
+    id, err := uuid.Parse(idStr)
     if err != nil {
         http.Error(w, "Invalid ID", http.StatusBadRequest)
         return
     }
 
     var strategy models.Strategy
-    if err := h.DB.First(&strategy, id).Error; err != nil {
+    if err := h.DB.First(&strategy, "id = ? AND user_id = ?", id, userID).Error; err != nil {
         if err == gorm.ErrRecordNotFound {
             http.NotFound(w, r)
         } else {
@@ -53,25 +59,8 @@ func (h *StrategyHandler) GetStrategy(w http.ResponseWriter, r *http.Request) {
 }
 
 func (h *StrategyHandler) GetStrategies(w http.ResponseWriter, r *http.Request) {
-    session, err := h.Store.Get(r, "Go-session-id")
-    if err != nil {
-        http.Error(w, "Failed to get session", http.StatusInternalServerError)
-        return
-    }
-
-    var userID uuid.UUID
-
-    switch v := session.Values["user_id"].(type) {
-    case string:
-        userID, err = uuid.Parse(v)
-        if err != nil {
-            http.Error(w, "Invalid user ID in session", http.StatusInternalServerError)
-            return
-        }
-    case uuid.UUID:
-        userID = v
-    default:
-        http.Error(w, "User not authenticated", http.StatusUnauthorized)
+    userID, ok := sessionUser(h.Store, w, r)
+    if !ok {
         return
     }
 
@@ -87,39 +76,44 @@ func (h *StrategyHandler) GetStrategies(w http.ResponseWriter, r *http.Request)
 
 
 func (h *StrategyHandler) CreateStrategy(w http.ResponseWriter, r *http.Request) {
-    session, err := h.Store.Get(r, "Go-session-id")
-    if err != nil {
-        http.Error(w, "Failed to get session", http.StatusInternalServerError)
+    userID, ok := sessionUser(h.Store, w, r)
+    if !ok {
         return
     }
 
-    // Use type switch or assert based on expected format (uuid.UUID or string)
-    var userID uuid.UUID
-
-    switch v := session.Values["user_id"].(type) {
-    case string:
-        userID, err = uuid.Parse(v)
-        if err != nil {
-            http.Error(w, "Invalid user ID in session", http.StatusInternalServerError)
-            return
-        }
-    case uuid.UUID:
-        userID = v
-    default:
-        http.Error(w, "User not authenticated", http.StatusUnauthorized)
+    var req StrategySaveRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+        http.Error(w, err.Error(), http.StatusBadRequest)
         return
     }
+    strategy := req.Strategy
 
-    var strategy models.Strategy
-    if err := json.NewDecoder(r.Body).Decode(&strategy); err != nil {
-        http.Error(w, err.Error(), http.StatusBadRequest)
+    if errs := script.Validate(strategy.Code); len(errs) > 0 {
+        writeScriptErrors(w, errs)
+        return
+    }
+    symbol, ok := normalizeSymbol(w, h.Instruments, strategy.Symbol)
+    if !ok {
         return
     }
+    strategy.Symbol = symbol
 
     strategy.ID = uuid.New() 
     strategy.UserID = userID
+    strategy.Version = 1
 
-    if err := h.DB.Create(&strategy).Error; err != nil {
+    message := req.Message
+    if message == "" {
+        message = "Initial version"
+    }
+
+    err := h.DB.Transaction(func(tx *gorm.DB) error {
+        if err := tx.Create(&strategy).Error; err != nil {
+            return err
+        }
+        return tx.Create(newStrategyVersion(&strategy, userID, message)).Error
+    })
+    if err != nil {
         http.Error(w, err.Error(), http.StatusInternalServerError)
         return
     }
@@ -131,16 +125,22 @@ func (h *StrategyHandler) CreateStrategy(w http.ResponseWriter, r *http.Request)
 
 
 // PUT /strategies/{id} - update an existing strategy
+// Every save is recorded as a new immutable StrategyVersion.
 func (h *StrategyHandler) UpdateStrategy(w http.ResponseWriter, r *http.Request) {
+    userID, ok := sessionUser(h.Store, w, r)
+    if !ok {
+        return
+    }
+
     idStr := r.URL.Path[len("/strategies/"):]
-    id, err := strconv.Atoi(idStr)
+    id, err := uuid.Parse(idStr)
     if err != nil {
         http.Error(w, "Invalid ID", http.StatusBadRequest)
         return
     }
 
     var existing models.Strategy
-    if err := h.DB.First(&existing, id).Error; err != nil {
+    if err := h.DB.First(&existing, "id = ? AND user_id = ?", id, userID).Error; err != nil {
         if err == gorm.ErrRecordNotFound {
             http.NotFound(w, r)
         } else {
@@ -149,14 +149,36 @@ func (h *StrategyHandler) UpdateStrategy(w http.ResponseWriter, r *http.Request)
         return
     }
 
-    var updated models.Strategy
-    if err := json.NewDecoder(r.Body).Decode(&updated); err != nil {
+    var req StrategySaveRequest
+    if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
         http.Error(w, err.Error(), http.StatusBadRequest)
         return
     }
+    updated := req.Strategy
+
+    if errs := script.Validate(updated.Code); len(errs) > 0 {
+        writeScriptErrors(w, errs)
+        return
+    }
+    symbol, ok := normalizeSymbol(w, h.Instruments, updated.Symbol)
+    if !ok {
+        return
+    }
+    updated.Symbol = symbol
 
     updated.ID = existing.ID // ensure ID stays same
-    if err := h.DB.Save(&updated).Error; err != nil {
+    updated.UserID = existing.UserID
+    updated.CreatedAt = existing.CreatedAt
+
+    err = h.DB.Transaction(func(tx *gorm.DB) error {
+        version, err := saveStrategyVersion(tx, &existing, &updated, userID, req.Message)
+        if err != nil {
+            return err
+        }
+        updated.Version = version
+        return tx.Save(&updated).Error
+    })
+    if err != nil {
         http.Error(w, err.Error(), http.StatusInternalServerError)
         return
     }
@@ -164,3 +186,14 @@ func (h *StrategyHandler) UpdateStrategy(w http.ResponseWriter, r *http.Request)
     w.Header().Set("Content-Type", "application/json")
     json.NewEncoder(w).Encode(updated)
 }
+
+// writeScriptErrors reports strategy code that failed to compile, with the
+// line and column of every problem so the editor can highlight them.
+func writeScriptErrors(w http.ResponseWriter, errs script.ErrorList) {
+    w.Header().Set("Content-Type", "application/json")
+    w.WriteHeader(http.StatusUnprocessableEntity)
+    json.NewEncoder(w).Encode(map[string]interface{}{
+        "error":  "Strategy code is invalid",
+        "errors": errs,
+    })
+}
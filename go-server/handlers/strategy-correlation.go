@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/sessions"
+	"go-backend/models"
+	"go-backend/portfolio"
+	"gorm.io/gorm"
+)
+
+type StrategyCorrelationHandler struct {
+	DB           *gorm.DB
+	Store        sessions.Store
+	Correlations *portfolio.Correlations
+}
+
+// GET /strategy-correlations?window=&threshold= - correlation matrix and
+// clusters of the user's deployed strategies, computed now
+func (h *StrategyCorrelationHandler) GetMatrix(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+
+	window, threshold := portfolio.DefaultCorrelationWindow, h.Correlations.Threshold
+	if s := r.URL.Query().Get("window"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil || v < 2 {
+			http.Error(w, "window must be an integer of at least 2", http.StatusBadRequest)
+			return
+		}
+		window = v
+	}
+	if s := r.URL.Query().Get("threshold"); s != "" {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil || v < -1 || v > 1 {
+			http.Error(w, "threshold must be between -1 and 1", http.StatusBadRequest)
+			return
+		}
+		threshold = v
+	}
+
+	matrix, err := h.Correlations.Compute(userID, window, threshold)
+	if err != nil {
+		http.Error(w, "Failed to compute strategy correlations", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(matrix)
+}
+
+// GET /strategy-correlations/stored?window= - rows stored by the daily job
+func (h *StrategyCorrelationHandler) GetStored(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+
+	q := h.DB.Where("user_id = ?", userID)
+	if s := r.URL.Query().Get("window"); s != "" {
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			http.Error(w, "Invalid window", http.StatusBadRequest)
+			return
+		}
+		q = q.Where("window_days = ?", v)
+	}
+
+	rows := []models.StrategyCorrelation{}
+	if err := q.Order("window_days, strategy_name").Find(&rows).Error; err != nil {
+		http.Error(w, "Failed to fetch strategy correlations", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rows)
+}
+
+// POST /strategy-correlations/refresh - recompute and store every window
+func (h *StrategyCorrelationHandler) Refresh(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+
+	matrices, err := h.Correlations.Refresh(userID)
+	if err != nil {
+		http.Error(w, "Failed to refresh strategy correlations", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(matrices)
+}
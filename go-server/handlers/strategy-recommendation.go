@@ -6,6 +6,7 @@ import (
 	"strconv"
 
 	"go-backend/models"
+	"go-backend/script"
 	"gorm.io/gorm"
 )
 
@@ -56,6 +57,11 @@ func (h *StrategyRecommendationHandler) CreateRecommendation(w http.ResponseWrit
 		return
 	}
 
+	if errs := script.Validate(strategy.Code); len(errs) > 0 {
+		writeScriptErrors(w, errs)
+		return
+	}
+
 	if err := h.DB.Create(&strategy).Error; err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -91,6 +97,11 @@ func (h *StrategyRecommendationHandler) UpdateRecommendation(w http.ResponseWrit
 		return
 	}
 
+	if errs := script.Validate(updated.Code); len(errs) > 0 {
+		writeScriptErrors(w, errs)
+		return
+	}
+
 	updated.ID = existing.ID // maintain same ID
 	if err := h.DB.Save(&updated).Error; err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -0,0 +1,278 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"go-backend/models"
+	"go-backend/textdiff"
+	"gorm.io/gorm"
+)
+
+// StrategySaveRequest is the body of POST /strategies and PUT /strategies/{id}.
+// Message becomes the commit message of the version created by the save.
+type StrategySaveRequest struct {
+	models.Strategy
+	Message string `json:"message"`
+}
+
+func newStrategyVersion(s *models.Strategy, authorID uuid.UUID, message string) *models.StrategyVersion {
+	return &models.StrategyVersion{
+		ID:         uuid.New(),
+		StrategyID: s.ID,
+		Version:    s.Version,
+		Code:       s.Code,
+		Symbol:     s.Symbol,
+		Timeframe:  s.Timeframe,
+		Message:    message,
+		AuthorID:   authorID,
+	}
+}
+
+// saveStrategyVersion records updated as the next version of existing and
+// returns its number. Strategies saved before versioning existed get their
+// current code captured as version 1 first so no history is lost.
+func saveStrategyVersion(tx *gorm.DB, existing, updated *models.Strategy, authorID uuid.UUID, message string) (int, error) {
+	var latest int
+	if err := tx.Model(&models.StrategyVersion{}).
+		Where("strategy_id = ?", existing.ID).
+		Select("COALESCE(MAX(version), 0)").Scan(&latest).Error; err != nil {
+		return 0, err
+	}
+
+	if latest == 0 {
+		baseline := *existing
+		baseline.Version = 1
+		if err := tx.Create(newStrategyVersion(&baseline, existing.UserID, "Imported from existing strategy")).Error; err != nil {
+			return 0, err
+		}
+		latest = 1
+	}
+
+	if message == "" {
+		message = fmt.Sprintf("Update to version %d", latest+1)
+	}
+	next := *updated
+	next.ID = existing.ID
+	next.Version = latest + 1
+	if err := tx.Create(newStrategyVersion(&next, authorID, message)).Error; err != nil {
+		return 0, err
+	}
+	return next.Version, nil
+}
+
+// loadStrategyVersion returns version n of a strategy, or the latest when n is 0.
+func loadStrategyVersion(db *gorm.DB, strategyID uuid.UUID, n int) (*models.StrategyVersion, error) {
+	var v models.StrategyVersion
+	q := db.Where("strategy_id = ?", strategyID)
+	if n > 0 {
+		q = q.Where("version = ?", n)
+	} else {
+		q = q.Order("version DESC")
+	}
+	if err := q.First(&v).Error; err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// pinStrategyVersion resolves the version a deployment or backtest should run:
+// version n, or the latest when n is 0. A strategy saved before versioning
+// existed has its current code captured as version 1 on first use.
+func pinStrategyVersion(db *gorm.DB, strategyID, userID uuid.UUID, n int) (*models.StrategyVersion, error) {
+	var strategy models.Strategy
+	if err := db.First(&strategy, "id = ? AND user_id = ?", strategyID, userID).Error; err != nil {
+		return nil, err
+	}
+
+	v, err := loadStrategyVersion(db, strategyID, n)
+	if err != gorm.ErrRecordNotFound || n > 0 {
+		return v, err
+	}
+
+	strategy.Version = 1
+	v = newStrategyVersion(&strategy, strategy.UserID, "Imported from existing strategy")
+	err = db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(v).Error; err != nil {
+			return err
+		}
+		return tx.Model(&strategy).Update("version", 1).Error
+	})
+	return v, err
+}
+
+// strategyIDFromPath parses the {id} out of /strategies/{id}/...
+func strategyIDFromPath(path string) (uuid.UUID, []string, error) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(path, "/strategies/"), "/"), "/")
+	id, err := uuid.Parse(parts[0])
+	return id, parts[1:], err
+}
+
+// ownedStrategy loads the strategy in the URL and checks it belongs to the
+// session user, writing the HTTP error itself when it does not.
+func (h *StrategyHandler) ownedStrategy(w http.ResponseWriter, r *http.Request) (*models.Strategy, uuid.UUID, []string, bool) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return nil, uuid.Nil, nil, false
+	}
+
+	id, rest, err := strategyIDFromPath(r.URL.Path)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return nil, uuid.Nil, nil, false
+	}
+
+	var strategy models.Strategy
+	if err := h.DB.First(&strategy, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.NotFound(w, r)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return nil, uuid.Nil, nil, false
+	}
+	return &strategy, userID, rest, true
+}
+
+// GET /strategies/{id}/versions - list all versions, newest first
+// GET /strategies/{id}/versions/{n} - get a single version
+func (h *StrategyHandler) GetStrategyVersions(w http.ResponseWriter, r *http.Request) {
+	strategy, _, rest, ok := h.ownedStrategy(w, r)
+	if !ok {
+		return
+	}
+
+	if len(rest) > 1 {
+		n, err := strconv.Atoi(rest[1])
+		if err != nil || n < 1 {
+			http.Error(w, "Invalid version", http.StatusBadRequest)
+			return
+		}
+		version, err := loadStrategyVersion(h.DB, strategy.ID, n)
+		if err != nil {
+			if err == gorm.ErrRecordNotFound {
+				http.NotFound(w, r)
+			} else {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+			}
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(version)
+		return
+	}
+
+	var versions []models.StrategyVersion
+	if err := h.DB.Where("strategy_id = ?", strategy.ID).Order("version DESC").Find(&versions).Error; err != nil {
+		http.Error(w, "Failed to fetch strategy versions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(versions)
+}
+
+// GET /strategies/{id}/diff?from=1&to=2 - unified diff of the code between two versions
+func (h *StrategyHandler) DiffStrategyVersions(w http.ResponseWriter, r *http.Request) {
+	strategy, _, _, ok := h.ownedStrategy(w, r)
+	if !ok {
+		return
+	}
+
+	from, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil || from < 1 {
+		http.Error(w, "Invalid from version", http.StatusBadRequest)
+		return
+	}
+	to := 0 // latest
+	if s := r.URL.Query().Get("to"); s != "" {
+		if to, err = strconv.Atoi(s); err != nil || to < 1 {
+			http.Error(w, "Invalid to version", http.StatusBadRequest)
+			return
+		}
+	}
+
+	a, err := loadStrategyVersion(h.DB, strategy.ID, from)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Version %d not found", from), http.StatusNotFound)
+		return
+	}
+	b, err := loadStrategyVersion(h.DB, strategy.ID, to)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Version %d not found", to), http.StatusNotFound)
+		return
+	}
+
+	diff := textdiff.Unified(fmt.Sprintf("v%d", a.Version), fmt.Sprintf("v%d", b.Version), a.Code, b.Code)
+
+	if strings.Contains(r.Header.Get("Accept"), "text/plain") {
+		w.Header().Set("Content-Type", "text/x-diff; charset=utf-8")
+		w.Write([]byte(diff))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"from": a.Version,
+		"to":   b.Version,
+		"diff": diff,
+	})
+}
+
+type RollbackRequest struct {
+	Version int    `json:"version"`
+	Message string `json:"message"`
+}
+
+// POST /strategies/{id}/rollback - restore an earlier version's code as a new version
+func (h *StrategyHandler) RollbackStrategy(w http.ResponseWriter, r *http.Request) {
+	strategy, userID, _, ok := h.ownedStrategy(w, r)
+	if !ok {
+		return
+	}
+
+	var req RollbackRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.Version < 1 {
+		http.Error(w, "version is required", http.StatusBadRequest)
+		return
+	}
+
+	target, err := loadStrategyVersion(h.DB, strategy.ID, req.Version)
+	if err != nil {
+		http.Error(w, fmt.Sprintf("Version %d not found", req.Version), http.StatusNotFound)
+		return
+	}
+
+	message := req.Message
+	if message == "" {
+		message = fmt.Sprintf("Roll back to version %d", target.Version)
+	}
+
+	updated := *strategy
+	updated.Code = target.Code
+	updated.Symbol = target.Symbol
+	updated.Timeframe = target.Timeframe
+
+	err = h.DB.Transaction(func(tx *gorm.DB) error {
+		version, err := saveStrategyVersion(tx, strategy, &updated, userID, message)
+		if err != nil {
+			return err
+		}
+		updated.Version = version
+		return tx.Save(&updated).Error
+	})
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
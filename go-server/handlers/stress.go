@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/sessions"
+	"go-backend/models"
+	"go-backend/portfolio"
+	"gorm.io/gorm"
+)
+
+type StressHandler struct {
+	DB     *gorm.DB
+	Store  sessions.Store
+	Stress *portfolio.Stress
+}
+
+// GET /stress-scenarios - the user's saved scenarios
+func (h *StressHandler) GetScenarios(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+
+	scenarios := []models.StressScenario{}
+	if err := h.DB.Where("user_id = ?", userID).Order("id").Find(&scenarios).Error; err != nil {
+		http.Error(w, "Failed to fetch stress scenarios", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(scenarios)
+}
+
+// GET /stress-scenarios/presets - built-in scenarios by key
+func (h *StressHandler) GetPresets(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(portfolio.PresetScenarios)
+}
+
+// POST /stress-scenarios - save a scenario
+func (h *StressHandler) CreateScenario(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+
+	var s models.StressScenario
+	if err := json.NewDecoder(r.Body).Decode(&s); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if s.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if _, err := portfolio.ScenarioFromModel(&s); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.ID = 0
+	s.UserID = userID
+
+	if err := h.DB.Create(&s).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(s)
+}
+
+func (h *StressHandler) ownedScenario(w http.ResponseWriter, r *http.Request) (*models.StressScenario, bool) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return nil, false
+	}
+	id, err := strconv.Atoi(strings.Trim(strings.TrimPrefix(r.URL.Path, "/stress-scenarios/"), "/"))
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return nil, false
+	}
+
+	var s models.StressScenario
+	if err := h.DB.First(&s, "id = ? AND user_id = ?", id, userID).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.NotFound(w, r)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return nil, false
+	}
+	return &s, true
+}
+
+// PUT /stress-scenarios/{id} - update a saved scenario
+func (h *StressHandler) UpdateScenario(w http.ResponseWriter, r *http.Request) {
+	existing, ok := h.ownedScenario(w, r)
+	if !ok {
+		return
+	}
+
+	var updated models.StressScenario
+	if err := json.NewDecoder(r.Body).Decode(&updated); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if updated.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if _, err := portfolio.ScenarioFromModel(&updated); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	updated.ID = existing.ID
+	updated.UserID = existing.UserID
+	updated.CreatedAt = existing.CreatedAt
+
+	if err := h.DB.Save(&updated).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(updated)
+}
+
+// DELETE /stress-scenarios/{id} - delete a saved scenario
+func (h *StressHandler) DeleteScenario(w http.ResponseWriter, r *http.Request) {
+	s, ok := h.ownedScenario(w, r)
+	if !ok {
+		return
+	}
+	if err := h.DB.Delete(s).Error; err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// StressTestRequest names a saved scenario, a preset, or carries one inline.
+type StressTestRequest struct {
+	ScenarioID *uint               `json:"scenarioId"`
+	Preset     string              `json:"preset"`
+	Scenario   *portfolio.Scenario `json:"scenario"`
+}
+
+// POST /stress-test - run a scenario against the current portfolio
+func (h *StressHandler) RunStressTest(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+
+	var req StressTestRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var scenario portfolio.Scenario
+	switch {
+	case req.ScenarioID != nil:
+		var saved models.StressScenario
+		if err := h.DB.First(&saved, "id = ? AND user_id = ?", *req.ScenarioID, userID).Error; err != nil {
+			http.Error(w, "Stress scenario not found", http.StatusNotFound)
+			return
+		}
+		var err error
+		if scenario, err = portfolio.ScenarioFromModel(&saved); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	case req.Preset != "":
+		preset, ok := portfolio.PresetScenarios[req.Preset]
+		if !ok {
+			http.Error(w, "Unknown preset", http.StatusNotFound)
+			return
+		}
+		scenario = preset
+	case req.Scenario != nil:
+		scenario = *req.Scenario
+	default:
+		http.Error(w, "scenarioId, preset or scenario is required", http.StatusBadRequest)
+		return
+	}
+	if err := scenario.Validate(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.Stress.Run(userID, scenario)
+	if err != nil {
+		http.Error(w, "Failed to run stress test", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
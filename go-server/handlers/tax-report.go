@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/sessions"
+	"go-backend/taxreport"
+	"gorm.io/gorm"
+)
+
+type TaxReportHandler struct {
+	DB      *gorm.DB
+	Store   sessions.Store
+	Reports *taxreport.Generator
+}
+
+// GET /reports/tax?fy=2024-25&format=json|csv|pdf - realised P&L for a
+// financial year split into speculative, F&O, STCG and LTCG; the current
+// year by default
+func (h *TaxReportHandler) GetTaxReport(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	fy := taxreport.YearOf(time.Now())
+	if s := q.Get("fy"); s != "" {
+		var err error
+		if fy, err = taxreport.ParseYear(s); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	format := strings.ToLower(q.Get("format"))
+	if format == "" {
+		format = "json"
+	}
+	if format != "json" && format != "csv" && format != "pdf" {
+		http.Error(w, "format must be json, csv or pdf", http.StatusBadRequest)
+		return
+	}
+
+	report, err := h.Reports.Generate(userID, fy)
+	if err != nil {
+		if errors.Is(err, taxreport.ErrNoYear) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Failed to build tax report", http.StatusInternalServerError)
+		return
+	}
+
+	filename := fmt.Sprintf("tax-pnl-FY%s.%s", fy, format)
+	switch format {
+	case "csv":
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		report.WriteCSV(w)
+	case "pdf":
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", `attachment; filename="`+filename+`"`)
+		report.WritePDF(w)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
@@ -3,9 +3,12 @@ package handlers
 import (
     "encoding/json"
     "net/http"
+    "strconv"
     "strings"
     "time"
 
+    "go-backend/analytics"
+    "go-backend/calendar"
     "go-backend/models"
     "github.com/google/uuid"
     "github.com/gorilla/sessions"
@@ -13,43 +16,106 @@ import (
 )
 
 type TradeSummaryHandler struct {
-    DB    *gorm.DB
-    Store sessions.Store
+    DB       *gorm.DB
+    Store    sessions.Store
+    Calendar *calendar.Calendar // time zone for weekday, hour and month groups
 }
 
 //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 /// GET /trade-summaries - list all trade summaries for the user
 func (h *TradeSummaryHandler) GetTradeSummaries(w http.ResponseWriter, r *http.Request) {
-    session, err := h.Store.Get(r, "Go-session-id")
-    if err != nil {
-        http.Error(w, "Failed to get session", http.StatusInternalServerError)
+    userID, ok := sessionUser(h.Store, w, r)
+    if !ok {
         return
     }
 
-    var userID uuid.UUID
+    var tradeSummaries []models.TradeSummary
+    if err := h.DB.Where("user_id = ?", userID).Find(&tradeSummaries).Error; err != nil {
+        http.Error(w, "Failed to fetch trade summaries", http.StatusInternalServerError)
+        return
+    }
 
-    switch v := session.Values["user_id"].(type) {
-    case string:
-        userID, err = uuid.Parse(v)
+    w.Header().Set("Content-Type", "application/json")
+    json.NewEncoder(w).Encode(tradeSummaries)
+}
+
+////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
+// GET /trade-summaries/analytics?from=&to=&strategyId=&instrument=&capital= - win rate,
+// profit factor, expectancy, streaks and an equity curve with drawdowns, overall and
+// grouped by strategy, instrument, weekday, hour and month
+func (h *TradeSummaryHandler) GetTradeAnalytics(w http.ResponseWriter, r *http.Request) {
+    userID, ok := sessionUser(h.Store, w, r)
+    if !ok {
+        return
+    }
+
+    query := r.URL.Query()
+    q := h.DB.Where("user_id = ?", userID)
+    if s := query.Get("from"); s != "" {
+        from, err := parseDay(s)
         if err != nil {
-            http.Error(w, "Invalid user ID in session", http.StatusInternalServerError)
+            http.Error(w, "Invalid from, expected YYYY-MM-DD or RFC3339", http.StatusBadRequest)
             return
         }
-    case uuid.UUID:
-        userID = v
-    default:
-        http.Error(w, "User not authenticated", http.StatusUnauthorized)
-        return
+        q = q.Where("exit_time >= ?", from)
+    }
+    if s := query.Get("to"); s != "" {
+        to, err := parseDay(s)
+        if err != nil {
+            http.Error(w, "Invalid to, expected YYYY-MM-DD or RFC3339", http.StatusBadRequest)
+            return
+        }
+        if len(s) == len("2006-01-02") {
+            q = q.Where("exit_time < ?", to.AddDate(0, 0, 1)) // the whole day
+        } else {
+            q = q.Where("exit_time <= ?", to)
+        }
+    }
+    var strategyIDs []uuid.UUID
+    for _, v := range query["strategyId"] {
+        for _, s := range strings.Split(v, ",") {
+            id, err := uuid.Parse(strings.TrimSpace(s))
+            if err != nil {
+                http.Error(w, "Invalid strategy ID", http.StatusBadRequest)
+                return
+            }
+            strategyIDs = append(strategyIDs, id)
+        }
+    }
+    if len(strategyIDs) > 0 {
+        q = q.Where("strategy_id IN ?", strategyIDs)
+    }
+    if s := strings.TrimSpace(query.Get("instrument")); s != "" {
+        q = q.Where("UPPER(instrument) = ?", strings.ToUpper(s))
+    }
+    opts := analytics.Options{Strategies: map[uuid.UUID]string{}}
+    if s := query.Get("capital"); s != "" {
+        var err error
+        if opts.Capital, err = strconv.ParseFloat(s, 64); err != nil || opts.Capital < 0 {
+            http.Error(w, "capital must be a non-negative number", http.StatusBadRequest)
+            return
+        }
+    }
+    if h.Calendar != nil {
+        opts.Location = h.Calendar.Location()
     }
 
     var tradeSummaries []models.TradeSummary
-    if err := h.DB.Where("user_id = ?", userID).Find(&tradeSummaries).Error; err != nil {
+    if err := q.Order("exit_time").Find(&tradeSummaries).Error; err != nil {
         http.Error(w, "Failed to fetch trade summaries", http.StatusInternalServerError)
         return
     }
+    var strategies []models.Strategy
+    if err := h.DB.Select("id, name").Where("user_id = ?", userID).Find(&strategies).Error; err != nil {
+        http.Error(w, "Failed to fetch strategies", http.StatusInternalServerError)
+        return
+    }
+    for _, s := range strategies {
+        opts.Strategies[s.ID] = s.Name
+    }
 
     w.Header().Set("Content-Type", "application/json")
-    json.NewEncoder(w).Encode(tradeSummaries)
+    json.NewEncoder(w).Encode(analytics.Analyze(tradeSummaries, opts))
 }
 
 ////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
@@ -89,24 +155,8 @@ type TradeSummaryRequest struct {
 
 // POST /trade-summaries - create a new trade summary
 func (h *TradeSummaryHandler) CreateTradeSummary(w http.ResponseWriter, r *http.Request) {
-    session, err := h.Store.Get(r, "Go-session-id")
-    if err != nil {
-        http.Error(w, "Failed to get session", http.StatusInternalServerError)
-        return
-    }
-
-    var userID uuid.UUID
-    switch v := session.Values["user_id"].(type) {
-    case string:
-        userID, err = uuid.Parse(v)
-        if err != nil {
-            http.Error(w, "Invalid user ID in session", http.StatusInternalServerError)
-            return
-        }
-    case uuid.UUID:
-        userID = v
-    default:
-        http.Error(w, "User not authenticated", http.StatusUnauthorized)
+    userID, ok := sessionUser(h.Store, w, r)
+    if !ok {
         return
     }
 
@@ -0,0 +1,100 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/sessions"
+	"go-backend/models"
+	"go-backend/tradebook"
+	"gorm.io/gorm"
+)
+
+type TradebookHandler struct {
+	DB       *gorm.DB
+	Store    sessions.Store
+	Importer *tradebook.Importer
+}
+
+const maxTradebookBytes = 32 << 20
+
+// POST /imports/tradebook?format=zerodha|upstox|generic&strategyId=&brokerId=&product=&dryRun=true
+// - import a broker tradebook export (CSV or XLSX), sent as a multipart
+// "file" or as the body. Generic exports take a JSON column "mapping",
+// e.g. {"symbol":"Scrip","time":"Executed At"}.
+func (h *TradebookHandler) Import(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, maxTradebookBytes)
+	var body io.Reader = r.Body
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/form-data") {
+		file, _, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "Missing file: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+	data, err := io.ReadAll(body)
+	if err != nil {
+		http.Error(w, "Failed to read upload: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	opts := tradebook.Options{UserID: userID, Product: r.FormValue("product")}
+	opts.DryRun, _ = strconv.ParseBool(r.FormValue("dryRun"))
+	if s := r.FormValue("strategyId"); s != "" {
+		if opts.StrategyID, err = uuid.Parse(s); err != nil {
+			http.Error(w, "Invalid strategy ID", http.StatusBadRequest)
+			return
+		}
+		var strategy models.Strategy
+		if err := h.DB.First(&strategy, "id = ? AND user_id = ?", opts.StrategyID, userID).Error; err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				http.Error(w, "Strategy not found", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Failed to fetch strategy", http.StatusInternalServerError)
+			return
+		}
+	}
+	if s := r.FormValue("brokerId"); s != "" {
+		id, err := strconv.ParseUint(s, 10, 64)
+		if err != nil {
+			http.Error(w, "Invalid broker ID", http.StatusBadRequest)
+			return
+		}
+		broker := uint(id)
+		opts.BrokerID = &broker
+	}
+	var mapping tradebook.Mapping
+	if s := r.FormValue("mapping"); s != "" {
+		if err := json.Unmarshal([]byte(s), &mapping); err != nil {
+			http.Error(w, "Invalid mapping: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := mapping.Validate(); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	res, err := h.Importer.Import(data, strings.ToLower(r.FormValue("format")), mapping, opts)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": err.Error(), "result": res})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(res)
+}
@@ -19,25 +19,8 @@ type TradingWorkflowHandler struct {
 //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 /// GET /trading-workflows - list all trading workflows for the user
 func (h *TradingWorkflowHandler) GetTradingWorkflows(w http.ResponseWriter, r *http.Request) {
-    session, err := h.Store.Get(r, "Go-session-id")
-    if err != nil {
-        http.Error(w, "Failed to get session", http.StatusInternalServerError)
-        return
-    }
-
-    var userID uuid.UUID
-
-    switch v := session.Values["user_id"].(type) {
-    case string:
-        userID, err = uuid.Parse(v)
-        if err != nil {
-            http.Error(w, "Invalid user ID in session", http.StatusInternalServerError)
-            return
-        }
-    case uuid.UUID:
-        userID = v
-    default:
-        http.Error(w, "User not authenticated", http.StatusUnauthorized)
+    userID, ok := sessionUser(h.Store, w, r)
+    if !ok {
         return
     }
 
@@ -86,24 +69,8 @@ type TradingWorkflowRequest struct {
 
 // POST /trading-workflows - create a new trading workflow
 func (h *TradingWorkflowHandler) CreateTradingWorkflow(w http.ResponseWriter, r *http.Request) {
-    session, err := h.Store.Get(r, "Go-session-id")
-    if err != nil {
-        http.Error(w, "Failed to get session", http.StatusInternalServerError)
-        return
-    }
-
-    var userID uuid.UUID
-    switch v := session.Values["user_id"].(type) {
-    case string:
-        userID, err = uuid.Parse(v)
-        if err != nil {
-            http.Error(w, "Invalid user ID in session", http.StatusInternalServerError)
-            return
-        }
-    case uuid.UUID:
-        userID = v
-    default:
-        http.Error(w, "User not authenticated", http.StatusUnauthorized)
+    userID, ok := sessionUser(h.Store, w, r)
+    if !ok {
         return
     }
 
@@ -5,6 +5,7 @@ import (
     "net/http"
     "strings"
 
+    "go-backend/charges"
     "go-backend/models"
     "github.com/google/uuid"
     "github.com/gorilla/sessions"
@@ -12,32 +13,16 @@ import (
 )
 
 type TransactionHandler struct {
-    DB    *gorm.DB
-    Store sessions.Store
+    DB      *gorm.DB
+    Store   sessions.Store
+    Charges *charges.Service
 }
 
 //////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////////
 /// GET /transactions - list all transactions for the user
 func (h *TransactionHandler) GetTransactions(w http.ResponseWriter, r *http.Request) {
-    session, err := h.Store.Get(r, "Go-session-id")
-    if err != nil {
-        http.Error(w, "Failed to get session", http.StatusInternalServerError)
-        return
-    }
-
-    var userID uuid.UUID
-
-    switch v := session.Values["user_id"].(type) {
-    case string:
-        userID, err = uuid.Parse(v)
-        if err != nil {
-            http.Error(w, "Invalid user ID in session", http.StatusInternalServerError)
-            return
-        }
-    case uuid.UUID:
-        userID = v
-    default:
-        http.Error(w, "User not authenticated", http.StatusUnauthorized)
+    userID, ok := sessionUser(h.Store, w, r)
+    if !ok {
         return
     }
 
@@ -117,6 +102,14 @@ func (h *TransactionHandler) CreateTransaction(w http.ResponseWriter, r *http.Re
         CostOfTrade: req.CostOfTrade,
     }
 
+    // Fills booked without costs are priced from the order's charge plan
+    if h.Charges != nil && transaction.Brokerage == 0 && transaction.Taxes == 0 {
+        var order models.Order
+        if err := h.DB.First(&order, "id = ?", req.OrderID).Error; err == nil {
+            h.Charges.Apply(&order, &transaction)
+        }
+    }
+
     if err := h.DB.Create(&transaction).Error; err != nil {
         http.Error(w, err.Error(), http.StatusInternalServerError)
         return
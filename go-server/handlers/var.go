@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/google/uuid"
+	"github.com/gorilla/sessions"
+	"go-backend/models"
+	"go-backend/portfolio"
+	"gorm.io/gorm"
+)
+
+type VaRHandler struct {
+	DB    *gorm.DB
+	Store sessions.Store
+	VaR   *portfolio.VaR
+}
+
+type VaRResponse struct {
+	Account    *portfolio.VaRReport   `json:"account,omitempty"`
+	Strategies []*portfolio.VaRReport `json:"strategies"`
+}
+
+// GET /var?strategyId= - one-day VaR and expected shortfall for the account
+// and each deployed strategy, or for one strategy
+func (h *VaRHandler) GetVaR(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+
+	resp := VaRResponse{Strategies: []*portfolio.VaRReport{}}
+	var strategies []uuid.UUID
+	if s := r.URL.Query().Get("strategyId"); s != "" {
+		id, err := uuid.Parse(s)
+		if err != nil {
+			http.Error(w, "Invalid strategyId", http.StatusBadRequest)
+			return
+		}
+		strategies = []uuid.UUID{id}
+	} else {
+		account, err := h.VaR.Compute(userID, nil)
+		if err != nil {
+			http.Error(w, "Failed to compute VaR", http.StatusInternalServerError)
+			return
+		}
+		resp.Account = account
+		if err := h.DB.Model(&models.DeployedStrategy{}).
+			Where("user_id = ? AND status <> ?", userID, models.DeploymentStatusStopped).
+			Distinct("strategy_id").Pluck("strategy_id", &strategies).Error; err != nil {
+			http.Error(w, "Failed to fetch deployed strategies", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	for i := range strategies {
+		report, err := h.VaR.Compute(userID, &strategies[i])
+		if err != nil {
+			http.Error(w, "Failed to compute VaR", http.StatusInternalServerError)
+			return
+		}
+		resp.Strategies = append(resp.Strategies, report)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -2,16 +2,25 @@ package handlers
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/google/uuid"
+	"github.com/gorilla/sessions"
+	"go-backend/broker"
 	"go-backend/models"
+	"go-backend/sizing"
 	"gorm.io/gorm"
 )
 
 type WorkflowActionHandler struct {
-	DB *gorm.DB
+	DB      *gorm.DB
+	Store   sessions.Store
+	Brokers *broker.Registry
+	Sizing  *sizing.Service
 }
 
 func (h *WorkflowActionHandler) GetWorkflowActions(w http.ResponseWriter, r *http.Request) {
@@ -84,3 +93,191 @@ func (h *WorkflowActionHandler) UpdateWorkflowAction(w http.ResponseWriter, r *h
 	}
 	json.NewEncoder(w).Encode(updated)
 }
+
+// POST /workflow-actions/{id}/execute - run a buy or sell action for the
+// session user. The order goes through the same pre-trade checks as any other.
+func (h *WorkflowActionHandler) ExecuteWorkflowAction(w http.ResponseWriter, r *http.Request) {
+	userID, ok := sessionUser(h.Store, w, r)
+	if !ok {
+		return
+	}
+
+	idStr := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/workflow-actions/"), "/execute")
+	id, err := strconv.Atoi(idStr)
+	if err != nil {
+		http.Error(w, "Invalid ID", http.StatusBadRequest)
+		return
+	}
+	// Only actions of the user's own workflows run. workflow_id is an integer
+	// column and trading_workflows.id a uuid, so they are compared as text.
+	var action models.WorkflowAction
+	if err := h.DB.Joins("JOIN trading_workflows ON trading_workflows.id::text = workflow_actions.workflow_id::text").
+		Where("workflow_actions.id = ? AND trading_workflows.user_id = ?", id, userID).
+		First(&action).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			http.NotFound(w, r)
+		} else {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+	if !action.IsEnabled {
+		http.Error(w, "Workflow action is disabled", http.StatusConflict)
+		return
+	}
+
+	order, params, err := workflowOrder(&action, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if params.BrokerID != nil && !h.Brokers.Owns(userID, *params.BrokerID) {
+		http.Error(w, "Broker connection does not belong to you", http.StatusForbidden)
+		return
+	}
+	if order.Quantity == 0 {
+		if err := h.sizeWorkflowOrder(order, params); err != nil {
+			http.Error(w, "Position sizing failed: "+err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+	}
+
+	submitErr := broker.Submit(r.Context(), h.DB, h.Brokers, order)
+	now := time.Now()
+	status := "success"
+	var errMsg *string
+	if submitErr != nil {
+		status = "failed"
+		msg := submitErr.Error()
+		errMsg = &msg
+	}
+	h.DB.Model(&action).Updates(map[string]interface{}{
+		"last_executed":    now,
+		"execution_status": status,
+		"error_message":    errMsg,
+	})
+
+	if submitErr != nil {
+		writeOrderRejected(w, order, submitErr)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(order)
+}
+
+// workflowAdditionalParams are the optional order settings carried in
+// WorkflowAction.AdditionalParams.
+type workflowAdditionalParams struct {
+	Exchange   string     `json:"exchange"`
+	BrokerID   *uint      `json:"brokerId"`
+	StrategyID *uuid.UUID `json:"strategyId"`
+	// Used when Quantity is "auto" to size with the position sizing rule
+	StopLoss  float64 `json:"stopLoss"`
+	Capital   float64 `json:"capital"`
+	Timeframe string  `json:"timeframe"`
+}
+
+// workflowOrder builds the order a buy/sell workflow action describes. A
+// quantity of "auto" is left at zero for the caller to size.
+func workflowOrder(a *models.WorkflowAction, userID uuid.UUID) (*models.Order, *workflowAdditionalParams, error) {
+	var params workflowAdditionalParams
+	if len(a.AdditionalParams) > 0 {
+		if err := json.Unmarshal(a.AdditionalParams, &params); err != nil {
+			return nil, nil, fmt.Errorf("invalid additionalParams: %v", err)
+		}
+	}
+
+	side := strings.ToUpper(a.ActionType)
+	if side != "BUY" && side != "SELL" {
+		return nil, nil, fmt.Errorf("action type %q does not place orders", a.ActionType)
+	}
+	if a.Symbol == nil || *a.Symbol == "" {
+		return nil, nil, fmt.Errorf("action has no symbol")
+	}
+	if a.Quantity == nil {
+		return nil, nil, fmt.Errorf("action has no quantity")
+	}
+	qty := 0
+	if q := strings.TrimSpace(*a.Quantity); !strings.EqualFold(q, "auto") {
+		var err error
+		if qty, err = strconv.Atoi(q); err != nil || qty <= 0 {
+			return nil, nil, fmt.Errorf("invalid quantity %q", *a.Quantity)
+		}
+	}
+
+	order := &models.Order{
+		UserID:     userID,
+		Instrument: *a.Symbol,
+		Exchange:   params.Exchange,
+		Quantity:   qty,
+		OrderType:  "MARKET",
+		Side:       side,
+		BrokerID:   params.BrokerID,
+		IsPaper:    params.BrokerID == nil,
+	}
+	if params.StrategyID != nil {
+		order.StrategyID = *params.StrategyID
+	}
+	if a.OrderType != nil && *a.OrderType != "" {
+		order.OrderType = strings.ToUpper(*a.OrderType)
+	}
+	if a.Price != nil && *a.Price != "" {
+		var err error
+		if order.Price, err = strconv.ParseFloat(strings.TrimSpace(*a.Price), 64); err != nil {
+			return nil, nil, fmt.Errorf("invalid price %q", *a.Price)
+		}
+	}
+	return order, &params, nil
+}
+
+// sizeWorkflowOrder sets the quantity of an "auto" order from the user's
+// position sizing rule, entering at the order price or the last price.
+func (h *WorkflowActionHandler) sizeWorkflowOrder(order *models.Order, params *workflowAdditionalParams) error {
+	if h.Sizing == nil {
+		return fmt.Errorf("position sizing is not available")
+	}
+	if params.Capital <= 0 {
+		return fmt.Errorf("additionalParams.capital is required to size an order")
+	}
+	rule, err := h.Sizing.Rule(order.UserID, order.StrategyID)
+	if err != nil {
+		if err == gorm.ErrRecordNotFound {
+			return fmt.Errorf("no active position sizing rule")
+		}
+		return err
+	}
+	entry := order.Price
+	if entry <= 0 {
+		var ok bool
+		if entry, ok = h.Sizing.LastPrice(order.Instrument); !ok {
+			return fmt.Errorf("no price available for %s", order.Instrument)
+		}
+	}
+
+	p := sizing.FromRule(rule)
+	bars, err := h.Sizing.Bars(p, order.Instrument, params.Timeframe)
+	if err != nil {
+		return err
+	}
+	var stats *sizing.Stats
+	if order.StrategyID != uuid.Nil {
+		stats = h.Sizing.StrategyStats(order.UserID, order.StrategyID)
+	}
+	res, err := sizing.Size(p, sizing.Market{
+		Equity:  params.Capital,
+		Entry:   entry,
+		Stop:    params.StopLoss,
+		Bars:    bars,
+		LotSize: sizing.LotSize(order.Exchange, order.Instrument),
+		Stats:   stats,
+	})
+	if err != nil {
+		return err
+	}
+	if res.Quantity <= 0 {
+		return fmt.Errorf("rule %q sizes this trade below one lot", rule.Name)
+	}
+	order.Quantity = res.Quantity
+	return nil
+}
@@ -5,12 +5,14 @@ import (
 	"net/http"
 	"strconv"
 
+	"go-backend/instruments"
 	"go-backend/models"
 	"gorm.io/gorm"
 )
 
 type WorkflowConditionHandler struct {
-	DB *gorm.DB
+	DB          *gorm.DB
+	Instruments *instruments.Resolver
 }
 
 // GET /workflow-conditions
@@ -51,6 +53,11 @@ func (h *WorkflowConditionHandler) Create(w http.ResponseWriter, r *http.Request
 		http.Error(w, err.Error(), http.StatusBadRequest)
 		return
 	}
+	symbol, ok := normalizeSymbol(w, h.Instruments, cond.Symbol)
+	if !ok {
+		return
+	}
+	cond.Symbol = symbol
 	if err := h.DB.Create(&cond).Error; err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -84,6 +91,11 @@ func (h *WorkflowConditionHandler) Update(w http.ResponseWriter, r *http.Request
 		return
 	}
 	updated.ID = existing.ID
+	symbol, ok := normalizeSymbol(w, h.Instruments, updated.Symbol)
+	if !ok {
+		return
+	}
+	updated.Symbol = symbol
 	if err := h.DB.Save(&updated).Error; err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
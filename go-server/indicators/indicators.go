@@ -0,0 +1,183 @@
+package indicators
+
+import "math"
+
+// All indicators take a series ordered oldest first and return a series of the
+// same length. Values that cannot be computed yet (warm-up) are NaN.
+
+func nanSeries(n int) []float64 {
+	out := make([]float64, n)
+	for i := range out {
+		out[i] = math.NaN()
+	}
+	return out
+}
+
+// SMA returns the simple moving average of src over period bars.
+func SMA(src []float64, period int) []float64 {
+	out := nanSeries(len(src))
+	if period <= 0 {
+		return out
+	}
+	sum := 0.0
+	for i, v := range src {
+		sum += v
+		if i >= period {
+			sum -= src[i-period]
+		}
+		if i >= period-1 {
+			out[i] = sum / float64(period)
+		}
+	}
+	return out
+}
+
+// EMA returns the exponential moving average of src, seeded with the SMA of
+// the first period values.
+func EMA(src []float64, period int) []float64 {
+	out := nanSeries(len(src))
+	if period <= 0 || len(src) < period {
+		return out
+	}
+	alpha := 2.0 / float64(period+1)
+	seed := 0.0
+	for i := 0; i < period; i++ {
+		seed += src[i]
+	}
+	prev := seed / float64(period)
+	out[period-1] = prev
+	for i := period; i < len(src); i++ {
+		prev = alpha*src[i] + (1-alpha)*prev
+		out[i] = prev
+	}
+	return out
+}
+
+// RSI returns Wilder's relative strength index of src.
+func RSI(src []float64, period int) []float64 {
+	out := nanSeries(len(src))
+	if period <= 0 || len(src) <= period {
+		return out
+	}
+	gain, loss := 0.0, 0.0
+	for i := 1; i <= period; i++ {
+		d := src[i] - src[i-1]
+		if d > 0 {
+			gain += d
+		} else {
+			loss -= d
+		}
+	}
+	avgGain := gain / float64(period)
+	avgLoss := loss / float64(period)
+	out[period] = rsiValue(avgGain, avgLoss)
+	for i := period + 1; i < len(src); i++ {
+		d := src[i] - src[i-1]
+		g, l := 0.0, 0.0
+		if d > 0 {
+			g = d
+		} else {
+			l = -d
+		}
+		avgGain = (avgGain*float64(period-1) + g) / float64(period)
+		avgLoss = (avgLoss*float64(period-1) + l) / float64(period)
+		out[i] = rsiValue(avgGain, avgLoss)
+	}
+	return out
+}
+
+func rsiValue(avgGain, avgLoss float64) float64 {
+	if avgLoss == 0 {
+		return 100
+	}
+	rs := avgGain / avgLoss
+	return 100 - 100/(1+rs)
+}
+
+// TrueRange returns the true range of each bar.
+func TrueRange(high, low, close []float64) []float64 {
+	out := make([]float64, len(close))
+	for i := range close {
+		tr := high[i] - low[i]
+		if i > 0 {
+			tr = math.Max(tr, math.Abs(high[i]-close[i-1]))
+			tr = math.Max(tr, math.Abs(low[i]-close[i-1]))
+		}
+		out[i] = tr
+	}
+	return out
+}
+
+// ATR returns Wilder's average true range.
+func ATR(high, low, close []float64, period int) []float64 {
+	tr := TrueRange(high, low, close)
+	out := nanSeries(len(tr))
+	if period <= 0 || len(tr) < period {
+		return out
+	}
+	sum := 0.0
+	for i := 0; i < period; i++ {
+		sum += tr[i]
+	}
+	prev := sum / float64(period)
+	out[period-1] = prev
+	for i := period; i < len(tr); i++ {
+		prev = (prev*float64(period-1) + tr[i]) / float64(period)
+		out[i] = prev
+	}
+	return out
+}
+
+// StdDev returns the rolling population standard deviation of src.
+func StdDev(src []float64, period int) []float64 {
+	out := nanSeries(len(src))
+	if period <= 0 {
+		return out
+	}
+	mean := SMA(src, period)
+	for i := period - 1; i < len(src); i++ {
+		ss := 0.0
+		for j := i - period + 1; j <= i; j++ {
+			d := src[j] - mean[i]
+			ss += d * d
+		}
+		out[i] = math.Sqrt(ss / float64(period))
+	}
+	return out
+}
+
+// Highest returns the rolling maximum of src.
+func Highest(src []float64, period int) []float64 {
+	return rolling(src, period, math.Max)
+}
+
+// Lowest returns the rolling minimum of src.
+func Lowest(src []float64, period int) []float64 {
+	return rolling(src, period, math.Min)
+}
+
+func rolling(src []float64, period int, pick func(a, b float64) float64) []float64 {
+	out := nanSeries(len(src))
+	if period <= 0 {
+		return out
+	}
+	for i := period - 1; i < len(src); i++ {
+		v := src[i-period+1]
+		for j := i - period + 2; j <= i; j++ {
+			v = pick(v, src[j])
+		}
+		out[i] = v
+	}
+	return out
+}
+
+// MACD returns the difference between the fast and slow EMA of src.
+func MACD(src []float64, fast, slow int) []float64 {
+	f := EMA(src, fast)
+	s := EMA(src, slow)
+	out := make([]float64, len(src))
+	for i := range src {
+		out[i] = f[i] - s[i]
+	}
+	return out
+}
@@ -0,0 +1,351 @@
+// Package instruments is the instrument master: contracts loaded from
+// broker instrument dumps, and a resolver that maps the free-text symbols
+// users and brokers send ("NIFTY", "NSE:NIFTY 50", a Kite token) to one
+// exchange trading symbol.
+package instruments
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Dump formats Load understands.
+const (
+	FormatZerodha = "zerodha" // Kite instruments.csv
+	FormatUpstox  = "upstox"  // Upstox complete.csv
+	FormatGeneric = "generic" // exchange,tradingsymbol plus any optional columns
+)
+
+// ImportResult summarises a Load.
+type ImportResult struct {
+	Format   string   `json:"format"`
+	Rows     int      `json:"rows"`
+	Imported int      `json:"imported"`
+	Skipped  int      `json:"skipped"`
+	Pruned   int64    `json:"pruned"`           // expired contracts removed
+	Errors   []string `json:"errors,omitempty"` // the first few rows that were skipped
+}
+
+const (
+	batchSize = 500
+	maxErrors = 20
+)
+
+// Load reads an instrument dump and upserts it into the master. format may
+// be empty to detect it from the header; broker names the tokens of a
+// generic dump. Contracts that expired before today are pruned.
+func Load(db *gorm.DB, r io.Reader, format, broker string) (*ImportResult, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("read header: %w", err)
+	}
+	cols := map[string]int{}
+	for i, h := range header {
+		cols[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))] = i
+	}
+	if format == "" {
+		format = detect(cols)
+	}
+	parse, ok := parsers[format]
+	if !ok {
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+	if format != FormatGeneric {
+		broker = format
+	}
+
+	res := &ImportResult{Format: format}
+	var batch []row
+	for {
+		rec, err := cr.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return res, fmt.Errorf("line %d: %w", res.Rows+2, err)
+		}
+		res.Rows++
+		get := func(name string) string {
+			if i, ok := cols[name]; ok && i < len(rec) {
+				return strings.TrimSpace(rec[i])
+			}
+			return ""
+		}
+		rw, err := parse(get)
+		if err != nil {
+			res.Skipped++
+			if len(res.Errors) < maxErrors {
+				res.Errors = append(res.Errors, fmt.Sprintf("line %d: %v", res.Rows+1, err))
+			}
+			continue
+		}
+		rw.broker = broker
+		batch = append(batch, rw)
+		if len(batch) == batchSize {
+			if err := upsert(db, batch); err != nil {
+				return res, err
+			}
+			res.Imported += len(batch)
+			batch = batch[:0]
+		}
+	}
+	if len(batch) > 0 {
+		if err := upsert(db, batch); err != nil {
+			return res, err
+		}
+		res.Imported += len(batch)
+	}
+
+	res.Pruned, err = Prune(db, time.Now())
+	return res, err
+}
+
+// Prune removes contracts that expired before the day of now.
+func Prune(db *gorm.DB, now time.Time) (int64, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	expired := db.Model(&models.Instrument{}).Select("id").Where("expiry < ?", today)
+	if err := db.Where("instrument_id IN (?)", expired).Delete(&models.InstrumentToken{}).Error; err != nil {
+		return 0, err
+	}
+	tx := db.Where("expiry < ?", today).Delete(&models.Instrument{})
+	return tx.RowsAffected, tx.Error
+}
+
+type row struct {
+	inst   models.Instrument
+	broker string
+	token  string
+}
+
+func upsert(db *gorm.DB, batch []row) error {
+	// Postgres refuses to update a row twice in one statement, so a symbol
+	// listed twice in a batch keeps its last row.
+	seen := map[string]int{}
+	var insts []models.Instrument
+	var rows []row
+	for _, r := range batch {
+		key := r.inst.Exchange + ":" + r.inst.TradingSymbol
+		if i, ok := seen[key]; ok {
+			insts[i], rows[i] = r.inst, r
+			continue
+		}
+		seen[key] = len(insts)
+		insts = append(insts, r.inst)
+		rows = append(rows, r)
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "exchange"}, {Name: "trading_symbol"}},
+			DoUpdates: clause.AssignmentColumns([]string{"segment", "instrument_type", "name", "underlying",
+				"lot_size", "tick_size", "expiry", "strike", "option_type", "updated_at"}),
+		}).Create(&insts).Error
+		if err != nil {
+			return err
+		}
+		var tokens []models.InstrumentToken
+		seenTokens := map[string]bool{}
+		for i, r := range rows {
+			if r.token == "" || r.broker == "" || insts[i].ID == 0 || seenTokens[r.token] {
+				continue
+			}
+			seenTokens[r.token] = true
+			tokens = append(tokens, models.InstrumentToken{InstrumentID: insts[i].ID, Broker: r.broker, Token: r.token})
+		}
+		if len(tokens) == 0 {
+			return nil
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "broker"}, {Name: "token"}},
+			DoUpdates: clause.AssignmentColumns([]string{"instrument_id"}),
+		}).Create(&tokens).Error
+	})
+}
+
+func detect(cols map[string]int) string {
+	has := func(name string) bool { _, ok := cols[name]; return ok }
+	switch {
+	case has("instrument_key"):
+		return FormatUpstox
+	case has("instrument_token") && has("segment"):
+		return FormatZerodha
+	}
+	return FormatGeneric
+}
+
+var parsers = map[string]func(get func(string) string) (row, error){
+	FormatZerodha: parseZerodha,
+	FormatUpstox:  parseUpstox,
+	FormatGeneric: parseGeneric,
+}
+
+// parseZerodha reads a Kite row. Indices are EQ rows in the INDICES
+// segment; derivatives name their underlying.
+func parseZerodha(get func(string) string) (row, error) {
+	var rw row
+	in := &rw.inst
+	in.Exchange = strings.ToUpper(get("exchange"))
+	in.TradingSymbol = strings.ToUpper(get("tradingsymbol"))
+	in.Segment = strings.ToUpper(get("segment"))
+	in.Name = get("name")
+	in.InstrumentType = strings.ToUpper(get("instrument_type"))
+	if in.Segment == "INDICES" {
+		in.InstrumentType = models.InstrumentIndex
+	}
+	if err := fill(in, get("lot_size"), get("tick_size"), get("expiry"), get("strike")); err != nil {
+		return rw, err
+	}
+	rw.token = get("instrument_token")
+	return rw, finish(in)
+}
+
+// upstoxExchanges maps Upstox's exchange segments to exchange codes.
+var upstoxExchanges = map[string]string{
+	"NSE_EQ": "NSE", "BSE_EQ": "BSE", "NSE_INDEX": "NSE", "BSE_INDEX": "BSE",
+	"NSE_FO": "NFO", "BSE_FO": "BFO", "MCX_FO": "MCX", "NCD_FO": "CDS", "BCD_FO": "BCD",
+}
+
+// parseUpstox reads an Upstox row. Upstox quotes tick sizes in paise and
+// names derivative types FUTIDX, OPTSTK and so on with the side in
+// option_type.
+func parseUpstox(get func(string) string) (row, error) {
+	var rw row
+	in := &rw.inst
+	seg := strings.ToUpper(get("exchange"))
+	ex, ok := upstoxExchanges[seg]
+	if !ok {
+		return rw, fmt.Errorf("unknown exchange %q", seg)
+	}
+	in.Exchange = ex
+	in.TradingSymbol = strings.ToUpper(get("tradingsymbol"))
+	in.Name = get("name")
+	typ := strings.ToUpper(get("instrument_type"))
+	switch {
+	case strings.HasSuffix(seg, "_INDEX") || typ == "INDEX":
+		in.InstrumentType = models.InstrumentIndex
+	case strings.HasPrefix(typ, "FUT"):
+		in.InstrumentType = models.InstrumentFuture
+	case strings.HasPrefix(typ, "OPT"):
+		in.InstrumentType = strings.ToUpper(get("option_type"))
+	default:
+		in.InstrumentType = models.InstrumentEquity
+	}
+	if err := fill(in, get("lot_size"), get("tick_size"), get("expiry"), get("strike")); err != nil {
+		return rw, err
+	}
+	in.TickSize /= 100
+	rw.token = get("instrument_key")
+	return rw, finish(in)
+}
+
+// parseGeneric reads a dump with at least exchange and tradingsymbol (or
+// symbol) columns.
+func parseGeneric(get func(string) string) (row, error) {
+	var rw row
+	in := &rw.inst
+	in.Exchange = strings.ToUpper(get("exchange"))
+	in.TradingSymbol = strings.ToUpper(get("tradingsymbol"))
+	if in.TradingSymbol == "" {
+		in.TradingSymbol = strings.ToUpper(get("symbol"))
+	}
+	in.Segment = strings.ToUpper(get("segment"))
+	in.Name = get("name")
+	in.Underlying = strings.ToUpper(get("underlying"))
+	in.InstrumentType = strings.ToUpper(get("instrument_type"))
+	if ot := strings.ToUpper(get("option_type")); ot == models.InstrumentCall || ot == models.InstrumentPut {
+		in.InstrumentType = ot
+	}
+	if err := fill(in, get("lot_size"), get("tick_size"), get("expiry"), get("strike")); err != nil {
+		return rw, err
+	}
+	rw.token = get("token")
+	return rw, finish(in)
+}
+
+func fill(in *models.Instrument, lot, tick, expiry, strike string) error {
+	var err error
+	if lot != "" {
+		if in.LotSize, err = strconv.Atoi(strings.TrimSuffix(lot, ".0")); err != nil {
+			return fmt.Errorf("invalid lot_size %q", lot)
+		}
+	}
+	if tick != "" {
+		if in.TickSize, err = strconv.ParseFloat(tick, 64); err != nil {
+			return fmt.Errorf("invalid tick_size %q", tick)
+		}
+	}
+	if strike != "" {
+		if in.Strike, err = strconv.ParseFloat(strike, 64); err != nil {
+			return fmt.Errorf("invalid strike %q", strike)
+		}
+	}
+	if expiry != "" {
+		t, err := parseDate(expiry)
+		if err != nil {
+			return err
+		}
+		in.Expiry = &t
+	}
+	return nil
+}
+
+var dateLayouts = []string{"2006-01-02", "02-01-2006", "02-Jan-2006", "02 Jan 2006", "2006-01-02 15:04:05"}
+
+// parseDate reads an expiry date; the contract expires at 15:30 on it.
+func parseDate(s string) (time.Time, error) {
+	for _, layout := range dateLayouts {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return time.Date(t.Year(), t.Month(), t.Day(), 15, 30, 0, 0, time.Local), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid expiry %q", s)
+}
+
+var errNoSymbol = errors.New("exchange and trading symbol are required")
+
+// finish validates a parsed row and fills what the dump left implicit.
+func finish(in *models.Instrument) error {
+	if in.Exchange == "" || in.TradingSymbol == "" {
+		return errNoSymbol
+	}
+	switch in.InstrumentType {
+	case models.InstrumentCall, models.InstrumentPut:
+		in.OptionType = in.InstrumentType
+	case models.InstrumentFuture, models.InstrumentIndex:
+	default:
+		in.InstrumentType = models.InstrumentEquity
+	}
+	if in.Segment == "" {
+		switch in.InstrumentType {
+		case models.InstrumentIndex:
+			in.Segment = "INDICES"
+		case models.InstrumentFuture:
+			in.Segment = in.Exchange + "-FUT"
+		case models.InstrumentCall, models.InstrumentPut:
+			in.Segment = in.Exchange + "-OPT"
+		default:
+			in.Segment = in.Exchange
+		}
+	}
+	if in.Expiry != nil && in.Underlying == "" {
+		in.Underlying = strings.ToUpper(in.Name)
+	}
+	if in.LotSize <= 0 {
+		in.LotSize = 1
+	}
+	if in.TickSize <= 0 {
+		in.TickSize = 0.05
+	}
+	return nil
+}
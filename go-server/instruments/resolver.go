@@ -0,0 +1,298 @@
+package instruments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"go-backend/marketfeed"
+	"go-backend/models"
+	"go-backend/options"
+	"go-backend/portfolio"
+	"go-backend/sizing"
+	"gorm.io/gorm"
+)
+
+// ErrUnknown is returned for symbols the master does not list.
+var ErrUnknown = errors.New("unknown instrument")
+
+// exchangePreference breaks ties when a symbol is given without an
+// exchange and is listed on several.
+var exchangePreference = []string{"NSE", "BSE", "NFO", "BFO", "MCX", "CDS", "BCD", "NCDEX"}
+
+// Resolver maps free-text symbols to instruments in the master. Lookups,
+// including misses, are cached until Invalidate.
+type Resolver struct {
+	DB *gorm.DB
+
+	mu       sync.RWMutex
+	cache    map[string]*models.Instrument // nil caches a miss
+	expiries map[string]time.Time
+	loaded   *bool
+}
+
+func NewResolver(db *gorm.DB) *Resolver {
+	return &Resolver{DB: db, cache: map[string]*models.Instrument{}, expiries: map[string]time.Time{}}
+}
+
+// Invalidate drops cached lookups; call it after the master changes.
+func (r *Resolver) Invalidate() {
+	r.mu.Lock()
+	r.cache = map[string]*models.Instrument{}
+	r.expiries = map[string]time.Time{}
+	r.loaded = nil
+	r.mu.Unlock()
+}
+
+// Loaded reports whether any instruments have been imported. Until then
+// symbols pass through Normalize unchecked.
+func (r *Resolver) Loaded() bool {
+	r.mu.RLock()
+	loaded := r.loaded
+	r.mu.RUnlock()
+	if loaded != nil {
+		return *loaded
+	}
+	var n int64
+	if err := r.DB.Model(&models.Instrument{}).Limit(1).Count(&n).Error; err != nil {
+		return false
+	}
+	ok := n > 0
+	r.mu.Lock()
+	r.loaded = &ok
+	r.mu.Unlock()
+	return ok
+}
+
+// split upper-cases symbol and takes an "NSE:" style prefix as the exchange
+// when none is given.
+func split(symbol, exchange string) (sym, ex string) {
+	sym = strings.ToUpper(strings.TrimSpace(symbol))
+	ex = strings.ToUpper(strings.TrimSpace(exchange))
+	if i := strings.Index(sym, ":"); i > 0 {
+		if ex == "" {
+			ex = sym[:i]
+		}
+		sym = strings.TrimSpace(sym[i+1:])
+	}
+	return sym, ex
+}
+
+// Resolve finds the instrument symbol names: a trading symbol, optionally
+// prefixed with its exchange, an index alias such as NIFTY, or a broker
+// token. exchange may be empty.
+func (r *Resolver) Resolve(symbol, exchange string) (*models.Instrument, error) {
+	sym, ex := split(symbol, exchange)
+	if sym == "" {
+		return nil, ErrUnknown
+	}
+	key := ex + "|" + sym
+	r.mu.RLock()
+	in, hit := r.cache[key]
+	r.mu.RUnlock()
+	if !hit {
+		var err error
+		if in, err = r.find(ex, sym, strings.TrimSpace(symbol)); err != nil {
+			return nil, err
+		}
+		r.mu.Lock()
+		r.cache[key] = in
+		r.mu.Unlock()
+	}
+	if in == nil {
+		return nil, ErrUnknown
+	}
+	return in, nil
+}
+
+func (r *Resolver) find(ex, sym, raw string) (*models.Instrument, error) {
+	in, err := r.bySymbol(ex, sym)
+	if in != nil || err != nil {
+		return in, err
+	}
+	if alias := options.SpotSymbol(sym); alias != sym {
+		if in, err = r.bySymbol(ex, alias); in != nil || err != nil {
+			return in, err
+		}
+	}
+	// Limit/Find rather than First: misses are routine and need not be logged
+	var toks []models.InstrumentToken
+	if err := r.DB.Where("token = ?", raw).Limit(1).Find(&toks).Error; err != nil || len(toks) == 0 {
+		return nil, err
+	}
+	var found []models.Instrument
+	if err := r.DB.Where("id = ?", toks[0].InstrumentID).Limit(1).Find(&found).Error; err != nil || len(found) == 0 {
+		return nil, err
+	}
+	return &found[0], nil
+}
+
+func (r *Resolver) bySymbol(ex, sym string) (*models.Instrument, error) {
+	q := r.DB.Where("trading_symbol = ?", sym)
+	if ex != "" {
+		q = q.Where("exchange = ?", ex)
+	}
+	var found []models.Instrument
+	if err := q.Find(&found).Error; err != nil {
+		return nil, err
+	}
+	if len(found) == 0 {
+		return nil, nil
+	}
+	best := 0
+	for i := range found {
+		if rank(found[i].Exchange) < rank(found[best].Exchange) {
+			best = i
+		}
+	}
+	return &found[best], nil
+}
+
+func rank(ex string) int {
+	for i, e := range exchangePreference {
+		if e == ex {
+			return i
+		}
+	}
+	return len(exchangePreference)
+}
+
+// Normalize returns the canonical trading symbol and exchange for symbol.
+// Before a master is loaded it only upper-cases and splits the input.
+func (r *Resolver) Normalize(symbol, exchange string) (string, string, error) {
+	sym, ex := split(symbol, exchange)
+	if sym == "" {
+		return "", "", errors.New("symbol is required")
+	}
+	if !r.Loaded() {
+		return sym, ex, nil
+	}
+	in, err := r.Resolve(symbol, exchange)
+	if err != nil {
+		if errors.Is(err, ErrUnknown) {
+			return "", "", fmt.Errorf("%w %q", ErrUnknown, strings.TrimSpace(symbol))
+		}
+		return "", "", err
+	}
+	return in.TradingSymbol, in.Exchange, nil
+}
+
+// Check is a broker pre-trade check: it rewrites the order's instrument and
+// exchange to their canonical form and refuses symbols the master does not
+// list.
+func (r *Resolver) Check(ctx context.Context, o *models.Order) error {
+	sym, ex, err := r.Normalize(o.Instrument, o.Exchange)
+	if err != nil {
+		return err
+	}
+	o.Instrument, o.Exchange = sym, ex
+	return nil
+}
+
+// Search returns instruments whose trading symbol or name starts with
+// prefix: exact matches first, then cash and index listings before
+// derivatives, nearest expiry first.
+func (r *Resolver) Search(prefix, exchange, instrumentType string, limit int) ([]models.Instrument, error) {
+	sym, ex := split(prefix, exchange)
+	if sym == "" {
+		return []models.Instrument{}, nil
+	}
+	like := strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(sym) + "%"
+	match := r.DB.Where("trading_symbol LIKE ? OR UPPER(name) LIKE ?", like, like)
+	if alias := options.SpotSymbol(sym); alias != sym {
+		match = match.Or("trading_symbol = ?", alias)
+	}
+	q := r.DB.Where(match)
+	if ex != "" {
+		q = q.Where("exchange = ?", ex)
+	}
+	if instrumentType != "" {
+		q = q.Where("instrument_type = ?", strings.ToUpper(instrumentType))
+	}
+	var found []models.Instrument
+	err := q.Order(gorm.Expr("trading_symbol = ? DESC", sym)).
+		Order("expiry IS NOT NULL, expiry, LENGTH(trading_symbol), trading_symbol").
+		Limit(limit).Find(&found).Error
+	return found, err
+}
+
+// lookup is Resolve for the package hooks, which fall back to their
+// built-in tables on a miss.
+func (r *Resolver) lookup(exchange, symbol string) *models.Instrument {
+	if !r.Loaded() {
+		return nil
+	}
+	in, err := r.Resolve(symbol, exchange)
+	if err != nil {
+		return nil
+	}
+	return in
+}
+
+// Expiry returns the monthly expiry of underlying's contracts in month,
+// taken from its futures, and false if the master has none.
+func (r *Resolver) Expiry(underlying string, year int, month time.Month) (time.Time, bool) {
+	key := fmt.Sprintf("%s|%d|%d", strings.ToUpper(underlying), year, month)
+	r.mu.RLock()
+	t, hit := r.expiries[key]
+	r.mu.RUnlock()
+	if !hit {
+		start := time.Date(year, month, 1, 0, 0, 0, 0, time.Local)
+		var found []models.Instrument
+		err := r.DB.Where("underlying = ? AND instrument_type = ? AND expiry >= ? AND expiry < ?",
+			strings.ToUpper(underlying), models.InstrumentFuture, start, start.AddDate(0, 1, 0)).
+			Order("expiry DESC").Limit(1).Find(&found).Error
+		if err != nil {
+			return time.Time{}, false // not cached: the next call retries
+		}
+		if len(found) > 0 && found[0].Expiry != nil {
+			t = *found[0].Expiry
+		}
+		r.mu.Lock()
+		r.expiries[key] = t
+		r.mu.Unlock()
+	}
+	return t, !t.IsZero()
+}
+
+// Install points the lot size, classification and expiry hooks of the
+// sizing, portfolio and options packages, and the feed's symbol keys, at
+// the master. Instruments it does not list keep the built-in answers.
+func (r *Resolver) Install() {
+	lotSize, classify, expiry := sizing.LotSizeFunc, portfolio.ClassifyFunc, options.ExpiryFunc
+	canonical := marketfeed.Canonical
+
+	marketfeed.Canonical = func(symbol string) string {
+		if sym, _, err := r.Normalize(symbol, ""); err == nil {
+			return sym
+		}
+		return canonical(symbol)
+	}
+
+	sizing.LotSizeFunc = func(exchange, instrument string) int {
+		if in := r.lookup(exchange, instrument); in != nil && in.LotSize > 0 {
+			return in.LotSize
+		}
+		return lotSize(exchange, instrument)
+	}
+	portfolio.ClassifyFunc = func(exchange, instrument string) portfolio.Classification {
+		in := r.lookup(exchange, instrument)
+		if in == nil {
+			return classify(exchange, instrument)
+		}
+		c := classify(in.Exchange, in.TradingSymbol)
+		if in.Underlying != "" && c.Sector == portfolio.SectorOther {
+			c.Sector = classify("", in.Underlying).Sector
+		}
+		return c
+	}
+	options.ExpiryFunc = func(underlying string, year int, month time.Month) time.Time {
+		if t, ok := r.Expiry(underlying, year, month); ok {
+			return t
+		}
+		return expiry(underlying, year, month)
+	}
+}
@@ -0,0 +1,109 @@
+// Package jobs runs background work on a daily schedule.
+package jobs
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// Func is one run of a job for the given day.
+type Func func(ctx context.Context, day time.Time) error
+
+type daily struct {
+	name   string
+	hour   int
+	minute int
+	fn     Func
+}
+
+// Scheduler runs jobs once a day at a fixed local time. A job whose time has
+// already passed when the scheduler starts runs straight away, so a restart
+// does not skip a day; jobs must therefore be safe to repeat.
+type Scheduler struct {
+	// Skip reports days on which no job runs. Nil means every weekday runs.
+	Skip func(day time.Time) bool
+
+	mu   sync.Mutex
+	jobs []daily
+}
+
+func NewScheduler() *Scheduler {
+	return &Scheduler{}
+}
+
+// Daily registers fn to run at hour:minute local time.
+func (s *Scheduler) Daily(name string, hour, minute int, fn Func) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs = append(s.jobs, daily{name: name, hour: hour, minute: minute, fn: fn})
+}
+
+// Run starts every registered job and blocks until ctx ends.
+func (s *Scheduler) Run(ctx context.Context) {
+	s.mu.Lock()
+	jobs := append([]daily(nil), s.jobs...)
+	s.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, j := range jobs {
+		wg.Add(1)
+		go func(j daily) {
+			defer wg.Done()
+			s.loop(ctx, j)
+		}(j)
+	}
+	wg.Wait()
+}
+
+func (s *Scheduler) loop(ctx context.Context, j daily) {
+	now := time.Now()
+	next := at(now, j.hour, j.minute)
+	if !next.After(now) {
+		s.run(ctx, j, next)
+		next = next.AddDate(0, 0, 1)
+	}
+	for {
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		s.run(ctx, j, next)
+		next = at(next.AddDate(0, 0, 1), j.hour, j.minute)
+	}
+}
+
+func (s *Scheduler) run(ctx context.Context, j daily, when time.Time) {
+	if s.skip(when) {
+		return
+	}
+	start := time.Now()
+	if err := j.fn(ctx, Day(when)); err != nil {
+		log.Printf("job %s: %v", j.name, err)
+		return
+	}
+	log.Printf("job %s: done in %s", j.name, time.Since(start).Round(time.Millisecond))
+}
+
+func (s *Scheduler) skip(t time.Time) bool {
+	if s.Skip != nil {
+		return s.Skip(t)
+	}
+	return t.Weekday() == time.Saturday || t.Weekday() == time.Sunday
+}
+
+// at is hour:minute on t's local date.
+func at(t time.Time, hour, minute int) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, hour, minute, 0, 0, t.Location())
+}
+
+// Day truncates t to midnight on its local date.
+func Day(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
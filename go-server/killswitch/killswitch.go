@@ -0,0 +1,364 @@
+// Package killswitch stops all trading for one user or for everyone. An
+// engaged switch rejects new orders at the broker gateway, and engaging it
+// cancels working orders, pauses deployments and automatic workflows and can
+// square off positions. It stays engaged until explicitly re-armed.
+package killswitch
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go-backend/broker"
+	"go-backend/ledger"
+	"go-backend/models"
+	"go-backend/runner"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+var (
+	ErrEngaged    = errors.New("kill switch is already engaged")
+	ErrNotEngaged = errors.New("kill switch is not engaged")
+)
+
+// Switch holds the engaged switches in memory so the order gateway can
+// check them without a query. The database is the source of truth; Load
+// reads it at start-up.
+type Switch struct {
+	DB      *gorm.DB
+	Brokers *broker.Registry
+	Runner  *runner.Supervisor
+
+	mu     sync.RWMutex
+	global bool
+	users  map[uuid.UUID]bool
+}
+
+func New(db *gorm.DB, brokers *broker.Registry, sup *runner.Supervisor) *Switch {
+	return &Switch{DB: db, Brokers: brokers, Runner: sup, users: map[uuid.UUID]bool{}}
+}
+
+// Load restores engaged switches after a restart.
+func (s *Switch) Load() error {
+	if err := s.uniqueGlobal(); err != nil {
+		return err
+	}
+	var engaged []models.KillSwitch
+	if err := s.DB.Where("engaged = ?", true).Find(&engaged).Error; err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, k := range engaged {
+		if k.UserID == nil {
+			s.global = true
+		} else {
+			s.users[*k.UserID] = true
+		}
+	}
+	return nil
+}
+
+// uniqueGlobal makes the global switch a single row. The unique index on
+// user_id does not cover NULLs, so a partial index on the NULL row does;
+// duplicates left by earlier concurrent first uses collapse into the most
+// recently updated one, which holds the last state anyone set.
+func (s *Switch) uniqueGlobal() error {
+	return s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec(`DELETE FROM kill_switches WHERE user_id IS NULL AND id <> (
+			SELECT id FROM kill_switches WHERE user_id IS NULL ORDER BY updated_at DESC, id DESC LIMIT 1)`).Error; err != nil {
+			return err
+		}
+		return tx.Exec(`CREATE UNIQUE INDEX IF NOT EXISTS idx_kill_switches_global
+			ON kill_switches ((user_id IS NULL)) WHERE user_id IS NULL`).Error
+	})
+}
+
+// Engaged reports whether trading is halted for userID, by its own switch
+// or the global one.
+func (s *Switch) Engaged(userID uuid.UUID) bool {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.global || s.users[userID]
+}
+
+// Check implements broker.PreTradeCheck. Exit orders that only reduce an
+// existing position still go through, so positions can be flattened.
+func (s *Switch) Check(ctx context.Context, o *models.Order) error {
+	s.mu.RLock()
+	global, user := s.global, s.users[o.UserID]
+	s.mu.RUnlock()
+	if !global && !user {
+		return nil
+	}
+	if o.IsExitOrder && s.reduces(o) {
+		return nil
+	}
+	which := "your kill switch is"
+	if global {
+		which = "the global kill switch is"
+	}
+	return &broker.RejectError{Reason: "trading halted: " + which + " engaged"}
+}
+
+func (s *Switch) reduces(o *models.Order) bool {
+	fills, err := ledger.LoadFills(s.DB, func(q *gorm.DB) *gorm.DB {
+		return q.Where("orders.user_id = ? AND UPPER(transactions.instrument) = ?", o.UserID, strings.ToUpper(o.Instrument))
+	})
+	if err != nil {
+		return false
+	}
+	pos := 0.0
+	for _, p := range ledger.Positions(fills) {
+		pos += p.Quantity
+	}
+	qty := float64(o.Quantity)
+	if strings.EqualFold(o.Side, "BUY") {
+		return pos < 0 && qty <= -pos
+	}
+	return pos > 0 && qty <= pos
+}
+
+// Summary is what engaging a switch did.
+type Summary struct {
+	OrdersCancelled     int      `json:"ordersCancelled"`
+	DeploymentsPaused   []uint   `json:"deploymentsPaused"`
+	DeploymentsSquared  []uint   `json:"deploymentsSquaredOff"`
+	WorkflowsPaused     []string `json:"workflowsPaused"`
+	ManualPositionsExit bool     `json:"manualPositionsExited"`
+	Errors              []string `json:"errors"`
+}
+
+// Engage halts trading for userID, or for everyone when userID is nil. New
+// orders are blocked before anything else happens; the rest is best effort
+// and failures are reported in the summary.
+func (s *Switch) Engage(ctx context.Context, userID *uuid.UUID, actor uuid.UUID, reason string, squareOff bool) (*models.KillSwitch, *Summary, error) {
+	sw, err := s.flip(userID, true, actor, reason)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sum := &Summary{DeploymentsPaused: []uint{}, DeploymentsSquared: []uint{}, WorkflowsPaused: []string{}, Errors: []string{}}
+	scope := func(q *gorm.DB) *gorm.DB {
+		if userID != nil {
+			return q.Where("user_id = ?", *userID)
+		}
+		return q
+	}
+
+	// Deployments first, so their workers stop placing orders before the
+	// open orders are cancelled.
+	var deployments []models.DeployedStrategy
+	if err := scope(s.DB.Where("status IN ?", []string{models.DeploymentStatusActive, models.DeploymentStatusPaused, models.DeploymentStatusError})).
+		Find(&deployments).Error; err != nil {
+		sum.Errors = append(sum.Errors, "load deployments: "+err.Error())
+	}
+	why := "kill switch: " + reason
+	who := runner.UserActor(actor)
+	for _, d := range deployments {
+		switch {
+		case squareOff:
+			if _, err := s.Runner.Transition(ctx, d.ID, runner.ActionSquareOff, who, why); err != nil {
+				sum.Errors = append(sum.Errors, fmt.Sprintf("square off deployment %d: %v", d.ID, err))
+			} else {
+				sum.DeploymentsSquared = append(sum.DeploymentsSquared, d.ID)
+			}
+		case d.Status == models.DeploymentStatusActive:
+			if _, err := s.Runner.Transition(ctx, d.ID, runner.ActionPause, who, why); err != nil &&
+				!errors.Is(err, runner.ErrInvalidTransition) {
+				sum.Errors = append(sum.Errors, fmt.Sprintf("pause deployment %d: %v", d.ID, err))
+			} else if err == nil {
+				sum.DeploymentsPaused = append(sum.DeploymentsPaused, d.ID)
+			}
+		}
+	}
+
+	var workflows []models.TradingWorkflow
+	if err := scope(s.DB.Where("is_automatic = ? AND status = ?", true, "active")).Find(&workflows).Error; err != nil {
+		sum.Errors = append(sum.Errors, "load workflows: "+err.Error())
+	}
+	for _, wf := range workflows {
+		if err := s.DB.Model(&wf).Update("status", "paused").Error; err != nil {
+			sum.Errors = append(sum.Errors, fmt.Sprintf("pause workflow %s: %v", wf.ID, err))
+		} else {
+			sum.WorkflowsPaused = append(sum.WorkflowsPaused, wf.ID.String())
+		}
+	}
+
+	// held stops stay to protect positions unless they are being closed
+	statuses := []string{models.OrderStatusOpen, models.OrderStatusPartiallyFilled}
+	if squareOff {
+		statuses = append(statuses, models.OrderStatusPending)
+	}
+	var open []models.Order
+	if err := scope(s.DB.Where("status IN ?", statuses)).Find(&open).Error; err != nil {
+		sum.Errors = append(sum.Errors, "load open orders: "+err.Error())
+	}
+	for i := range open {
+		if err := broker.Cancel(ctx, s.DB, s.Brokers, &open[i]); err != nil {
+			sum.Errors = append(sum.Errors, fmt.Sprintf("cancel order %s: %v", open[i].OrderID, err))
+		} else {
+			sum.OrdersCancelled++
+		}
+	}
+
+	if squareOff {
+		var users []uuid.UUID
+		if userID != nil {
+			users = []uuid.UUID{*userID}
+		} else if err := s.DB.Model(&models.Order{}).Where("deployment_id IS NULL").
+			Distinct("user_id").Pluck("user_id", &users).Error; err != nil {
+			sum.Errors = append(sum.Errors, "load users: "+err.Error())
+		}
+		for _, id := range users {
+			if err := s.Runner.FlattenManual(ctx, id, nil); err != nil {
+				sum.Errors = append(sum.Errors, fmt.Sprintf("flatten user %s: %v", id, err))
+			}
+		}
+		sum.ManualPositionsExit = true
+	}
+
+	s.audit(sw, models.KillSwitchEngage, actor, reason, squareOff, sum)
+	log.Printf("kill switch engaged (%s) by %s: %d orders cancelled, %d deployments paused, %d squared off, %d workflows paused, %d errors",
+		label(userID), actor, sum.OrdersCancelled, len(sum.DeploymentsPaused), len(sum.DeploymentsSquared), len(sum.WorkflowsPaused), len(sum.Errors))
+	return sw, sum, nil
+}
+
+// Arm re-enables trading. Nothing that was paused is resumed; deployments
+// and workflows have to be restarted one by one.
+func (s *Switch) Arm(userID *uuid.UUID, actor uuid.UUID, reason string) (*models.KillSwitch, error) {
+	sw, err := s.flip(userID, false, actor, reason)
+	if err != nil {
+		return nil, err
+	}
+	s.audit(sw, models.KillSwitchArm, actor, reason, false, nil)
+	log.Printf("kill switch re-armed (%s) by %s", label(userID), actor)
+	return sw, nil
+}
+
+// State returns the stored switch, or an armed one if it was never used.
+func (s *Switch) State(userID *uuid.UUID) (*models.KillSwitch, error) {
+	var sw models.KillSwitch
+	q := s.DB.Where("user_id IS NULL")
+	if userID != nil {
+		q = s.DB.Where("user_id = ?", *userID)
+	}
+	err := q.First(&sw).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return &models.KillSwitch{UserID: userID}, nil
+	}
+	return &sw, err
+}
+
+// Events lists the audit trail of a switch, newest first.
+func (s *Switch) Events(userID *uuid.UUID) ([]models.KillSwitchEvent, error) {
+	events := []models.KillSwitchEvent{}
+	q := s.DB.Where("user_id IS NULL")
+	if userID != nil {
+		q = s.DB.Where("user_id = ?", *userID)
+	}
+	err := q.Order("created_at DESC").Find(&events).Error
+	return events, err
+}
+
+// flip persists the new state under a row lock and updates the in-memory
+// flag while still holding the gateway lock, so no order slips through
+// between the two.
+func (s *Switch) flip(userID *uuid.UUID, engage bool, actor uuid.UUID, reason string) (*models.KillSwitch, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var sw models.KillSwitch
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		q := tx.Clauses(clause.Locking{Strength: "UPDATE"})
+		if userID != nil {
+			q = q.Where("user_id = ?", *userID)
+		} else {
+			q = q.Where("user_id IS NULL")
+		}
+		err := q.Session(&gorm.Session{}).First(&sw).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// A concurrent first use may insert the row too; the unique
+			// indexes let only one through, and both then lock that row.
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&models.KillSwitch{UserID: userID}).Error; err != nil {
+				return err
+			}
+			err = q.Session(&gorm.Session{}).First(&sw).Error
+		}
+		if err != nil {
+			return err
+		}
+
+		if sw.Engaged == engage {
+			if engage {
+				return ErrEngaged
+			}
+			return ErrNotEngaged
+		}
+		now := time.Now()
+		sw.Engaged = engage
+		sw.Reason = reason
+		if engage {
+			sw.EngagedAt, sw.EngagedBy = &now, &actor
+		} else {
+			sw.ArmedAt, sw.ArmedBy = &now, &actor
+		}
+		return tx.Save(&sw).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if userID == nil {
+		s.global = engage
+	} else if engage {
+		s.users[*userID] = true
+	} else {
+		delete(s.users, *userID)
+	}
+	return &sw, nil
+}
+
+func (s *Switch) audit(sw *models.KillSwitch, action string, actor uuid.UUID, reason string, squareOff bool, sum *Summary) {
+	event := models.KillSwitchEvent{
+		KillSwitchID: sw.ID,
+		UserID:       sw.UserID,
+		Action:       action,
+		ActorID:      &actor,
+		Reason:       reason,
+		SquareOff:    squareOff,
+	}
+	if sum != nil {
+		event.Summary, _ = json.Marshal(sum)
+	}
+	if err := s.DB.Create(&event).Error; err != nil {
+		log.Printf("kill switch: record %s event: %v", action, err)
+	}
+}
+
+func label(userID *uuid.UUID) string {
+	if userID == nil {
+		return "global"
+	}
+	return "user " + userID.String()
+}
+
+// ParseUserIDs reads a comma-separated list of user IDs, such as the
+// KILL_SWITCH_ADMINS setting, skipping entries that are not UUIDs.
+func ParseUserIDs(list string) map[uuid.UUID]bool {
+	out := map[uuid.UUID]bool{}
+	for _, s := range strings.Split(list, ",") {
+		if id, err := uuid.Parse(strings.TrimSpace(s)); err == nil {
+			out[id] = true
+		}
+	}
+	return out
+}
@@ -0,0 +1,115 @@
+// Package ledger rebuilds positions and realised P&L from Transaction fills.
+// Transactions do not carry a side, so fills are always read joined with
+// their parent Order.
+package ledger
+
+import (
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Fill is a Transaction together with the order fields needed to book it.
+type Fill struct {
+	OrderID      uuid.UUID
+	UserID       uuid.UUID
+	StrategyID   uuid.UUID
+	DeploymentID *uint
+	Instrument   string
+	Exchange     string
+	Side         string
+	Quantity     float64
+	Price        float64
+	Fees         float64
+	ExecutedAt   time.Time
+}
+
+// Signed returns the fill quantity, negative for sells.
+func (f Fill) Signed() float64 {
+	if strings.EqualFold(f.Side, "SELL") {
+		return -f.Quantity
+	}
+	return f.Quantity
+}
+
+// Position is the net holding in one instrument.
+type Position struct {
+	Instrument string    `json:"instrument"`
+	Quantity   float64   `json:"quantity"`
+	AvgPrice   float64   `json:"avgPrice"`
+	Realized   float64   `json:"realized"` // after fees
+	Fees       float64   `json:"fees"`
+	OpenedAt   time.Time `json:"openedAt"`
+}
+
+// Apply books a fill against the position using average-cost accounting and
+// returns the P&L it realised (before fees).
+func (p *Position) Apply(f Fill) float64 {
+	signed := f.Signed()
+	p.Fees += f.Fees
+	p.Realized -= f.Fees
+	realized := 0.0
+
+	if p.Quantity != 0 && (p.Quantity > 0) != (signed > 0) {
+		closing := math.Min(math.Abs(signed), math.Abs(p.Quantity))
+		dir := 1.0
+		if p.Quantity < 0 {
+			dir = -1
+		}
+		realized = (f.Price - p.AvgPrice) * closing * dir
+		p.Realized += realized
+		p.Quantity -= dir * closing
+		signed += dir * closing
+		if p.Quantity == 0 {
+			p.AvgPrice = 0
+		}
+	}
+	if signed != 0 {
+		if p.Quantity == 0 {
+			p.OpenedAt = f.ExecutedAt
+		}
+		total := math.Abs(p.Quantity) + math.Abs(signed)
+		p.AvgPrice = (p.AvgPrice*math.Abs(p.Quantity) + f.Price*math.Abs(signed)) / total
+		p.Quantity += signed
+	}
+	return realized
+}
+
+// Unrealized is the mark-to-market P&L of the open quantity at price.
+func (p *Position) Unrealized(price float64) float64 {
+	return (price - p.AvgPrice) * p.Quantity
+}
+
+// Positions books fills (which must be in execution order) per instrument.
+func Positions(fills []Fill) map[string]*Position {
+	out := map[string]*Position{}
+	for _, f := range fills {
+		k := strings.ToUpper(f.Instrument)
+		p, ok := out[k]
+		if !ok {
+			p = &Position{Instrument: f.Instrument}
+			out[k] = p
+		}
+		p.Apply(f)
+	}
+	return out
+}
+
+// LoadFills reads fills in execution order. scope narrows the query and may
+// refer to both the transactions and orders tables.
+func LoadFills(db *gorm.DB, scope func(*gorm.DB) *gorm.DB) ([]Fill, error) {
+	q := db.Table("transactions").
+		Select("transactions.order_id, orders.user_id, orders.strategy_id, orders.deployment_id, " +
+			"transactions.instrument, orders.exchange, orders.side, transactions.quantity, transactions.fill_price AS price, " +
+			"transactions.brokerage + transactions.taxes AS fees, transactions.executed_at").
+		Joins("JOIN orders ON orders.id = transactions.order_id")
+	if scope != nil {
+		q = scope(q)
+	}
+	var fills []Fill
+	err := q.Order("transactions.executed_at, transactions.created_at").Scan(&fills).Error
+	return fills, err
+}
@@ -0,0 +1,67 @@
+package ledger
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestPositionApply(t *testing.T) {
+	t0 := time.Date(2024, 1, 2, 9, 15, 0, 0, time.UTC)
+	buy := func(qty, price, fees float64) Fill {
+		return Fill{Instrument: "RELIANCE", Side: "BUY", Quantity: qty, Price: price, Fees: fees, ExecutedAt: t0}
+	}
+	sell := func(qty, price, fees float64) Fill {
+		return Fill{Instrument: "RELIANCE", Side: "SELL", Quantity: qty, Price: price, Fees: fees, ExecutedAt: t0}
+	}
+
+	tests := []struct {
+		name         string
+		fills        []Fill
+		wantQty      float64
+		wantAvg      float64
+		wantRealized float64 // after fees
+		wantLast     float64 // P&L realised by the last fill, before fees
+	}{
+		{"open long", []Fill{buy(10, 100, 0)}, 10, 100, 0, 0},
+		{"average up", []Fill{buy(10, 100, 0), buy(10, 110, 0)}, 20, 105, 0, 0},
+		{"partial close", []Fill{buy(10, 100, 0), sell(4, 110, 0)}, 6, 100, 40, 40},
+		{"full close", []Fill{buy(10, 100, 0), sell(10, 95, 0)}, 0, 0, -50, -50},
+		{"flip long to short", []Fill{buy(10, 100, 0), sell(15, 90, 0)}, -5, 90, -100, -100},
+		{"cover short", []Fill{sell(5, 50, 0), buy(5, 40, 0)}, 0, 0, 50, 50},
+		{"flip short to long", []Fill{sell(5, 50, 0), buy(8, 60, 0)}, 3, 60, -50, -50},
+		{"fees reduce realised", []Fill{buy(10, 100, 3), sell(10, 101, 2)}, 0, 0, 5, 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p Position
+			var last float64
+			for _, f := range tt.fills {
+				last = p.Apply(f)
+			}
+			if !near(p.Quantity, tt.wantQty) || !near(p.AvgPrice, tt.wantAvg) || !near(p.Realized, tt.wantRealized) || !near(last, tt.wantLast) {
+				t.Errorf("got qty %g avg %g realised %g last %g, want %g %g %g %g",
+					p.Quantity, p.AvgPrice, p.Realized, last, tt.wantQty, tt.wantAvg, tt.wantRealized, tt.wantLast)
+			}
+		})
+	}
+}
+
+func TestPositionsGroupsByInstrument(t *testing.T) {
+	got := Positions([]Fill{
+		{Instrument: "infy", Side: "BUY", Quantity: 2, Price: 10},
+		{Instrument: "INFY", Side: "SELL", Quantity: 1, Price: 12},
+		{Instrument: "TCS", Side: "SELL", Quantity: 3, Price: 20},
+	})
+	if len(got) != 2 {
+		t.Fatalf("got %d positions, want 2", len(got))
+	}
+	if p := got["INFY"]; p.Quantity != 1 || p.Realized != 2 {
+		t.Errorf("INFY = %+v, want quantity 1 realised 2", *p)
+	}
+	if p := got["TCS"]; p.Quantity != -3 || p.Unrealized(18) != 6 {
+		t.Errorf("TCS = %+v, want quantity -3 and 6 unrealised at 18", *p)
+	}
+}
+
+func near(a, b float64) bool { return math.Abs(a-b) < 1e-9 }
@@ -11,10 +11,28 @@ import (
 	"github.com/google/uuid"
 	"github.com/gorilla/sessions"
 	"github.com/rs/cors"
+	"go-backend/broker"
+	"go-backend/calendar"
+	"go-backend/charges"
+	"go-backend/corpactions"
+	"go-backend/digest"
+	"go-backend/execution"
 	"go-backend/handlers"
+	"go-backend/instruments"
+	"go-backend/jobs"
+	"go-backend/killswitch"
+	"go-backend/marketfeed"
 	"go-backend/models"
-	// "os"
+	"go-backend/options"
+	"go-backend/portfolio"
+	"go-backend/risk"
+	"go-backend/runner"
+	"go-backend/taxreport"
+	"go-backend/tradebook"
+	"os"
+	"context"
 	"fmt"
+	"strings"
 	"time"
 )
 
@@ -74,6 +92,73 @@ func main() {
 
 	mux := http.NewServeMux()
 
+	// Live trading: bars published to the feed drive deployed strategies,
+	// whose orders go through the broker registry (paper or live adapters).
+	feed := marketfeed.NewHub()
+	// Fills are priced with the user's brokerage plan and Indian statutory charges
+	chargeSvc := charges.NewService(db)
+	fills := &broker.FillRecorder{DB: db, Charges: chargeSvc.Apply}
+	paper := broker.NewPaper(fills, feed)
+	brokers := broker.NewRegistry(paper)
+	// Every order path (manual, workflow, strategy) is gated by the user's risk limits
+	riskEngine := risk.NewEngine(db, feed)
+	supervisor := runner.New(db, feed, brokers)
+	// The kill switch is checked before the risk limits; exits that only
+	// reduce a position still pass so it can flatten
+	killSwitch := killswitch.New(db, brokers, supervisor)
+	supervisor.Halted = killSwitch.Engaged
+	// Symbols are normalized against the instrument master before any other
+	// check sees them; lot sizes, sectors and expiries come from it too
+	symbols := instruments.NewResolver(db)
+	symbols.Install()
+	brokers.Use(symbols.Check)
+	// Market hours come from the trading calendar: holidays, special sessions
+	// and early closes are read from TRADING_CALENDAR_FILE
+	tradingCalendar, err := calendar.Load(os.Getenv("TRADING_CALENDAR_FILE"))
+	if err != nil {
+		log.Fatal("Failed to load trading calendar: ", err)
+	}
+	brokers.Use(tradingCalendar.Check)
+	brokers.Use(killSwitch.Check)
+	brokers.Use(riskEngine.Check)
+	sizer := supervisor.Sizing
+	riskMonitor := risk.NewMonitor(riskEngine, supervisor, brokers)
+	exposures := portfolio.NewExposures(db, feed)
+	riskMonitor.Exposures = exposures
+	valueAtRisk := portfolio.NewVaR(db, feed)
+	riskMonitor.VaR = valueAtRisk
+	optionBook := options.NewBook(db, feed)
+	riskMonitor.Greeks = optionBook
+	fills.OnFill(riskMonitor.OnFill)
+	fills.OnFill(broker.TrackBaskets(db))
+	exits := broker.NewExits(db, brokers, feed)
+	fills.OnFill(exits.OnFill)
+	algos := execution.NewEngine(db, brokers, feed)
+	fills.OnFill(algos.OnFill)
+	supervisor.Slicer = algos
+	// End-of-day jobs run after the NSE close
+	scheduler := jobs.NewScheduler()
+	scheduler.Skip = func(day time.Time) bool { return !tradingCalendar.IsTradingDay(calendar.DefaultExchange, day) }
+	portfolioRisk := portfolio.NewJob(db, os.Getenv("PORTFOLIO_BENCHMARK"))
+	portfolioRisk.TradingDay = tradingCalendar.TradingDays(calendar.DefaultExchange)
+	scheduler.Daily("portfolio-risk", 16, 0, portfolioRisk.Run)
+	scheduler.Daily("exposures", 16, 0, exposures.Run)
+	correlations := portfolio.NewCorrelations(db)
+	correlations.TradingDay = tradingCalendar.TradingDays(calendar.DefaultExchange)
+	scheduler.Daily("strategy-correlations", 16, 30, correlations.Run)
+	// Splits, bonuses and dividends going ex today are applied before the open
+	corporateActions := corpactions.NewProcessor(db)
+	scheduler.Daily("corporate-actions", 8, 30, corporateActions.Run)
+	// Performance digests go out after the end-of-day snapshots to users who
+	// opted in; MAIL_TRANSPORT picks SMTP or a local file sink
+	mailer, err := digest.TransportFromEnv()
+	if err != nil {
+		log.Fatal("Failed to configure mail: ", err)
+	}
+	digests := digest.NewService(db, mailer)
+	digests.TradingDay = tradingCalendar.TradingDays(calendar.DefaultExchange)
+	scheduler.Daily("performance-digests", 18, 0, digests.Run)
+
 	// Auto-migrate User model
 	db.AutoMigrate(&models.User{})
 
@@ -121,9 +206,10 @@ func main() {
 	// Automigrate strategies model
 
 	db.AutoMigrate(&models.Strategy{})
+	db.AutoMigrate(&models.StrategyVersion{})
 
 	h1 := &handlers.StrategyHandler{DB: db,
-		Store: store}
+		Store: store, Instruments: symbols}
 
 	mux.HandleFunc("/strategies", func(w http.ResponseWriter, r *http.Request) {
 
@@ -145,6 +231,18 @@ func main() {
 
 	// Handle /strategies/{id} crud operations
 	mux.HandleFunc("/strategies/", func(w http.ResponseWriter, r *http.Request) {
+		// Version history lives under /strategies/{id}/versions, /diff and /rollback
+		switch {
+		case strings.Contains(r.URL.Path, "/versions") && r.Method == http.MethodGet:
+			h1.GetStrategyVersions(w, r)
+			return
+		case strings.HasSuffix(r.URL.Path, "/diff") && r.Method == http.MethodGet:
+			h1.DiffStrategyVersions(w, r)
+			return
+		case strings.HasSuffix(r.URL.Path, "/rollback") && r.Method == http.MethodPost:
+			h1.RollbackStrategy(w, r)
+			return
+		}
 		// crude way to get method and id
 		switch r.Method {
 		case http.MethodGet:
@@ -155,11 +253,70 @@ func main() {
 			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		}
 	})
+	// Auto-migrate Backtest and MarketData models
+	db.AutoMigrate(&models.MarketData{})
+	db.AutoMigrate(&models.Backtest{})
+
+	hb := &handlers.BacktestHandler{DB: db, Store: store, Sizing: sizer, Charges: chargeSvc}
+	hm := &handlers.MarketDataHandler{DB: db, Store: store, Feed: feed, Actions: corporateActions,
+		Instruments: symbols, Feeders: killswitch.ParseUserIDs(os.Getenv("MARKET_DATA_FEEDERS"))}
+
+	mux.HandleFunc("/market-data", func(w http.ResponseWriter, r *http.Request) {
+		session, _ := store.Get(r, "Go-session-id")
+		_, ok := session.Values["user_id"]
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			hm.GetMarketData(w, r)
+		case http.MethodPost:
+			hm.IngestMarketData(w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/backtests", func(w http.ResponseWriter, r *http.Request) {
+		session, _ := store.Get(r, "Go-session-id")
+		_, ok := session.Values["user_id"]
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			hb.GetBacktests(w, r)
+		case http.MethodPost:
+			hb.CreateBacktest(w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/backtests/", func(w http.ResponseWriter, r *http.Request) {
+		session, _ := store.Get(r, "Go-session-id")
+		_, ok := session.Values["user_id"]
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			hb.GetBacktest(w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
 	// Auto-migrate DeployStrategy model
 	db.AutoMigrate(&models.DeployedStrategy{})
+	db.AutoMigrate(&models.DeploymentEvent{})
 
 	h2 := &handlers.DeployStrategyHandler{DB: db,
-		Store: store}
+		Store:  store,
+		Runner: supervisor}
 
 	mux.HandleFunc("/deploy-strategy", func(w http.ResponseWriter, r *http.Request) {
 
@@ -178,6 +335,34 @@ func main() {
 			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
 		}
 	})
+	mux.HandleFunc("/deploy-strategy/", func(w http.ResponseWriter, r *http.Request) {
+		session, _ := store.Get(r, "Go-session-id")
+		_, ok := session.Values["user_id"]
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+		// /deploy-strategy/{id}/{action} and /deploy-strategy/{id}/events
+		if parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/"); len(parts) == 3 {
+			switch {
+			case parts[2] == "events" && r.Method == http.MethodGet:
+				h2.GetDeploymentEvents(w, r)
+			case r.Method == http.MethodPost:
+				h2.TransitionDeployedStrategy(w, r)
+			default:
+				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			}
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			h2.GetDeployedStrategy(w, r)
+		case http.MethodPut:
+			h2.UpdateDeployedStrategy(w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
 	// Auto-migrate StrategyRecommendation model
 	db.AutoMigrate(&models.StrategyRecommendation{})
 
@@ -250,10 +435,80 @@ func main() {
 	db.AutoMigrate(&models.Order{})
 	db.AutoMigrate(&models.Transaction{})
 	db.AutoMigrate(&models.TradeSummary{})
+	db.AutoMigrate(&models.RiskLimit{})
+	db.AutoMigrate(&models.RiskEvent{})
+
+	hr := &handlers.RiskLimitHandler{DB: db, Store: store, Instruments: symbols}
 
-	h9 := &handlers.OrderHandler{DB: db, Store: store}
-	h10 := &handlers.TransactionHandler{DB: db, Store: store}
-	h11 := &handlers.TradeSummaryHandler{DB: db, Store: store}
+	mux.HandleFunc("/risk-limits", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			hr.GetRiskLimits(w, r)
+		case http.MethodPost:
+			hr.CreateRiskLimit(w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	db.AutoMigrate(&models.PositionSizingRule{})
+
+	hps := &handlers.PositionSizingHandler{DB: db, Store: store, Sizing: sizer}
+
+	mux.HandleFunc("/position-sizing/rules", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			hps.GetRules(w, r)
+		case http.MethodPost:
+			hps.CreateRule(w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/position-sizing/rules/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			hps.UpdateRule(w, r)
+		case http.MethodDelete:
+			hps.DeleteRule(w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/position-sizing/preview", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		hps.Preview(w, r)
+	})
+
+	mux.HandleFunc("/risk-events", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		hr.GetRiskEvents(w, r)
+	})
+
+	mux.HandleFunc("/risk-limits/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			hr.GetRiskLimit(w, r)
+		case http.MethodPut:
+			hr.UpdateRiskLimit(w, r)
+		case http.MethodDelete:
+			hr.DeleteRiskLimit(w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	h9 := &handlers.OrderHandler{DB: db, Store: store, Brokers: brokers}
+	h10 := &handlers.TransactionHandler{DB: db, Store: store, Charges: chargeSvc}
+	h11 := &handlers.TradeSummaryHandler{DB: db, Store: store, Calendar: tradingCalendar}
 
 	// Order routes
 	mux.HandleFunc("/orders", func(w http.ResponseWriter, r *http.Request) {
@@ -347,6 +602,14 @@ func main() {
 		}
 	})
 
+	mux.HandleFunc("/trade-summaries/analytics", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		h11.GetTradeAnalytics(w, r)
+	})
+
 	mux.HandleFunc("/trade-summaries/", func(w http.ResponseWriter, r *http.Request) {
 		session, _ := store.Get(r, "Go-session-id")
 		_, ok := session.Values["user_id"]
@@ -396,7 +659,7 @@ func main() {
 	// Auto-migrate WorkflowCondition model
 	db.AutoMigrate(&models.WorkflowCondition{})
 
-	h6 := &handlers.WorkflowConditionHandler{DB: db}
+	h6 := &handlers.WorkflowConditionHandler{DB: db, Instruments: symbols}
 
 	mux.HandleFunc("/workflow-conditions", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
@@ -423,7 +686,7 @@ func main() {
 	// Auto-migrate WorkflowAction model
 	db.AutoMigrate(&models.WorkflowAction{})
 
-	h7 := &handlers.WorkflowActionHandler{DB: db}
+	h7 := &handlers.WorkflowActionHandler{DB: db, Store: store, Brokers: brokers, Sizing: sizer}
 
 	mux.HandleFunc("/workflow-actions", func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
@@ -437,6 +700,14 @@ func main() {
 	})
 
 	mux.HandleFunc("/workflow-actions/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/execute") {
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			h7.ExecuteWorkflowAction(w, r)
+			return
+		}
 		switch r.Method {
 		case http.MethodGet:
 			h7.GetWorkflowAction(w, r)
@@ -473,6 +744,469 @@ func main() {
 		}
 	})
 
+	db.AutoMigrate(&models.PortfolioRisk{})
+
+	hpr := &handlers.PortfolioRiskHandler{DB: db, Store: store}
+
+	mux.HandleFunc("/portfolio-risk", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		hpr.GetPortfolioRisk(w, r)
+	})
+
+	db.AutoMigrate(&models.MarketExposure{})
+	db.AutoMigrate(&models.SectorExposure{})
+
+	hx := &handlers.ExposureHandler{DB: db, Store: store, Exposures: exposures}
+
+	mux.HandleFunc("/exposures", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		hx.GetExposures(w, r)
+	})
+
+	mux.HandleFunc("/exposures/markets", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		hx.GetMarketExposures(w, r)
+	})
+
+	mux.HandleFunc("/exposures/sectors", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		hx.GetSectorExposures(w, r)
+	})
+
+	db.AutoMigrate(&models.StrategyCorrelation{})
+
+	hsc := &handlers.StrategyCorrelationHandler{DB: db, Store: store, Correlations: correlations}
+
+	mux.HandleFunc("/strategy-correlations", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		hsc.GetMatrix(w, r)
+	})
+
+	mux.HandleFunc("/strategy-correlations/stored", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		hsc.GetStored(w, r)
+	})
+
+	mux.HandleFunc("/strategy-correlations/refresh", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		hsc.Refresh(w, r)
+	})
+
+	hvar := &handlers.VaRHandler{DB: db, Store: store, VaR: valueAtRisk}
+
+	mux.HandleFunc("/var", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		hvar.GetVaR(w, r)
+	})
+
+	db.AutoMigrate(&models.StressScenario{})
+
+	hst := &handlers.StressHandler{DB: db, Store: store, Stress: portfolio.NewStress(db, feed, valueAtRisk)}
+
+	mux.HandleFunc("/stress-scenarios", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			hst.GetScenarios(w, r)
+		case http.MethodPost:
+			hst.CreateScenario(w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/stress-scenarios/", func(w http.ResponseWriter, r *http.Request) {
+		if strings.Trim(r.URL.Path, "/") == "stress-scenarios/presets" {
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			hst.GetPresets(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodPut:
+			hst.UpdateScenario(w, r)
+		case http.MethodDelete:
+			hst.DeleteScenario(w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/stress-test", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		hst.RunStressTest(w, r)
+	})
+
+	db.AutoMigrate(&models.KillSwitch{})
+	db.AutoMigrate(&models.KillSwitchEvent{})
+
+	hks := &handlers.KillSwitchHandler{DB: db, Store: store, Switch: killSwitch,
+		Admins: killswitch.ParseUserIDs(os.Getenv("KILL_SWITCH_ADMINS"))}
+
+	mux.HandleFunc("/kill-switch", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		hks.GetKillSwitch(w, r)
+	})
+
+	mux.HandleFunc("/kill-switch/", func(w http.ResponseWriter, r *http.Request) {
+		switch strings.Trim(strings.TrimPrefix(r.URL.Path, "/kill-switch/"), "/") {
+		case "engage":
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			hks.Engage(w, r)
+		case "arm":
+			if r.Method != http.MethodPost {
+				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			hks.Arm(w, r)
+		case "events":
+			if r.Method != http.MethodGet {
+				http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+				return
+			}
+			hks.GetEvents(w, r)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+
+	hop := &handlers.OptionsHandler{DB: db, Store: store, Chain: options.NewChain(db, feed), Book: optionBook}
+
+	mux.HandleFunc("/options/chain", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		hop.GetChain(w, r)
+	})
+
+	mux.HandleFunc("/options/price", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		hop.Price(w, r)
+	})
+
+	mux.HandleFunc("/options/payoff", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		hop.Payoff(w, r)
+	})
+
+	mux.HandleFunc("/options/greeks", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		hop.GetNetGreeks(w, r)
+	})
+
+	db.AutoMigrate(&models.BasketOrder{})
+
+	hbo := &handlers.BasketOrderHandler{DB: db, Store: store, Brokers: brokers, Feed: feed}
+
+	mux.HandleFunc("/baskets", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			hbo.GetBaskets(w, r)
+		case http.MethodPost:
+			hbo.CreateBasket(w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/baskets/", func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/cancel") && r.Method == http.MethodPost:
+			hbo.CancelBasket(w, r)
+		case r.Method == http.MethodGet:
+			hbo.GetBasket(w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	hxo := &handlers.ExitOrderHandler{DB: db, Store: store, Exits: exits}
+
+	mux.HandleFunc("/orders/bracket", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		hxo.CreateBracket(w, r)
+	})
+
+	mux.HandleFunc("/orders/oco", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		hxo.CreateOCO(w, r)
+	})
+
+	db.AutoMigrate(&models.AlgoOrder{})
+
+	hao := &handlers.AlgoOrderHandler{DB: db, Store: store, Engine: algos}
+
+	mux.HandleFunc("/algo-orders", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			hao.GetAlgoOrders(w, r)
+		case http.MethodPost:
+			hao.CreateAlgoOrder(w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/algo-orders/", func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/cancel") && r.Method == http.MethodPost:
+			hao.CancelAlgoOrder(w, r)
+		case r.Method == http.MethodGet:
+			hao.GetAlgoOrder(w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	db.AutoMigrate(&models.ChargePlan{})
+
+	hch := &handlers.ChargesHandler{DB: db, Store: store, Charges: chargeSvc}
+
+	mux.HandleFunc("/charge-plans", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			hch.GetPlans(w, r)
+		case http.MethodPost:
+			hch.CreatePlan(w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/charge-plans/", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPut:
+			hch.UpdatePlan(w, r)
+		case http.MethodDelete:
+			hch.DeletePlan(w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/charges/presets", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		hch.GetPresets(w, r)
+	})
+
+	mux.HandleFunc("/charges/estimate", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		hch.Estimate(w, r)
+	})
+
+	db.AutoMigrate(&models.Instrument{}, &models.InstrumentToken{})
+
+	hin := &handlers.InstrumentHandler{DB: db, Store: store, Instruments: symbols,
+		Admins: killswitch.ParseUserIDs(os.Getenv("INSTRUMENT_ADMINS"))}
+
+	mux.HandleFunc("/instruments/search", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		hin.Search(w, r)
+	})
+
+	mux.HandleFunc("/instruments/resolve", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		hin.Resolve(w, r)
+	})
+
+	mux.HandleFunc("/instruments/import", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		hin.Import(w, r)
+	})
+
+	hcal := &handlers.CalendarHandler{Store: store, Calendar: tradingCalendar}
+
+	mux.HandleFunc("/calendar/status", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		hcal.GetStatus(w, r)
+	})
+
+	mux.HandleFunc("/calendar/holidays", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		hcal.GetHolidays(w, r)
+	})
+
+	mux.HandleFunc("/calendar/reload", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		hcal.Reload(w, r)
+	})
+
+	db.AutoMigrate(&models.CorporateAction{}, &models.CorporateActionEntry{})
+
+	hca := &handlers.CorporateActionHandler{DB: db, Store: store, Processor: corporateActions,
+		Admins: killswitch.ParseUserIDs(os.Getenv("CORPORATE_ACTION_ADMINS"))}
+
+	mux.HandleFunc("/corporate-actions", func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			hca.GetActions(w, r)
+		case http.MethodPost:
+			hca.CreateAction(w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	mux.HandleFunc("/corporate-actions/entries", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		hca.GetEntries(w, r)
+	})
+
+	mux.HandleFunc("/corporate-actions/", func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case strings.HasSuffix(strings.TrimSuffix(r.URL.Path, "/"), "/apply") && r.Method == http.MethodPost:
+			hca.ApplyAction(w, r)
+		case r.Method == http.MethodGet:
+			hca.GetAction(w, r)
+		case r.Method == http.MethodDelete:
+			hca.DeleteAction(w, r)
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	})
+
+	htb := &handlers.TradebookHandler{DB: db, Store: store,
+		Importer: tradebook.NewImporter(db, symbols, chargeSvc, tradingCalendar)}
+
+	mux.HandleFunc("/imports/tradebook", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		htb.Import(w, r)
+	})
+
+	htax := &handlers.TaxReportHandler{DB: db, Store: store, Reports: taxreport.NewGenerator(db, tradingCalendar)}
+
+	mux.HandleFunc("/reports/tax", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		htax.GetTaxReport(w, r)
+	})
+
+	db.AutoMigrate(&models.NotificationPreferences{}, &models.ReportDelivery{})
+	hdg := &handlers.DigestHandler{DB: db, Store: store, Digests: digests}
+
+	mux.HandleFunc("/reports/digests", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		hdg.ListDeliveries(w, r)
+	})
+
+	mux.HandleFunc("/reports/digests/preview", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		hdg.Preview(w, r)
+	})
+
+	// Start the live trading engine once every table exists
+	if err := killSwitch.Load(); err != nil {
+		log.Fatal("Failed to load kill switches: ", err)
+	}
+	var openPaper []models.Order
+	db.Where("is_paper = ? AND status IN ?", true,
+		[]string{models.OrderStatusOpen, models.OrderStatusPartiallyFilled}).Find(&openPaper)
+	paper.Restore(openPaper)
+	if err := exits.Restore(); err != nil {
+		log.Println("Failed to restore held stops:", err)
+	}
+	go paper.Run(context.Background())
+	go exits.Run(context.Background())
+	if err := algos.Restore(); err != nil {
+		log.Println("Failed to restore algo orders:", err)
+	}
+	go algos.Run(context.Background())
+	go riskMonitor.Run(context.Background())
+	go scheduler.Run(context.Background())
+	go func() {
+		if err := supervisor.Start(context.Background()); err != nil {
+			log.Println("Failed to start strategy runner:", err)
+		}
+	}()
+
 	handler := cors.New(cors.Options{
 		AllowedOrigins:   []string{"http://localhost:5003"},
 		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
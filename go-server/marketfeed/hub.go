@@ -0,0 +1,191 @@
+// Package marketfeed distributes live bars to everything that trades on them:
+// deployed strategy runners, the paper broker and the risk monitor.
+package marketfeed
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"go-backend/models"
+	"go-backend/script"
+	"gorm.io/gorm"
+)
+
+// Update is a bar published for a symbol and timeframe.
+type Update struct {
+	Symbol    string
+	Timeframe string
+	Bar       script.Bar
+}
+
+type subscriber struct {
+	symbol, timeframe string // empty matches everything
+	ch                chan Update
+}
+
+// Hub fans bars out to subscribers and remembers the last traded price of
+// every symbol. Slow subscribers drop bars rather than block the publisher.
+type Hub struct {
+	mu     sync.RWMutex
+	subs   map[*subscriber]struct{}
+	prices map[string]float64
+	at     map[string]time.Time
+	latest map[string]time.Time // last bar published per symbol and timeframe
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		subs:   map[*subscriber]struct{}{},
+		prices: map[string]float64{},
+		at:     map[string]time.Time{},
+		latest: map[string]time.Time{},
+	}
+}
+
+// Canonical maps a symbol to the form bars, prices and subscriptions are
+// keyed by, so "nse:reliance" and "RELIANCE" are one series. The instrument
+// master replaces it; the default only upper-cases.
+var Canonical = func(symbol string) string { return strings.ToUpper(strings.TrimSpace(symbol)) }
+
+func key(symbol string) string {
+	if symbol == "" {
+		return ""
+	}
+	return Canonical(symbol)
+}
+
+// Subscribe returns a channel of bars for symbol/timeframe. Empty strings act
+// as wildcards. Call the returned function to unsubscribe.
+func (h *Hub) Subscribe(symbol, timeframe string) (<-chan Update, func()) {
+	s := &subscriber{symbol: key(symbol), timeframe: timeframe, ch: make(chan Update, 64)}
+	h.mu.Lock()
+	h.subs[s] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return s.ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subs, s)
+			h.mu.Unlock()
+			close(s.ch)
+		})
+	}
+}
+
+// Publish records the bar's close as the symbol's last price and delivers it.
+// A bar older than the last one published for its symbol and timeframe is
+// dropped, so late or replayed data never reaches brokers and runners; a
+// revision of the latest bar is delivered. It reports whether the bar went
+// out.
+func (h *Hub) Publish(symbol, timeframe string, bar script.Bar) bool {
+	k := key(symbol)
+	u := Update{Symbol: k, Timeframe: timeframe, Bar: bar}
+	h.mu.Lock()
+	series := k + "|" + timeframe
+	if bar.Time.Before(h.latest[series]) {
+		h.mu.Unlock()
+		return false
+	}
+	h.latest[series] = bar.Time
+	if bar.Time.After(h.at[k]) || h.at[k].IsZero() {
+		h.prices[k] = bar.Close
+		h.at[k] = bar.Time
+	}
+	h.mu.Unlock()
+
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for s := range h.subs {
+		if s.symbol != "" && s.symbol != k {
+			continue
+		}
+		if s.timeframe != "" && s.timeframe != timeframe {
+			continue
+		}
+		select {
+		case s.ch <- u:
+		default:
+		}
+	}
+	return true
+}
+
+// LastPrice returns the most recent close seen for symbol.
+func (h *Hub) LastPrice(symbol string) (float64, bool) {
+	k := key(symbol)
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	p, ok := h.prices[k]
+	return p, ok
+}
+
+// Prices returns a copy of every last price.
+func (h *Hub) Prices() map[string]float64 {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	out := make(map[string]float64, len(h.prices))
+	for k, v := range h.prices {
+		out[k] = v
+	}
+	return out
+}
+
+// History loads stored bars for symbol/timeframe in time order, as traded.
+// Zero times leave that end of the range open.
+func History(db *gorm.DB, symbol, timeframe string, from, to time.Time) ([]script.Bar, error) {
+	rows, err := history(db, symbol, timeframe, from, to)
+	return toBars(rows, false), err
+}
+
+// AdjustedHistory is History with bars before each applied corporate action
+// back-adjusted, so splits, bonuses and dividends do not show as gaps.
+func AdjustedHistory(db *gorm.DB, symbol, timeframe string, from, to time.Time) ([]script.Bar, error) {
+	rows, err := history(db, symbol, timeframe, from, to)
+	return toBars(rows, true), err
+}
+
+func history(db *gorm.DB, symbol, timeframe string, from, to time.Time) ([]models.MarketData, error) {
+	var rows []models.MarketData
+	q := db.Where("symbol = ? AND timeframe = ?", symbol, timeframe)
+	if !from.IsZero() {
+		q = q.Where("timestamp >= ?", from)
+	}
+	if !to.IsZero() {
+		q = q.Where("timestamp <= ?", to)
+	}
+	if err := q.Order("timestamp").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	return rows, nil
+}
+
+// Recent loads the latest n stored bars, oldest first. They are adjusted
+// for corporate actions so indicators warm up on a continuous series.
+func Recent(db *gorm.DB, symbol, timeframe string, n int) ([]script.Bar, error) {
+	var rows []models.MarketData
+	if err := db.Where("symbol = ? AND timeframe = ?", symbol, timeframe).
+		Order("timestamp DESC").Limit(n).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(rows)-1; i < j; i, j = i+1, j-1 {
+		rows[i], rows[j] = rows[j], rows[i]
+	}
+	return toBars(rows, true), nil
+}
+
+func toBars(rows []models.MarketData, adjusted bool) []script.Bar {
+	bars := make([]script.Bar, len(rows))
+	for i, m := range rows {
+		p, v := 1.0, 1.0
+		if adjusted && m.AdjFactor > 0 {
+			p = m.AdjFactor
+		}
+		if adjusted && m.VolumeFactor > 0 {
+			v = m.VolumeFactor
+		}
+		bars[i] = script.Bar{Time: m.Timestamp, Open: m.Open * p, High: m.High * p, Low: m.Low * p, Close: m.Close * p, Volume: m.Volume * v}
+	}
+	return bars
+}
@@ -13,6 +13,7 @@ type NotificationPreferences struct {
     TradingAlerts       bool
     MarketUpdates       bool
     PerformanceReports  bool
+    ReportFrequency     string `gorm:"default:'weekly'"` // daily, weekly or monthly digest
 
     CreatedAt time.Time
     UpdatedAt time.Time
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AlgoOrder is a parent order worked by an execution algorithm. The
+// algorithm sends it as child Orders (AlgoOrderID set) over time: evenly
+// (TWAP), following the instrument's historical intraday volume (VWAP), or
+// VisibleQty at a time (iceberg).
+type AlgoOrder struct {
+	ID         uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID     uuid.UUID `gorm:"type:uuid;not null;index" json:"userId"`
+	Algo       string    `gorm:"not null" json:"algo"`
+	Instrument string    `gorm:"not null" json:"instrument"`
+	Exchange   string    `json:"exchange"`
+	Side       string    `gorm:"not null" json:"side"`
+	Quantity   int       `gorm:"not null" json:"quantity"`
+	// LimitPrice makes the slices LIMIT orders at that price; 0 sends MARKET.
+	LimitPrice float64   `json:"limitPrice,omitempty"`
+	StartAt    time.Time `json:"startAt"`
+	EndAt      time.Time `json:"endAt"`                     // TWAP and VWAP; unfilled slices are cancelled then
+	Interval   int       `json:"intervalSeconds"`           // between TWAP and VWAP slices
+	VisibleQty int       `json:"visibleQuantity,omitempty"` // iceberg
+	// MaxParticipation caps what has been sent at this % of the volume the
+	// feed has traded since the start; 0 means no cap.
+	MaxParticipation float64 `json:"maxParticipation,omitempty"`
+
+	Status       string  `gorm:"default:'RUNNING';index" json:"status"`
+	Reason       string  `gorm:"type:text" json:"reason,omitempty"`
+	SentQty      int     `gorm:"default:0" json:"sentQty"`
+	FilledQty    int     `gorm:"default:0" json:"filledQty"`
+	AvgFillPrice float64 `json:"avgFillPrice"`
+	ArrivalPrice float64 `json:"arrivalPrice"`
+	// SlippageBps is the average fill against the arrival price in basis
+	// points; positive is worse than arrival for the order's side.
+	SlippageBps float64 `json:"slippageBps"`
+
+	StrategyID   uuid.UUID `gorm:"type:uuid;index" json:"strategyId"`
+	DeploymentID *uint     `gorm:"index" json:"deploymentId,omitempty"`
+	BrokerID     *uint     `json:"brokerId,omitempty"`
+	IsPaper      bool      `gorm:"default:false" json:"isPaper"`
+	IsExitOrder  bool      `gorm:"default:false" json:"isExitOrder"`
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt    time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+	Children     []Order   `gorm:"foreignKey:AlgoOrderID" json:"children,omitempty"`
+}
+
+// Execution algorithms.
+const (
+	AlgoTWAP    = "twap"
+	AlgoVWAP    = "vwap"
+	AlgoIceberg = "iceberg"
+)
+
+// Algo order statuses.
+const (
+	AlgoStatusRunning   = "RUNNING"
+	AlgoStatusCompleted = "COMPLETED"
+	AlgoStatusExpired   = "EXPIRED" // the window ended before it filled
+	AlgoStatusCancelled = "CANCELLED"
+	AlgoStatusFailed    = "FAILED" // a slice was refused
+)
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Backtest stores the result of running a pinned strategy version over
+// historical MarketData.
+type Backtest struct {
+	ID                uuid.UUID       `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID            uuid.UUID       `gorm:"type:uuid;not null;index" json:"userId"`
+	StrategyID        uuid.UUID       `gorm:"type:uuid;not null;index" json:"strategyId"`
+	StrategyVersion   int             `gorm:"not null" json:"strategyVersion"`
+	Symbol            string          `json:"symbol"`
+	Timeframe         string          `json:"timeframe"`
+	StartDate         time.Time       `json:"startDate"`
+	EndDate           time.Time       `json:"endDate"`
+	InitialCapital    float64         `json:"initialCapital"`
+	FinalCapital      float64         `json:"finalCapital"`
+	TotalPnl          float64         `json:"totalPnl"`
+	PercentReturn     float64         `json:"percentReturn"`
+	SharpeRatio       *float64        `json:"sharpeRatio,omitempty"`
+	MaxDrawdown       *float64        `json:"maxDrawdown,omitempty"`
+	WinRate           *float64        `json:"winRate,omitempty"`
+	ProfitFactor      *float64        `json:"profitFactor,omitempty"`
+	Trades            int             `json:"trades"`
+	Equity            json.RawMessage `gorm:"type:json" json:"equity"`
+	TradesData        json.RawMessage `gorm:"type:json" json:"tradesData"`
+	CommissionPercent float64         `json:"commissionPercent"`
+	SlippagePercent   float64         `json:"slippagePercent"`
+	PriceAdjustment   string          `gorm:"default:'raw'" json:"priceAdjustment"` // adjusted or raw bars
+	Status            string          `gorm:"default:'completed'" json:"status"`    // completed, failed
+	ErrorMessage      *string         `json:"errorMessage,omitempty"`
+	CreatedAt         time.Time       `gorm:"autoCreateTime" json:"createdAt"`
+}
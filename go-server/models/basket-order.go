@@ -0,0 +1,48 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// BasketOrder groups the legs of a multi-leg order: a straddle, a spread or
+// a pair. Legs are Orders with BasketID set; each leg trades LegRatio x
+// Quantity units. Legs go to the venue all or none, and if a leg is
+// rejected once its siblings are working, the filled legs are unwound.
+type BasketOrder struct {
+	ID           uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	UserID       uuid.UUID `gorm:"type:uuid;not null;index" json:"userId"`
+	Name         string    `json:"name"`
+	Kind         string    `json:"kind,omitempty"` // straddle, strangle, spread, pair, ...
+	Quantity     int       `gorm:"not null" json:"quantity"`
+	Status       string    `gorm:"default:'OPEN';index" json:"status"`
+	Reason       string    `gorm:"type:text" json:"reason,omitempty"` // why it was rejected, unwound or cancelled
+	StrategyID   uuid.UUID `gorm:"type:uuid;index" json:"strategyId"`
+	DeploymentID *uint     `gorm:"index" json:"deploymentId,omitempty"`
+	BrokerID     *uint     `json:"brokerId,omitempty"`
+	IsPaper      bool      `gorm:"default:false" json:"isPaper"`
+	CreatedAt    time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt    time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+	Legs         []Order   `gorm:"foreignKey:BasketID" json:"legs,omitempty"`
+}
+
+// Basket statuses. OPEN, PARTIALLY_FILLED, FILLED, CANCELLED and REJECTED
+// mean what they do for orders; REJECTED baskets never reached the venue.
+const (
+	BasketStatusOpen            = OrderStatusOpen
+	BasketStatusPartiallyFilled = OrderStatusPartiallyFilled
+	BasketStatusFilled          = OrderStatusFilled
+	BasketStatusCancelled       = OrderStatusCancelled
+	BasketStatusRejected        = OrderStatusRejected
+	BasketStatusUnwound         = "UNWOUND" // a leg failed after others were placed; fills were reversed
+)
+
+// IsTerminal reports whether the basket's legs can no longer fill.
+func (b *BasketOrder) IsTerminal() bool {
+	switch b.Status {
+	case BasketStatusFilled, BasketStatusCancelled, BasketStatusRejected, BasketStatusUnwound:
+		return true
+	}
+	return false
+}
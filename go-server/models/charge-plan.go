@@ -0,0 +1,22 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ChargePlan is a user's brokerage schedule for one broker connection, or
+// for all of them when BrokerID is nil. Preset names a built-in plan from
+// the charges package; Brokerage overrides its per-segment fees.
+type ChargePlan struct {
+	ID        uint            `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    uuid.UUID       `gorm:"type:uuid;not null;index" json:"userId"`
+	Name      string          `gorm:"not null" json:"name"`
+	BrokerID  *uint           `gorm:"index" json:"brokerId,omitempty"`
+	Preset    string          `json:"preset,omitempty"`
+	Brokerage json.RawMessage `gorm:"type:json" json:"brokerage,omitempty"` // segment -> {percent, flat, min, max}
+	CreatedAt time.Time       `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt time.Time       `gorm:"autoUpdateTime" json:"updatedAt"`
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CorporateAction is a split, bonus or dividend on one listed symbol. Once
+// APPLIED, stored MarketData before the ex-date carries its adjustment and
+// open positions on the ex-date have been restated.
+type CorporateAction struct {
+	ID       uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Symbol   string    `gorm:"not null;index" json:"symbol"`
+	Exchange string    `json:"exchange,omitempty"`
+	Type     string    `gorm:"not null" json:"type"` // SPLIT, BONUS or DIVIDEND
+	ExDate   time.Time `gorm:"not null;index" json:"exDate"`
+	// Splits give NewShares for every OldShares held; bonuses give
+	// NewShares extra for every OldShares.
+	NewShares   float64    `json:"newShares,omitempty"`
+	OldShares   float64    `json:"oldShares,omitempty"`
+	Dividend    float64    `gorm:"type:decimal(15,4);default:0" json:"dividend,omitempty"` // per share
+	PriceFactor float64    `gorm:"default:0" json:"priceFactor"`                           // multiplies earlier prices; set when applied
+	Status      string     `gorm:"default:'PENDING';index" json:"status"`                  // PENDING or APPLIED
+	Notes       string     `gorm:"type:text" json:"notes,omitempty"`
+	AppliedAt   *time.Time `json:"appliedAt,omitempty"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt   time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+// Corporate action types and statuses.
+const (
+	CorporateActionSplit    = "SPLIT"
+	CorporateActionBonus    = "BONUS"
+	CorporateActionDividend = "DIVIDEND"
+
+	CorporateActionPending = "PENDING"
+	CorporateActionApplied = "APPLIED"
+)
+
+// CorporateActionEntry is what an applied action did to one holding: the
+// shares a split or bonus added (booked as an adjustment order at zero
+// cost) or the cash a dividend paid.
+type CorporateActionEntry struct {
+	ID                uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	CorporateActionID uint       `gorm:"not null;index" json:"corporateActionId"`
+	UserID            uuid.UUID  `gorm:"type:uuid;not null;index" json:"userId"`
+	StrategyID        uuid.UUID  `gorm:"type:uuid;index" json:"strategyId"`
+	DeploymentID      *uint      `json:"deploymentId,omitempty"`
+	Instrument        string     `gorm:"not null" json:"instrument"`
+	Type              string     `gorm:"not null" json:"type"`
+	Quantity          float64    `json:"quantity"`                                   // held on the ex-date, negative when short
+	QuantityDelta     int        `json:"quantityDelta"`                              // shares added (or owed when short)
+	Amount            float64    `gorm:"type:decimal(15,4);default:0" json:"amount"` // dividend cash, negative when short
+	OrderID           *uuid.UUID `gorm:"type:uuid" json:"orderId,omitempty"`         // adjustment order for splits and bonuses
+	ExDate            time.Time  `gorm:"not null;index" json:"exDate"`
+	CreatedAt         time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+}
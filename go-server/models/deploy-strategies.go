@@ -2,6 +2,8 @@ package models
 
 import (
 	"time"
+	"strconv"
+	"strings"
 	"github.com/google/uuid"
 	"encoding/json"
 )
@@ -9,6 +11,7 @@ import (
 type DeployedStrategy struct {
     ID              uint      `gorm:"primaryKey;autoIncrement"`
     StrategyID      uuid.UUID `gorm:"type:uuid;not null"`
+    StrategyVersion int       `gorm:"not null;default:1"` // pinned StrategyVersion.Version
     UserID          uuid.UUID `gorm:"type:uuid;not null"`
     BrokerID        uint      `gorm:"not null"`
     Name            string    `gorm:"not null"`
@@ -16,9 +19,44 @@ type DeployedStrategy struct {
     CapitalDeployed string
     TradingType     string
     Status          string
+    LastError       *string   // most recent runner failure, if any
     CurrentPnl      float64
     PercentPnl      float64
     DeployedAt      time.Time `gorm:"autoCreateTime"`
     LastUpdated     time.Time `gorm:"autoUpdateTime"`
     Metadata json.RawMessage `gorm:"type:json"`
 }
+
+// Deployment statuses. The runner only executes active deployments; stopped
+// is final.
+const (
+    DeploymentStatusActive  = "active"
+    DeploymentStatusPaused  = "paused"
+    DeploymentStatusStopped = "stopped"
+    DeploymentStatusError   = "error"
+)
+
+// Capital is CapitalDeployed as a number, or -1 when it cannot be parsed.
+func (d *DeployedStrategy) Capital() float64 {
+    return parseAmount(d.CapitalDeployed, 0)
+}
+
+// Multiplier is LotMultiplier as a number (1 when unset), or -1 when it
+// cannot be parsed.
+func (d *DeployedStrategy) Multiplier() float64 {
+    return parseAmount(d.LotMultiplier, 1)
+}
+
+// parseAmount reads the string-typed numeric columns, tolerating thousands
+// separators, a currency symbol and an "x" suffix.
+func parseAmount(s string, def float64) float64 {
+    s = strings.NewReplacer(",", "", "₹", "", "$", "", "x", "", "X", "").Replace(strings.TrimSpace(s))
+    if s == "" {
+        return def
+    }
+    v, err := strconv.ParseFloat(s, 64)
+    if err != nil {
+        return -1
+    }
+    return v
+}
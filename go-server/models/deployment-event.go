@@ -0,0 +1,21 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// DeploymentEvent is the audit record of one lifecycle transition of a
+// DeployedStrategy.
+type DeploymentEvent struct {
+	ID           uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	DeploymentID uint       `gorm:"not null;index" json:"deploymentId"`
+	Action       string     `gorm:"not null" json:"action"`
+	FromStatus   string     `json:"fromStatus"`
+	ToStatus     string     `json:"toStatus"`
+	ActorID      *uuid.UUID `gorm:"type:uuid" json:"actorId,omitempty"` // nil when the system acted
+	Source       string     `gorm:"not null" json:"source"`             // user, runner, risk, ...
+	Reason       string     `gorm:"type:text" json:"reason"`
+	CreatedAt    time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+}
@@ -0,0 +1,38 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MarketExposure is the current exposure of a user's open positions to one
+// market (equity, F&O, FX, crypto, commodity). Percentages are of portfolio
+// value. Rows are replaced whenever exposures are recomputed.
+type MarketExposure struct {
+	ID            uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID        uuid.UUID `gorm:"type:uuid;not null;index" json:"userId"`
+	Market        string    `gorm:"not null" json:"market"`
+	Gross         float64   `json:"gross"`
+	Net           float64   `json:"net"`
+	Percentage    float64   `json:"percentage"` // gross
+	NetPercentage float64   `json:"netPercentage"`
+	Positions     int       `json:"positions"`
+	UpdatedAt     time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+// SectorExposure is the same breakdown by sector. Status compares the gross
+// percentage with the user's sector cap (safe, warning or breach).
+type SectorExposure struct {
+	ID            uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID        uuid.UUID `gorm:"type:uuid;not null;index" json:"userId"`
+	Sector        string    `gorm:"not null" json:"sector"`
+	Gross         float64   `json:"gross"`
+	Net           float64   `json:"net"`
+	Percentage    float64   `json:"percentage"` // gross
+	NetPercentage float64   `json:"netPercentage"`
+	Positions     int       `json:"positions"`
+	Cap           float64   `json:"cap"`
+	Status        string    `json:"status"`
+	UpdatedAt     time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// Instrument is one tradable contract in the instrument master, keyed by
+// exchange and trading symbol. It is loaded from broker instrument dumps.
+type Instrument struct {
+	ID             uint              `gorm:"primaryKey;autoIncrement" json:"id"`
+	Exchange       string            `gorm:"not null;uniqueIndex:idx_instrument_symbol" json:"exchange"` // NSE, BSE, NFO, BFO, MCX, CDS
+	TradingSymbol  string            `gorm:"not null;uniqueIndex:idx_instrument_symbol" json:"tradingSymbol"`
+	Segment        string            `gorm:"index" json:"segment"` // NSE, INDICES, NFO-FUT, NFO-OPT, MCX-FUT, ...
+	InstrumentType string            `json:"instrumentType"`       // EQ, INDEX, FUT, CE or PE
+	Name           string            `json:"name"`
+	Underlying     string            `gorm:"index" json:"underlying,omitempty"` // derivatives only
+	LotSize        int               `gorm:"default:1" json:"lotSize"`
+	TickSize       float64           `gorm:"type:decimal(10,4);default:0.05" json:"tickSize"`
+	Expiry         *time.Time        `gorm:"index" json:"expiry,omitempty"`
+	Strike         float64           `gorm:"type:decimal(15,4);default:0" json:"strike,omitempty"`
+	OptionType     string            `json:"optionType,omitempty"` // CE or PE
+	Tokens         []InstrumentToken `gorm:"foreignKey:InstrumentID;constraint:OnDelete:CASCADE" json:"tokens,omitempty"`
+	CreatedAt      time.Time         `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt      time.Time         `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+// InstrumentToken is a broker's own identifier for an instrument, e.g. a
+// Kite instrument_token or an Upstox instrument_key.
+type InstrumentToken struct {
+	ID           uint   `gorm:"primaryKey;autoIncrement" json:"-"`
+	InstrumentID uint   `gorm:"not null;index" json:"-"`
+	Broker       string `gorm:"not null;uniqueIndex:idx_instrument_token" json:"broker"`
+	Token        string `gorm:"not null;uniqueIndex:idx_instrument_token" json:"token"`
+}
+
+// Instrument types.
+const (
+	InstrumentEquity = "EQ"
+	InstrumentIndex  = "INDEX"
+	InstrumentFuture = "FUT"
+	InstrumentCall   = "CE"
+	InstrumentPut    = "PE"
+)
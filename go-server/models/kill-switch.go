@@ -0,0 +1,43 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// KillSwitch is the persisted state of one kill switch. The global switch
+// has a nil UserID. Once engaged it stays engaged, across restarts, until it
+// is explicitly re-armed.
+type KillSwitch struct {
+	ID        uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID    *uuid.UUID `gorm:"type:uuid;uniqueIndex" json:"userId"`
+	Engaged   bool       `gorm:"not null;default:false" json:"engaged"`
+	Reason    string     `json:"reason"`
+	EngagedAt *time.Time `json:"engagedAt"`
+	EngagedBy *uuid.UUID `gorm:"type:uuid" json:"engagedBy"`
+	ArmedAt   *time.Time `json:"armedAt"`
+	ArmedBy   *uuid.UUID `gorm:"type:uuid" json:"armedBy"`
+	UpdatedAt time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+// Kill switch actions.
+const (
+	KillSwitchEngage = "engage"
+	KillSwitchArm    = "arm"
+)
+
+// KillSwitchEvent audits every engage and re-arm. Summary records what the
+// switch cancelled, paused and squared off, and anything that failed.
+type KillSwitchEvent struct {
+	ID           uint            `gorm:"primaryKey;autoIncrement" json:"id"`
+	KillSwitchID uint            `gorm:"not null;index" json:"killSwitchId"`
+	UserID       *uuid.UUID      `gorm:"type:uuid;index" json:"userId"` // nil for the global switch
+	Action       string          `gorm:"not null" json:"action"`
+	ActorID      *uuid.UUID      `gorm:"type:uuid" json:"actorId"`
+	Reason       string          `json:"reason"`
+	SquareOff    bool            `json:"squareOff"`
+	Summary      json.RawMessage `gorm:"type:json" json:"summary"`
+	CreatedAt    time.Time       `gorm:"autoCreateTime" json:"createdAt"`
+}
@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// MarketData is one OHLCV bar for a symbol and timeframe.
+type MarketData struct {
+	ID        uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	Symbol    string    `gorm:"not null;index:idx_market_data_bar,unique" json:"symbol"`
+	Timeframe string    `gorm:"not null;index:idx_market_data_bar,unique" json:"timeframe"`
+	Timestamp time.Time `gorm:"not null;index:idx_market_data_bar,unique" json:"timestamp"`
+	Open      float64   `json:"open"`
+	High      float64   `json:"high"`
+	Low       float64   `json:"low"`
+	Close     float64   `json:"close"`
+	Volume    float64   `json:"volume"`
+	// Corporate action adjustment for bars before an ex-date: the adjusted
+	// series is prices times AdjFactor and volume times VolumeFactor. The
+	// stored OHLCV stays as traded.
+	AdjFactor    float64 `gorm:"default:1" json:"-"`
+	VolumeFactor float64 `gorm:"default:1" json:"-"`
+}
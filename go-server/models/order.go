@@ -22,6 +22,63 @@ type Order struct {
     UpdatedAt     time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
     IsExitOrder   bool       `gorm:"default:false" json:"isExitOrder"`
     ParentOrderID *uuid.UUID `gorm:"type:uuid;index" json:"parentOrderId,omitempty"`
+    DeploymentID  *uint      `gorm:"index" json:"deploymentId,omitempty"`
+    BrokerID      *uint      `json:"brokerId,omitempty"`
+    IsPaper       bool       `gorm:"default:false" json:"isPaper"`
+    BrokerOrderID string     `json:"brokerOrderId,omitempty"`
+    FilledQty     int        `gorm:"default:0" json:"filledQty"`
+    RiskLimitID   *uint      `json:"riskLimitId,omitempty"` // limit that blocked or downsized the order
+    RiskReason    string     `gorm:"type:text" json:"riskReason,omitempty"`
+    BasketID      *uuid.UUID `gorm:"type:uuid;index" json:"basketId,omitempty"` // multi-leg order this is a leg or unwind of
+    LegRatio      int        `gorm:"default:0" json:"legRatio,omitempty"`       // leg's units per basket unit; 0 for unwinds
+    TriggerPrice  float64    `gorm:"type:decimal(15,4);default:0" json:"triggerPrice,omitempty"` // stop orders: price that releases them
+    TrailAmount   float64    `gorm:"default:0" json:"trailAmount,omitempty"`                    // trailing stops: distance kept from the best price
+    TrailPercent  float64    `gorm:"default:0" json:"trailPercent,omitempty"`                   // or that distance as a % of the best price
+    OCOGroupID    *uuid.UUID `gorm:"type:uuid;index" json:"ocoGroupId,omitempty"`               // a fill on one order shrinks the rest of the group
+    TriggeredAt   *time.Time `json:"triggeredAt,omitempty"`
+    AlgoOrderID   *uuid.UUID `gorm:"type:uuid;index" json:"algoOrderId,omitempty"` // execution algo that sent this slice
+    Product       string     `json:"product,omitempty"` // CNC, MIS or NRML; empty equity orders are delivery
+}
+
+// Order statuses used across the Go backend.
+const (
+    OrderStatusOpen            = "OPEN"
+    OrderStatusPartiallyFilled = "PARTIALLY_FILLED"
+    OrderStatusFilled          = "FILLED"
+    OrderStatusCancelled       = "CANCELLED"
+    OrderStatusRejected        = "REJECTED"
+    // OrderStatusPending orders are held by the server: exits waiting for
+    // their entry to fill, or stops waiting for their trigger.
+    OrderStatusPending = "PENDING"
+)
+
+// Stop order types. Venues that cannot hold them natively get a MARKET order
+// from the server once the trigger is hit.
+const (
+    OrderTypeStop         = "STOP"
+    OrderTypeTrailingStop = "TRAILING_STOP"
+)
+
+// OrderTypeAdjustment orders are never routed: they book the shares a split
+// or bonus added to a position, at zero cost.
+const OrderTypeAdjustment = "ADJUSTMENT"
+
+// OrderTypeImported orders are never routed: they are the parents of fills
+// imported from a broker tradebook for trades placed elsewhere.
+const OrderTypeImported = "IMPORTED"
+
+// IsStop reports whether the order waits for a trigger price.
+func (o *Order) IsStop() bool {
+    return o.OrderType == OrderTypeStop || o.OrderType == OrderTypeTrailingStop
+}
+
+// IsTerminal reports whether the order can no longer fill.
+func (o *Order) IsTerminal() bool {
+    switch o.Status {
+    case OrderStatusFilled, OrderStatusCancelled, OrderStatusRejected:
+        return true
+    }
+    return false
 }
 
 // // TableName specifies the table name for GORM
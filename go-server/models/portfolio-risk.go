@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PortfolioRisk is the end-of-day risk snapshot of a user's account. One row
+// is kept per user and trading day. Changes, drawdowns and volatility are in
+// percent.
+type PortfolioRisk struct {
+	ID              uint      `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID          uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_portfolio_risk_day" json:"userId"`
+	Date            time.Time `gorm:"type:date;not null;uniqueIndex:idx_portfolio_risk_day" json:"date"`
+	TotalValue      float64   `json:"totalValue"`
+	DailyValue      float64   `json:"dailyValue"` // change in value over the day
+	DailyChange     float64   `json:"dailyChange"`
+	WeeklyChange    float64   `json:"weeklyChange"`
+	MonthlyChange   float64   `json:"monthlyChange"`
+	CurrentDrawdown float64   `json:"currentDrawdown"`
+	MaxDrawdown     float64   `json:"maxDrawdown"`
+	Volatility      float64   `json:"volatility"` // annualised
+	SharpeRatio     float64   `json:"sharpeRatio"`
+	Beta            float64   `json:"beta"`
+	Benchmark       string    `json:"benchmark"`
+	Strategies      int64     `json:"strategies"`   // strategies holding a position
+	ActiveTrades    int64     `json:"activeTrades"` // open positions
+	UpdatedAt       time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+}
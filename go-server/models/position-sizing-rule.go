@@ -0,0 +1,29 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// PositionSizingRule decides order quantities for a strategy. It mirrors
+// shared.PositionSizingRules, keyed by the Go backend's UUID users. A rule
+// without StrategyID applies to all of the user's strategies.
+type PositionSizingRule struct {
+	ID              uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID          uuid.UUID  `gorm:"type:uuid;not null;index" json:"userId"`
+	Name            string     `gorm:"not null" json:"name"`
+	Description     *string    `json:"description"`
+	Strategy        string     `gorm:"not null" json:"strategy"` // display name, e.g. "All Strategies"
+	StrategyID      *uuid.UUID `gorm:"type:uuid;index" json:"strategyId,omitempty"`
+	Method          string     `gorm:"not null" json:"method"` // fixed-quantity, fixed, percent-equity, risk-based, volatility, kelly
+	RiskPerTrade    float64    `gorm:"not null" json:"riskPerTrade"`
+	MaxPositionSize float64    `gorm:"not null" json:"maxPositionSize"`
+	FixedQuantity   float64    `json:"fixedQuantity,omitempty"`
+	ATRPeriod       int        `json:"atrPeriod,omitempty"`
+	ATRMultiplier   float64    `json:"atrMultiplier,omitempty"`
+	KellyFraction   float64    `json:"kellyFraction,omitempty"`
+	IsActive        bool       `gorm:"not null" json:"isActive"`
+	CreatedAt       time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt       time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ReportDelivery tracks one performance digest per user and period. The
+// unique key is claimed before sending, so a digest goes out at most once
+// however often the job runs.
+type ReportDelivery struct {
+	ID          uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID      uuid.UUID  `gorm:"type:uuid;not null;uniqueIndex:idx_report_delivery" json:"userId"`
+	Period      string     `gorm:"not null;uniqueIndex:idx_report_delivery" json:"period"` // daily, weekly, monthly
+	PeriodStart time.Time  `gorm:"not null;uniqueIndex:idx_report_delivery" json:"periodStart"`
+	PeriodEnd   time.Time  `gorm:"not null" json:"periodEnd"` // exclusive
+	Email       string     `json:"email"`
+	Status      string     `gorm:"not null;index" json:"status"`
+	Attempts    int        `gorm:"default:0" json:"attempts"`
+	Error       string     `gorm:"type:text" json:"error,omitempty"`
+	SentAt      *time.Time `json:"sentAt,omitempty"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt   time.Time  `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+// Report delivery statuses. A SENDING row left by a crash is not retried:
+// the mail may already have gone.
+const (
+	ReportSending = "SENDING"
+	ReportSent    = "SENT"
+	ReportFailed  = "FAILED"  // retried on later runs
+	ReportSkipped = "SKIPPED" // nothing happened in the period
+)
+
+// Performance digest frequencies.
+const (
+	ReportDaily   = "daily"
+	ReportWeekly  = "weekly"
+	ReportMonthly = "monthly"
+)
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RiskEvent records a RiskLimit changing status, with what the monitor saw
+// before and after it acted.
+type RiskEvent struct {
+	ID          uint            `gorm:"primaryKey;autoIncrement" json:"id"`
+	RiskLimitID uint            `gorm:"not null;index" json:"riskLimitId"`
+	UserID      uuid.UUID       `gorm:"type:uuid;not null;index" json:"userId"`
+	Metric      string          `gorm:"not null" json:"metric"`
+	Threshold   float64         `json:"threshold"`
+	Value       float64         `json:"value"`
+	FromStatus  string          `json:"fromStatus"`
+	ToStatus    string          `json:"toStatus"`
+	Action      string          `json:"action"`      // action executed, empty when none
+	ActionError *string         `json:"actionError"` // set when the action failed
+	Before      json.RawMessage `gorm:"type:json" json:"before"`
+	After       json.RawMessage `gorm:"type:json" json:"after"`
+	CreatedAt   time.Time       `gorm:"autoCreateTime" json:"createdAt"`
+}
@@ -0,0 +1,103 @@
+package models
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RiskLimit is a user-defined limit checked before every order and by the
+// risk monitor. It mirrors shared.RiskLimits, keyed by the Go backend's UUID
+// users.
+type RiskLimit struct {
+	ID           uint       `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID       uuid.UUID  `gorm:"type:uuid;not null;index" json:"userId"`
+	Name         string     `gorm:"not null" json:"name"`
+	Description  *string    `json:"description"`
+	Type         string     `gorm:"not null" json:"type"` // account, strategy, position
+	Metric       string     `gorm:"not null" json:"metric"`
+	Threshold    float64    `gorm:"not null" json:"threshold"`
+	CurrentValue *float64   `json:"currentValue"`
+	Status       string     `gorm:"default:'safe';not null" json:"status"` // safe, warning, breach
+	Action       string     `gorm:"not null" json:"action"`                // notify, reduce, pause, block, exit
+	IsActive     bool       `gorm:"not null" json:"isActive"`
+	StrategyID   *uuid.UUID `gorm:"type:uuid;index" json:"strategyId,omitempty"` // strategy limits: nil applies to each strategy
+	Instrument   string     `json:"instrument,omitempty"`                        // position limits: empty applies to each symbol
+	// AllowedInstruments is the comma-separated allow-list for the
+	// "allowed instruments" metric.
+	AllowedInstruments string    `gorm:"type:text" json:"allowedInstruments,omitempty"`
+	CreatedAt          time.Time `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt          time.Time `gorm:"autoUpdateTime" json:"updatedAt"`
+}
+
+// Risk limit types.
+const (
+	RiskTypeAccount  = "account"
+	RiskTypeStrategy = "strategy"
+	RiskTypePosition = "position"
+)
+
+// Risk limit statuses.
+const (
+	RiskStatusSafe    = "safe"
+	RiskStatusWarning = "warning"
+	RiskStatusBreach  = "breach"
+)
+
+// riskWarnRatio is the share of a threshold at which a limit turns to warning.
+const riskWarnRatio = 0.8
+
+// RiskStatusOf classifies usage against a threshold.
+func RiskStatusOf(usage, threshold float64) string {
+	switch {
+	case usage >= threshold:
+		return RiskStatusBreach
+	case usage >= threshold*riskWarnRatio:
+		return RiskStatusWarning
+	}
+	return RiskStatusSafe
+}
+
+// Actions taken when a limit is breached, before a trade or by the monitor.
+const (
+	RiskActionNotify = "notify" // alert only; orders go through
+	RiskActionReduce = "reduce" // downsize the order to fit; the monitor pauses deployments
+	RiskActionPause  = "pause"  // pause the deployments in scope
+	RiskActionBlock  = "block"  // reject new orders while breached
+	RiskActionExit   = "exit"   // flatten everything in scope
+)
+
+// Metrics understood by the pre-trade engine. Names follow the frontend.
+const (
+	RiskMetricOrderValue         = "order value"         // notional of a single order
+	RiskMetricPositionSize       = "position size"       // absolute net quantity in one symbol
+	RiskMetricDailyPnl           = "daily P&L"           // threshold is the maximum loss for the day
+	RiskMetricOpenOrders         = "open orders"         // number of working orders
+	RiskMetricAllowedInstruments = "allowed instruments" // see AllowedInstruments
+)
+
+// Metrics recomputed continuously by the risk monitor.
+const (
+	RiskMetricDrawdown            = "drawdown"             // intraday drawdown, % of capital
+	RiskMetricGrossExposure       = "gross exposure"       // sum of |quantity| x price
+	RiskMetricStrategyPnl         = "strategy P&L"         // threshold is the maximum loss, % of strategy capital
+	RiskMetricMarginUtilisation   = "margin utilisation"   // gross exposure, % of capital
+	RiskMetricSectorConcentration = "sector concentration" // largest sector's gross exposure, % of portfolio value
+	RiskMetricVaR95               = "VaR 95%"              // one-day historical VaR of open positions
+	RiskMetricVaR99               = "VaR 99%"
+	RiskMetricNetDelta            = "net delta" // |sum of delta x underlying price|
+	RiskMetricNetGamma            = "net gamma" // |change in delta value for a 1% move|
+	RiskMetricNetVega             = "net vega"  // |P&L for a one point move in volatility|
+	RiskMetricNetTheta            = "net theta" // threshold is the maximum time decay per day
+)
+
+// RiskMetrics are the metrics some check evaluates; a limit on any other
+// would never fire.
+var RiskMetrics = map[string]bool{
+	RiskMetricOrderValue: true, RiskMetricPositionSize: true, RiskMetricDailyPnl: true,
+	RiskMetricOpenOrders: true, RiskMetricAllowedInstruments: true,
+	RiskMetricDrawdown: true, RiskMetricGrossExposure: true, RiskMetricStrategyPnl: true,
+	RiskMetricMarginUtilisation: true, RiskMetricSectorConcentration: true,
+	RiskMetricVaR95: true, RiskMetricVaR99: true,
+	RiskMetricNetDelta: true, RiskMetricNetGamma: true, RiskMetricNetVega: true, RiskMetricNetTheta: true,
+}
@@ -29,6 +29,7 @@ type Strategy struct {
     Symbol      string    `json:"symbol" gorm:"not null"`
     Timeframe   string    `json:"timeframe" gorm:"not null"`
     IsActive    bool      `json:"isActive" gorm:"default:true"`
+    Version     int       `json:"version" gorm:"default:0"` // latest StrategyVersion.Version
     CreatedAt   time.Time `json:"createdAt" gorm:"autoCreateTime"`
     UpdatedAt   time.Time `json:"updatedAt" gorm:"autoUpdateTime"`
 
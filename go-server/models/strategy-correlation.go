@@ -0,0 +1,23 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// StrategyCorrelation holds one strategy's row of the user's correlation
+// matrix over a window of daily returns. CorrelationData is a list of
+// {strategyId, name, pearson, spearman, observations}, one per other
+// strategy.
+type StrategyCorrelation struct {
+	ID              uint            `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID          uuid.UUID       `gorm:"type:uuid;not null;uniqueIndex:idx_strategy_correlation" json:"userId"`
+	StrategyID      uuid.UUID       `gorm:"type:uuid;not null;uniqueIndex:idx_strategy_correlation" json:"strategyId"`
+	Window          int             `gorm:"column:window_days;not null;uniqueIndex:idx_strategy_correlation" json:"window"` // trading days
+	StrategyName    string          `json:"strategyName"`
+	Source          string          `json:"source"` // live or backtest
+	CorrelationData json.RawMessage `gorm:"type:json" json:"correlationData"`
+	UpdatedAt       time.Time       `gorm:"autoUpdateTime" json:"updatedAt"`
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// ErrVersionImmutable is returned when something tries to change a saved revision.
+var ErrVersionImmutable = errors.New("strategy versions are immutable")
+
+// StrategyVersion is an immutable snapshot of a strategy taken on every save.
+// Deployments and backtests pin a version so it is always known which code
+// produced which trades.
+type StrategyVersion struct {
+	ID         uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	StrategyID uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_strategy_version" json:"strategyId"`
+	Version    int       `gorm:"not null;uniqueIndex:idx_strategy_version" json:"version"`
+	Code       string    `gorm:"type:text" json:"code"`
+	Symbol     string    `json:"symbol"`
+	Timeframe  string    `json:"timeframe"`
+	Message    string    `json:"message"`
+	AuthorID   uuid.UUID `gorm:"type:uuid;not null" json:"authorId"`
+	CreatedAt  time.Time `gorm:"autoCreateTime" json:"createdAt"`
+}
+
+func (v *StrategyVersion) BeforeUpdate(tx *gorm.DB) error {
+	return ErrVersionImmutable
+}
+
+func (v *StrategyVersion) BeforeDelete(tx *gorm.DB) error {
+	return ErrVersionImmutable
+}
@@ -0,0 +1,32 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Stress scenario kinds.
+const (
+	StressKindShock  = "shock"  // apply Shocks to current prices
+	StressKindReplay = "replay" // apply each instrument's move between From and To
+)
+
+// StressScenario is a saved what-if the user can run against the current
+// portfolio. Shocks is a list of {symbol, sector, market, move} where move
+// is a percentage; DefaultMove applies to anything no shock matches.
+type StressScenario struct {
+	ID                   uint            `gorm:"primaryKey;autoIncrement" json:"id"`
+	UserID               uuid.UUID       `gorm:"type:uuid;not null;index" json:"userId"`
+	Name                 string          `gorm:"not null" json:"name"`
+	Description          *string         `json:"description"`
+	Kind                 string          `gorm:"not null" json:"kind"`
+	Shocks               json.RawMessage `gorm:"type:json" json:"shocks"`
+	DefaultMove          float64         `json:"defaultMove"`
+	VolatilityMultiplier float64         `json:"volatilityMultiplier"` // scales VaR; 0 or 1 leaves it unchanged
+	From                 *time.Time      `json:"from"`
+	To                   *time.Time      `json:"to"`
+	CreatedAt            time.Time       `gorm:"autoCreateTime" json:"createdAt"`
+	UpdatedAt            time.Time       `gorm:"autoUpdateTime" json:"updatedAt"`
+}
@@ -0,0 +1,210 @@
+package options
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go-backend/ledger"
+	"go-backend/marketfeed"
+	"go-backend/models"
+	"gorm.io/gorm"
+)
+
+// Book aggregates the greeks of a user's open positions. Options are valued
+// at the volatility implied by their last price; futures and stock carry a
+// delta of one per unit.
+type Book struct {
+	DB   *gorm.DB
+	Feed *marketfeed.Hub
+	Rate float64
+}
+
+func NewBook(db *gorm.DB, feed *marketfeed.Hub) *Book {
+	return &Book{DB: db, Feed: feed, Rate: DefaultRate}
+}
+
+// PositionGreeks are one position's greeks, already scaled by its quantity.
+type PositionGreeks struct {
+	Instrument string  `json:"instrument"`
+	Underlying string  `json:"underlying"`
+	Type       string  `json:"type"` // CE, PE, FUT or EQ
+	Quantity   float64 `json:"quantity"`
+	Price      float64 `json:"price"`
+	Spot       float64 `json:"spot"`
+	IV         float64 `json:"iv,omitempty"`
+	Greeks     Greeks  `json:"greeks"`
+}
+
+// UnderlyingGreeks nets the positions on one underlying. DeltaValue is delta
+// in currency; GammaValue is the change in DeltaValue for a 1% move.
+type UnderlyingGreeks struct {
+	Underlying string  `json:"underlying"`
+	Spot       float64 `json:"spot"`
+	Greeks     Greeks  `json:"greeks"`
+	DeltaValue float64 `json:"deltaValue"`
+	GammaValue float64 `json:"gammaValue"`
+}
+
+// BookGreeks is the net greeks of one scope. Deltas in units of different
+// underlyings do not add up, so the totals are in currency: DeltaValue,
+// GammaValue, and Theta, Vega and Rho from Greeks.
+type BookGreeks struct {
+	StrategyID  *uuid.UUID         `json:"strategyId,omitempty"`
+	Greeks      Greeks             `json:"greeks"`
+	DeltaValue  float64            `json:"deltaValue"`
+	GammaValue  float64            `json:"gammaValue"`
+	Underlyings []UnderlyingGreeks `json:"underlyings"`
+	Positions   []PositionGreeks   `json:"positions"`
+	Missing     []string           `json:"missing"` // open positions without a price
+	At          time.Time          `json:"at"`
+}
+
+// Compute nets the greeks of the user's open positions, narrowed to one
+// strategy when strategyID is set.
+func (b *Book) Compute(userID uuid.UUID, strategyID *uuid.UUID) (*BookGreeks, error) {
+	fills, err := ledger.LoadFills(b.DB, func(q *gorm.DB) *gorm.DB {
+		q = q.Where("orders.user_id = ?", userID)
+		if strategyID != nil {
+			q = q.Where("orders.strategy_id = ?", *strategyID)
+		}
+		return q
+	})
+	if err != nil {
+		return nil, fmt.Errorf("load fills: %w", err)
+	}
+	exchanges := map[string]string{}
+	for _, f := range fills {
+		exchanges[strings.ToUpper(f.Instrument)] = strings.ToUpper(f.Exchange)
+	}
+
+	report := &BookGreeks{StrategyID: strategyID, Underlyings: []UnderlyingGreeks{},
+		Positions: []PositionGreeks{}, Missing: []string{}, At: time.Now()}
+	type open struct {
+		pos      *ledger.Position
+		contract Contract
+	}
+	var positions []open
+	var symbols []string
+	for k, p := range ledger.Positions(fills) {
+		if p.Quantity == 0 {
+			continue
+		}
+		ct, err := ParseSymbol(k)
+		if err != nil {
+			ct = Contract{Symbol: k, Underlying: k, Type: Underlying}
+		}
+		positions = append(positions, open{p, ct})
+		symbols = append(symbols, k)
+		if ct.Type != Underlying {
+			symbols = append(symbols, SpotSymbol(ct.Underlying), FutureSymbol(ct.Underlying, ct.Expiry))
+		}
+	}
+	if len(positions) == 0 {
+		return report, nil
+	}
+	prices, err := LastPrices(b.DB, b.Feed, symbols)
+	if err != nil {
+		return nil, err
+	}
+
+	byUnderlying := map[string]*UnderlyingGreeks{}
+	for _, o := range positions {
+		ct, qty := o.contract, o.pos.Quantity
+		pg := PositionGreeks{Instrument: ct.Symbol, Underlying: ct.Underlying, Type: ct.Type,
+			Quantity: qty, Price: prices[ct.Symbol]}
+
+		// MCX and currency options are on futures; equity and index options on the spot
+		model := BlackScholes
+		spotSyms := []string{SpotSymbol(ct.Underlying), FutureSymbol(ct.Underlying, ct.Expiry)}
+		if ex := exchanges[ct.Symbol]; ex == "MCX" || ex == "CDS" || ex == "BCD" {
+			model = Black76
+			spotSyms[0], spotSyms[1] = spotSyms[1], spotSyms[0]
+		}
+		switch ct.Type {
+		case Underlying:
+			pg.Spot = pg.Price
+			pg.Greeks.Delta = qty
+		case Future:
+			pg.Spot = prices[spotSyms[0]]
+			if pg.Spot == 0 {
+				pg.Spot = pg.Price
+			}
+			pg.Greeks.Delta = qty
+		default:
+			for _, s := range spotSyms {
+				if p := prices[s]; p > 0 {
+					pg.Spot = p
+					break
+				}
+			}
+			if pg.Spot > 0 && pg.Price > 0 {
+				p := Params{Model: model, Type: ct.Type, Underlying: pg.Spot, Strike: ct.Strike,
+					Time: YearsTo(ct.Expiry, report.At), Rate: b.Rate}
+				if iv, err := ImpliedVol(p, pg.Price); err == nil {
+					p.Vol = iv
+					pg.IV = iv
+				}
+				_, g := Compute(p)
+				pg.Greeks.Add(g, qty)
+			}
+		}
+		if pg.Spot <= 0 {
+			report.Missing = append(report.Missing, ct.Symbol)
+			continue
+		}
+
+		report.Positions = append(report.Positions, pg)
+		u, ok := byUnderlying[ct.Underlying]
+		if !ok {
+			u = &UnderlyingGreeks{Underlying: ct.Underlying, Spot: pg.Spot}
+			byUnderlying[ct.Underlying] = u
+		}
+		u.Greeks.Add(pg.Greeks, 1)
+	}
+
+	for _, u := range byUnderlying {
+		u.DeltaValue = round2(u.Greeks.Delta * u.Spot)
+		u.GammaValue = round2(u.Greeks.Gamma * u.Spot * u.Spot / 100)
+		report.Greeks.Add(u.Greeks, 1)
+		report.DeltaValue += u.DeltaValue
+		report.GammaValue += u.GammaValue
+		report.Underlyings = append(report.Underlyings, *u)
+	}
+	sort.Slice(report.Underlyings, func(i, j int) bool {
+		return math.Abs(report.Underlyings[i].DeltaValue) > math.Abs(report.Underlyings[j].DeltaValue)
+	})
+	sort.Slice(report.Positions, func(i, j int) bool { return report.Positions[i].Instrument < report.Positions[j].Instrument })
+	sort.Strings(report.Missing)
+	return report, nil
+}
+
+// IsGreekMetric reports whether a risk limit metric is measured from
+// BookGreeks.
+func IsGreekMetric(metric string) bool {
+	switch strings.TrimSpace(metric) {
+	case models.RiskMetricNetDelta, models.RiskMetricNetGamma, models.RiskMetricNetVega, models.RiskMetricNetTheta:
+		return true
+	}
+	return false
+}
+
+// Metric returns a greek metric's value and its usage against the limit's
+// threshold. Delta, gamma and vega limits are on the absolute value; theta
+// limits on decay, so only a negative theta uses them up.
+func (g *BookGreeks) Metric(metric string) (value, usage float64) {
+	switch strings.TrimSpace(metric) {
+	case models.RiskMetricNetDelta:
+		return g.DeltaValue, math.Abs(g.DeltaValue)
+	case models.RiskMetricNetGamma:
+		return g.GammaValue, math.Abs(g.GammaValue)
+	case models.RiskMetricNetVega:
+		return g.Greeks.Vega, math.Abs(g.Greeks.Vega)
+	case models.RiskMetricNetTheta:
+		return g.Greeks.Theta, -g.Greeks.Theta
+	}
+	return 0, 0
+}
@@ -0,0 +1,213 @@
+package options
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"go-backend/marketfeed"
+	"gorm.io/gorm"
+)
+
+// Chain builds option chains from the contracts stored in MarketData,
+// pricing each quote from the live feed or its latest stored close.
+type Chain struct {
+	DB   *gorm.DB
+	Feed *marketfeed.Hub
+	Rate float64
+}
+
+func NewChain(db *gorm.DB, feed *marketfeed.Hub) *Chain {
+	return &Chain{DB: db, Feed: feed, Rate: DefaultRate}
+}
+
+// ChainQuote is one side of a strike.
+type ChainQuote struct {
+	Symbol    string  `json:"symbol"`
+	LastPrice float64 `json:"lastPrice"`
+	IV        float64 `json:"iv"` // 0 when it could not be solved
+	Greeks    Greeks  `json:"greeks"`
+}
+
+// ChainRow pairs the call and put of a strike.
+type ChainRow struct {
+	Strike float64     `json:"strike"`
+	Call   *ChainQuote `json:"call,omitempty"`
+	Put    *ChainQuote `json:"put,omitempty"`
+}
+
+type ChainReport struct {
+	Underlying string      `json:"underlying"`
+	Model      string      `json:"model"`
+	Expiry     time.Time   `json:"expiry"`
+	Expiries   []time.Time `json:"expiries"`
+	Spot       float64     `json:"spot"`
+	ATM        float64     `json:"atm"` // strike nearest the spot
+	Rows       []ChainRow  `json:"rows"`
+}
+
+// Contracts lists the unexpired options on underlying with stored data.
+func (c *Chain) Contracts(underlying string) ([]Contract, error) {
+	u := strings.ToUpper(strings.TrimSpace(underlying))
+	var symbols []string
+	if err := c.DB.Raw(`SELECT DISTINCT UPPER(symbol) FROM market_data WHERE UPPER(symbol) LIKE ?`, u+"%").
+		Scan(&symbols).Error; err != nil {
+		return nil, fmt.Errorf("load contracts: %w", err)
+	}
+	now := time.Now()
+	var out []Contract
+	for _, s := range symbols {
+		ct, err := ParseSymbol(s)
+		if err != nil || ct.Underlying != u || !ct.IsOption() || ct.Expiry.Before(now) {
+			continue
+		}
+		out = append(out, ct)
+	}
+	return out, nil
+}
+
+// Compute builds the chain for one expiry; a zero expiry picks the nearest.
+// Black-76 prices against the expiry month's future, Black-Scholes against
+// the spot.
+func (c *Chain) Compute(underlying string, expiry time.Time, model string) (*ChainReport, error) {
+	if model == "" {
+		model = BlackScholes
+	}
+	if model != BlackScholes && model != Black76 {
+		return nil, fmt.Errorf("model must be %s or %s", BlackScholes, Black76)
+	}
+	contracts, err := c.Contracts(underlying)
+	if err != nil {
+		return nil, err
+	}
+	report := &ChainReport{Underlying: strings.ToUpper(strings.TrimSpace(underlying)), Model: model,
+		Expiries: []time.Time{}, Rows: []ChainRow{}}
+
+	seen := map[time.Time]bool{}
+	for _, ct := range contracts {
+		if !seen[ct.Expiry] {
+			seen[ct.Expiry] = true
+			report.Expiries = append(report.Expiries, ct.Expiry)
+		}
+	}
+	sort.Slice(report.Expiries, func(i, j int) bool { return report.Expiries[i].Before(report.Expiries[j]) })
+	if len(report.Expiries) == 0 {
+		return report, nil
+	}
+	report.Expiry = report.Expiries[0]
+	if !expiry.IsZero() {
+		report.Expiry = time.Time{}
+		for _, e := range report.Expiries {
+			if sameDate(e, expiry) {
+				report.Expiry = e
+			}
+		}
+		if report.Expiry.IsZero() {
+			return report, nil
+		}
+	}
+
+	var symbols []string
+	for _, ct := range contracts {
+		if ct.Expiry.Equal(report.Expiry) {
+			symbols = append(symbols, ct.Symbol)
+		}
+	}
+	spotSyms := []string{SpotSymbol(report.Underlying), FutureSymbol(report.Underlying, report.Expiry)}
+	if model == Black76 {
+		spotSyms[0], spotSyms[1] = spotSyms[1], spotSyms[0]
+	}
+	prices, err := LastPrices(c.DB, c.Feed, append(symbols, spotSyms...))
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range spotSyms {
+		if p := prices[s]; p > 0 {
+			report.Spot = p
+			break
+		}
+	}
+
+	rows := map[float64]*ChainRow{}
+	now := time.Now()
+	for _, ct := range contracts {
+		if !ct.Expiry.Equal(report.Expiry) {
+			continue
+		}
+		row, ok := rows[ct.Strike]
+		if !ok {
+			row = &ChainRow{Strike: ct.Strike}
+			rows[ct.Strike] = row
+		}
+		q := &ChainQuote{Symbol: ct.Symbol, LastPrice: prices[ct.Symbol]}
+		if report.Spot > 0 && q.LastPrice > 0 {
+			p := Params{Model: model, Type: ct.Type, Underlying: report.Spot, Strike: ct.Strike,
+				Time: YearsTo(ct.Expiry, now), Rate: c.Rate}
+			if iv, err := ImpliedVol(p, q.LastPrice); err == nil {
+				p.Vol = iv
+				_, q.Greeks = Compute(p)
+				q.IV = iv
+			}
+		}
+		if ct.Type == Call {
+			row.Call = q
+		} else {
+			row.Put = q
+		}
+	}
+	for _, row := range rows {
+		report.Rows = append(report.Rows, *row)
+	}
+	sort.Slice(report.Rows, func(i, j int) bool { return report.Rows[i].Strike < report.Rows[j].Strike })
+	if report.Spot > 0 {
+		best := math.Inf(1)
+		for _, row := range report.Rows {
+			if d := math.Abs(row.Strike - report.Spot); d < best {
+				best, report.ATM = d, row.Strike
+			}
+		}
+	}
+	return report, nil
+}
+
+// LastPrices returns the live price of each symbol, falling back to its
+// latest stored close. Keys are upper case; symbols without a price are
+// absent.
+func LastPrices(db *gorm.DB, feed *marketfeed.Hub, symbols []string) (map[string]float64, error) {
+	out := map[string]float64{}
+	var missing []string
+	for _, s := range symbols {
+		s = strings.ToUpper(s)
+		if feed != nil {
+			if p, ok := feed.LastPrice(s); ok {
+				out[s] = p
+				continue
+			}
+		}
+		missing = append(missing, s)
+	}
+	if len(missing) == 0 {
+		return out, nil
+	}
+	var rows []struct {
+		Symbol string
+		Close  float64
+	}
+	if err := db.Raw(`SELECT DISTINCT ON (UPPER(symbol)) UPPER(symbol) AS symbol, close
+		FROM market_data WHERE UPPER(symbol) IN ?
+		ORDER BY UPPER(symbol), timestamp DESC`, missing).Scan(&rows).Error; err != nil {
+		return nil, fmt.Errorf("load prices: %w", err)
+	}
+	for _, r := range rows {
+		out[r.Symbol] = r.Close
+	}
+	return out, nil
+}
+
+func sameDate(a, b time.Time) bool {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	return ay == by && am == bm && ad == bd
+}
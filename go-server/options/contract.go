@@ -0,0 +1,137 @@
+package options
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Contract types beyond Call and Put.
+const Future = "FUT"
+
+// Contract is a parsed derivative trading symbol.
+type Contract struct {
+	Symbol     string    `json:"symbol"`
+	Underlying string    `json:"underlying"`
+	Expiry     time.Time `json:"expiry"`
+	Strike     float64   `json:"strike,omitempty"`
+	Type       string    `json:"type"` // CE, PE or FUT
+}
+
+// IsOption reports whether c is a call or a put.
+func (c Contract) IsOption() bool { return c.Type == Call || c.Type == Put }
+
+// ExpiryFunc returns the expiry of a monthly contract on underlying. It is a
+// variable so an instrument master or trading calendar can supply exact
+// dates; the default is the month's last Thursday.
+var ExpiryFunc = lastThursday
+
+var (
+	months = map[string]time.Month{
+		"JAN": time.January, "FEB": time.February, "MAR": time.March, "APR": time.April,
+		"MAY": time.May, "JUN": time.June, "JUL": time.July, "AUG": time.August,
+		"SEP": time.September, "OCT": time.October, "NOV": time.November, "DEC": time.December,
+	}
+	// NIFTY25JAN24000CE, NIFTY25JANFUT
+	monthlyRe = regexp.MustCompile(`^([A-Z&-]+?)(\d{2})(JAN|FEB|MAR|APR|MAY|JUN|JUL|AUG|SEP|OCT|NOV|DEC)(?:(\d+(?:\.\d+)?)(CE|PE)|(FUT))$`)
+	// weekly options carry the day: NIFTY2510924000CE is 9 Jan 2025 (O, N and D are Oct-Dec)
+	weeklyRe = regexp.MustCompile(`^([A-Z&-]+?)(\d{2})([1-9OND])(\d{2})(\d+(?:\.\d+)?)(CE|PE)$`)
+)
+
+// ParseSymbol parses an NSE-style option or future symbol. An exchange
+// prefix ("NFO:") is ignored.
+func ParseSymbol(symbol string) (Contract, error) {
+	sym := strings.ToUpper(strings.TrimSpace(symbol))
+	if i := strings.Index(sym, ":"); i >= 0 {
+		sym = sym[i+1:]
+	}
+
+	if m := monthlyRe.FindStringSubmatch(sym); m != nil {
+		yy, _ := strconv.Atoi(m[2])
+		c := Contract{Symbol: sym, Underlying: m[1], Expiry: ExpiryFunc(m[1], 2000+yy, months[m[3]])}
+		if m[6] != "" {
+			c.Type = Future
+			return c, nil
+		}
+		c.Strike, _ = strconv.ParseFloat(m[4], 64)
+		c.Type = m[5]
+		return c, nil
+	}
+
+	if m := weeklyRe.FindStringSubmatch(sym); m != nil {
+		yy, _ := strconv.Atoi(m[2])
+		var mon time.Month
+		switch m[3] {
+		case "O":
+			mon = time.October
+		case "N":
+			mon = time.November
+		case "D":
+			mon = time.December
+		default:
+			n, _ := strconv.Atoi(m[3])
+			mon = time.Month(n)
+		}
+		dd, _ := strconv.Atoi(m[4])
+		if dd < 1 || dd > 31 {
+			return Contract{}, fmt.Errorf("invalid expiry day in %q", symbol)
+		}
+		strike, _ := strconv.ParseFloat(m[5], 64)
+		return Contract{Symbol: sym, Underlying: m[1], Expiry: expiryTime(2000+yy, mon, dd), Strike: strike, Type: m[6]}, nil
+	}
+	return Contract{}, fmt.Errorf("%q is not a derivative symbol", symbol)
+}
+
+// OptionSymbol formats the monthly symbol of an option.
+func OptionSymbol(underlying string, expiry time.Time, strike float64, typ string) string {
+	return fmt.Sprintf("%s%02d%s%s%s", strings.ToUpper(underlying), expiry.Year()%100,
+		strings.ToUpper(expiry.Month().String()[:3]), strconv.FormatFloat(strike, 'f', -1, 64), typ)
+}
+
+// FutureSymbol formats the monthly futures symbol expiring in expiry's month.
+func FutureSymbol(underlying string, expiry time.Time) string {
+	return fmt.Sprintf("%s%02d%sFUT", strings.ToUpper(underlying), expiry.Year()%100,
+		strings.ToUpper(expiry.Month().String()[:3]))
+}
+
+// spotSymbols maps index derivative underlyings to the index's own symbol.
+var spotSymbols = map[string]string{
+	"NIFTY":      "NIFTY 50",
+	"BANKNIFTY":  "NIFTY BANK",
+	"FINNIFTY":   "NIFTY FIN SERVICE",
+	"MIDCPNIFTY": "NIFTY MID SELECT",
+	"NIFTYNXT50": "NIFTY NEXT 50",
+}
+
+// SpotSymbol is the symbol the underlying's spot price is stored under.
+func SpotSymbol(underlying string) string {
+	u := strings.ToUpper(underlying)
+	if s, ok := spotSymbols[u]; ok {
+		return s
+	}
+	return u
+}
+
+// YearsTo is the time from now to expiry in years, never negative.
+func YearsTo(expiry, now time.Time) float64 {
+	d := expiry.Sub(now)
+	if d <= 0 {
+		return 0
+	}
+	return d.Hours() / 24 / 365
+}
+
+// expiryTime is the market close on the expiry date.
+func expiryTime(year int, month time.Month, day int) time.Time {
+	return time.Date(year, month, day, 15, 30, 0, 0, time.Local)
+}
+
+func lastThursday(_ string, year int, month time.Month) time.Time {
+	d := time.Date(year, month+1, 0, 0, 0, 0, 0, time.Local)
+	for d.Weekday() != time.Thursday {
+		d = d.AddDate(0, 0, -1)
+	}
+	return expiryTime(d.Year(), d.Month(), d.Day())
+}
@@ -0,0 +1,251 @@
+package options
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Leg sides.
+const (
+	Buy  = "BUY"
+	Sell = "SELL"
+)
+
+// Underlying is a leg type for stock or index positions held alongside
+// options; Future legs track the underlying price one for one.
+const Underlying = "EQ"
+
+// Defaults for payoff curves.
+const (
+	DefaultPayoffPoints = 101
+	DefaultPayoffRange  = 0.15 // spot +/- 15%
+	DefaultVol          = 0.20
+)
+
+// Leg is one position of a strategy. Quantity is in units of the underlying
+// (lots x lot size); Premium is the entry price per unit. Vol overrides the
+// volatility implied from Premium.
+type Leg struct {
+	Type     string    `json:"type"` // CE, PE, FUT or EQ
+	Side     string    `json:"side"`
+	Strike   float64   `json:"strike,omitempty"`
+	Expiry   time.Time `json:"expiry"`
+	Quantity float64   `json:"quantity"`
+	Premium  float64   `json:"premium"`
+	Vol      float64   `json:"vol,omitempty"`
+}
+
+func (l Leg) sign() float64 {
+	if l.Side == Sell {
+		return -1
+	}
+	return 1
+}
+
+// PayoffConfig positions the curves. Lower and Upper default to Spot +/-
+// DefaultPayoffRange; Days lists the T+n curves drawn besides expiry.
+type PayoffConfig struct {
+	Spot     float64   `json:"spot"`
+	Model    string    `json:"model"`
+	Rate     float64   `json:"rate"`
+	Dividend float64   `json:"dividend"`
+	Vol      float64   `json:"vol"` // for legs without a premium to imply from
+	Lower    float64   `json:"lower"`
+	Upper    float64   `json:"upper"`
+	Points   int       `json:"points"`
+	Days     []int     `json:"days"`
+	Now      time.Time `json:"-"`
+}
+
+// PayoffCurve is the strategy's P&L at each spot on a valuation date.
+type PayoffCurve struct {
+	Label string    `json:"label"` // "expiry" or "T+n"
+	Date  time.Time `json:"date"`
+	PnL   []float64 `json:"pnl"`
+}
+
+// PayoffReport holds the curves and the strategy's key figures at expiry.
+// Max profit and loss are over the charted range; the Unlimited flags tell
+// whether they keep growing beyond its upper end.
+type PayoffReport struct {
+	Spots           []float64     `json:"spots"`
+	Curves          []PayoffCurve `json:"curves"`
+	Breakevens      []float64     `json:"breakevens"`
+	MaxProfit       float64       `json:"maxProfit"`
+	MaxLoss         float64       `json:"maxLoss"`
+	UnlimitedProfit bool          `json:"unlimitedProfit"`
+	UnlimitedLoss   bool          `json:"unlimitedLoss"`
+	NetPremium      float64       `json:"netPremium"` // paid is negative, received positive
+	Value           float64       `json:"value"`      // theoretical value now
+	Greeks          Greeks        `json:"greeks"`     // net, for the strategy's quantities
+	Vols            []float64     `json:"vols"`       // per leg, as used
+}
+
+// validateLegs normalises leg types and sides.
+func validateLegs(legs []Leg) error {
+	if len(legs) == 0 {
+		return fmt.Errorf("at least one leg is required")
+	}
+	for i := range legs {
+		l := &legs[i]
+		switch t := strings.ToUpper(l.Type); t {
+		case Future, Underlying:
+			l.Type = t
+		default:
+			typ, err := NormalizeType(t)
+			if err != nil {
+				return fmt.Errorf("leg %d: %w", i+1, err)
+			}
+			l.Type = typ
+			if l.Strike <= 0 {
+				return fmt.Errorf("leg %d: strike must be positive", i+1)
+			}
+			if l.Expiry.IsZero() {
+				return fmt.Errorf("leg %d: expiry is required", i+1)
+			}
+		}
+		l.Side = strings.ToUpper(l.Side)
+		if l.Side != Buy && l.Side != Sell {
+			return fmt.Errorf("leg %d: side must be BUY or SELL", i+1)
+		}
+		if l.Quantity <= 0 {
+			return fmt.Errorf("leg %d: quantity must be positive", i+1)
+		}
+	}
+	return nil
+}
+
+// Payoff charts a multi-leg strategy at the first expiry among its option
+// legs and at now + n days for each of cfg.Days. Later-dated legs are still
+// valued with Black-Scholes at the first expiry, so calendar spreads chart
+// correctly.
+func Payoff(legs []Leg, cfg PayoffConfig) (*PayoffReport, error) {
+	legs = append([]Leg(nil), legs...)
+	if err := validateLegs(legs); err != nil {
+		return nil, err
+	}
+	if cfg.Spot <= 0 {
+		return nil, fmt.Errorf("spot must be positive")
+	}
+	if cfg.Model == "" {
+		cfg.Model = BlackScholes
+	}
+	if cfg.Now.IsZero() {
+		cfg.Now = time.Now()
+	}
+	if cfg.Vol <= 0 {
+		cfg.Vol = DefaultVol
+	}
+	if cfg.Points < 2 {
+		cfg.Points = DefaultPayoffPoints
+	}
+	if cfg.Lower <= 0 {
+		cfg.Lower = cfg.Spot * (1 - DefaultPayoffRange)
+	}
+	if cfg.Upper <= cfg.Lower {
+		cfg.Upper = cfg.Spot * (1 + DefaultPayoffRange)
+	}
+
+	report := &PayoffReport{Spots: make([]float64, cfg.Points), Curves: []PayoffCurve{}, Breakevens: []float64{}}
+	step := (cfg.Upper - cfg.Lower) / float64(cfg.Points-1)
+	for i := range report.Spots {
+		report.Spots[i] = cfg.Lower + step*float64(i)
+	}
+
+	var expiry time.Time
+	for i, l := range legs {
+		if l.Type == Future || l.Type == Underlying {
+			report.Vols = append(report.Vols, 0)
+			continue
+		}
+		if expiry.IsZero() || l.Expiry.Before(expiry) {
+			expiry = l.Expiry
+		}
+		vol := l.Vol
+		if vol <= 0 {
+			vol = cfg.Vol
+			if l.Premium > 0 {
+				if iv, err := ImpliedVol(cfg.params(l, cfg.Spot, cfg.Now, 0), l.Premium); err == nil {
+					vol = iv
+				}
+			}
+		}
+		legs[i].Vol = vol
+		report.Vols = append(report.Vols, vol)
+		report.NetPremium -= l.sign() * l.Premium * l.Quantity
+	}
+
+	for _, l := range legs {
+		value, g := cfg.value(l, cfg.Spot, cfg.Now)
+		report.Value += l.sign() * value * l.Quantity
+		report.Greeks.Add(g, l.sign()*l.Quantity)
+	}
+
+	if expiry.IsZero() || expiry.Before(cfg.Now) {
+		expiry = cfg.Now
+	}
+	at := report.curve(legs, cfg, "expiry", expiry)
+	for _, n := range cfg.Days {
+		date := cfg.Now.AddDate(0, 0, n)
+		if n < 0 || date.After(expiry) {
+			continue
+		}
+		report.curve(legs, cfg, fmt.Sprintf("T+%d", n), date)
+	}
+
+	report.MaxProfit, report.MaxLoss = math.Inf(-1), math.Inf(1)
+	for i, v := range at {
+		report.MaxProfit = math.Max(report.MaxProfit, v)
+		report.MaxLoss = math.Min(report.MaxLoss, v)
+		if i > 0 && (at[i-1] < 0) != (v < 0) {
+			// linear interpolation between the two charted spots
+			s0, s1 := report.Spots[i-1], report.Spots[i]
+			report.Breakevens = append(report.Breakevens, round2(s0+(s1-s0)*(-at[i-1])/(v-at[i-1])))
+		}
+	}
+	n := len(at)
+	slope := at[n-1] - at[n-2]
+	report.UnlimitedProfit = slope > 1e-9
+	report.UnlimitedLoss = slope < -1e-9
+	sort.Float64s(report.Breakevens)
+	return report, nil
+}
+
+func (r *PayoffReport) curve(legs []Leg, cfg PayoffConfig, label string, date time.Time) []float64 {
+	pnl := make([]float64, len(r.Spots))
+	for i, s := range r.Spots {
+		for _, l := range legs {
+			value, _ := cfg.value(l, s, date)
+			pnl[i] += l.sign() * (value - l.Premium) * l.Quantity
+		}
+		pnl[i] = round2(pnl[i])
+	}
+	r.Curves = append(r.Curves, PayoffCurve{Label: label, Date: date, PnL: pnl})
+	return pnl
+}
+
+func (cfg PayoffConfig) params(l Leg, spot float64, at time.Time, vol float64) Params {
+	return Params{
+		Model:      cfg.Model,
+		Type:       l.Type,
+		Underlying: spot,
+		Strike:     l.Strike,
+		Time:       YearsTo(l.Expiry, at),
+		Rate:       cfg.Rate,
+		Dividend:   cfg.Dividend,
+		Vol:        vol,
+	}
+}
+
+// value prices one unit of the leg at spot on date.
+func (cfg PayoffConfig) value(l Leg, spot float64, at time.Time) (float64, Greeks) {
+	if l.Type == Future || l.Type == Underlying {
+		return spot, Greeks{Delta: 1}
+	}
+	return Compute(cfg.params(l, spot, at, l.Vol))
+}
+
+func round2(v float64) float64 { return math.Round(v*100) / 100 }
@@ -0,0 +1,226 @@
+// Package options prices European options with Black-Scholes (spot
+// underlyings) and Black-76 (futures underlyings), solves implied
+// volatility, computes greeks and builds payoff curves for multi-leg
+// strategies.
+package options
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Option types.
+const (
+	Call = "CE"
+	Put  = "PE"
+)
+
+// Pricing models.
+const (
+	BlackScholes = "black-scholes" // underlying is a spot price; Dividend is a continuous yield
+	Black76      = "black-76"      // underlying is a futures price
+)
+
+// DefaultRate is the annual risk-free rate used when none is given.
+const DefaultRate = 0.065
+
+var ErrNoVol = errors.New("implied volatility did not converge")
+
+// Params describe one option. Time is in years; Rate, Dividend and Vol are
+// annual decimals (0.065 = 6.5%).
+type Params struct {
+	Model      string  `json:"model"`
+	Type       string  `json:"type"`
+	Underlying float64 `json:"underlying"`
+	Strike     float64 `json:"strike"`
+	Time       float64 `json:"time"`
+	Rate       float64 `json:"rate"`
+	Dividend   float64 `json:"dividend"`
+	Vol        float64 `json:"vol"`
+}
+
+// Greeks are per one unit of the underlying. Theta is per calendar day,
+// Vega per one volatility point and Rho per one percentage point of rate.
+type Greeks struct {
+	Delta float64 `json:"delta"`
+	Gamma float64 `json:"gamma"`
+	Theta float64 `json:"theta"`
+	Vega  float64 `json:"vega"`
+	Rho   float64 `json:"rho"`
+}
+
+// Add accumulates g scaled by qty.
+func (g *Greeks) Add(o Greeks, qty float64) {
+	g.Delta += o.Delta * qty
+	g.Gamma += o.Gamma * qty
+	g.Theta += o.Theta * qty
+	g.Vega += o.Vega * qty
+	g.Rho += o.Rho * qty
+}
+
+// NormalizeType maps CALL/C/CE and PUT/P/PE to Call and Put.
+func NormalizeType(t string) (string, error) {
+	switch strings.ToUpper(strings.TrimSpace(t)) {
+	case "CE", "C", "CALL":
+		return Call, nil
+	case "PE", "P", "PUT":
+		return Put, nil
+	}
+	return "", fmt.Errorf("option type must be CE or PE, got %q", t)
+}
+
+// Validate checks the inputs and fills defaults.
+func (p *Params) Validate() error {
+	t, err := NormalizeType(p.Type)
+	if err != nil {
+		return err
+	}
+	p.Type = t
+	switch p.Model {
+	case "":
+		p.Model = BlackScholes
+	case BlackScholes, Black76:
+	default:
+		return fmt.Errorf("model must be %s or %s", BlackScholes, Black76)
+	}
+	if p.Underlying <= 0 || p.Strike <= 0 {
+		return fmt.Errorf("underlying and strike must be positive")
+	}
+	if p.Time < 0 || p.Vol < 0 {
+		return fmt.Errorf("time and vol must not be negative")
+	}
+	return nil
+}
+
+// forward and discount express both models as Black-76 on a forward.
+func (p Params) forward() (f, df float64) {
+	df = math.Exp(-p.Rate * p.Time)
+	if p.Model == Black76 {
+		return p.Underlying, df
+	}
+	return p.Underlying * math.Exp((p.Rate-p.Dividend)*p.Time), df
+}
+
+func intrinsic(typ string, s, k float64) float64 {
+	if typ == Call {
+		return math.Max(s-k, 0)
+	}
+	return math.Max(k-s, 0)
+}
+
+// Price is the option's fair value.
+func Price(p Params) float64 {
+	if p.Time <= 0 || p.Vol <= 0 {
+		f, df := p.forward()
+		return df * intrinsic(p.Type, f, p.Strike)
+	}
+	f, df := p.forward()
+	sd := p.Vol * math.Sqrt(p.Time)
+	d1 := (math.Log(f/p.Strike) + sd*sd/2) / sd
+	d2 := d1 - sd
+	if p.Type == Call {
+		return df * (f*cdf(d1) - p.Strike*cdf(d2))
+	}
+	return df * (p.Strike*cdf(-d2) - f*cdf(-d1))
+}
+
+// Compute returns the price and greeks together.
+func Compute(p Params) (float64, Greeks) {
+	price := Price(p)
+	if p.Time <= 0 || p.Vol <= 0 {
+		g := Greeks{}
+		if intrinsic(p.Type, p.Underlying, p.Strike) > 0 {
+			g.Delta = 1
+			if p.Type == Put {
+				g.Delta = -1
+			}
+		}
+		return price, g
+	}
+
+	f, df := p.forward()
+	sqrtT := math.Sqrt(p.Time)
+	sd := p.Vol * sqrtT
+	d1 := (math.Log(f/p.Strike) + sd*sd/2) / sd
+	d2 := d1 - sd
+	pdf1 := pdf(d1)
+
+	// carry is e^{-qT} for spot, e^{-rT} for futures: dF/dS times discount
+	carry := df
+	if p.Model == BlackScholes {
+		carry = math.Exp(-p.Dividend * p.Time)
+	}
+
+	var g Greeks
+	g.Gamma = carry * pdf1 / (p.Underlying * sd)
+	g.Vega = p.Underlying * carry * pdf1 * sqrtT / 100
+	decay := -p.Underlying * carry * pdf1 * p.Vol / (2 * sqrtT)
+	if p.Type == Call {
+		g.Delta = carry * cdf(d1)
+		if p.Model == Black76 {
+			g.Theta = decay + p.Rate*price
+			g.Rho = -p.Time * price / 100
+		} else {
+			g.Theta = decay + p.Dividend*p.Underlying*carry*cdf(d1) - p.Rate*p.Strike*df*cdf(d2)
+			g.Rho = p.Strike * p.Time * df * cdf(d2) / 100
+		}
+	} else {
+		g.Delta = -carry * cdf(-d1)
+		if p.Model == Black76 {
+			g.Theta = decay + p.Rate*price
+			g.Rho = -p.Time * price / 100
+		} else {
+			g.Theta = decay - p.Dividend*p.Underlying*carry*cdf(-d1) + p.Rate*p.Strike*df*cdf(-d2)
+			g.Rho = -p.Strike * p.Time * df * cdf(-d2) / 100
+		}
+	}
+	g.Theta /= 365
+	return price, g
+}
+
+// ImpliedVol solves for the volatility that prices the option at price,
+// with Newton steps guarded by bisection.
+func ImpliedVol(p Params, price float64) (float64, error) {
+	if p.Time <= 0 {
+		return 0, fmt.Errorf("option has expired")
+	}
+	lo, hi := 1e-4, 5.0
+	p.Vol = lo
+	if price < Price(p)-1e-8 {
+		return 0, fmt.Errorf("price %.4f is below the option's intrinsic value", price)
+	}
+	p.Vol = hi
+	if price > Price(p) {
+		return 0, ErrNoVol
+	}
+
+	vol := 0.3
+	for i := 0; i < 100; i++ {
+		p.Vol = vol
+		v, g := Compute(p)
+		diff := v - price
+		if math.Abs(diff) < 1e-6 {
+			return vol, nil
+		}
+		if diff > 0 {
+			hi = vol
+		} else {
+			lo = vol
+		}
+		next := vol - diff/(g.Vega*100)
+		if g.Vega <= 1e-10 || next <= lo || next >= hi || math.IsNaN(next) {
+			next = (lo + hi) / 2
+		}
+		vol = next
+		if hi-lo < 1e-9 {
+			return vol, nil
+		}
+	}
+	return 0, ErrNoVol
+}
+
+func cdf(x float64) float64 { return 0.5 * math.Erfc(-x/math.Sqrt2) }
+
+func pdf(x float64) float64 { return math.Exp(-x*x/2) / math.Sqrt(2*math.Pi) }
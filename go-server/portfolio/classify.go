@@ -0,0 +1,114 @@
+package portfolio
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Markets an open position can be classified into.
+const (
+	MarketEquity    = "Equity"
+	MarketFO        = "F&O"
+	MarketFX        = "FX"
+	MarketCrypto    = "Crypto"
+	MarketCommodity = "Commodity"
+)
+
+// SectorOther is used for instruments the classifier does not know.
+const SectorOther = "Other"
+
+// Classification places an instrument in a market and a sector.
+type Classification struct {
+	Market string `json:"market"`
+	Sector string `json:"sector"`
+}
+
+// ClassifyFunc classifies an instrument. It is a variable so a richer
+// instrument source can replace the built-in tables.
+var ClassifyFunc = builtinClassify
+
+// Classify returns the market and sector of instrument on exchange.
+func Classify(exchange, instrument string) Classification { return ClassifyFunc(exchange, instrument) }
+
+var (
+	// derivative contract symbols, e.g. NIFTY25JANFUT or RELIANCE25JAN2900CE
+	contractRe = regexp.MustCompile(`^([A-Z&-]+?)\d{2}[A-Z0-9]*(FUT|CE|PE)$`)
+
+	cryptoExchanges = map[string]bool{"CRYPTO": true, "BINANCE": true, "COINDCX": true, "WAZIRX": true, "DELTA": true}
+	cryptoQuotes    = []string{"USDT", "USDC", "-USD", "-INR"}
+
+	// sectors of common NSE underlyings; indices are their own sector
+	sectors = map[string]string{
+		"NIFTY": "Index", "NIFTY 50": "Index", "BANKNIFTY": "Index", "NIFTY BANK": "Index", "FINNIFTY": "Index",
+		"MIDCPNIFTY": "Index", "NIFTYNXT50": "Index", "SENSEX": "Index", "BANKEX": "Index",
+		"NIFTYBEES": "ETF", "BANKBEES": "ETF", "GOLDBEES": "ETF",
+		"RELIANCE": "Energy", "ONGC": "Energy", "NTPC": "Energy", "POWERGRID": "Energy", "BPCL": "Energy", "COALINDIA": "Energy",
+		"TCS": "Information Technology", "INFY": "Information Technology", "HCLTECH": "Information Technology",
+		"WIPRO": "Information Technology", "TECHM": "Information Technology", "LTIM": "Information Technology",
+		"HDFCBANK": "Financial Services", "ICICIBANK": "Financial Services", "AXISBANK": "Financial Services",
+		"SBIN": "Financial Services", "KOTAKBANK": "Financial Services", "INDUSINDBK": "Financial Services",
+		"BAJFINANCE": "Financial Services", "BAJAJFINSV": "Financial Services", "HDFCLIFE": "Financial Services", "SBILIFE": "Financial Services",
+		"ADANIPORTS": "Infrastructure", "LT": "Infrastructure", "ULTRACEMCO": "Infrastructure", "GRASIM": "Infrastructure",
+		"TATAMOTORS": "Auto", "MARUTI": "Auto", "M&M": "Auto", "BAJAJ-AUTO": "Auto", "EICHERMOT": "Auto", "HEROMOTOCO": "Auto",
+		"SUNPHARMA": "Pharma", "DIVISLAB": "Pharma", "DRREDDY": "Pharma", "CIPLA": "Pharma", "APOLLOHOSP": "Pharma",
+		"BHARTIARTL": "Telecom",
+		"ITC":        "FMCG", "HINDUNILVR": "FMCG", "NESTLEIND": "FMCG", "BRITANNIA": "FMCG", "TATACONSUM": "FMCG",
+		"HINDALCO": "Metals", "TATASTEEL": "Metals", "JSWSTEEL": "Metals",
+		"TITAN": "Consumer Durables", "ASIANPAINT": "Consumer Durables",
+	}
+
+	commoditySectors = map[string]string{
+		"CRUDEOIL": "Energy", "CRUDEOILM": "Energy", "NATURALGAS": "Energy", "NATGASMINI": "Energy",
+		"GOLD": "Precious Metals", "GOLDM": "Precious Metals", "GOLDPETAL": "Precious Metals",
+		"SILVER": "Precious Metals", "SILVERM": "Precious Metals", "SILVERMIC": "Precious Metals",
+		"COPPER": "Base Metals", "ZINC": "Base Metals", "ALUMINIUM": "Base Metals", "LEAD": "Base Metals", "NICKEL": "Base Metals",
+		"COTTON": "Agri", "MENTHAOIL": "Agri", "CARDAMOM": "Agri",
+	}
+)
+
+func builtinClassify(exchange, instrument string) Classification {
+	ex, sym := strings.ToUpper(exchange), strings.ToUpper(strings.TrimSpace(instrument))
+	if i := strings.Index(sym, ":"); i > 0 {
+		if ex == "" {
+			ex = sym[:i]
+		}
+		sym = sym[i+1:]
+	}
+
+	switch ex {
+	case "CDS", "BCD":
+		return Classification{MarketFX, "Currency"}
+	case "MCX", "NCDEX":
+		return Classification{MarketCommodity, lookup(commoditySectors, underlying(sym))}
+	case "NFO", "BFO":
+		return Classification{MarketFO, lookup(sectors, underlying(sym))}
+	}
+	if cryptoExchanges[ex] {
+		return Classification{MarketCrypto, "Crypto"}
+	}
+	for _, q := range cryptoQuotes {
+		if strings.HasSuffix(sym, q) && len(sym) > len(q) {
+			return Classification{MarketCrypto, "Crypto"}
+		}
+	}
+	if contractRe.MatchString(sym) {
+		return Classification{MarketFO, lookup(sectors, underlying(sym))}
+	}
+	return Classification{MarketEquity, lookup(sectors, sym)}
+}
+
+// underlying strips the expiry, strike and contract type from a derivative
+// symbol.
+func underlying(sym string) string {
+	if m := contractRe.FindStringSubmatch(sym); m != nil {
+		return m[1]
+	}
+	return sym
+}
+
+func lookup(table map[string]string, sym string) string {
+	if s, ok := table[sym]; ok {
+		return s
+	}
+	return SectorOther
+}
@@ -0,0 +1,439 @@
+package portfolio
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"go-backend/models"
+	"gorm.io/gorm"
+)
+
+// Defaults for Correlations.
+var DefaultCorrelationWindows = []int{20, 60, 120}
+
+const (
+	DefaultCorrelationWindow = 60
+	DefaultClusterThreshold  = 0.7
+	DefaultMinObservations   = 10
+	SourceLive               = "live"
+	SourceBacktest           = "backtest"
+)
+
+// Correlations compares the daily returns of a user's deployed strategies.
+// A strategy's series is its live daily net P&L from trade summaries when it
+// has traded on at least MinObservations days, otherwise the daily returns
+// of its latest completed backtest. Correlation is scale-free, so live P&L
+// and backtest returns can be compared directly.
+type Correlations struct {
+	DB              *gorm.DB
+	Windows         []int   // stored windows, in trading days
+	Threshold       float64 // Pearson correlation at which strategies cluster
+	MinObservations int
+
+	// TradingDay reports which days a live strategy is expected to have a
+	// return (zero when it did not trade). Nil means weekdays.
+	TradingDay func(time.Time) bool
+}
+
+func NewCorrelations(db *gorm.DB) *Correlations {
+	return &Correlations{
+		DB:              db,
+		Windows:         DefaultCorrelationWindows,
+		Threshold:       DefaultClusterThreshold,
+		MinObservations: DefaultMinObservations,
+	}
+}
+
+// CorrelationStrategy is one row and column of the matrix.
+type CorrelationStrategy struct {
+	ID           uuid.UUID `json:"id"`
+	Name         string    `json:"name"`
+	Source       string    `json:"source"`
+	Observations int       `json:"observations"` // daily returns available
+}
+
+// CorrelationPair is one cell, as stored in StrategyCorrelation.
+type CorrelationPair struct {
+	StrategyID   uuid.UUID `json:"strategyId"`
+	Name         string    `json:"name"`
+	Pearson      *float64  `json:"pearson"` // nil with fewer than MinObservations common days
+	Spearman     *float64  `json:"spearman"`
+	Observations int       `json:"observations"`
+}
+
+// CorrelationCluster is a group of strategies linked by correlations at or
+// above the threshold.
+type CorrelationCluster struct {
+	Strategies     []CorrelationStrategy `json:"strategies"`
+	AvgCorrelation float64               `json:"avgCorrelation"` // mean Pearson over the cluster's pairs
+}
+
+// CorrelationMatrix is the correlation of every pair of strategies over the
+// last Window common trading days.
+type CorrelationMatrix struct {
+	Window     int                   `json:"window"`
+	Threshold  float64               `json:"threshold"`
+	Strategies []CorrelationStrategy `json:"strategies"`
+	Pearson    [][]*float64          `json:"pearson"`
+	Spearman   [][]*float64          `json:"spearman"`
+	Clusters   []CorrelationCluster  `json:"clusters"`
+}
+
+type returnSeries struct {
+	CorrelationStrategy
+	values map[time.Time]float64
+}
+
+// Compute builds the matrix over window days, clustering at threshold.
+func (c *Correlations) Compute(userID uuid.UUID, window int, threshold float64) (*CorrelationMatrix, error) {
+	series, err := c.load(userID)
+	if err != nil {
+		return nil, err
+	}
+	return c.matrix(series, window, threshold), nil
+}
+
+// Refresh computes and stores the matrix for every configured window.
+func (c *Correlations) Refresh(userID uuid.UUID) ([]*CorrelationMatrix, error) {
+	series, err := c.load(userID)
+	if err != nil {
+		return nil, err
+	}
+	var out []*CorrelationMatrix
+	var rows []models.StrategyCorrelation
+	for _, w := range c.Windows {
+		m := c.matrix(series, w, c.Threshold)
+		out = append(out, m)
+		for i, s := range m.Strategies {
+			var pairs []CorrelationPair
+			for j, o := range m.Strategies {
+				if i == j {
+					continue
+				}
+				pairs = append(pairs, CorrelationPair{StrategyID: o.ID, Name: o.Name,
+					Pearson: m.Pearson[i][j], Spearman: m.Spearman[i][j], Observations: common(series[i], series[j], w)})
+			}
+			data, _ := json.Marshal(pairs)
+			rows = append(rows, models.StrategyCorrelation{UserID: userID, StrategyID: s.ID, Window: w,
+				StrategyName: s.Name, Source: s.Source, CorrelationData: data})
+		}
+	}
+
+	err = c.DB.Transaction(func(tx *gorm.DB) error {
+		// strategies no longer deployed drop out of the matrix
+		if err := tx.Where("user_id = ?", userID).Delete(&models.StrategyCorrelation{}).Error; err != nil {
+			return err
+		}
+		if len(rows) == 0 {
+			return nil
+		}
+		return tx.Create(&rows).Error
+	})
+	if err != nil {
+		return nil, fmt.Errorf("store correlations: %w", err)
+	}
+	return out, nil
+}
+
+// Run refreshes every user with a deployment. It is a jobs.Func.
+func (c *Correlations) Run(ctx context.Context, day time.Time) error {
+	var users []uuid.UUID
+	if err := c.DB.Model(&models.DeployedStrategy{}).Where("status <> ?", models.DeploymentStatusStopped).
+		Distinct("user_id").Pluck("user_id", &users).Error; err != nil {
+		return fmt.Errorf("load users: %w", err)
+	}
+	failed := 0
+	for _, id := range users {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if _, err := c.Refresh(id); err != nil {
+			log.Printf("strategy correlations: user %s: %v", id, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d users failed", failed, len(users))
+	}
+	return nil
+}
+
+// load builds a return series for each strategy the user has deployed and
+// not stopped.
+func (c *Correlations) load(userID uuid.UUID) ([]*returnSeries, error) {
+	var deployments []models.DeployedStrategy
+	if err := c.DB.Where("user_id = ? AND status <> ?", userID, models.DeploymentStatusStopped).
+		Order("deployed_at").Find(&deployments).Error; err != nil {
+		return nil, fmt.Errorf("load deployments: %w", err)
+	}
+
+	var out []*returnSeries
+	seen := map[uuid.UUID]bool{}
+	for _, d := range deployments {
+		if seen[d.StrategyID] {
+			continue
+		}
+		seen[d.StrategyID] = true
+
+		name := d.Name
+		var strategy models.Strategy
+		if err := c.DB.Select("name").First(&strategy, "id = ?", d.StrategyID).Error; err == nil && strategy.Name != "" {
+			name = strategy.Name
+		}
+		s := &returnSeries{CorrelationStrategy: CorrelationStrategy{ID: d.StrategyID, Name: name}}
+
+		live, traded, err := c.live(userID, d.StrategyID, d.DeployedAt)
+		if err != nil {
+			return nil, err
+		}
+		if traded >= c.minObservations() {
+			s.Source, s.values = SourceLive, live
+		} else if s.values, err = c.backtest(d.StrategyID); err != nil {
+			return nil, err
+		} else if len(s.values) > 0 {
+			s.Source = SourceBacktest
+		} else {
+			s.Source, s.values = SourceLive, live
+		}
+		s.Observations = len(s.values)
+		out = append(out, s)
+	}
+	return out, nil
+}
+
+// live is the strategy's daily net P&L by exit day, zero on trading days
+// without a closed trade, and the number of days with one.
+func (c *Correlations) live(userID, strategyID uuid.UUID, since time.Time) (map[time.Time]float64, int, error) {
+	var summaries []models.TradeSummary
+	if err := c.DB.Where("user_id = ? AND strategy_id = ?", userID, strategyID).
+		Order("exit_time").Find(&summaries).Error; err != nil {
+		return nil, 0, fmt.Errorf("load trade summaries: %w", err)
+	}
+	start := day(since)
+	if len(summaries) > 0 && summaries[0].ExitTime.Before(start) {
+		start = day(summaries[0].ExitTime)
+	}
+	out := map[time.Time]float64{}
+	for d := start; !d.After(day(time.Now())); d = d.AddDate(0, 0, 1) {
+		if c.tradingDay(d) {
+			out[d] = 0
+		}
+	}
+	traded := map[time.Time]bool{}
+	for _, t := range summaries {
+		d := day(t.ExitTime)
+		out[d] += t.NetPnL
+		traded[d] = true
+	}
+	return out, len(traded), nil
+}
+
+// backtest is the daily return of the strategy's latest completed backtest,
+// from the last equity point of each day.
+func (c *Correlations) backtest(strategyID uuid.UUID) (map[time.Time]float64, error) {
+	var bt models.Backtest
+	err := c.DB.Where("strategy_id = ? AND status = ?", strategyID, "completed").
+		Order("created_at DESC").First(&bt).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("load backtest: %w", err)
+	}
+	var equity []struct {
+		Time   time.Time `json:"time"`
+		Equity float64   `json:"equity"`
+	}
+	if len(bt.Equity) == 0 || json.Unmarshal(bt.Equity, &equity) != nil {
+		return nil, nil
+	}
+
+	closes := map[time.Time]float64{}
+	var days []time.Time
+	for _, p := range equity {
+		d := day(p.Time)
+		if _, ok := closes[d]; !ok {
+			days = append(days, d)
+		}
+		closes[d] = p.Equity
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	out := map[time.Time]float64{}
+	for i := 1; i < len(days); i++ {
+		if prev := closes[days[i-1]]; prev > 0 {
+			out[days[i]] = closes[days[i]]/prev - 1
+		}
+	}
+	return out, nil
+}
+
+func (c *Correlations) matrix(series []*returnSeries, window int, threshold float64) *CorrelationMatrix {
+	if window < 2 {
+		window = DefaultCorrelationWindow
+	}
+	n := len(series)
+	m := &CorrelationMatrix{
+		Window:     window,
+		Threshold:  threshold,
+		Strategies: make([]CorrelationStrategy, n),
+		Pearson:    make([][]*float64, n),
+		Spearman:   make([][]*float64, n),
+		Clusters:   []CorrelationCluster{},
+	}
+	for i, s := range series {
+		m.Strategies[i] = s.CorrelationStrategy
+		m.Pearson[i] = make([]*float64, n)
+		m.Spearman[i] = make([]*float64, n)
+	}
+	one := 1.0
+	for i := 0; i < n; i++ {
+		m.Pearson[i][i], m.Spearman[i][i] = &one, &one
+		for j := i + 1; j < n; j++ {
+			a, b := aligned(series[i], series[j], window)
+			if len(a) < c.minObservations() {
+				continue
+			}
+			if p := pearson(a, b); !math.IsNaN(p) {
+				v := round(p)
+				m.Pearson[i][j], m.Pearson[j][i] = &v, &v
+			}
+			if s := pearson(ranks(a), ranks(b)); !math.IsNaN(s) {
+				v := round(s)
+				m.Spearman[i][j], m.Spearman[j][i] = &v, &v
+			}
+		}
+	}
+	m.Clusters = cluster(m, threshold)
+	return m
+}
+
+func (c *Correlations) minObservations() int {
+	if c.MinObservations < 2 {
+		return DefaultMinObservations
+	}
+	return c.MinObservations
+}
+
+func (c *Correlations) tradingDay(d time.Time) bool {
+	if c.TradingDay != nil {
+		return c.TradingDay(d)
+	}
+	return d.Weekday() != time.Saturday && d.Weekday() != time.Sunday
+}
+
+// aligned returns the two series over their last window common days.
+func aligned(x, y *returnSeries, window int) ([]float64, []float64) {
+	var days []time.Time
+	for d := range x.values {
+		if _, ok := y.values[d]; ok {
+			days = append(days, d)
+		}
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	if len(days) > window {
+		days = days[len(days)-window:]
+	}
+	a, b := make([]float64, len(days)), make([]float64, len(days))
+	for i, d := range days {
+		a[i], b[i] = x.values[d], y.values[d]
+	}
+	return a, b
+}
+
+func common(x, y *returnSeries, window int) int {
+	a, _ := aligned(x, y, window)
+	return len(a)
+}
+
+// pearson is NaN when either series is constant.
+func pearson(a, b []float64) float64 {
+	am, asd := meanStd(a)
+	bm, bsd := meanStd(b)
+	if asd == 0 || bsd == 0 {
+		return math.NaN()
+	}
+	cov := 0.0
+	for i := range a {
+		cov += (a[i] - am) * (b[i] - bm)
+	}
+	return cov / float64(len(a)-1) / (asd * bsd)
+}
+
+// ranks assigns 1-based ranks, averaging ties.
+func ranks(xs []float64) []float64 {
+	idx := make([]int, len(xs))
+	for i := range idx {
+		idx[i] = i
+	}
+	sort.Slice(idx, func(i, j int) bool { return xs[idx[i]] < xs[idx[j]] })
+	out := make([]float64, len(xs))
+	for i := 0; i < len(idx); {
+		j := i
+		for j+1 < len(idx) && xs[idx[j+1]] == xs[idx[i]] {
+			j++
+		}
+		r := float64(i+j)/2 + 1
+		for k := i; k <= j; k++ {
+			out[idx[k]] = r
+		}
+		i = j + 1
+	}
+	return out
+}
+
+// cluster groups strategies whose Pearson correlation reaches threshold,
+// transitively (single linkage). Only groups of two or more are returned.
+func cluster(m *CorrelationMatrix, threshold float64) []CorrelationCluster {
+	n := len(m.Strategies)
+	parent := make([]int, n)
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(i int) int {
+		if parent[i] != i {
+			parent[i] = find(parent[i])
+		}
+		return parent[i]
+	}
+	for i := 0; i < n; i++ {
+		for j := i + 1; j < n; j++ {
+			if p := m.Pearson[i][j]; p != nil && *p >= threshold {
+				parent[find(i)] = find(j)
+			}
+		}
+	}
+
+	groups := map[int][]int{}
+	for i := 0; i < n; i++ {
+		groups[find(i)] = append(groups[find(i)], i)
+	}
+	out := []CorrelationCluster{}
+	for _, members := range groups {
+		if len(members) < 2 {
+			continue
+		}
+		cl := CorrelationCluster{}
+		sum, pairs := 0.0, 0
+		for a, i := range members {
+			cl.Strategies = append(cl.Strategies, m.Strategies[i])
+			for _, j := range members[a+1:] {
+				if p := m.Pearson[i][j]; p != nil {
+					sum += *p
+					pairs++
+				}
+			}
+		}
+		if pairs > 0 {
+			cl.AvgCorrelation = round(sum / float64(pairs))
+		}
+		out = append(out, cl)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].AvgCorrelation > out[j].AvgCorrelation })
+	return out
+}
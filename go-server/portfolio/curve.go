@@ -0,0 +1,184 @@
+// Package portfolio computes account-level risk from the trade ledger: a daily
+// equity curve per user and the PortfolioRisk snapshots derived from it.
+package portfolio
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go-backend/ledger"
+	"go-backend/models"
+	"gorm.io/gorm"
+)
+
+// Point is the account at the close of one trading day.
+type Point struct {
+	Day          time.Time
+	Value        float64 // cash plus the market value of open positions
+	Flow         float64 // capital added during the day
+	Return       float64 // time-weighted: flows do not count as gains
+	Strategies   int64
+	ActiveTrades int64
+}
+
+// Curve builds the user's daily equity curve up to and including through.
+// Cash is the capital committed to the user's deployments from the day each
+// was deployed, plus realised P&L after fees. Open positions are marked at
+// the day's last stored close, falling back to the last earlier close and
+// then to the average cost. It returns nil when the user has no capital and
+// no fills.
+func (j *Job) Curve(userID uuid.UUID, through time.Time) ([]Point, error) {
+	fills, err := ledger.LoadFills(j.DB, func(q *gorm.DB) *gorm.DB {
+		return q.Where("orders.user_id = ? AND transactions.executed_at < ?", userID, dayAfter(through))
+	})
+	if err != nil {
+		return nil, fmt.Errorf("load fills: %w", err)
+	}
+	var deployments []models.DeployedStrategy
+	if err := j.DB.Where("user_id = ?", userID).Order("deployed_at").Find(&deployments).Error; err != nil {
+		return nil, fmt.Errorf("load deployments: %w", err)
+	}
+
+	var start time.Time
+	if len(fills) > 0 {
+		start = day(fills[0].ExecutedAt)
+	}
+	for _, d := range deployments {
+		if c := d.Capital(); c > 0 && (start.IsZero() || d.DeployedAt.Before(start)) {
+			start = day(d.DeployedAt)
+		}
+	}
+	end := day(through)
+	if start.IsZero() || start.After(end) {
+		return nil, nil
+	}
+
+	var symbols []string
+	seen := map[string]bool{}
+	for _, f := range fills {
+		if k := strings.ToUpper(f.Instrument); !seen[k] {
+			seen[k] = true
+			symbols = append(symbols, k)
+		}
+	}
+	closes, err := dailyCloses(j.DB, symbols, start, end)
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct {
+		strategy   uuid.UUID
+		instrument string
+	}
+	positions := map[key]*ledger.Position{}
+	last := map[string]float64{} // latest close seen per instrument
+	var curve []Point
+	capital, realized, flow := 0.0, 0.0, 0.0
+	fi, di := 0, 0
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		next := d.AddDate(0, 0, 1)
+		for ; di < len(deployments) && deployments[di].DeployedAt.Before(next); di++ {
+			if c := deployments[di].Capital(); c > 0 {
+				flow += c
+				capital += c
+			}
+		}
+		for ; fi < len(fills) && fills[fi].ExecutedAt.Before(next); fi++ {
+			f := fills[fi]
+			k := key{f.StrategyID, strings.ToUpper(f.Instrument)}
+			p, ok := positions[k]
+			if !ok {
+				p = &ledger.Position{Instrument: f.Instrument}
+				positions[k] = p
+			}
+			realized += p.Apply(f) - f.Fees
+		}
+		for sym, byDay := range closes {
+			if c, ok := byDay[d]; ok {
+				last[sym] = c
+			}
+		}
+		if !j.tradingDay(d) {
+			continue // flows and fills carry into the next trading day
+		}
+
+		pt := Point{Day: d, Flow: flow}
+		flow = 0
+		open := 0.0
+		strategies := map[uuid.UUID]bool{}
+		for k, p := range positions {
+			if p.Quantity == 0 {
+				continue
+			}
+			price, ok := last[k.instrument]
+			if !ok {
+				price = p.AvgPrice
+			}
+			open += p.Unrealized(price)
+			pt.ActiveTrades++
+			if k.strategy != uuid.Nil {
+				strategies[k.strategy] = true
+			}
+		}
+		pt.Strategies = int64(len(strategies))
+		pt.Value = capital + realized + open
+		if n := len(curve); n > 0 {
+			pt.Return = periodReturn(curve[n-1].Value, pt.Value, pt.Flow)
+		}
+		curve = append(curve, pt)
+	}
+	return curve, nil
+}
+
+// periodReturn treats flow as arriving at the start of the period.
+func periodReturn(prev, value, flow float64) float64 {
+	base := prev + flow
+	if base <= 0 {
+		return 0
+	}
+	return (value - base) / base
+}
+
+// dailyCloses returns the last stored close of each symbol on each day in
+// [from, to], keyed by upper-cased symbol and local day. Bars of every
+// timeframe count, so intraday-only symbols are priced too.
+func dailyCloses(db *gorm.DB, symbols []string, from, to time.Time) (map[string]map[time.Time]float64, error) {
+	out := map[string]map[time.Time]float64{}
+	if len(symbols) == 0 {
+		return out, nil
+	}
+	var rows []struct {
+		Symbol    string
+		Timestamp time.Time
+		Close     float64
+	}
+	err := db.Raw(`SELECT DISTINCT ON (UPPER(symbol), timestamp::date) UPPER(symbol) AS symbol, timestamp, close
+		FROM market_data
+		WHERE UPPER(symbol) IN ? AND timestamp >= ? AND timestamp < ?
+		ORDER BY UPPER(symbol), timestamp::date, timestamp DESC`, symbols, from, dayAfter(to)).
+		Scan(&rows).Error
+	if err != nil {
+		return nil, fmt.Errorf("load closes: %w", err)
+	}
+	for _, r := range rows {
+		byDay, ok := out[r.Symbol]
+		if !ok {
+			byDay = map[time.Time]float64{}
+			out[r.Symbol] = byDay
+		}
+		// the database date and the local date can differ; keep the latest bar
+		byDay[day(r.Timestamp)] = r.Close
+	}
+	return out, nil
+}
+
+// day is midnight of t's local date. Days are map keys, so they are always
+// built in time.Local.
+func day(t time.Time) time.Time {
+	y, m, d := t.In(time.Local).Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+}
+
+func dayAfter(t time.Time) time.Time { return day(t).AddDate(0, 0, 1) }
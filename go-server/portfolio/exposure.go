@@ -0,0 +1,238 @@
+package portfolio
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go-backend/ledger"
+	"go-backend/marketfeed"
+	"go-backend/models"
+	"gorm.io/gorm"
+)
+
+// DefaultSectorCap is the sector concentration, in percent of portfolio
+// value, above which a warning is raised when the user has no "sector
+// concentration" risk limit.
+const DefaultSectorCap = 25.0
+
+// Exposures breaks a user's open positions down by market and sector.
+type Exposures struct {
+	DB        *gorm.DB
+	Feed      *marketfeed.Hub
+	SectorCap float64
+}
+
+func NewExposures(db *gorm.DB, feed *marketfeed.Hub) *Exposures {
+	return &Exposures{DB: db, Feed: feed, SectorCap: DefaultSectorCap}
+}
+
+// ExposureReport is one computation of a user's exposures.
+type ExposureReport struct {
+	Value    float64                 `json:"value"` // portfolio value the percentages are of
+	Gross    float64                 `json:"gross"`
+	Net      float64                 `json:"net"`
+	Cap      float64                 `json:"cap"`
+	Markets  []models.MarketExposure `json:"markets"`
+	Sectors  []models.SectorExposure `json:"sectors"` // largest first
+	Warnings []string                `json:"warnings"`
+	At       time.Time               `json:"at"`
+}
+
+// Concentration is the largest classified sector and its gross percentage.
+func (r *ExposureReport) Concentration() (string, float64) {
+	for _, s := range r.Sectors {
+		if s.Sector != SectorOther {
+			return s.Sector, s.Percentage
+		}
+	}
+	return "", 0
+}
+
+// Compute marks the user's open positions at the feed's last prices (average
+// cost when there is none) and aggregates them. Portfolio value is deployed
+// capital plus realised and unrealised P&L, as in the PortfolioRisk curve;
+// when that is not positive the percentages are of gross exposure.
+func (e *Exposures) Compute(userID uuid.UUID) (*ExposureReport, error) {
+	fills, err := ledger.LoadFills(e.DB, func(q *gorm.DB) *gorm.DB {
+		return q.Where("orders.user_id = ?", userID)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("load fills: %w", err)
+	}
+	exchanges := map[string]string{}
+	for _, f := range fills {
+		if f.Exchange != "" {
+			exchanges[strings.ToUpper(f.Instrument)] = f.Exchange
+		}
+	}
+
+	var deployments []models.DeployedStrategy
+	if err := e.DB.Where("user_id = ?", userID).Find(&deployments).Error; err != nil {
+		return nil, fmt.Errorf("load deployments: %w", err)
+	}
+	capital := 0.0
+	for _, d := range deployments {
+		if c := d.Capital(); c > 0 {
+			capital += c
+		}
+	}
+
+	report := &ExposureReport{Cap: e.cap(userID), Warnings: []string{}, At: time.Now()}
+	markets := map[string]*models.MarketExposure{}
+	sectors := map[string]*models.SectorExposure{}
+	pnl := 0.0
+	for k, p := range ledger.Positions(fills) {
+		pnl += p.Realized
+		if p.Quantity == 0 {
+			continue
+		}
+		price := p.AvgPrice
+		if e.Feed != nil {
+			if last, ok := e.Feed.LastPrice(p.Instrument); ok {
+				price = last
+			}
+		}
+		pnl += p.Unrealized(price)
+		mv := p.Quantity * price
+		report.Gross += math.Abs(mv)
+		report.Net += mv
+
+		c := Classify(exchanges[k], p.Instrument)
+		m, ok := markets[c.Market]
+		if !ok {
+			m = &models.MarketExposure{UserID: userID, Market: c.Market}
+			markets[c.Market] = m
+		}
+		m.Gross += math.Abs(mv)
+		m.Net += mv
+		m.Positions++
+		s, ok := sectors[c.Sector]
+		if !ok {
+			s = &models.SectorExposure{UserID: userID, Sector: c.Sector}
+			sectors[c.Sector] = s
+		}
+		s.Gross += math.Abs(mv)
+		s.Net += mv
+		s.Positions++
+	}
+
+	report.Value = capital + pnl
+	if report.Value <= 0 {
+		report.Value = report.Gross
+	}
+	pct := func(v float64) float64 {
+		if report.Value <= 0 {
+			return 0
+		}
+		return round(v / report.Value * 100)
+	}
+	for _, m := range markets {
+		m.Percentage, m.NetPercentage = pct(m.Gross), pct(m.Net)
+		report.Markets = append(report.Markets, *m)
+	}
+	for _, s := range sectors {
+		s.Percentage, s.NetPercentage = pct(s.Gross), pct(s.Net)
+		s.Cap = report.Cap
+		s.Status = models.RiskStatusOf(s.Percentage, report.Cap)
+		if s.Status == models.RiskStatusBreach && s.Sector != SectorOther {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("%s is %.1f%% of portfolio value, above the %g%% sector cap",
+				s.Sector, s.Percentage, report.Cap))
+		}
+		report.Sectors = append(report.Sectors, *s)
+	}
+	sort.Slice(report.Markets, func(i, j int) bool { return report.Markets[i].Gross > report.Markets[j].Gross })
+	sort.Slice(report.Sectors, func(i, j int) bool { return report.Sectors[i].Gross > report.Sectors[j].Gross })
+	sort.Strings(report.Warnings)
+	return report, nil
+}
+
+// cap is the user's tightest active sector concentration limit, else the
+// default.
+func (e *Exposures) cap(userID uuid.UUID) float64 {
+	var limit models.RiskLimit
+	err := e.DB.Where("user_id = ? AND is_active = ? AND metric = ?", userID, true, models.RiskMetricSectorConcentration).
+		Order("threshold").First(&limit).Error
+	if err == nil && limit.Threshold > 0 {
+		return limit.Threshold
+	}
+	if e.SectorCap > 0 {
+		return e.SectorCap
+	}
+	return DefaultSectorCap
+}
+
+// Refresh computes the user's exposures and replaces the stored rows. A
+// sector newly crossing the cap is logged; risk limits on the metric turn it
+// into a RiskEvent through the monitor.
+func (e *Exposures) Refresh(userID uuid.UUID) (*ExposureReport, error) {
+	report, err := e.Compute(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	var before []models.SectorExposure
+	e.DB.Where("user_id = ? AND status = ?", userID, models.RiskStatusBreach).Find(&before)
+	breached := map[string]bool{}
+	for _, s := range before {
+		breached[s.Sector] = true
+	}
+
+	err = e.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", userID).Delete(&models.MarketExposure{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", userID).Delete(&models.SectorExposure{}).Error; err != nil {
+			return err
+		}
+		if len(report.Markets) > 0 {
+			if err := tx.Create(&report.Markets).Error; err != nil {
+				return err
+			}
+		}
+		if len(report.Sectors) > 0 {
+			if err := tx.Create(&report.Sectors).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("store exposures: %w", err)
+	}
+
+	for _, s := range report.Sectors {
+		if s.Status == models.RiskStatusBreach && !breached[s.Sector] && s.Sector != SectorOther {
+			log.Printf("exposure: user %s: %s concentration %.1f%% exceeds the %g%% cap", userID, s.Sector, s.Percentage, s.Cap)
+		}
+	}
+	return report, nil
+}
+
+// Run refreshes every active user. It is a jobs.Func, scheduled after
+// the close so stored exposures reflect closing prices.
+func (e *Exposures) Run(ctx context.Context, day time.Time) error {
+	users, err := activeUsers(e.DB)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, id := range users {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if _, err := e.Refresh(id); err != nil {
+			log.Printf("exposure: user %s: %v", id, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d users failed", failed, len(users))
+	}
+	return nil
+}
@@ -0,0 +1,258 @@
+package portfolio
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go-backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Defaults for Job.
+const (
+	DefaultBenchmark    = "NIFTY 50"
+	DefaultRiskFreeRate = 6.5 // annual, percent
+	DefaultWindow       = 252 // trading days of returns behind volatility, Sharpe and beta
+)
+
+// Job computes and stores PortfolioRisk snapshots.
+type Job struct {
+	DB           *gorm.DB
+	Benchmark    string  // market_data symbol that beta is measured against
+	RiskFreeRate float64 // annual, percent
+	Window       int
+
+	// TradingDay reports which days get a snapshot. Nil means weekdays.
+	TradingDay func(time.Time) bool
+}
+
+func NewJob(db *gorm.DB, benchmark string) *Job {
+	if benchmark == "" {
+		benchmark = DefaultBenchmark
+	}
+	return &Job{DB: db, Benchmark: benchmark, RiskFreeRate: DefaultRiskFreeRate, Window: DefaultWindow}
+}
+
+func (j *Job) tradingDay(d time.Time) bool {
+	if j.TradingDay != nil {
+		return j.TradingDay(d)
+	}
+	return d.Weekday() != time.Saturday && d.Weekday() != time.Sunday
+}
+
+// Run snapshots every user with fills or deployed capital through day. It is
+// a jobs.Func.
+func (j *Job) Run(ctx context.Context, day time.Time) error {
+	users, err := activeUsers(j.DB)
+	if err != nil {
+		return err
+	}
+	failed := 0
+	for _, id := range users {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if _, err := j.Snapshot(id, day); err != nil {
+			log.Printf("portfolio risk: user %s: %v", id, err)
+			failed++
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d users failed", failed, len(users))
+	}
+	return nil
+}
+
+// activeUsers are the users with fills or deployments.
+func activeUsers(db *gorm.DB) ([]uuid.UUID, error) {
+	var traders, deployers []uuid.UUID
+	if err := db.Table("orders").Joins("JOIN transactions ON transactions.order_id = orders.id").
+		Distinct("orders.user_id").Pluck("orders.user_id", &traders).Error; err != nil {
+		return nil, fmt.Errorf("load users: %w", err)
+	}
+	if err := db.Model(&models.DeployedStrategy{}).Distinct("user_id").Pluck("user_id", &deployers).Error; err != nil {
+		return nil, fmt.Errorf("load users: %w", err)
+	}
+	seen := map[uuid.UUID]bool{}
+	var out []uuid.UUID
+	for _, id := range append(traders, deployers...) {
+		if !seen[id] {
+			seen[id] = true
+			out = append(out, id)
+		}
+	}
+	return out, nil
+}
+
+// Snapshot rebuilds the user's whole history through day and upserts one
+// PortfolioRisk per trading day, so fills booked late are reflected.
+func (j *Job) Snapshot(userID uuid.UUID, through time.Time) ([]models.PortfolioRisk, error) {
+	curve, err := j.Curve(userID, through)
+	if err != nil || len(curve) == 0 {
+		return nil, err
+	}
+	bench, err := j.benchmarkReturns(curve)
+	if err != nil {
+		return nil, err
+	}
+	rows := j.metrics(userID, curve, bench)
+	err = j.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "date"}},
+		UpdateAll: true,
+	}).CreateInBatches(rows, 200).Error
+	if err != nil {
+		return nil, fmt.Errorf("store snapshots: %w", err)
+	}
+	return rows, nil
+}
+
+// benchmarkReturns aligns the benchmark's close-to-close returns with the
+// curve. Days without a close on both ends are NaN.
+func (j *Job) benchmarkReturns(curve []Point) ([]float64, error) {
+	sym := strings.ToUpper(j.Benchmark)
+	closes, err := dailyCloses(j.DB, []string{sym}, curve[0].Day, curve[len(curve)-1].Day)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]float64, len(curve))
+	prev := math.NaN()
+	for i, p := range curve {
+		out[i] = math.NaN()
+		c, ok := closes[sym][p.Day]
+		if !ok {
+			prev = math.NaN()
+			continue
+		}
+		if prev > 0 {
+			out[i] = c/prev - 1
+		}
+		prev = c
+	}
+	return out, nil
+}
+
+func (j *Job) metrics(userID uuid.UUID, curve []Point, bench []float64) []models.PortfolioRisk {
+	window := j.Window
+	if window < 2 {
+		window = DefaultWindow
+	}
+	rfDaily := j.RiskFreeRate / 100 / 252
+
+	rows := make([]models.PortfolioRisk, len(curve))
+	index := make([]float64, len(curve)) // growth of 1 at time-weighted returns
+	peak, maxDD := 0.0, 0.0
+	for i, p := range curve {
+		index[i] = 1
+		if i > 0 {
+			index[i] = index[i-1] * (1 + p.Return)
+		}
+		peak = math.Max(peak, index[i])
+		dd := (peak - index[i]) / peak * 100
+		maxDD = math.Max(maxDD, dd)
+
+		r := models.PortfolioRisk{
+			UserID:          userID,
+			Date:            p.Day,
+			TotalValue:      round(p.Value),
+			DailyChange:     round(p.Return * 100),
+			CurrentDrawdown: round(dd),
+			MaxDrawdown:     round(maxDD),
+			Benchmark:       j.Benchmark,
+			Strategies:      p.Strategies,
+			ActiveTrades:    p.ActiveTrades,
+		}
+		if i > 0 {
+			r.DailyValue = round(p.Value - curve[i-1].Value - p.Flow)
+		}
+		r.WeeklyChange = round(change(curve, index, i, p.Day.AddDate(0, 0, -7)))
+		r.MonthlyChange = round(change(curve, index, i, p.Day.AddDate(0, -1, 0)))
+
+		lo := i - window + 1
+		if lo < 1 {
+			lo = 1 // curve[0] has no return
+		}
+		if i >= lo {
+			rets := make([]float64, 0, i-lo+1)
+			for _, q := range curve[lo : i+1] {
+				rets = append(rets, q.Return)
+			}
+			mean, sd := meanStd(rets)
+			r.Volatility = round(sd * math.Sqrt(252) * 100)
+			if sd > 0 {
+				r.SharpeRatio = round((mean - rfDaily) / sd * math.Sqrt(252))
+			}
+			r.Beta = round(beta(rets, bench[lo:i+1]))
+		}
+		rows[i] = r
+	}
+	return rows
+}
+
+// change is the time-weighted return in percent from the last trading day
+// on or before since up to curve[i].
+func change(curve []Point, index []float64, i int, since time.Time) float64 {
+	k := -1
+	for b := i - 1; b >= 0; b-- {
+		if !curve[b].Day.After(since) {
+			k = b
+			break
+		}
+	}
+	if k < 0 {
+		k = 0 // younger than the period: change since inception
+	}
+	return (index[i]/index[k] - 1) * 100
+}
+
+func meanStd(xs []float64) (float64, float64) {
+	if len(xs) == 0 {
+		return 0, 0
+	}
+	mean := 0.0
+	for _, x := range xs {
+		mean += x
+	}
+	mean /= float64(len(xs))
+	if len(xs) < 2 {
+		return mean, 0
+	}
+	ss := 0.0
+	for _, x := range xs {
+		ss += (x - mean) * (x - mean)
+	}
+	return mean, math.Sqrt(ss / float64(len(xs)-1))
+}
+
+// beta is cov(portfolio, benchmark) / var(benchmark) over the days where the
+// benchmark has a return.
+func beta(rets, bench []float64) float64 {
+	var ps, bs []float64
+	for i, b := range bench {
+		if !math.IsNaN(b) {
+			ps = append(ps, rets[i])
+			bs = append(bs, b)
+		}
+	}
+	if len(bs) < 2 {
+		return 0
+	}
+	pm, _ := meanStd(ps)
+	bm, bsd := meanStd(bs)
+	if bsd == 0 {
+		return 0
+	}
+	cov := 0.0
+	for i := range bs {
+		cov += (ps[i] - pm) * (bs[i] - bm)
+	}
+	cov /= float64(len(bs) - 1)
+	return cov / (bsd * bsd)
+}
+
+func round(v float64) float64 { return math.Round(v*10000) / 10000 }
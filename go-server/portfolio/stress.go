@@ -0,0 +1,599 @@
+package portfolio
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go-backend/ledger"
+	"go-backend/marketfeed"
+	"go-backend/models"
+	"gorm.io/gorm"
+)
+
+// StressShock moves matching instruments by Move percent. The most specific
+// match wins: symbol, then sector, then market.
+type StressShock struct {
+	Symbol string  `json:"symbol,omitempty"`
+	Sector string  `json:"sector,omitempty"`
+	Market string  `json:"market,omitempty"`
+	Move   float64 `json:"move"`
+}
+
+// Scenario is a stress test ready to run.
+type Scenario struct {
+	Name                 string        `json:"name"`
+	Kind                 string        `json:"kind"`
+	Shocks               []StressShock `json:"shocks,omitempty"`
+	DefaultMove          float64       `json:"defaultMove"`
+	VolatilityMultiplier float64       `json:"volatilityMultiplier"`
+	From                 time.Time     `json:"from,omitempty"`
+	To                   time.Time     `json:"to,omitempty"`
+}
+
+// PresetScenarios are available to every user by key.
+var PresetScenarios = map[string]Scenario{
+	"march-2020": {
+		Name: "March 2020 crash (19 Feb - 23 Mar 2020)", Kind: models.StressKindReplay,
+		From: time.Date(2020, 2, 19, 0, 0, 0, 0, time.Local), To: time.Date(2020, 3, 23, 0, 0, 0, 0, time.Local),
+		VolatilityMultiplier: 3,
+	},
+	"gap-down-10": {Name: "10% gap down", Kind: models.StressKindShock, DefaultMove: -10, VolatilityMultiplier: 2},
+	"gap-up-10":   {Name: "10% gap up", Kind: models.StressKindShock, DefaultMove: 10},
+	"banking-selloff": {
+		Name: "Banking sell-off", Kind: models.StressKindShock, DefaultMove: -3, VolatilityMultiplier: 1.5,
+		Shocks: []StressShock{{Sector: "Financial Services", Move: -12}, {Symbol: "BANKNIFTY", Move: -10}, {Symbol: "FINNIFTY", Move: -10}},
+	},
+	"rupee-shock": {
+		Name: "Rupee depreciation", Kind: models.StressKindShock,
+		Shocks: []StressShock{{Market: MarketFX, Move: 4}, {Sector: "Information Technology", Move: 3},
+			{Sector: "Precious Metals", Move: 5}, {Market: MarketEquity, Move: -2}},
+	},
+}
+
+// ScenarioFromModel converts a stored scenario.
+func ScenarioFromModel(s *models.StressScenario) (Scenario, error) {
+	sc := Scenario{Name: s.Name, Kind: s.Kind, DefaultMove: s.DefaultMove, VolatilityMultiplier: s.VolatilityMultiplier}
+	if len(s.Shocks) > 0 && string(s.Shocks) != "null" {
+		if err := json.Unmarshal(s.Shocks, &sc.Shocks); err != nil {
+			return sc, fmt.Errorf("invalid shocks: %w", err)
+		}
+	}
+	if s.From != nil {
+		sc.From = *s.From
+	}
+	if s.To != nil {
+		sc.To = *s.To
+	}
+	return sc, sc.Validate()
+}
+
+// Validate checks the scenario can be run.
+func (s Scenario) Validate() error {
+	switch s.Kind {
+	case models.StressKindShock:
+		for _, sh := range s.Shocks {
+			if sh.Symbol == "" && sh.Sector == "" && sh.Market == "" {
+				return fmt.Errorf("each shock needs a symbol, sector or market")
+			}
+			if sh.Move <= -100 {
+				return fmt.Errorf("a move of %g%% would take the price below zero", sh.Move)
+			}
+		}
+		if s.DefaultMove <= -100 {
+			return fmt.Errorf("defaultMove must be above -100")
+		}
+	case models.StressKindReplay:
+		if s.From.IsZero() || s.To.IsZero() || !s.To.After(s.From) {
+			return fmt.Errorf("a replay needs from before to")
+		}
+	default:
+		return fmt.Errorf("kind must be shock or replay")
+	}
+	if s.VolatilityMultiplier < 0 {
+		return fmt.Errorf("volatilityMultiplier must not be negative")
+	}
+	return nil
+}
+
+// Stress runs scenarios against a user's current positions.
+type Stress struct {
+	DB        *gorm.DB
+	Feed      *marketfeed.Hub
+	VaR       *VaR
+	Benchmark string // proxies equity instruments without history in a replay
+}
+
+func NewStress(db *gorm.DB, feed *marketfeed.Hub, v *VaR) *Stress {
+	return &Stress{DB: db, Feed: feed, VaR: v, Benchmark: DefaultBenchmark}
+}
+
+// StressPosition is one open position under the scenario. Move is in
+// percent; Source says where it came from (symbol, sector, market, default,
+// history, proxy or none).
+type StressPosition struct {
+	StrategyID   uuid.UUID `json:"strategyId"`
+	Instrument   string    `json:"instrument"`
+	Market       string    `json:"market"`
+	Sector       string    `json:"sector"`
+	Quantity     float64   `json:"quantity"`
+	Price        float64   `json:"price"`
+	Value        float64   `json:"value"`
+	Move         float64   `json:"move"`
+	ShockedPrice float64   `json:"shockedPrice"`
+	PnL          float64   `json:"pnl"`
+	Source       string    `json:"source"`
+}
+
+// StressStrategy totals the positions of one strategy.
+type StressStrategy struct {
+	StrategyID uuid.UUID `json:"strategyId"`
+	Value      float64   `json:"value"`
+	PnL        float64   `json:"pnl"`
+	PnLPercent float64   `json:"pnlPercent"` // of the strategy's deployed capital, when known
+}
+
+// StressBreach is a risk limit the scenario would move to warning or breach.
+type StressBreach struct {
+	RiskLimitID uint       `json:"riskLimitId"`
+	Name        string     `json:"name"`
+	Metric      string     `json:"metric"`
+	Action      string     `json:"action"`
+	Threshold   float64    `json:"threshold"`
+	Value       float64    `json:"value"`
+	Status      string     `json:"status"`
+	StrategyID  *uuid.UUID `json:"strategyId,omitempty"`
+}
+
+// StressReport is the outcome of one scenario.
+type StressReport struct {
+	Scenario       Scenario         `json:"scenario"`
+	PortfolioValue float64          `json:"portfolioValue"`
+	PnL            float64          `json:"pnl"`
+	PnLPercent     float64          `json:"pnlPercent"`
+	WorstPnL       *float64         `json:"worstPnl,omitempty"` // replay: lowest point along the path
+	WorstDay       *time.Time       `json:"worstDay,omitempty"`
+	VaR            *float64         `json:"var,omitempty"`         // one-day 99% parametric VaR now
+	StressedVaR    *float64         `json:"stressedVar,omitempty"` // after the moves, times the volatility multiplier
+	Positions      []StressPosition `json:"positions"`
+	Strategies     []StressStrategy `json:"strategies"`
+	Breaches       []StressBreach   `json:"breaches"`
+	At             time.Time        `json:"at"`
+}
+
+type stressKey struct {
+	strategy   uuid.UUID
+	instrument string
+}
+
+// Run applies the scenario to the user's open positions.
+func (s *Stress) Run(userID uuid.UUID, sc Scenario) (*StressReport, error) {
+	if err := sc.Validate(); err != nil {
+		return nil, err
+	}
+	fills, err := ledger.LoadFills(s.DB, func(q *gorm.DB) *gorm.DB {
+		return q.Where("orders.user_id = ?", userID)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("load fills: %w", err)
+	}
+
+	exchanges := map[string]string{}
+	positions := map[stressKey]*ledger.Position{}
+	for _, f := range fills {
+		k := stressKey{f.StrategyID, strings.ToUpper(f.Instrument)}
+		if f.Exchange != "" {
+			exchanges[k.instrument] = f.Exchange
+		}
+		p, ok := positions[k]
+		if !ok {
+			p = &ledger.Position{Instrument: f.Instrument}
+			positions[k] = p
+		}
+		p.Apply(f)
+	}
+
+	report := &StressReport{Scenario: sc, Positions: []StressPosition{}, Strategies: []StressStrategy{},
+		Breaches: []StressBreach{}, At: time.Now()}
+	pnlNow := map[uuid.UUID]float64{} // realised plus unrealised before the scenario
+	var instruments []string
+	seen := map[string]bool{}
+	for k, p := range positions {
+		pnlNow[k.strategy] += p.Realized
+		if p.Quantity == 0 {
+			continue
+		}
+		price := p.AvgPrice
+		if s.Feed != nil {
+			if last, ok := s.Feed.LastPrice(p.Instrument); ok {
+				price = last
+			}
+		}
+		pnlNow[k.strategy] += p.Unrealized(price)
+		c := Classify(exchanges[k.instrument], p.Instrument)
+		report.Positions = append(report.Positions, StressPosition{
+			StrategyID: k.strategy, Instrument: k.instrument, Market: c.Market, Sector: c.Sector,
+			Quantity: p.Quantity, Price: price, Value: p.Quantity * price,
+		})
+		if !seen[k.instrument] {
+			seen[k.instrument] = true
+			instruments = append(instruments, k.instrument)
+		}
+	}
+
+	var replay *replayPaths
+	if sc.Kind == models.StressKindReplay {
+		if replay, err = s.replay(instruments, sc.From, sc.To); err != nil {
+			return nil, err
+		}
+	}
+	for i := range report.Positions {
+		p := &report.Positions[i]
+		if replay != nil {
+			p.Move, p.Source = replay.move(p.Instrument, p.Market)
+		} else {
+			p.Move, p.Source = sc.move(p)
+		}
+		p.ShockedPrice = round(p.Price * (1 + p.Move/100))
+		p.PnL = round(p.Value * p.Move / 100)
+		p.Move = round(p.Move)
+		report.PnL += p.PnL
+	}
+	sort.Slice(report.Positions, func(i, j int) bool { return report.Positions[i].PnL < report.Positions[j].PnL })
+	if replay != nil {
+		if worst, day, ok := replay.worst(report.Positions); ok {
+			report.WorstPnL, report.WorstDay = &worst, &day
+		}
+	}
+
+	var deployments []models.DeployedStrategy
+	if err := s.DB.Where("user_id = ? AND status <> ?", userID, models.DeploymentStatusStopped).
+		Find(&deployments).Error; err != nil {
+		return nil, fmt.Errorf("load deployments: %w", err)
+	}
+	capital := map[uuid.UUID]float64{}
+	total := 0.0
+	for _, d := range deployments {
+		if c := d.Capital(); c > 0 {
+			capital[d.StrategyID] += c
+			total += c
+		}
+	}
+	allPnl := 0.0
+	for _, v := range pnlNow {
+		allPnl += v
+	}
+	report.PortfolioValue = round(total + allPnl)
+	if report.PortfolioValue > 0 {
+		report.PnLPercent = round(report.PnL / report.PortfolioValue * 100)
+	}
+	report.PnL = round(report.PnL)
+
+	byStrategy := map[uuid.UUID]*StressStrategy{}
+	for _, p := range report.Positions {
+		st, ok := byStrategy[p.StrategyID]
+		if !ok {
+			st = &StressStrategy{StrategyID: p.StrategyID}
+			byStrategy[p.StrategyID] = st
+		}
+		st.Value += p.Value
+		st.PnL += p.PnL
+	}
+	for id, st := range byStrategy {
+		if c := capital[id]; c > 0 {
+			st.PnLPercent = round(st.PnL / c * 100)
+		}
+		st.Value, st.PnL = round(st.Value), round(st.PnL)
+		report.Strategies = append(report.Strategies, *st)
+	}
+	sort.Slice(report.Strategies, func(i, j int) bool { return report.Strategies[i].PnL < report.Strategies[j].PnL })
+
+	var vr *VaRReport
+	if s.VaR != nil {
+		if vr, err = s.VaR.Compute(userID, nil); err != nil {
+			return nil, err
+		}
+		if r := vr.Find(VaRParametric, 0.99); r != nil {
+			now, stressed := r.VaR, r.VaR*stressFactor(report, sc)
+			stressed = round(stressed)
+			report.VaR, report.StressedVaR = &now, &stressed
+		}
+	}
+
+	if err := s.breaches(userID, report, capital, pnlNow); err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// move picks the shock for a position.
+func (sc Scenario) move(p *StressPosition) (float64, string) {
+	for _, sh := range sc.Shocks {
+		if sh.Symbol != "" && strings.EqualFold(sh.Symbol, p.Instrument) {
+			return sh.Move, "symbol"
+		}
+	}
+	for _, sh := range sc.Shocks {
+		if sh.Symbol == "" && sh.Sector != "" && strings.EqualFold(sh.Sector, p.Sector) {
+			return sh.Move, "sector"
+		}
+	}
+	for _, sh := range sc.Shocks {
+		if sh.Symbol == "" && sh.Sector == "" && strings.EqualFold(sh.Market, p.Market) {
+			return sh.Move, "market"
+		}
+	}
+	return sc.DefaultMove, "default"
+}
+
+// stressFactor scales today's VaR to the post-scenario book: exposure
+// changes linearly with the moves and volatility by the multiplier.
+func stressFactor(r *StressReport, sc Scenario) float64 {
+	before, after := 0.0, 0.0
+	for _, p := range r.Positions {
+		before += math.Abs(p.Value)
+		after += math.Abs(p.Value + p.PnL)
+	}
+	f := 1.0
+	if before > 0 {
+		f = after / before
+	}
+	if sc.VolatilityMultiplier > 0 {
+		f *= sc.VolatilityMultiplier
+	}
+	return f
+}
+
+// replayPaths are the closes of each instrument over a replay window.
+type replayPaths struct {
+	base   map[string]float64
+	closes map[string]map[time.Time]float64
+	days   []time.Time // every day in the window with any close
+	proxy  string
+}
+
+func (s *Stress) replay(instruments []string, from, to time.Time) (*replayPaths, error) {
+	proxy := strings.ToUpper(s.Benchmark)
+	syms := append(append([]string{}, instruments...), proxy)
+	closes, err := dailyCloses(s.DB, syms, day(from).AddDate(0, 0, -10), day(to))
+	if err != nil {
+		return nil, err
+	}
+	rp := &replayPaths{base: map[string]float64{}, closes: map[string]map[time.Time]float64{}, proxy: proxy}
+	start, end := day(from), day(to)
+	daySet := map[time.Time]bool{}
+	for _, sym := range syms {
+		byDay := closes[sym]
+		var before, after []time.Time
+		for d := range byDay {
+			if d.After(start) && !d.After(end) {
+				after = append(after, d)
+			} else if !d.After(start) {
+				before = append(before, d)
+			}
+		}
+		if len(after) == 0 {
+			continue
+		}
+		sort.Slice(before, func(i, j int) bool { return before[i].Before(before[j]) })
+		sort.Slice(after, func(i, j int) bool { return after[i].Before(after[j]) })
+		if len(before) > 0 {
+			rp.base[sym] = byDay[before[len(before)-1]]
+		} else {
+			rp.base[sym] = byDay[after[0]]
+		}
+		if rp.base[sym] <= 0 {
+			delete(rp.base, sym)
+			continue
+		}
+		path := map[time.Time]float64{}
+		for _, d := range after {
+			path[d] = byDay[d]
+			daySet[d] = true
+		}
+		rp.closes[sym] = path
+	}
+	for d := range daySet {
+		rp.days = append(rp.days, d)
+	}
+	sort.Slice(rp.days, func(i, j int) bool { return rp.days[i].Before(rp.days[j]) })
+	return rp, nil
+}
+
+// move is the instrument's percent change over the window. Equity and F&O
+// instruments without history take the benchmark's move.
+func (rp *replayPaths) move(sym, market string) (float64, string) {
+	if m, ok := rp.total(sym); ok {
+		return m, "history"
+	}
+	if market == MarketEquity || market == MarketFO {
+		if m, ok := rp.total(rp.proxy); ok {
+			return m, "proxy"
+		}
+	}
+	return 0, "none"
+}
+
+func (rp *replayPaths) total(sym string) (float64, bool) {
+	path, ok := rp.closes[sym]
+	if !ok {
+		return 0, false
+	}
+	last := 0.0
+	for _, d := range rp.days {
+		if c, ok := path[d]; ok {
+			last = c
+		}
+	}
+	return (last/rp.base[sym] - 1) * 100, true
+}
+
+// worst walks the window day by day, carrying each instrument's last close
+// forward, and returns the lowest cumulative P&L.
+func (rp *replayPaths) worst(positions []StressPosition) (float64, time.Time, bool) {
+	if len(rp.days) == 0 {
+		return 0, time.Time{}, false
+	}
+	last := map[string]float64{}
+	worst, worstDay := math.Inf(1), time.Time{}
+	for _, d := range rp.days {
+		pnl := 0.0
+		for _, p := range positions {
+			sym := p.Instrument
+			if p.Source == "proxy" {
+				sym = rp.proxy
+			} else if p.Source != "history" {
+				continue
+			}
+			if c, ok := rp.closes[sym][d]; ok {
+				last[sym] = c
+			}
+			if c, ok := last[sym]; ok {
+				pnl += p.Value * (c/rp.base[sym] - 1)
+			}
+		}
+		if pnl < worst {
+			worst, worstDay = pnl, d
+		}
+	}
+	return round(worst), worstDay, true
+}
+
+// breaches evaluates the user's active limits against the portfolio after
+// the scenario. The scenario's P&L counts as one day's loss; order-level
+// metrics are not affected by a price move and are skipped.
+func (s *Stress) breaches(userID uuid.UUID, r *StressReport, capital, pnlNow map[uuid.UUID]float64) error {
+	var limits []models.RiskLimit
+	if err := s.DB.Where("user_id = ? AND is_active = ?", userID, true).Order("id").Find(&limits).Error; err != nil {
+		return fmt.Errorf("load risk limits: %w", err)
+	}
+
+	type scope struct {
+		pnl, pnlNow, gross, capital float64
+		sectors                     map[string]float64
+		value                       map[string]float64 // post-scenario gross per instrument
+	}
+	measure := func(strategyID *uuid.UUID) *scope {
+		sc := &scope{sectors: map[string]float64{}, value: map[string]float64{}}
+		for _, p := range r.Positions {
+			if strategyID != nil && p.StrategyID != *strategyID {
+				continue
+			}
+			post := math.Abs(p.Value + p.PnL)
+			sc.pnl += p.PnL
+			sc.gross += post
+			sc.sectors[p.Sector] += post
+			sc.value[p.Instrument] += post
+		}
+		for id, v := range pnlNow {
+			if strategyID == nil || id == *strategyID {
+				sc.pnlNow += v
+			}
+		}
+		for id, c := range capital {
+			if strategyID == nil || id == *strategyID {
+				sc.capital += c
+			}
+		}
+		return sc
+	}
+
+	for _, l := range limits {
+		var strategies []*uuid.UUID
+		switch {
+		case l.Type == models.RiskTypeStrategy && l.StrategyID != nil:
+			strategies = []*uuid.UUID{l.StrategyID}
+		case l.Type == models.RiskTypeStrategy:
+			for i := range r.Strategies {
+				if r.Strategies[i].StrategyID != uuid.Nil {
+					strategies = append(strategies, &r.Strategies[i].StrategyID)
+				}
+			}
+		default:
+			strategies = []*uuid.UUID{nil}
+		}
+
+		var best *StressBreach
+		for _, sid := range strategies {
+			sc := measure(sid)
+			var value, usage float64
+			switch l.Metric {
+			case models.RiskMetricDailyPnl:
+				value, usage = sc.pnl, -sc.pnl
+			case models.RiskMetricGrossExposure:
+				value = sc.gross
+				if l.Type == models.RiskTypePosition {
+					value = 0
+					for sym, v := range sc.value {
+						if l.Instrument == "" || strings.EqualFold(sym, l.Instrument) {
+							value = math.Max(value, v)
+						}
+					}
+				}
+				usage = value
+			case models.RiskMetricDrawdown:
+				if sc.capital <= 0 {
+					continue
+				}
+				value = math.Max(0, -sc.pnl) / sc.capital * 100
+				usage = value
+			case models.RiskMetricStrategyPnl:
+				if sc.capital <= 0 {
+					continue
+				}
+				value = (sc.pnlNow + sc.pnl) / sc.capital * 100
+				usage = -value
+			case models.RiskMetricMarginUtilisation:
+				if sc.capital <= 0 {
+					continue
+				}
+				value = sc.gross / sc.capital * 100
+				usage = value
+			case models.RiskMetricSectorConcentration:
+				base := sc.capital + sc.pnlNow + sc.pnl
+				if base <= 0 {
+					base = sc.gross
+				}
+				if base <= 0 {
+					continue
+				}
+				for sector, v := range sc.sectors {
+					if sector != SectorOther {
+						value = math.Max(value, v/base*100)
+					}
+				}
+				usage = value
+			case models.RiskMetricVaR95, models.RiskMetricVaR99:
+				if r.StressedVaR == nil || sid != nil {
+					continue
+				}
+				value = *r.StressedVaR
+				if l.Metric == models.RiskMetricVaR95 {
+					value *= normalQuantile(0.95) / normalQuantile(0.99)
+				}
+				usage = value
+			default:
+				continue
+			}
+			status := models.RiskStatusOf(usage, l.Threshold)
+			if status == models.RiskStatusSafe {
+				continue
+			}
+			if best == nil || (status == models.RiskStatusBreach && best.Status != models.RiskStatusBreach) {
+				best = &StressBreach{RiskLimitID: l.ID, Name: l.Name, Metric: l.Metric, Action: l.Action,
+					Threshold: l.Threshold, Value: round(value), Status: status, StrategyID: sid}
+			}
+		}
+		if best != nil {
+			r.Breaches = append(r.Breaches, *best)
+		}
+	}
+	sort.SliceStable(r.Breaches, func(i, j int) bool {
+		return r.Breaches[i].Status == models.RiskStatusBreach && r.Breaches[j].Status != models.RiskStatusBreach
+	})
+	return nil
+}
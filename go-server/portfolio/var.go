@@ -0,0 +1,484 @@
+package portfolio
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go-backend/ledger"
+	"go-backend/marketfeed"
+	"go-backend/models"
+	"gorm.io/gorm"
+)
+
+// VaR methods.
+const (
+	VaRHistorical = "historical"
+	VaRParametric = "parametric"
+	VaRMonteCarlo = "monte-carlo"
+)
+
+// Defaults for VaR.
+const (
+	DefaultVaRLookback    = 250 // daily returns
+	DefaultVaRSimulations = 10000
+)
+
+// VaRConfidences are the levels every report covers.
+var VaRConfidences = []float64{0.95, 0.99}
+
+// VaR estimates the one-day value at risk and expected shortfall of open
+// positions from the daily returns of their stored MarketData. Closes and
+// aligned returns are cached for the day, as they only change at the close.
+type VaR struct {
+	DB          *gorm.DB
+	Feed        *marketfeed.Hub
+	Lookback    int
+	Simulations int
+
+	mu      sync.Mutex
+	day     time.Time
+	cache   map[string]map[time.Time]float64 // symbol -> closes
+	aligned map[string]alignedReturns        // sorted symbols -> their returns
+}
+
+type alignedReturns struct {
+	returns map[string][]float64
+	kept    map[string]bool
+}
+
+func NewVaR(db *gorm.DB, feed *marketfeed.Hub) *VaR {
+	return &VaR{DB: db, Feed: feed, Lookback: DefaultVaRLookback, Simulations: DefaultVaRSimulations}
+}
+
+// VaRContribution is one position's share of a VaR figure. Components add
+// up to the VaR; Marginal is the VaR added per unit of extra exposure.
+type VaRContribution struct {
+	Instrument string  `json:"instrument"`
+	Value      float64 `json:"value"` // signed market value
+	Marginal   float64 `json:"marginal"`
+	Component  float64 `json:"component"`
+	Percent    float64 `json:"percent"` // of the VaR
+}
+
+// VaRResult is one method at one confidence level. Losses are positive
+// amounts of currency.
+type VaRResult struct {
+	Method        string            `json:"method"`
+	Confidence    float64           `json:"confidence"`
+	VaR           float64           `json:"var"`
+	ES            float64           `json:"es"`
+	Contributions []VaRContribution `json:"contributions"`
+}
+
+// VaRReport covers one scope: the account, or one strategy.
+type VaRReport struct {
+	StrategyID   *uuid.UUID  `json:"strategyId,omitempty"`
+	Gross        float64     `json:"gross"`
+	Positions    int         `json:"positions"`
+	Observations int         `json:"observations"` // common days of returns used
+	Missing      []string    `json:"missing"`      // open instruments without enough history
+	Results      []VaRResult `json:"results"`
+	At           time.Time   `json:"at"`
+}
+
+// Find returns the result for method and confidence, or nil.
+func (r *VaRReport) Find(method string, confidence float64) *VaRResult {
+	for i := range r.Results {
+		if r.Results[i].Method == method && math.Abs(r.Results[i].Confidence-confidence) < 1e-9 {
+			return &r.Results[i]
+		}
+	}
+	return nil
+}
+
+// Compute estimates VaR for the user's open positions, narrowed to one
+// strategy when strategyID is set. Results are empty when no position has
+// enough history.
+func (v *VaR) Compute(userID uuid.UUID, strategyID *uuid.UUID) (*VaRReport, error) {
+	return v.compute(userID, strategyID, true)
+}
+
+// Historical is Compute with the historical method only, for callers such
+// as the risk monitor that check limits every tick and read nothing else.
+func (v *VaR) Historical(userID uuid.UUID, strategyID *uuid.UUID) (*VaRReport, error) {
+	return v.compute(userID, strategyID, false)
+}
+
+func (v *VaR) compute(userID uuid.UUID, strategyID *uuid.UUID, allMethods bool) (*VaRReport, error) {
+	fills, err := ledger.LoadFills(v.DB, func(q *gorm.DB) *gorm.DB {
+		q = q.Where("orders.user_id = ?", userID)
+		if strategyID != nil {
+			q = q.Where("orders.strategy_id = ?", *strategyID)
+		}
+		return q
+	})
+	if err != nil {
+		return nil, fmt.Errorf("load fills: %w", err)
+	}
+
+	report := &VaRReport{StrategyID: strategyID, Missing: []string{}, Results: []VaRResult{}, At: time.Now()}
+	var instruments []string
+	var values []float64
+	for k, p := range ledger.Positions(fills) {
+		if p.Quantity == 0 {
+			continue
+		}
+		price := p.AvgPrice
+		if v.Feed != nil {
+			if last, ok := v.Feed.LastPrice(p.Instrument); ok {
+				price = last
+			}
+		}
+		instruments = append(instruments, k)
+		values = append(values, p.Quantity*price)
+		report.Gross += math.Abs(p.Quantity * price)
+		report.Positions++
+	}
+	if len(instruments) == 0 {
+		return report, nil
+	}
+
+	returns, kept, err := v.returns(instruments)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	var exposure []float64
+	for i, sym := range instruments {
+		if kept[sym] {
+			names = append(names, sym)
+			exposure = append(exposure, values[i])
+		} else {
+			report.Missing = append(report.Missing, sym)
+		}
+	}
+	sort.Strings(report.Missing)
+	if len(names) == 0 || len(returns[names[0]]) < 2 {
+		return report, nil
+	}
+	series := make([][]float64, len(names))
+	for i, sym := range names {
+		series[i] = returns[sym]
+	}
+	report.Observations = len(series[0])
+
+	// scenario P&L per position, one row per day
+	scenarios := make([][]float64, report.Observations)
+	for t := range scenarios {
+		scenarios[t] = make([]float64, len(names))
+		for i := range names {
+			scenarios[t][i] = exposure[i] * series[i][t]
+		}
+	}
+	if !allMethods {
+		for _, c := range VaRConfidences {
+			report.Results = append(report.Results, empirical(VaRHistorical, c, names, exposure, scenarios))
+		}
+		return report, nil
+	}
+	mean, cov := moments(series)
+	sims := v.simulate(exposure, mean, cov)
+
+	for _, c := range VaRConfidences {
+		report.Results = append(report.Results,
+			empirical(VaRHistorical, c, names, exposure, scenarios),
+			parametric(c, names, exposure, mean, cov),
+			empirical(VaRMonteCarlo, c, names, exposure, sims))
+	}
+	return report, nil
+}
+
+// returns loads aligned daily returns over the lookback. Instruments with
+// fewer than two closes are left out of kept; the rest are aligned on the
+// days they all have a close. The result is shared; callers must not
+// modify it.
+func (v *VaR) returns(instruments []string) (map[string][]float64, map[string]bool, error) {
+	sorted := append([]string(nil), instruments...)
+	sort.Strings(sorted)
+	key := strings.Join(sorted, ",")
+	v.mu.Lock()
+	hit, ok := v.aligned[key]
+	ok = ok && v.day.Equal(day(time.Now()))
+	v.mu.Unlock()
+	if ok {
+		return hit.returns, hit.kept, nil
+	}
+
+	lookback := v.Lookback
+	if lookback < 2 {
+		lookback = DefaultVaRLookback
+	}
+	closes, err := v.closes(instruments, lookback)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	kept := map[string]bool{}
+	var days []time.Time
+	first := true
+	for _, sym := range instruments {
+		byDay := closes[sym]
+		if len(byDay) < 2 {
+			continue
+		}
+		kept[sym] = true
+		if first {
+			for d := range byDay {
+				days = append(days, d)
+			}
+			first = false
+			continue
+		}
+		common := days[:0]
+		for _, d := range days {
+			if _, ok := byDay[d]; ok {
+				common = append(common, d)
+			}
+		}
+		days = common
+	}
+	sort.Slice(days, func(i, j int) bool { return days[i].Before(days[j]) })
+	if len(days) > lookback+1 {
+		days = days[len(days)-lookback-1:]
+	}
+
+	out := map[string][]float64{}
+	for sym := range kept {
+		r := make([]float64, 0, len(days))
+		for t := 1; t < len(days); t++ {
+			prev := closes[sym][days[t-1]]
+			if prev <= 0 {
+				r = append(r, 0)
+				continue
+			}
+			r = append(r, closes[sym][days[t]]/prev-1)
+		}
+		out[sym] = r
+	}
+	v.mu.Lock()
+	if v.aligned != nil {
+		v.aligned[key] = alignedReturns{returns: out, kept: kept}
+	}
+	v.mu.Unlock()
+	return out, kept, nil
+}
+
+func (v *VaR) closes(instruments []string, lookback int) (map[string]map[time.Time]float64, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	today := day(time.Now())
+	if !v.day.Equal(today) || v.cache == nil {
+		v.day, v.cache, v.aligned = today, map[string]map[time.Time]float64{}, map[string]alignedReturns{}
+	}
+	var missing []string
+	for _, sym := range instruments {
+		if _, ok := v.cache[sym]; !ok {
+			missing = append(missing, sym)
+		}
+	}
+	if len(missing) > 0 {
+		// enough calendar days for lookback trading days plus holidays
+		from := today.AddDate(0, 0, -(lookback*7/5 + 30))
+		loaded, err := dailyCloses(v.DB, missing, from, today.AddDate(0, 0, -1))
+		if err != nil {
+			return nil, err
+		}
+		for _, sym := range missing {
+			v.cache[sym] = loaded[sym]
+		}
+	}
+	out := make(map[string]map[time.Time]float64, len(instruments))
+	for _, sym := range instruments {
+		out[sym] = v.cache[sym]
+	}
+	return out, nil
+}
+
+// empirical reads VaR and ES off simulated or historical scenarios. A
+// position's component is its average P&L over the tail scenarios, scaled so
+// the components sum to the VaR.
+func empirical(method string, confidence float64, names []string, exposure []float64, scenarios [][]float64) VaRResult {
+	n := len(scenarios)
+	pnl := make([]float64, n)
+	order := make([]int, n)
+	for t, s := range scenarios {
+		for _, x := range s {
+			pnl[t] += x
+		}
+		order[t] = t
+	}
+	sort.Slice(order, func(a, b int) bool { return pnl[order[a]] < pnl[order[b]] })
+
+	tail := int(math.Ceil(float64(n) * (1 - confidence)))
+	if tail < 1 {
+		tail = 1
+	}
+	res := VaRResult{Method: method, Confidence: confidence}
+	res.VaR = math.Max(0, -pnl[order[tail-1]])
+	component := make([]float64, len(names))
+	for _, t := range order[:tail] {
+		res.ES -= pnl[t]
+		for i, x := range scenarios[t] {
+			component[i] -= x
+		}
+	}
+	res.ES /= float64(tail)
+	scale := 0.0
+	if res.ES != 0 {
+		scale = res.VaR / res.ES / float64(tail)
+	}
+	for i := range component {
+		component[i] *= scale
+	}
+	res.ES = math.Max(0, res.ES)
+	res.Contributions = contributions(names, exposure, component, res.VaR)
+	res.VaR, res.ES = round(res.VaR), round(res.ES)
+	return res
+}
+
+// parametric assumes normally distributed returns with the sample mean and
+// covariance. Components are the Euler allocation of z·σ.
+func parametric(confidence float64, names []string, exposure, mean []float64, cov [][]float64) VaRResult {
+	n := len(names)
+	sigmaV := make([]float64, n) // Σv
+	mu, variance := 0.0, 0.0
+	for i := 0; i < n; i++ {
+		mu += exposure[i] * mean[i]
+		for j := 0; j < n; j++ {
+			sigmaV[i] += cov[i][j] * exposure[j]
+		}
+		variance += exposure[i] * sigmaV[i]
+	}
+	sd := math.Sqrt(math.Max(variance, 0))
+	z := normalQuantile(confidence)
+
+	res := VaRResult{Method: VaRParametric, Confidence: confidence}
+	res.VaR = math.Max(0, z*sd-mu)
+	res.ES = math.Max(0, sd*normalPDF(z)/(1-confidence)-mu)
+	component := make([]float64, n)
+	if sd > 0 {
+		for i := range component {
+			component[i] = exposure[i] * (z*sigmaV[i]/sd - mean[i])
+		}
+	}
+	res.Contributions = contributions(names, exposure, component, res.VaR)
+	res.VaR, res.ES = round(res.VaR), round(res.ES)
+	return res
+}
+
+// simulate draws correlated normal returns through the Cholesky factor of
+// cov. The seed is fixed so a report does not change between calls on the
+// same data.
+func (v *VaR) simulate(exposure, mean []float64, cov [][]float64) [][]float64 {
+	n := len(exposure)
+	sims := v.Simulations
+	if sims <= 0 {
+		sims = DefaultVaRSimulations
+	}
+	l := cholesky(cov)
+	rng := rand.New(rand.NewSource(1))
+	out := make([][]float64, sims)
+	z := make([]float64, n)
+	for s := range out {
+		for i := range z {
+			z[i] = rng.NormFloat64()
+		}
+		row := make([]float64, n)
+		for i := 0; i < n; i++ {
+			r := mean[i]
+			for j := 0; j <= i; j++ {
+				r += l[i][j] * z[j]
+			}
+			row[i] = exposure[i] * r
+		}
+		out[s] = row
+	}
+	return out
+}
+
+func contributions(names []string, exposure, component []float64, total float64) []VaRContribution {
+	out := make([]VaRContribution, len(names))
+	for i, sym := range names {
+		c := VaRContribution{Instrument: sym, Value: round(exposure[i]), Component: round(component[i])}
+		if exposure[i] != 0 {
+			c.Marginal = round(component[i] / exposure[i])
+		}
+		if total > 0 {
+			c.Percent = round(component[i] / total * 100)
+		}
+		out[i] = c
+	}
+	sort.Slice(out, func(a, b int) bool { return out[a].Component > out[b].Component })
+	return out
+}
+
+// moments is the sample mean and covariance of aligned series.
+func moments(series [][]float64) ([]float64, [][]float64) {
+	n, t := len(series), len(series[0])
+	mean := make([]float64, n)
+	for i, s := range series {
+		mean[i], _ = meanStd(s)
+	}
+	cov := make([][]float64, n)
+	for i := range cov {
+		cov[i] = make([]float64, n)
+		for j := 0; j <= i; j++ {
+			c := 0.0
+			for k := 0; k < t; k++ {
+				c += (series[i][k] - mean[i]) * (series[j][k] - mean[j])
+			}
+			if t > 1 {
+				c /= float64(t - 1)
+			}
+			cov[i][j] = c
+			cov[j][i] = c
+		}
+	}
+	return mean, cov
+}
+
+// cholesky factors a covariance matrix, flooring pivots so duplicated or
+// perfectly correlated instruments do not break the factorisation.
+func cholesky(a [][]float64) [][]float64 {
+	n := len(a)
+	l := make([][]float64, n)
+	for i := range l {
+		l[i] = make([]float64, n)
+	}
+	for i := 0; i < n; i++ {
+		for j := 0; j <= i; j++ {
+			s := a[i][j]
+			for k := 0; k < j; k++ {
+				s -= l[i][k] * l[j][k]
+			}
+			if i == j {
+				l[i][i] = math.Sqrt(math.Max(s, 1e-18))
+			} else {
+				l[i][j] = s / l[j][j]
+			}
+		}
+	}
+	return l
+}
+
+func normalQuantile(p float64) float64 { return math.Sqrt2 * math.Erfinv(2*p-1) }
+
+func normalPDF(z float64) float64 { return math.Exp(-z*z/2) / math.Sqrt(2*math.Pi) }
+
+// VaRMetric maps a VaR risk limit metric to its confidence level. Limits are
+// measured by historical simulation.
+func VaRMetric(metric string) (float64, bool) {
+	switch strings.TrimSpace(metric) {
+	case models.RiskMetricVaR95:
+		return 0.95, true
+	case models.RiskMetricVaR99:
+		return 0.99, true
+	}
+	return 0, false
+}
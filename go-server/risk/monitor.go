@@ -0,0 +1,461 @@
+package risk
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go-backend/broker"
+	"go-backend/ledger"
+	"go-backend/models"
+	"go-backend/options"
+	"go-backend/portfolio"
+	"go-backend/runner"
+)
+
+// monitored are the metrics whose status the Monitor owns.
+var monitored = map[string]bool{
+	models.RiskMetricDrawdown:            true,
+	models.RiskMetricGrossExposure:       true,
+	models.RiskMetricStrategyPnl:         true,
+	models.RiskMetricMarginUtilisation:   true,
+	models.RiskMetricDailyPnl:            true,
+	models.RiskMetricSectorConcentration: true,
+	models.RiskMetricVaR95:               true,
+	models.RiskMetricVaR99:               true,
+	models.RiskMetricNetDelta:            true,
+	models.RiskMetricNetGamma:            true,
+	models.RiskMetricNetVega:             true,
+	models.RiskMetricNetTheta:            true,
+}
+
+// evalInterval batches fills and price ticks so a burst of bars causes one
+// evaluation rather than many.
+const evalInterval = time.Second
+
+// Monitor recomputes monitored limits on every fill and price update, moves
+// them through safe/warning/breach and runs the limit's action on a breach.
+// Capital is the sum of CapitalDeployed over the deployments in scope.
+type Monitor struct {
+	Engine  *Engine
+	Runner  *runner.Supervisor
+	Brokers *broker.Registry
+	// Exposures, when set, is refreshed for users with new fills and
+	// measures sector concentration limits.
+	Exposures *portfolio.Exposures
+	// VaR, when set, measures VaR limits.
+	VaR *portfolio.VaR
+	// Greeks, when set, measures net greek limits.
+	Greeks *options.Book
+
+	mu         sync.Mutex
+	dirty      map[uuid.UUID]bool
+	pricesMove bool
+
+	peaks map[string]peak // intraday equity high per scope; only touched by Run
+}
+
+type peak struct {
+	day    time.Time
+	equity float64
+}
+
+func NewMonitor(engine *Engine, sup *runner.Supervisor, brokers *broker.Registry) *Monitor {
+	return &Monitor{
+		Engine:  engine,
+		Runner:  sup,
+		Brokers: brokers,
+		dirty:   map[uuid.UUID]bool{},
+		peaks:   map[string]peak{},
+	}
+}
+
+// OnFill is a broker.FillListener.
+func (m *Monitor) OnFill(order *models.Order, tx *models.Transaction) {
+	m.mu.Lock()
+	m.dirty[order.UserID] = true
+	m.mu.Unlock()
+}
+
+// Run evaluates users as fills and prices arrive until ctx ends.
+func (m *Monitor) Run(ctx context.Context) {
+	updates, stop := m.Engine.Feed.Subscribe("", "")
+	defer stop()
+	ticker := time.NewTicker(evalInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-updates:
+			m.mu.Lock()
+			m.pricesMove = true
+			m.mu.Unlock()
+		case <-ticker.C:
+			m.tick(ctx)
+		}
+	}
+}
+
+func (m *Monitor) tick(ctx context.Context) {
+	m.mu.Lock()
+	users := m.dirty
+	all := m.pricesMove
+	m.dirty, m.pricesMove = map[uuid.UUID]bool{}, false
+	m.mu.Unlock()
+
+	if m.Exposures != nil {
+		for id := range users {
+			if _, err := m.Exposures.Refresh(id); err != nil {
+				log.Printf("risk monitor: exposures for user %s: %v", id, err)
+			}
+		}
+	}
+
+	if all {
+		// A price move can affect anyone holding a position.
+		var ids []uuid.UUID
+		m.Engine.DB.Model(&models.RiskLimit{}).Where("is_active = ? AND metric IN ?", true, monitoredMetrics()).
+			Distinct("user_id").Pluck("user_id", &ids)
+		for _, id := range ids {
+			users[id] = true
+		}
+	}
+	for id := range users {
+		if err := m.Evaluate(ctx, id); err != nil {
+			log.Printf("risk monitor: user %s: %v", id, err)
+		}
+	}
+}
+
+func monitoredMetrics() []string {
+	out := make([]string, 0, len(monitored))
+	for k := range monitored {
+		out = append(out, k)
+	}
+	return out
+}
+
+// scope is what one limit is measured over.
+type scope struct {
+	key         string
+	strategyID  *uuid.UUID
+	exposure    *exposure
+	capital     float64
+	deployments []models.DeployedStrategy
+	tail        *portfolio.VaRReport // computed on first use
+	greeks      *options.BookGreeks  // computed on first use
+}
+
+// snapshot is stored on RiskEvent before and after the action.
+type snapshot struct {
+	Status      string            `json:"status"`
+	Value       float64           `json:"value"`
+	Capital     float64           `json:"capital"`
+	Pnl         float64           `json:"pnl"`
+	DailyPnl    float64           `json:"dailyPnl"`
+	Gross       float64           `json:"gross"`
+	Positions   []ledger.Position `json:"positions"`
+	Deployments map[uint]string   `json:"deployments"` // id -> status
+}
+
+// Evaluate recomputes every monitored limit of a user.
+func (m *Monitor) Evaluate(ctx context.Context, userID uuid.UUID) error {
+	db := m.Engine.DB
+	var limits []models.RiskLimit
+	if err := db.Where("user_id = ? AND is_active = ? AND metric IN ?", userID, true, monitoredMetrics()).
+		Order("id").Find(&limits).Error; err != nil {
+		return err
+	}
+	if len(limits) == 0 {
+		return nil
+	}
+
+	var deployments []models.DeployedStrategy
+	if err := db.Where("user_id = ? AND status <> ?", userID, models.DeploymentStatusStopped).
+		Find(&deployments).Error; err != nil {
+		return err
+	}
+
+	cache := map[string]*scope{}
+	var exposures *portfolio.ExposureReport
+	for i := range limits {
+		l := &limits[i]
+		var sc *scope
+		var value, usage float64
+		var err error
+		if l.Metric == models.RiskMetricSectorConcentration {
+			if m.Exposures == nil {
+				continue
+			}
+			if exposures == nil {
+				if exposures, err = m.Exposures.Compute(userID); err != nil {
+					return err
+				}
+			}
+			if sc, err = m.scope(userID, nil, deployments, cache); err != nil {
+				return err
+			}
+			_, value = exposures.Concentration()
+			usage = value
+		} else if sc, value, usage, err = m.worst(userID, l, deployments, cache); err != nil {
+			return err
+		}
+		if sc == nil {
+			continue
+		}
+
+		status := models.RiskStatusOf(usage, l.Threshold)
+		db.Model(l).Updates(map[string]interface{}{"current_value": value, "status": status})
+		if status == l.Status {
+			continue
+		}
+
+		event := models.RiskEvent{
+			RiskLimitID: l.ID,
+			UserID:      userID,
+			Metric:      l.Metric,
+			Threshold:   l.Threshold,
+			Value:       value,
+			FromStatus:  l.Status,
+			ToStatus:    status,
+		}
+		event.Before, _ = json.Marshal(m.snapshot(sc, l.Status, value))
+		if status == models.RiskStatusBreach {
+			event.Action = l.Action
+			if err := m.act(ctx, l, sc); err != nil {
+				msg := err.Error()
+				event.ActionError = &msg
+			}
+			// Re-measure so the snapshot shows the effect of the action.
+			if ex, err := m.Engine.measure(userID, sc.strategyID); err == nil {
+				sc.exposure = ex
+			}
+			if len(sc.deployments) > 0 {
+				db.Where("id IN ?", deploymentIDs(sc.deployments)).Find(&sc.deployments)
+			}
+			delete(cache, sc.key)
+		}
+		event.After, _ = json.Marshal(m.snapshot(sc, status, value))
+		if err := db.Create(&event).Error; err != nil {
+			return err
+		}
+		log.Printf("risk monitor: limit %d %q %s -> %s (%s %.2f, threshold %g)",
+			l.ID, l.Name, event.FromStatus, status, l.Metric, value, l.Threshold)
+	}
+	return nil
+}
+
+// worst measures l over every scope it covers and returns the scope with the
+// highest usage. A nil scope means the limit cannot be measured yet.
+func (m *Monitor) worst(userID uuid.UUID, l *models.RiskLimit, deployments []models.DeployedStrategy, cache map[string]*scope) (*scope, float64, float64, error) {
+	var strategies []*uuid.UUID
+	if l.Type == models.RiskTypeStrategy {
+		if l.StrategyID != nil {
+			strategies = append(strategies, l.StrategyID)
+		} else {
+			seen := map[uuid.UUID]bool{}
+			for _, d := range deployments {
+				if !seen[d.StrategyID] {
+					seen[d.StrategyID] = true
+					id := d.StrategyID
+					strategies = append(strategies, &id)
+				}
+			}
+		}
+	} else {
+		strategies = []*uuid.UUID{nil}
+	}
+
+	var best *scope
+	var bestValue, bestUsage float64
+	for _, sid := range strategies {
+		sc, err := m.scope(userID, sid, deployments, cache)
+		if err != nil {
+			return nil, 0, 0, err
+		}
+		value, usage, ok := m.value(l, sc)
+		if ok && (best == nil || usage > bestUsage) {
+			best, bestValue, bestUsage = sc, value, usage
+		}
+	}
+	return best, bestValue, bestUsage, nil
+}
+
+func (m *Monitor) scope(userID uuid.UUID, strategyID *uuid.UUID, deployments []models.DeployedStrategy, cache map[string]*scope) (*scope, error) {
+	key := "account"
+	if strategyID != nil {
+		key = strategyID.String()
+	}
+	if sc, ok := cache[key]; ok {
+		return sc, nil
+	}
+
+	ex, err := m.Engine.measure(userID, strategyID)
+	if err != nil {
+		return nil, err
+	}
+	sc := &scope{key: key, strategyID: strategyID, exposure: ex}
+	for _, d := range deployments {
+		if strategyID != nil && d.StrategyID != *strategyID {
+			continue
+		}
+		sc.deployments = append(sc.deployments, d)
+		if c := d.Capital(); c > 0 {
+			sc.capital += c
+		}
+	}
+	cache[key] = sc
+	return sc, nil
+}
+
+// value computes the metric of l over sc and its usage on the threshold
+// scale. ok is false when the metric needs capital and there is none.
+func (m *Monitor) value(l *models.RiskLimit, sc *scope) (value, usage float64, ok bool) {
+	ex := sc.exposure
+	switch l.Metric {
+	case models.RiskMetricDailyPnl:
+		return ex.dailyPnl, -ex.dailyPnl, true
+	case models.RiskMetricGrossExposure:
+		gross := ex.gross
+		if l.Type == models.RiskTypePosition {
+			gross = 0
+			for _, p := range ex.positions {
+				if l.Instrument != "" && !strings.EqualFold(p.Instrument, l.Instrument) {
+					continue
+				}
+				gross = math.Max(gross, math.Abs(p.Quantity)*m.Engine.price(p.Instrument, p.AvgPrice))
+			}
+		}
+		return gross, gross, true
+	}
+	if confidence, isVaR := portfolio.VaRMetric(l.Metric); isVaR {
+		if m.VaR == nil {
+			return 0, 0, false
+		}
+		if sc.tail == nil {
+			report, err := m.VaR.Historical(l.UserID, sc.strategyID)
+			if err != nil {
+				log.Printf("risk monitor: VaR for user %s: %v", l.UserID, err)
+				return 0, 0, false
+			}
+			sc.tail = report
+		}
+		if r := sc.tail.Find(portfolio.VaRHistorical, confidence); r != nil {
+			return r.VaR, r.VaR, true
+		}
+		return 0, 0, true // no position with history
+	}
+	if options.IsGreekMetric(l.Metric) {
+		if m.Greeks == nil {
+			return 0, 0, false
+		}
+		if sc.greeks == nil {
+			book, err := m.Greeks.Compute(l.UserID, sc.strategyID)
+			if err != nil {
+				log.Printf("risk monitor: greeks for user %s: %v", l.UserID, err)
+				return 0, 0, false
+			}
+			sc.greeks = book
+		}
+		value, usage = sc.greeks.Metric(l.Metric)
+		return value, usage, true
+	}
+
+	if sc.capital <= 0 {
+		return 0, 0, false
+	}
+	switch l.Metric {
+	case models.RiskMetricStrategyPnl:
+		v := ex.pnl / sc.capital * 100
+		return v, -v, true
+	case models.RiskMetricMarginUtilisation:
+		v := ex.gross / sc.capital * 100
+		return v, v, true
+	case models.RiskMetricDrawdown:
+		equity := sc.capital + ex.pnl
+		y, mo, d := time.Now().Date()
+		today := time.Date(y, mo, d, 0, 0, 0, 0, time.Local)
+		key := l.UserID.String() + "/" + sc.key
+		pk, seen := m.peaks[key]
+		if !seen || !pk.day.Equal(today) || equity > pk.equity {
+			pk = peak{day: today, equity: equity}
+			m.peaks[key] = pk
+		}
+		v := (pk.equity - equity) / sc.capital * 100
+		return v, v, true
+	}
+	return 0, 0, false
+}
+
+func (m *Monitor) snapshot(sc *scope, status string, value float64) snapshot {
+	s := snapshot{
+		Status:      status,
+		Value:       value,
+		Capital:     sc.capital,
+		Pnl:         sc.exposure.pnl,
+		DailyPnl:    sc.exposure.dailyPnl,
+		Gross:       sc.exposure.gross,
+		Deployments: map[uint]string{},
+	}
+	for _, p := range sc.exposure.positions {
+		if p.Quantity != 0 {
+			s.Positions = append(s.Positions, *p)
+		}
+	}
+	for _, d := range sc.deployments {
+		s.Deployments[d.ID] = d.Status
+	}
+	return s
+}
+
+// act runs the limit's breach action over the scope.
+func (m *Monitor) act(ctx context.Context, l *models.RiskLimit, sc *scope) error {
+	reason := fmt.Sprintf("risk limit %q breached (%s, threshold %g)", l.Name, l.Metric, l.Threshold)
+	actor := runner.SystemActor("risk")
+	var errs []string
+
+	switch l.Action {
+	case models.RiskActionReduce, models.RiskActionPause:
+		for _, d := range sc.deployments {
+			if d.Status != models.DeploymentStatusActive {
+				continue
+			}
+			if _, err := m.Runner.Transition(ctx, d.ID, runner.ActionPause, actor, reason); err != nil &&
+				!errors.Is(err, runner.ErrInvalidTransition) {
+				errs = append(errs, fmt.Sprintf("pause deployment %d: %v", d.ID, err))
+			}
+		}
+	case models.RiskActionExit:
+		for _, d := range sc.deployments {
+			if _, err := m.Runner.Transition(ctx, d.ID, runner.ActionSquareOff, actor, reason); err != nil &&
+				!errors.Is(err, runner.ErrInvalidTransition) {
+				errs = append(errs, fmt.Sprintf("square off deployment %d: %v", d.ID, err))
+			}
+		}
+		if err := m.Runner.FlattenManual(ctx, l.UserID, sc.strategyID); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	// notify is the event itself; block is enforced by the pre-trade check.
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+func deploymentIDs(ds []models.DeployedStrategy) []uint {
+	ids := make([]uint, len(ds))
+	for i, d := range ds {
+		ids[i] = d.ID
+	}
+	return ids
+}
@@ -0,0 +1,275 @@
+// Package risk enforces the user's RiskLimits: a pre-trade gate every order
+// passes through on its way to a broker, and a monitor that keeps limit
+// statuses current and acts on breaches.
+package risk
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go-backend/broker"
+	"go-backend/ledger"
+	"go-backend/marketfeed"
+	"go-backend/models"
+	"gorm.io/gorm"
+)
+
+// Engine evaluates active RiskLimits. Check is installed on the broker
+// registry so that manual, workflow and strategy orders are all covered.
+type Engine struct {
+	DB   *gorm.DB
+	Feed *marketfeed.Hub
+}
+
+func NewEngine(db *gorm.DB, feed *marketfeed.Hub) *Engine {
+	return &Engine{DB: db, Feed: feed}
+}
+
+// exposure is the state of one scope (the whole account or one strategy)
+// before the order.
+type exposure struct {
+	positions  map[string]*ledger.Position
+	pnl        float64 // realised plus unrealised, since inception
+	dailyPnl   float64
+	gross      float64 // sum of |quantity| x price
+	openOrders int64
+}
+
+// Check implements broker.PreTradeCheck. Limits are applied in id order; a
+// limit may downsize the order for the limits after it.
+func (e *Engine) Check(ctx context.Context, o *models.Order) error {
+	var limits []models.RiskLimit
+	if err := e.DB.Where("user_id = ? AND is_active = ?", o.UserID, true).Order("id").Find(&limits).Error; err != nil {
+		return fmt.Errorf("load risk limits: %w", err)
+	}
+
+	scopes := map[string]*exposure{}
+	for i := range limits {
+		l := &limits[i]
+		if !applies(l, o) {
+			continue
+		}
+		var strategyID *uuid.UUID
+		if l.Type == models.RiskTypeStrategy {
+			strategyID = &o.StrategyID
+		}
+		key := "account"
+		if strategyID != nil {
+			key = strategyID.String()
+		}
+		ex, ok := scopes[key]
+		if !ok {
+			var err error
+			if ex, err = e.measure(o.UserID, strategyID); err != nil {
+				return err
+			}
+			scopes[key] = ex
+		}
+		if err := e.apply(l, ex, o); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func applies(l *models.RiskLimit, o *models.Order) bool {
+	switch l.Type {
+	case models.RiskTypeStrategy:
+		if o.StrategyID == uuid.Nil {
+			return false
+		}
+		return l.StrategyID == nil || *l.StrategyID == o.StrategyID
+	case models.RiskTypePosition:
+		return l.Instrument == "" || strings.EqualFold(l.Instrument, o.Instrument)
+	}
+	return true
+}
+
+// measure rebuilds positions, today's P&L and the working order count for a
+// user, optionally narrowed to one strategy. Daily P&L is what was realised
+// today plus the mark-to-market of open positions.
+func (e *Engine) measure(userID uuid.UUID, strategyID *uuid.UUID) (*exposure, error) {
+	fills, err := ledger.LoadFills(e.DB, func(q *gorm.DB) *gorm.DB {
+		q = q.Where("orders.user_id = ?", userID)
+		if strategyID != nil {
+			q = q.Where("orders.strategy_id = ?", *strategyID)
+		}
+		return q
+	})
+	if err != nil {
+		return nil, fmt.Errorf("load fills: %w", err)
+	}
+
+	y, m, d := time.Now().Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, time.Local)
+	ex := &exposure{positions: map[string]*ledger.Position{}}
+	for _, f := range fills {
+		k := strings.ToUpper(f.Instrument)
+		p, ok := ex.positions[k]
+		if !ok {
+			p = &ledger.Position{Instrument: f.Instrument}
+			ex.positions[k] = p
+		}
+		realized := p.Apply(f)
+		if !f.ExecutedAt.Before(today) {
+			ex.dailyPnl += realized - f.Fees
+		}
+	}
+	for _, p := range ex.positions {
+		ex.pnl += p.Realized
+		if p.Quantity != 0 {
+			price := e.price(p.Instrument, p.AvgPrice)
+			ex.dailyPnl += p.Unrealized(price)
+			ex.pnl += p.Unrealized(price)
+			ex.gross += math.Abs(p.Quantity) * price
+		}
+	}
+
+	q := e.DB.Model(&models.Order{}).Where("user_id = ? AND status IN ?", userID,
+		[]string{models.OrderStatusOpen, models.OrderStatusPartiallyFilled})
+	if strategyID != nil {
+		q = q.Where("strategy_id = ?", *strategyID)
+	}
+	if err := q.Count(&ex.openOrders).Error; err != nil {
+		return nil, fmt.Errorf("count open orders: %w", err)
+	}
+	return ex, nil
+}
+
+func (e *Engine) price(instrument string, fallback float64) float64 {
+	if e.Feed != nil {
+		if p, ok := e.Feed.LastPrice(instrument); ok {
+			return p
+		}
+	}
+	return fallback
+}
+
+// apply evaluates one limit against the order, downsizing or rejecting it as
+// the limit's action says, and stores the limit's current value and status.
+func (e *Engine) apply(l *models.RiskLimit, ex *exposure, o *models.Order) error {
+	pos := 0.0
+	if p, ok := ex.positions[strings.ToUpper(o.Instrument)]; ok {
+		pos = p.Quantity
+	}
+	signed := float64(o.Quantity)
+	if strings.EqualFold(o.Side, "SELL") {
+		signed = -signed
+	}
+	reducing := pos != 0 && (pos > 0) != (signed > 0) && math.Abs(signed) <= math.Abs(pos)
+
+	price := o.Price
+	if !strings.EqualFold(o.OrderType, "LIMIT") || price <= 0 {
+		price = e.price(o.Instrument, o.Price)
+	}
+
+	if l.Action == models.RiskActionBlock && l.Status == models.RiskStatusBreach && !reducing {
+		return &broker.RejectError{LimitID: &l.ID,
+			Reason: fmt.Sprintf("new orders are blocked while risk limit %q is breached", l.Name)}
+	}
+
+	// current is the metric before the order, projected after it. usage maps
+	// a value onto the threshold scale; maxQty is the largest quantity that
+	// fits, or -1 when the metric cannot be satisfied by downsizing.
+	var current, projected float64
+	usage := func(v float64) float64 { return v }
+	maxQty := -1
+	breach := false
+	hasValue := true
+
+	switch l.Metric {
+	case models.RiskMetricOrderValue:
+		// Orders that only reduce a position always pass, so square-offs
+		// and exits are never rejected or left partly open.
+		if price <= 0 && !reducing {
+			return &broker.RejectError{LimitID: &l.ID,
+				Reason: fmt.Sprintf("risk limit %q: no reference price for %s", l.Name, o.Instrument)}
+		}
+		projected = float64(o.Quantity) * price
+		breach = !reducing && projected > l.Threshold
+		maxQty = int(math.Floor(l.Threshold / price))
+	case models.RiskMetricPositionSize:
+		current, projected = math.Abs(pos), math.Abs(pos+signed)
+		breach = projected > l.Threshold && projected > current
+		if signed > 0 {
+			maxQty = int(math.Floor(l.Threshold - pos))
+		} else {
+			maxQty = int(math.Floor(l.Threshold + pos))
+		}
+	case models.RiskMetricDailyPnl:
+		current, projected = ex.dailyPnl, ex.dailyPnl
+		usage = func(v float64) float64 { return -v }
+		breach = !reducing && -ex.dailyPnl >= l.Threshold
+	case models.RiskMetricOpenOrders:
+		current, projected = float64(ex.openOrders), float64(ex.openOrders+1)
+		breach = !reducing && projected > l.Threshold
+	case models.RiskMetricAllowedInstruments:
+		hasValue = false
+		breach = !reducing && !allowed(l.AllowedInstruments, o.Instrument)
+	default:
+		// Portfolio metrics (drawdown, exposure, ...) belong to the monitor.
+		return nil
+	}
+
+	if breach {
+		switch l.Action {
+		case models.RiskActionNotify:
+			// let it through; the stored status shows the breach
+		case models.RiskActionReduce:
+			if maxQty <= 0 {
+				e.store(l, current, usage(current), hasValue)
+				return &broker.RejectError{LimitID: &l.ID,
+					Reason: fmt.Sprintf("risk limit %q (%s %g) leaves no room for %s", l.Name, l.Metric, l.Threshold, o.Instrument)}
+			}
+			o.Quantity = maxQty
+			o.RiskLimitID = &l.ID
+			o.RiskReason = fmt.Sprintf("downsized to %d by risk limit %q (%s %g)", maxQty, l.Name, l.Metric, l.Threshold)
+			if l.Metric == models.RiskMetricOrderValue {
+				projected = float64(maxQty) * price
+			} else {
+				projected = math.Abs(pos + math.Copysign(float64(maxQty), signed))
+			}
+		default:
+			e.store(l, current, usage(current), hasValue)
+			return &broker.RejectError{LimitID: &l.ID,
+				Reason: fmt.Sprintf("blocked by risk limit %q: %s would be %s, limit %g", l.Name, l.Metric, describe(l, projected, hasValue), l.Threshold)}
+		}
+	}
+	e.store(l, projected, usage(projected), hasValue)
+	return nil
+}
+
+func describe(l *models.RiskLimit, v float64, hasValue bool) string {
+	if !hasValue {
+		return "outside " + l.AllowedInstruments
+	}
+	return fmt.Sprintf("%.2f", v)
+}
+
+// allowed compares canonical symbols, so a list written before the
+// instrument master was loaded still matches the normalized order.
+func allowed(list, instrument string) bool {
+	want := marketfeed.Canonical(instrument)
+	for _, s := range strings.Split(list, ",") {
+		if s = strings.TrimSpace(s); s != "" && marketfeed.Canonical(s) == want {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *Engine) store(l *models.RiskLimit, value, usage float64, hasValue bool) {
+	if monitored[l.Metric] {
+		return // the monitor owns the status so it can record the transition
+	}
+	updates := map[string]interface{}{"status": models.RiskStatusSafe}
+	if hasValue {
+		updates["current_value"] = value
+		updates["status"] = models.RiskStatusOf(usage, l.Threshold)
+	}
+	e.DB.Model(l).Updates(updates)
+}
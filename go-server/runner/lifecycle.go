@@ -0,0 +1,259 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/google/uuid"
+	"go-backend/broker"
+	"go-backend/ledger"
+	"go-backend/models"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// Lifecycle actions on a deployment.
+const (
+	ActionPause     = "pause"
+	ActionResume    = "resume"
+	ActionStop      = "stop"
+	ActionSquareOff = "square-off"
+	ActionFail      = "fail"  // runner gave up after repeated crashes
+	ActionRepin     = "repin" // pinned to another strategy version; status unchanged
+)
+
+// transitions maps action -> from status -> to status.
+var transitions = map[string]map[string]string{
+	ActionPause: {
+		models.DeploymentStatusActive: models.DeploymentStatusPaused,
+	},
+	ActionResume: {
+		models.DeploymentStatusPaused: models.DeploymentStatusActive,
+		models.DeploymentStatusError:  models.DeploymentStatusActive,
+	},
+	ActionStop: {
+		models.DeploymentStatusActive: models.DeploymentStatusStopped,
+		models.DeploymentStatusPaused: models.DeploymentStatusStopped,
+		models.DeploymentStatusError:  models.DeploymentStatusStopped,
+	},
+	// Square-off is allowed on a stopped deployment so a partly failed
+	// flatten can be retried.
+	ActionSquareOff: {
+		models.DeploymentStatusActive:  models.DeploymentStatusStopped,
+		models.DeploymentStatusPaused:  models.DeploymentStatusStopped,
+		models.DeploymentStatusError:   models.DeploymentStatusStopped,
+		models.DeploymentStatusStopped: models.DeploymentStatusStopped,
+	},
+	ActionFail: {
+		models.DeploymentStatusActive: models.DeploymentStatusError,
+	},
+}
+
+// ErrInvalidTransition is returned for an action the deployment's current
+// status does not allow.
+var ErrInvalidTransition = errors.New("invalid deployment transition")
+
+// ErrHalted is returned when resuming a deployment whose owner is halted by
+// a kill switch.
+var ErrHalted = errors.New("trading is halted by a kill switch")
+
+// Actor identifies who triggered a transition. UserID is nil for the system.
+type Actor struct {
+	UserID *uuid.UUID
+	Source string
+}
+
+// UserActor is the actor for a transition requested by a user.
+func UserActor(id uuid.UUID) Actor { return Actor{UserID: &id, Source: "user"} }
+
+// SystemActor is the actor for a transition made by a backend component.
+func SystemActor(source string) Actor { return Actor{Source: source} }
+
+// IsValidAction reports whether action names a lifecycle transition users
+// may request.
+func IsValidAction(action string) bool {
+	_, ok := transitions[action]
+	return ok && action != ActionFail
+}
+
+// Transition moves deployment id through action, records the audit event and
+// then starts, stops or squares off the worker to match the new status.
+func (s *Supervisor) Transition(ctx context.Context, id uint, action string, actor Actor, reason string) (*models.DeployedStrategy, error) {
+	next, ok := transitions[action]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown action %q", ErrInvalidTransition, action)
+	}
+
+	var d models.DeployedStrategy
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(&d, id).Error; err != nil {
+			return err
+		}
+		if action == ActionResume && s.Halted != nil && s.Halted(d.UserID) {
+			return ErrHalted
+		}
+		from := d.Status
+		to, ok := next[from]
+		if !ok {
+			return fmt.Errorf("%w: cannot %s a deployment that is %s", ErrInvalidTransition, action, from)
+		}
+		if err := tx.Model(&d).Update("status", to).Error; err != nil {
+			return err
+		}
+		d.Status = to
+		return tx.Create(&models.DeploymentEvent{
+			DeploymentID: d.ID,
+			Action:       action,
+			FromStatus:   from,
+			ToStatus:     to,
+			ActorID:      actor.UserID,
+			Source:       actor.Source,
+			Reason:       reason,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	switch action {
+	case ActionPause, ActionStop:
+		s.Halt(d.ID)
+	case ActionResume:
+		s.Launch(d)
+	case ActionSquareOff:
+		s.Halt(d.ID)
+		if err := s.squareOff(ctx, &d); err != nil {
+			return &d, fmt.Errorf("square-off: %w", err)
+		}
+	}
+	return &d, nil
+}
+
+// squareOff cancels the deployment's open orders and sends market orders that
+// flatten every position it opened.
+func (s *Supervisor) squareOff(ctx context.Context, d *models.DeployedStrategy) error {
+	if err := cancelOpenOrders(ctx, s.DB, s.Brokers, d.ID); err != nil {
+		return err
+	}
+	fills, err := ledger.LoadFills(s.DB, func(q *gorm.DB) *gorm.DB {
+		return q.Where("orders.deployment_id = ?", d.ID)
+	})
+	if err != nil {
+		return err
+	}
+
+	var failed []string
+	for _, p := range ledger.Positions(fills) {
+		if p.Quantity == 0 {
+			continue
+		}
+		side := "SELL"
+		if p.Quantity < 0 {
+			side = "BUY"
+		}
+		order := deploymentOrder(d, p.Instrument, side, int(math.Round(math.Abs(p.Quantity))), "MARKET", 0)
+		order.IsExitOrder = true
+		if err := broker.Submit(ctx, s.DB, s.Brokers, &order); err != nil {
+			failed = append(failed, p.Instrument+": "+err.Error())
+		}
+	}
+	if len(failed) > 0 {
+		return errors.New(strings.Join(failed, "; "))
+	}
+	return nil
+}
+
+// cancelOpenOrders cancels every working order of a deployment, and the
+// exits and stops the server holds for it.
+func cancelOpenOrders(ctx context.Context, db *gorm.DB, reg *broker.Registry, deploymentID uint) error {
+	var open []models.Order
+	if err := db.Where("deployment_id = ? AND status IN ?", deploymentID,
+		[]string{models.OrderStatusOpen, models.OrderStatusPartiallyFilled, models.OrderStatusPending}).Find(&open).Error; err != nil {
+		return err
+	}
+	for i := range open {
+		if err := broker.Cancel(ctx, db, reg, &open[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// deploymentOrder builds an order attributed to deployment d and routed to
+// its paper or live broker.
+func deploymentOrder(d *models.DeployedStrategy, instrument, side string, qty int, orderType string, price float64) models.Order {
+	id := d.ID
+	order := models.Order{
+		UserID:       d.UserID,
+		Instrument:   instrument,
+		Exchange:     exchangeOf(instrument),
+		Quantity:     qty,
+		Price:        price,
+		OrderType:    orderType,
+		Side:         side,
+		StrategyID:   d.StrategyID,
+		DeploymentID: &id,
+	}
+	if strings.EqualFold(d.TradingType, "paper") {
+		order.IsPaper = true
+	} else {
+		brokerID := d.BrokerID
+		order.BrokerID = &brokerID
+	}
+	return order
+}
+
+// FlattenManual closes positions opened by orders outside any deployment,
+// routing each exit like the most recent order in that instrument.
+func (s *Supervisor) FlattenManual(ctx context.Context, userID uuid.UUID, strategyID *uuid.UUID) error {
+	db := s.DB
+	fills, err := ledger.LoadFills(db, func(q *gorm.DB) *gorm.DB {
+		q = q.Where("orders.user_id = ? AND orders.deployment_id IS NULL", userID)
+		if strategyID != nil {
+			q = q.Where("orders.strategy_id = ?", *strategyID)
+		}
+		return q
+	})
+	if err != nil {
+		return err
+	}
+
+	var errs []string
+	for _, p := range ledger.Positions(fills) {
+		if p.Quantity == 0 {
+			continue
+		}
+		var last models.Order
+		if err := db.Where("user_id = ? AND instrument = ? AND deployment_id IS NULL", userID, p.Instrument).
+			Order("placed_at DESC").First(&last).Error; err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", p.Instrument, err))
+			continue
+		}
+		side := "SELL"
+		if p.Quantity < 0 {
+			side = "BUY"
+		}
+		exit := models.Order{
+			UserID:      userID,
+			Instrument:  p.Instrument,
+			Exchange:    last.Exchange,
+			Quantity:    int(math.Round(math.Abs(p.Quantity))),
+			OrderType:   "MARKET",
+			Side:        side,
+			StrategyID:  last.StrategyID,
+			IsExitOrder: true,
+			BrokerID:    last.BrokerID,
+			IsPaper:     last.IsPaper,
+		}
+		if err := broker.Submit(ctx, db, s.Brokers, &exit); err != nil {
+			errs = append(errs, fmt.Sprintf("flatten %s: %v", p.Instrument, err))
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
@@ -0,0 +1,447 @@
+// Package runner executes active DeployedStrategy rows: one goroutine per
+// deployment, fed live bars from the market feed, trading through the broker
+// registry. A failing deployment is restarted with backoff and never affects
+// the others.
+package runner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"go-backend/broker"
+	"go-backend/ledger"
+	"go-backend/marketfeed"
+	"go-backend/models"
+	"go-backend/script"
+	"go-backend/sizing"
+	"gorm.io/gorm"
+)
+
+const maxRestarts = 5
+
+// healthyRun is how long a worker must run before its next failure counts
+// as a fresh start rather than another restart in a row.
+const healthyRun = 10 * time.Minute
+
+// ErrCapitalExceeded is returned to a script whose order would take the
+// deployment's exposure past CapitalDeployed.
+var ErrCapitalExceeded = errors.New("order would exceed deployed capital")
+
+// Slicer hands large orders to an execution algorithm. It reports false
+// when the order should be sent as is.
+type Slicer interface {
+	Slice(ctx context.Context, d *models.DeployedStrategy, o *models.Order) (bool, error)
+}
+
+// Supervisor owns the running deployments.
+type Supervisor struct {
+	DB      *gorm.DB
+	Feed    *marketfeed.Hub
+	Brokers *broker.Registry
+	Sizing  *sizing.Service
+	Limits  script.Limits
+	// Halted reports users whose trading is stopped by a kill switch; their
+	// deployments cannot be resumed. Nil means no one is halted.
+	Halted func(userID uuid.UUID) bool
+	// Slicer, when set, may take a deployment's order to work it over time
+	// instead of sending it whole.
+	Slicer Slicer
+
+	mu      sync.Mutex
+	ctx     context.Context
+	workers map[uint]*worker
+}
+
+func New(db *gorm.DB, feed *marketfeed.Hub, brokers *broker.Registry) *Supervisor {
+	return &Supervisor{
+		DB:      db,
+		Feed:    feed,
+		Brokers: brokers,
+		Sizing:  sizing.NewService(db, feed),
+		Limits:  script.DefaultLimits,
+		ctx:     context.Background(),
+		workers: map[uint]*worker{},
+	}
+}
+
+// Start launches every deployment whose status is active. Workers stop when
+// ctx is cancelled.
+func (s *Supervisor) Start(ctx context.Context) error {
+	s.mu.Lock()
+	s.ctx = ctx
+	s.mu.Unlock()
+
+	var deployments []models.DeployedStrategy
+	if err := s.DB.Where("status = ?", models.DeploymentStatusActive).Find(&deployments).Error; err != nil {
+		return err
+	}
+	for _, d := range deployments {
+		s.Launch(d)
+	}
+	log.Printf("runner: started %d deployed strategies", len(deployments))
+	return nil
+}
+
+// Launch starts a worker for d unless one is already running.
+func (s *Supervisor) Launch(d models.DeployedStrategy) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.workers[d.ID]; ok {
+		return
+	}
+	ctx, cancel := context.WithCancel(s.ctx)
+	w := &worker{sup: s, dep: d, cancel: cancel, done: make(chan struct{})}
+	s.workers[d.ID] = w
+	go s.supervise(ctx, w)
+}
+
+// Halt stops the worker for deployment id and waits for it to exit.
+func (s *Supervisor) Halt(id uint) {
+	s.mu.Lock()
+	w, ok := s.workers[id]
+	s.mu.Unlock()
+	if !ok {
+		return
+	}
+	w.cancel()
+	<-w.done
+}
+
+// Reload restarts d's worker so it picks up edited settings or a re-pinned
+// version. Deployments that are not running are left alone.
+func (s *Supervisor) Reload(d models.DeployedStrategy) {
+	if !s.IsRunning(d.ID) {
+		return
+	}
+	s.Halt(d.ID)
+	if d.Status == models.DeploymentStatusActive {
+		s.Launch(d)
+	}
+}
+
+// IsRunning reports whether deployment id has a live worker.
+func (s *Supervisor) IsRunning(id uint) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, ok := s.workers[id]
+	return ok
+}
+
+func (s *Supervisor) supervise(ctx context.Context, w *worker) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.workers, w.dep.ID)
+		s.mu.Unlock()
+		close(w.done)
+	}()
+
+	backoff := time.Second
+	for attempt := 1; ; attempt++ {
+		started := time.Now()
+		err := w.safeRun(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		// Only failures in quick succession give up on the deployment;
+		// occasional feed or database errors over its lifetime do not.
+		if time.Since(started) >= healthyRun {
+			attempt, backoff = 1, time.Second
+		}
+		log.Printf("runner: deployment %d stopped (attempt %d/%d): %v", w.dep.ID, attempt, maxRestarts, err)
+		w.recordError(err)
+		if attempt >= maxRestarts {
+			// Transition would wait on this worker via Halt, so record the
+			// failure directly and let the deferred cleanup remove it.
+			s.fail(w.dep.ID, err)
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff *= 2
+	}
+}
+
+// fail moves an active deployment to error after the runner gives up on it.
+func (s *Supervisor) fail(id uint, cause error) {
+	err := s.DB.Transaction(func(tx *gorm.DB) error {
+		res := tx.Model(&models.DeployedStrategy{}).
+			Where("id = ? AND status = ?", id, models.DeploymentStatusActive).
+			Update("status", models.DeploymentStatusError)
+		if res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		return tx.Create(&models.DeploymentEvent{
+			DeploymentID: id,
+			Action:       ActionFail,
+			FromStatus:   models.DeploymentStatusActive,
+			ToStatus:     models.DeploymentStatusError,
+			Source:       "runner",
+			Reason:       fmt.Sprintf("stopped after %d failed attempts: %v", maxRestarts, cause),
+		}).Error
+	})
+	if err != nil {
+		log.Printf("runner: failed to mark deployment %d as errored: %v", id, err)
+	}
+}
+
+// worker runs one deployment and is the script.Host its program sees.
+type worker struct {
+	sup    *Supervisor
+	dep    models.DeployedStrategy
+	cancel context.CancelFunc
+	done   chan struct{}
+
+	ctx        context.Context
+	symbol     string
+	timeframe  string
+	multiplier float64
+	capital    float64
+	bars       []script.Bar // closed bars, which the script sees
+	forming    *script.Bar  // the bar still trading, not yet evaluated
+	live       bool         // forming has been updated from the feed
+	pos        ledger.Position
+}
+
+func (w *worker) safeRun(ctx context.Context) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v\n%s", r, debug.Stack())
+		}
+	}()
+	return w.run(ctx)
+}
+
+func (w *worker) run(ctx context.Context) error {
+	db := w.sup.DB
+	w.ctx = ctx
+
+	var version models.StrategyVersion
+	if err := db.Where("strategy_id = ? AND version = ?", w.dep.StrategyID, w.dep.StrategyVersion).
+		First(&version).Error; err != nil {
+		return fmt.Errorf("load strategy version %d: %w", w.dep.StrategyVersion, err)
+	}
+	prog, err := script.Compile(version.Code)
+	if err != nil {
+		return fmt.Errorf("compile strategy version %d: %w", version.Version, err)
+	}
+
+	w.symbol, w.timeframe = version.Symbol, version.Timeframe
+	w.multiplier = w.dep.Multiplier()
+	w.capital = w.dep.Capital()
+	if w.multiplier <= 0 {
+		return fmt.Errorf("invalid lot multiplier %q", w.dep.LotMultiplier)
+	}
+	if w.capital <= 0 {
+		return fmt.Errorf("invalid capital deployed %q", w.dep.CapitalDeployed)
+	}
+
+	if w.bars, err = marketfeed.Recent(db, w.symbol, w.timeframe, w.sup.Limits.MaxBars); err != nil {
+		return fmt.Errorf("load history: %w", err)
+	}
+	// The newest stored bar may still be trading
+	if n := len(w.bars); n > 0 {
+		last := w.bars[n-1]
+		w.bars, w.forming, w.live = w.bars[:n-1], &last, false
+	}
+	if err := w.refreshPosition(); err != nil {
+		return err
+	}
+
+	updates, stop := w.sup.Feed.Subscribe(w.symbol, w.timeframe)
+	defer stop()
+	inst := prog.NewInstance()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case u := <-updates:
+			closed := w.addBar(u.Bar)
+			if err := w.refreshPosition(); err != nil {
+				return err
+			}
+			if closed {
+				if err := inst.OnBar(ctx, w, w.sup.Limits); err != nil {
+					// A script error skips this bar; it does not stop the deployment.
+					log.Printf("runner: deployment %d: %v", w.dep.ID, err)
+					w.recordError(err)
+				}
+			}
+			if err := w.updatePnl(); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// addBar takes a feed update. An update of the forming bar replaces it; a
+// newer bar closes it and reports whether the script should now evaluate
+// it, as a backtest does once per closed bar. A bar that closed before the
+// worker saw it trade, such as the last one stored before a restart, joins
+// the history without being evaluated again.
+func (w *worker) addBar(b script.Bar) bool {
+	if w.forming != nil && !b.Time.After(w.forming.Time) {
+		if b.Time.Equal(w.forming.Time) {
+			*w.forming = b
+			w.live = true
+		}
+		return false
+	}
+	if w.forming == nil {
+		if n := len(w.bars); n > 0 && !b.Time.After(w.bars[n-1].Time) {
+			return false
+		}
+		w.forming, w.live = &b, true
+		return false
+	}
+	closed := w.live
+	w.bars = append(w.bars, *w.forming)
+	if max := w.sup.Limits.MaxBars; max > 0 && len(w.bars) > max {
+		w.bars = w.bars[len(w.bars)-max:]
+	}
+	w.forming, w.live = &b, true
+	return closed
+}
+
+func (w *worker) refreshPosition() error {
+	fills, err := ledger.LoadFills(w.sup.DB, func(q *gorm.DB) *gorm.DB {
+		return q.Where("orders.deployment_id = ?", w.dep.ID)
+	})
+	if err != nil {
+		return fmt.Errorf("load fills: %w", err)
+	}
+	w.pos = ledger.Position{Instrument: w.symbol}
+	for _, f := range fills {
+		w.pos.Apply(f)
+	}
+	return nil
+}
+
+func (w *worker) lastPrice() float64 {
+	if w.forming != nil {
+		return w.forming.Close
+	}
+	if n := len(w.bars); n > 0 {
+		return w.bars[n-1].Close
+	}
+	return w.pos.AvgPrice
+}
+
+func (w *worker) pnl() float64 {
+	return w.pos.Realized + w.pos.Unrealized(w.lastPrice())
+}
+
+func (w *worker) updatePnl() error {
+	pnl := w.pnl()
+	return w.sup.DB.Model(&models.DeployedStrategy{}).Where("id = ?", w.dep.ID).Updates(map[string]interface{}{
+		"current_pnl":  pnl,
+		"percent_pnl":  pnl / w.capital * 100,
+		"last_updated": time.Now(),
+	}).Error
+}
+
+func (w *worker) recordError(err error) {
+	msg := err.Error()
+	w.sup.DB.Model(&models.DeployedStrategy{}).Where("id = ?", w.dep.ID).Update("last_error", msg)
+}
+
+// Bars, Position, Equity, PlaceOrder, CancelAll and Log implement script.Host.
+// Quantities seen by the script are in its own units; the lot multiplier is
+// applied only when an order is sent.
+
+func (w *worker) Bars() []script.Bar { return w.bars }
+
+func (w *worker) Position() script.Position {
+	return script.Position{Quantity: w.pos.Quantity / w.multiplier, AvgPrice: w.pos.AvgPrice}
+}
+
+func (w *worker) Equity() float64 { return w.capital + w.pnl() }
+
+func (w *worker) PlaceOrder(req script.OrderRequest) error {
+	qty := int(math.Floor(req.Quantity*w.multiplier + 1e-9))
+	if qty <= 0 {
+		return fmt.Errorf("quantity %v x lot multiplier %v rounds to zero", req.Quantity, w.multiplier)
+	}
+	signed := float64(qty)
+	if req.Side == "SELL" {
+		signed = -signed
+	}
+	price := w.lastPrice()
+	if req.OrderType == "LIMIT" {
+		price = req.Price
+	}
+	projected := math.Abs(w.pos.Quantity+signed) * price
+	reduces := math.Abs(w.pos.Quantity+signed) < math.Abs(w.pos.Quantity)
+	if !reduces && projected > w.capital {
+		return fmt.Errorf("%w: %.2f > %.2f", ErrCapitalExceeded, projected, w.capital)
+	}
+
+	order := deploymentOrder(&w.dep, w.symbol, req.Side, qty, req.OrderType, req.Price)
+	order.IsExitOrder = req.IsExit
+	if w.sup.Slicer != nil {
+		// a sliced order fills over time; the position catches up with it
+		sliced, err := w.sup.Slicer.Slice(w.ctx, &w.dep, &order)
+		if err != nil {
+			return err
+		}
+		if sliced {
+			return w.refreshPosition()
+		}
+	}
+	if err := broker.Submit(w.ctx, w.sup.DB, w.sup.Brokers, &order); err != nil {
+		return err
+	}
+	return w.refreshPosition()
+}
+
+// PositionSize sizes against the deployment's equity and returns script
+// units, so the lot multiplier is not applied twice.
+func (w *worker) PositionSize(stop float64) (float64, error) {
+	svc := w.sup.Sizing
+	rule, err := svc.Rule(w.dep.UserID, w.dep.StrategyID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return 0, fmt.Errorf("no position sizing rule for this strategy")
+		}
+		return 0, err
+	}
+	res, err := sizing.Size(sizing.FromRule(rule), sizing.Market{
+		Equity:  w.Equity(),
+		Entry:   w.lastPrice(),
+		Stop:    stop,
+		Bars:    w.bars,
+		LotSize: sizing.LotSize(exchangeOf(w.symbol), w.symbol),
+		Stats:   svc.StrategyStats(w.dep.UserID, w.dep.StrategyID),
+	})
+	if err != nil {
+		return 0, err
+	}
+	return float64(res.Quantity) / w.multiplier, nil
+}
+
+func (w *worker) CancelAll() error {
+	return cancelOpenOrders(w.ctx, w.sup.DB, w.sup.Brokers, w.dep.ID)
+}
+
+func (w *worker) Log(line int, msg string) {
+	log.Printf("runner: deployment %d line %d: %s", w.dep.ID, line, msg)
+}
+
+// exchangeOf returns the exchange prefix of "NSE:RELIANCE" style symbols.
+func exchangeOf(symbol string) string {
+	if i := strings.Index(symbol, ":"); i > 0 {
+		return symbol[:i]
+	}
+	return ""
+}
@@ -0,0 +1,103 @@
+package script
+
+// Expr is any expression node.
+type Expr interface {
+	pos() Pos
+}
+
+// Stmt is any statement node.
+type Stmt interface {
+	pos() Pos
+}
+
+type NumberLit struct {
+	P     Pos
+	Value float64
+}
+
+type StringLit struct {
+	P     Pos
+	Value string
+}
+
+type BoolLit struct {
+	P     Pos
+	Value bool
+}
+
+type Ident struct {
+	P    Pos
+	Name string
+}
+
+type UnaryExpr struct {
+	P  Pos
+	Op string
+	X  Expr
+}
+
+type BinaryExpr struct {
+	P    Pos
+	Op   string
+	L, R Expr
+}
+
+type CallExpr struct {
+	P    Pos
+	Name string
+	Args []Expr
+}
+
+// IndexExpr looks back into a series: close[1] is the previous bar's close.
+type IndexExpr struct {
+	P     Pos
+	X     Expr
+	Index Expr
+}
+
+// LetStmt declares a variable. Persistent (var) declarations keep their value
+// between bars and are only initialised on the first bar.
+type LetStmt struct {
+	P          Pos
+	Name       string
+	Value      Expr
+	Persistent bool
+}
+
+type AssignStmt struct {
+	P     Pos
+	Name  string
+	Value Expr
+}
+
+type IfStmt struct {
+	P    Pos
+	Cond Expr
+	Then []Stmt
+	Else []Stmt
+}
+
+type WhileStmt struct {
+	P    Pos
+	Cond Expr
+	Body []Stmt
+}
+
+type ExprStmt struct {
+	P Pos
+	X Expr
+}
+
+func (n *NumberLit) pos() Pos  { return n.P }
+func (n *StringLit) pos() Pos  { return n.P }
+func (n *BoolLit) pos() Pos    { return n.P }
+func (n *Ident) pos() Pos      { return n.P }
+func (n *UnaryExpr) pos() Pos  { return n.P }
+func (n *BinaryExpr) pos() Pos { return n.P }
+func (n *CallExpr) pos() Pos   { return n.P }
+func (n *IndexExpr) pos() Pos  { return n.P }
+func (n *LetStmt) pos() Pos    { return n.P }
+func (n *AssignStmt) pos() Pos { return n.P }
+func (n *IfStmt) pos() Pos     { return n.P }
+func (n *WhileStmt) pos() Pos  { return n.P }
+func (n *ExprStmt) pos() Pos   { return n.P }
@@ -0,0 +1,333 @@
+package script
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"go-backend/indicators"
+)
+
+// seriesVars are the read-only names every script can see.
+var seriesVars = map[string]func(r *run) Value{
+	"open":      func(r *run) Value { return r.column("open") },
+	"high":      func(r *run) Value { return r.column("high") },
+	"low":       func(r *run) Value { return r.column("low") },
+	"close":     func(r *run) Value { return r.column("close") },
+	"volume":    func(r *run) Value { return r.column("volume") },
+	"bar_index": func(r *run) Value { return float64(len(r.bars) - 1) },
+	"hour":      func(r *run) Value { return float64(r.bars[len(r.bars)-1].Time.Hour()) },
+	"minute":    func(r *run) Value { return float64(r.bars[len(r.bars)-1].Time.Minute()) },
+	"weekday":   func(r *run) Value { return float64(r.bars[len(r.bars)-1].Time.Weekday()) },
+}
+
+func (r *run) column(name string) Series {
+	if s, ok := r.series[name]; ok {
+		return s
+	}
+	s := make(Series, len(r.bars))
+	for i, b := range r.bars {
+		switch name {
+		case "open":
+			s[i] = b.Open
+		case "high":
+			s[i] = b.High
+		case "low":
+			s[i] = b.Low
+		case "close":
+			s[i] = b.Close
+		case "volume":
+			s[i] = b.Volume
+		}
+	}
+	r.series[name] = s
+	return s
+}
+
+type builtin struct {
+	minArgs, maxArgs int // maxArgs < 0 means variadic
+	fn               func(r *run, p Pos, args []Value) (Value, error)
+}
+
+var builtins = map[string]builtin{
+	"sma":     seriesFn(indicators.SMA),
+	"ema":     seriesFn(indicators.EMA),
+	"rsi":     seriesFn(indicators.RSI),
+	"stdev":   seriesFn(indicators.StdDev),
+	"highest": seriesFn(indicators.Highest),
+	"lowest":  seriesFn(indicators.Lowest),
+	"macd":    {3, 3, builtinMACD},
+	"atr":     {1, 1, builtinATR},
+
+	"crossover":  {2, 2, crossFn(true)},
+	"crossunder": {2, 2, crossFn(false)},
+
+	"abs":   mathFn(math.Abs),
+	"sqrt":  mathFn(math.Sqrt),
+	"min":   {2, -1, builtinMinMax(math.Min)},
+	"max":   {2, -1, builtinMinMax(math.Max)},
+	"round": {1, 2, builtinRound},
+	"na":    {1, 1, builtinNA},
+	"nz":    {1, 2, builtinNZ},
+
+	"position":  {0, 0, func(r *run, p Pos, _ []Value) (Value, error) { return r.host.Position().Quantity, nil }},
+	"avg_price": {0, 0, func(r *run, p Pos, _ []Value) (Value, error) { return r.host.Position().AvgPrice, nil }},
+	"equity":    {0, 0, func(r *run, p Pos, _ []Value) (Value, error) { return r.host.Equity(), nil }},
+	"size":      {0, 1, builtinSize},
+
+	"buy":        {1, 2, orderFn("BUY")},
+	"sell":       {1, 2, orderFn("SELL")},
+	"exit":       {0, 0, builtinExit},
+	"cancel_all": {0, 0, builtinCancelAll},
+	"log":        {1, -1, builtinLog},
+}
+
+func numArg(p Pos, fn string, v Value) (float64, error) {
+	f, ok := scalar(v)
+	if !ok {
+		return 0, errorf(p, "%s: expected a number, got %s", fn, typeName(v))
+	}
+	return f, nil
+}
+
+func seriesArg(p Pos, fn string, v Value) (Series, error) {
+	switch v := v.(type) {
+	case Series:
+		return v, nil
+	case float64:
+		return Series{v}, nil
+	}
+	return nil, errorf(p, "%s: expected a series, got %s", fn, typeName(v))
+}
+
+// maxPeriod bounds indicator periods, well beyond any lookback a host
+// keeps, so a period can neither overflow int nor the cost charged for it.
+const maxPeriod = 100000
+
+func periodArg(p Pos, fn string, v Value) (int, error) {
+	f, err := numArg(p, fn, v)
+	if err != nil {
+		return 0, err
+	}
+	if f < 1 || f != math.Trunc(f) {
+		return 0, errorf(p, "%s: period must be a positive whole number, got %v", fn, f)
+	}
+	if f > maxPeriod {
+		return 0, errorf(p, "%s: period must be at most %d, got %v", fn, maxPeriod, f)
+	}
+	return int(f), nil
+}
+
+func seriesFn(calc func([]float64, int) []float64) builtin {
+	return builtin{2, 2, func(r *run, p Pos, args []Value) (Value, error) {
+		src, err := seriesArg(p, "indicator", args[0])
+		if err != nil {
+			return nil, err
+		}
+		n, err := periodArg(p, "indicator", args[1])
+		if err != nil {
+			return nil, err
+		}
+		if err := r.tick(p, len(src)*min(n, len(src))/8+len(src)); err != nil {
+			return nil, err
+		}
+		return Series(calc(src, n)), nil
+	}}
+}
+
+func builtinMACD(r *run, p Pos, args []Value) (Value, error) {
+	src, err := seriesArg(p, "macd", args[0])
+	if err != nil {
+		return nil, err
+	}
+	fast, err := periodArg(p, "macd", args[1])
+	if err != nil {
+		return nil, err
+	}
+	slow, err := periodArg(p, "macd", args[2])
+	if err != nil {
+		return nil, err
+	}
+	if err := r.tick(p, 2*len(src)); err != nil {
+		return nil, err
+	}
+	return Series(indicators.MACD(src, fast, slow)), nil
+}
+
+func builtinATR(r *run, p Pos, args []Value) (Value, error) {
+	n, err := periodArg(p, "atr", args[0])
+	if err != nil {
+		return nil, err
+	}
+	if err := r.tick(p, len(r.bars)); err != nil {
+		return nil, err
+	}
+	return Series(indicators.ATR(r.column("high"), r.column("low"), r.column("close"), n)), nil
+}
+
+func crossFn(over bool) func(r *run, p Pos, args []Value) (Value, error) {
+	return func(r *run, p Pos, args []Value) (Value, error) {
+		a, err := seriesArg(p, "cross", args[0])
+		if err != nil {
+			return nil, err
+		}
+		b, err := seriesArg(p, "cross", args[1])
+		if err != nil {
+			return nil, err
+		}
+		prev := func(s Series) float64 {
+			if len(s) == 1 {
+				return s[0]
+			}
+			return s.ago(1)
+		}
+		a0, a1, b0, b1 := a.last(), prev(a), b.last(), prev(b)
+		if over {
+			return a0 > b0 && a1 <= b1, nil
+		}
+		return a0 < b0 && a1 >= b1, nil
+	}
+}
+
+func mathFn(f func(float64) float64) builtin {
+	return builtin{1, 1, func(r *run, p Pos, args []Value) (Value, error) {
+		x, err := numArg(p, "math", args[0])
+		if err != nil {
+			return nil, err
+		}
+		return f(x), nil
+	}}
+}
+
+func builtinMinMax(pick func(a, b float64) float64) func(r *run, p Pos, args []Value) (Value, error) {
+	return func(r *run, p Pos, args []Value) (Value, error) {
+		out, err := numArg(p, "min/max", args[0])
+		if err != nil {
+			return nil, err
+		}
+		for _, a := range args[1:] {
+			x, err := numArg(p, "min/max", a)
+			if err != nil {
+				return nil, err
+			}
+			out = pick(out, x)
+		}
+		return out, nil
+	}
+}
+
+func builtinRound(r *run, p Pos, args []Value) (Value, error) {
+	x, err := numArg(p, "round", args[0])
+	if err != nil {
+		return nil, err
+	}
+	digits := 0.0
+	if len(args) == 2 {
+		if digits, err = numArg(p, "round", args[1]); err != nil {
+			return nil, err
+		}
+	}
+	scale := math.Pow(10, digits)
+	return math.Round(x*scale) / scale, nil
+}
+
+func builtinNA(r *run, p Pos, args []Value) (Value, error) {
+	x, err := numArg(p, "na", args[0])
+	if err != nil {
+		return nil, err
+	}
+	return math.IsNaN(x), nil
+}
+
+func builtinNZ(r *run, p Pos, args []Value) (Value, error) {
+	x, err := numArg(p, "nz", args[0])
+	if err != nil {
+		return nil, err
+	}
+	if !math.IsNaN(x) {
+		return x, nil
+	}
+	if len(args) == 2 {
+		return numArg(p, "nz", args[1])
+	}
+	return 0.0, nil
+}
+
+func (r *run) placeOrder(p Pos, req OrderRequest) error {
+	r.orders++
+	if r.limits.MaxOrders > 0 && r.orders > r.limits.MaxOrders {
+		return errorf(p, "more than %d orders placed on one bar", r.limits.MaxOrders)
+	}
+	req.Line = p.Line
+	if err := r.host.PlaceOrder(req); err != nil {
+		return runtimeErr(p, err)
+	}
+	return nil
+}
+
+func orderFn(side string) func(r *run, p Pos, args []Value) (Value, error) {
+	fn := strings.ToLower(side)
+	return func(r *run, p Pos, args []Value) (Value, error) {
+		qty, err := numArg(p, fn, args[0])
+		if err != nil {
+			return nil, err
+		}
+		if !(qty > 0) {
+			return nil, errorf(p, "%s: quantity must be positive, got %v", fn, qty)
+		}
+		req := OrderRequest{Side: side, Quantity: qty, OrderType: "MARKET"}
+		if len(args) == 2 {
+			price, err := numArg(p, fn, args[1])
+			if err != nil {
+				return nil, err
+			}
+			req.OrderType, req.Price = "LIMIT", price
+		}
+		return true, r.placeOrder(p, req)
+	}
+}
+
+// size([stop]) returns the quantity the position sizing rule allows for an
+// entry at the current close.
+func builtinSize(r *run, p Pos, args []Value) (Value, error) {
+	stop := 0.0
+	if len(args) == 1 {
+		var err error
+		if stop, err = numArg(p, "size", args[0]); err != nil {
+			return nil, err
+		}
+	}
+	qty, err := r.host.PositionSize(stop)
+	if err != nil {
+		return nil, runtimeErr(p, err)
+	}
+	return qty, nil
+}
+
+func builtinExit(r *run, p Pos, _ []Value) (Value, error) {
+	pos := r.host.Position()
+	if pos.Quantity == 0 {
+		return false, nil
+	}
+	req := OrderRequest{Side: "SELL", Quantity: pos.Quantity, OrderType: "MARKET", IsExit: true}
+	if pos.Quantity < 0 {
+		req.Side, req.Quantity = "BUY", -pos.Quantity
+	}
+	return true, r.placeOrder(p, req)
+}
+
+func builtinCancelAll(r *run, p Pos, _ []Value) (Value, error) {
+	if err := r.host.CancelAll(); err != nil {
+		return nil, runtimeErr(p, err)
+	}
+	return true, nil
+}
+
+func builtinLog(r *run, p Pos, args []Value) (Value, error) {
+	parts := make([]string, len(args))
+	for i, a := range args {
+		parts[i] = fmt.Sprint(display(a))
+	}
+	r.host.Log(p.Line, strings.Join(parts, " "))
+	return true, nil
+}
@@ -0,0 +1,136 @@
+package script
+
+import "strconv"
+
+// checker resolves names and call arity before a script is ever run, so
+// typos are reported on save rather than in the middle of a trading session.
+type checker struct {
+	scopes []map[string]bool
+	errs   ErrorList
+}
+
+func check(stmts []Stmt) ErrorList {
+	c := &checker{scopes: []map[string]bool{{}}}
+	c.stmts(stmts)
+	return c.errs
+}
+
+func (c *checker) report(p Pos, format string, args ...interface{}) {
+	c.errs = append(c.errs, errorf(p, format, args...))
+}
+
+func (c *checker) declared(name string) bool {
+	if _, ok := seriesVars[name]; ok {
+		return true
+	}
+	for i := len(c.scopes) - 1; i >= 0; i-- {
+		if c.scopes[i][name] {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *checker) stmts(stmts []Stmt) {
+	for _, s := range stmts {
+		c.stmt(s)
+	}
+}
+
+func (c *checker) block(stmts []Stmt) {
+	c.scopes = append(c.scopes, map[string]bool{})
+	c.stmts(stmts)
+	c.scopes = c.scopes[:len(c.scopes)-1]
+}
+
+func (c *checker) stmt(s Stmt) {
+	switch s := s.(type) {
+	case *LetStmt:
+		c.expr(s.Value)
+		scope := c.scopes[len(c.scopes)-1]
+		switch {
+		case s.Persistent && len(c.scopes) > 1:
+			c.report(s.P, "var %q must be declared at the top level", s.Name)
+		case isReserved(s.Name):
+			c.report(s.P, "%q is a built-in name and cannot be redeclared", s.Name)
+		case scope[s.Name]:
+			c.report(s.P, "%q is already declared in this scope", s.Name)
+		}
+		scope[s.Name] = true
+	case *AssignStmt:
+		c.expr(s.Value)
+		switch {
+		case isReserved(s.Name):
+			c.report(s.P, "cannot assign to built-in %q", s.Name)
+		case !c.declared(s.Name):
+			c.report(s.P, "assignment to undeclared variable %q (use let or var)", s.Name)
+		}
+	case *IfStmt:
+		c.expr(s.Cond)
+		c.block(s.Then)
+		c.block(s.Else)
+	case *WhileStmt:
+		c.expr(s.Cond)
+		c.block(s.Body)
+	case *ExprStmt:
+		if _, ok := s.X.(*CallExpr); !ok {
+			c.report(s.P, "expression result is not used")
+		}
+		c.expr(s.X)
+	}
+}
+
+func (c *checker) expr(e Expr) {
+	switch e := e.(type) {
+	case *Ident:
+		if !c.declared(e.Name) {
+			if _, ok := builtins[e.Name]; ok {
+				c.report(e.P, "%q is a function; call it as %s(...)", e.Name, e.Name)
+			} else {
+				c.report(e.P, "undefined name %q", e.Name)
+			}
+		}
+	case *UnaryExpr:
+		c.expr(e.X)
+	case *BinaryExpr:
+		c.expr(e.L)
+		c.expr(e.R)
+	case *IndexExpr:
+		c.expr(e.X)
+		c.expr(e.Index)
+	case *CallExpr:
+		b, ok := builtins[e.Name]
+		switch {
+		case !ok:
+			c.report(e.P, "unknown function %q", e.Name)
+		case len(e.Args) < b.minArgs || b.maxArgs >= 0 && len(e.Args) > b.maxArgs:
+			c.report(e.P, "%s expects %s, got %d", e.Name, arity(b), len(e.Args))
+		}
+		for _, a := range e.Args {
+			c.expr(a)
+		}
+	}
+}
+
+func isReserved(name string) bool {
+	_, isVar := seriesVars[name]
+	_, isFn := builtins[name]
+	return isVar || isFn
+}
+
+func arity(b builtin) string {
+	plural := func(n int) string {
+		if n == 1 {
+			return "1 argument"
+		}
+		return strconv.Itoa(n) + " arguments"
+	}
+	switch {
+	case b.maxArgs < 0:
+		return "at least " + plural(b.minArgs)
+	case b.minArgs == b.maxArgs:
+		return plural(b.minArgs)
+	default:
+		return strconv.Itoa(b.minArgs) + " to " + plural(b.maxArgs)
+	}
+}
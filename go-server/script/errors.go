@@ -0,0 +1,46 @@
+package script
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	// ErrStepLimit is returned when a script exceeds its instruction budget.
+	ErrStepLimit = errors.New("script exceeded its step limit")
+	// ErrTimeout is returned when a script runs past its wall-clock budget.
+	ErrTimeout = errors.New("script exceeded its time limit")
+	// ErrStringLimit is returned when a script builds an over-long string.
+	ErrStringLimit = errors.New("script exceeded its string length limit")
+)
+
+// Error is a compile or runtime error tied to a position in the source.
+type Error struct {
+	Line    int    `json:"line"`
+	Column  int    `json:"column"`
+	Message string `json:"message"`
+	Err     error  `json:"-"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("line %d:%d: %s", e.Line, e.Column, e.Message)
+}
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// ErrorList collects every problem found while compiling a script so the
+// editor can show them all at once.
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	msgs := make([]string, len(l))
+	for i, e := range l {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func errorf(p Pos, format string, args ...interface{}) *Error {
+	return &Error{Line: p.Line, Column: p.Col, Message: fmt.Sprintf(format, args...)}
+}
@@ -0,0 +1,419 @@
+package script
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+)
+
+// Value is a runtime value: float64, bool, string or Series.
+type Value interface{}
+
+// Series is a bar-aligned sequence of values, oldest first. In arithmetic a
+// series combines element-wise; in comparisons its latest value is used.
+type Series []float64
+
+func (s Series) last() float64 {
+	if len(s) == 0 {
+		return math.NaN()
+	}
+	return s[len(s)-1]
+}
+
+func (s Series) ago(n int) float64 {
+	if n < 0 || n >= len(s) {
+		return math.NaN()
+	}
+	return s[len(s)-1-n]
+}
+
+type run struct {
+	ctx      context.Context
+	host     Host
+	bars     []Bar
+	limits   Limits
+	deadline time.Time
+	scopes   []map[string]Value
+	series   map[string]Series
+	steps    int
+	orders   int
+}
+
+func runtimeErr(p Pos, err error) *Error {
+	return &Error{Line: p.Line, Column: p.Col, Message: err.Error(), Err: err}
+}
+
+// tick charges cost steps against the budget and periodically checks the
+// wall clock and the caller's context.
+func (r *run) tick(p Pos, cost int) error {
+	before := r.steps
+	r.steps += cost
+	if r.limits.MaxSteps > 0 && r.steps > r.limits.MaxSteps {
+		return runtimeErr(p, ErrStepLimit)
+	}
+	if r.steps/256 != before/256 {
+		if r.limits.Timeout > 0 && time.Now().After(r.deadline) {
+			return runtimeErr(p, ErrTimeout)
+		}
+		if err := r.ctx.Err(); err != nil {
+			return runtimeErr(p, err)
+		}
+	}
+	return nil
+}
+
+func (r *run) lookup(name string) (Value, bool) {
+	for i := len(r.scopes) - 1; i >= 0; i-- {
+		if v, ok := r.scopes[i][name]; ok {
+			return v, true
+		}
+	}
+	if f, ok := seriesVars[name]; ok {
+		return f(r), true
+	}
+	return nil, false
+}
+
+func (r *run) stmts(stmts []Stmt) error {
+	for _, s := range stmts {
+		if err := r.stmt(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *run) block(stmts []Stmt) error {
+	r.scopes = append(r.scopes, map[string]Value{})
+	err := r.stmts(stmts)
+	r.scopes = r.scopes[:len(r.scopes)-1]
+	return err
+}
+
+func (r *run) stmt(s Stmt) error {
+	if err := r.tick(s.pos(), 1); err != nil {
+		return err
+	}
+	switch s := s.(type) {
+	case *LetStmt:
+		if s.Persistent {
+			if _, ok := r.scopes[0][s.Name]; ok {
+				return nil
+			}
+			v, err := r.eval(s.Value)
+			if err != nil {
+				return err
+			}
+			r.scopes[0][s.Name] = v
+			return nil
+		}
+		v, err := r.eval(s.Value)
+		if err != nil {
+			return err
+		}
+		r.scopes[len(r.scopes)-1][s.Name] = v
+	case *AssignStmt:
+		v, err := r.eval(s.Value)
+		if err != nil {
+			return err
+		}
+		for i := len(r.scopes) - 1; i >= 0; i-- {
+			if _, ok := r.scopes[i][s.Name]; ok {
+				r.scopes[i][s.Name] = v
+				return nil
+			}
+		}
+		return errorf(s.P, "assignment to undeclared variable %q", s.Name)
+	case *IfStmt:
+		ok, err := r.cond(s.Cond)
+		if err != nil {
+			return err
+		}
+		if ok {
+			return r.block(s.Then)
+		}
+		return r.block(s.Else)
+	case *WhileStmt:
+		for {
+			ok, err := r.cond(s.Cond)
+			if err != nil || !ok {
+				return err
+			}
+			if err := r.block(s.Body); err != nil {
+				return err
+			}
+		}
+	case *ExprStmt:
+		_, err := r.eval(s.X)
+		return err
+	}
+	return nil
+}
+
+func (r *run) cond(e Expr) (bool, error) {
+	v, err := r.eval(e)
+	if err != nil {
+		return false, err
+	}
+	return truthy(e.pos(), v)
+}
+
+func truthy(p Pos, v Value) (bool, error) {
+	switch v := v.(type) {
+	case bool:
+		return v, nil
+	case float64:
+		return v != 0 && !math.IsNaN(v), nil
+	case Series:
+		l := v.last()
+		return l != 0 && !math.IsNaN(l), nil
+	}
+	return false, errorf(p, "%s cannot be used as a condition", typeName(v))
+}
+
+func typeName(v Value) string {
+	switch v.(type) {
+	case float64:
+		return "number"
+	case bool:
+		return "bool"
+	case string:
+		return "string"
+	case Series:
+		return "series"
+	}
+	return "nothing"
+}
+
+func (r *run) eval(e Expr) (Value, error) {
+	if err := r.tick(e.pos(), 1); err != nil {
+		return nil, err
+	}
+	switch e := e.(type) {
+	case *NumberLit:
+		return e.Value, nil
+	case *StringLit:
+		return e.Value, nil
+	case *BoolLit:
+		return e.Value, nil
+	case *Ident:
+		v, ok := r.lookup(e.Name)
+		if !ok {
+			return nil, errorf(e.P, "undefined name %q", e.Name)
+		}
+		return v, nil
+	case *UnaryExpr:
+		x, err := r.eval(e.X)
+		if err != nil {
+			return nil, err
+		}
+		if e.Op == "not" {
+			b, err := truthy(e.P, x)
+			return !b, err
+		}
+		if err := r.chargeSeries(e.P, x); err != nil {
+			return nil, err
+		}
+		return arith(e.P, "*", x, -1.0)
+	case *BinaryExpr:
+		return r.binary(e)
+	case *IndexExpr:
+		x, err := r.eval(e.X)
+		if err != nil {
+			return nil, err
+		}
+		idx, err := r.eval(e.Index)
+		if err != nil {
+			return nil, err
+		}
+		s, ok := x.(Series)
+		if !ok {
+			return nil, errorf(e.P, "cannot index %s; only series support [n]", typeName(x))
+		}
+		n, ok := idx.(float64)
+		if !ok {
+			return nil, errorf(e.P, "series index must be a number, got %s", typeName(idx))
+		}
+		return s.ago(int(n)), nil
+	case *CallExpr:
+		args := make([]Value, len(e.Args))
+		for i, a := range e.Args {
+			v, err := r.eval(a)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = v
+		}
+		return builtins[e.Name].fn(r, e.P, args)
+	}
+	return nil, errorf(e.pos(), "unsupported expression")
+}
+
+func (r *run) binary(e *BinaryExpr) (Value, error) {
+	l, err := r.eval(e.L)
+	if err != nil {
+		return nil, err
+	}
+	if e.Op == "and" || e.Op == "or" {
+		lb, err := truthy(e.L.pos(), l)
+		if err != nil {
+			return nil, err
+		}
+		if e.Op == "and" && !lb || e.Op == "or" && lb {
+			return lb, nil
+		}
+		rv, err := r.eval(e.R)
+		if err != nil {
+			return nil, err
+		}
+		return truthy(e.R.pos(), rv)
+	}
+	rv, err := r.eval(e.R)
+	if err != nil {
+		return nil, err
+	}
+	switch e.Op {
+	case "==", "!=", "<", "<=", ">", ">=":
+		return compare(e.P, e.Op, l, rv)
+	}
+	if err := r.chargeSeries(e.P, l, rv); err != nil {
+		return nil, err
+	}
+	if ls, ok := l.(string); ok && e.Op == "+" {
+		// Concatenation is the only way a string grows; doubling one in a
+		// loop must hit a limit before it exhausts memory.
+		if n := len(ls) + len(fmt.Sprint(display(rv))); r.limits.MaxString > 0 && n > r.limits.MaxString {
+			return nil, runtimeErr(e.P, ErrStringLimit)
+		} else if err := r.tick(e.P, n/16); err != nil {
+			return nil, err
+		}
+	}
+	return arith(e.P, e.Op, l, rv)
+}
+
+// chargeSeries charges element-wise work on any series operands.
+func (r *run) chargeSeries(p Pos, vals ...Value) error {
+	cost := 0
+	for _, v := range vals {
+		if s, ok := v.(Series); ok {
+			cost += len(s)
+		}
+	}
+	if cost == 0 {
+		return nil
+	}
+	return r.tick(p, cost)
+}
+
+func compare(p Pos, op string, l, r Value) (Value, error) {
+	if ls, ok := l.(string); ok {
+		rs, ok := r.(string)
+		if !ok || (op != "==" && op != "!=") {
+			return nil, errorf(p, "cannot compare %s %s %s", typeName(l), op, typeName(r))
+		}
+		return (ls == rs) == (op == "=="), nil
+	}
+	if lb, ok := l.(bool); ok {
+		rb, ok := r.(bool)
+		if !ok || (op != "==" && op != "!=") {
+			return nil, errorf(p, "cannot compare %s %s %s", typeName(l), op, typeName(r))
+		}
+		return (lb == rb) == (op == "=="), nil
+	}
+	a, aok := scalar(l)
+	b, bok := scalar(r)
+	if !aok || !bok {
+		return nil, errorf(p, "cannot compare %s %s %s", typeName(l), op, typeName(r))
+	}
+	switch op {
+	case "==":
+		return a == b, nil
+	case "!=":
+		return a != b, nil
+	case "<":
+		return a < b, nil
+	case "<=":
+		return a <= b, nil
+	case ">":
+		return a > b, nil
+	default:
+		return a >= b, nil
+	}
+}
+
+// scalar reduces numbers and series to a single number (a series' latest value).
+func scalar(v Value) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case Series:
+		return v.last(), true
+	}
+	return 0, false
+}
+
+func applyOp(op string, a, b float64) float64 {
+	switch op {
+	case "+":
+		return a + b
+	case "-":
+		return a - b
+	case "*":
+		return a * b
+	case "/":
+		if b == 0 {
+			return math.NaN()
+		}
+		return a / b
+	default:
+		if b == 0 {
+			return math.NaN()
+		}
+		return math.Mod(a, b)
+	}
+}
+
+func arith(p Pos, op string, l, r Value) (Value, error) {
+	ls, lSeries := l.(Series)
+	rs, rSeries := r.(Series)
+	lf, lNum := l.(float64)
+	rf, rNum := r.(float64)
+	switch {
+	case lNum && rNum:
+		return applyOp(op, lf, rf), nil
+	case lSeries && rNum:
+		out := make(Series, len(ls))
+		for i, v := range ls {
+			out[i] = applyOp(op, v, rf)
+		}
+		return out, nil
+	case lNum && rSeries:
+		out := make(Series, len(rs))
+		for i, v := range rs {
+			out[i] = applyOp(op, lf, v)
+		}
+		return out, nil
+	case lSeries && rSeries:
+		n := len(ls)
+		if len(rs) < n {
+			n = len(rs)
+		}
+		out := make(Series, n)
+		for i := 0; i < n; i++ {
+			out[n-1-i] = applyOp(op, ls.ago(i), rs.ago(i))
+		}
+		return out, nil
+	}
+	if ls, ok := l.(string); ok && op == "+" {
+		return ls + fmt.Sprint(display(r)), nil
+	}
+	return nil, errorf(p, "cannot apply %q to %s and %s", op, typeName(l), typeName(r))
+}
+
+func display(v Value) interface{} {
+	if s, ok := v.(Series); ok {
+		return s.last()
+	}
+	return v
+}
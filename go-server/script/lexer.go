@@ -0,0 +1,124 @@
+package script
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Pos is a 1-based line/column position in the script source.
+type Pos struct {
+	Line int
+	Col  int
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokNumber
+	tokString
+	tokOp
+	tokKeyword
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	num  float64
+	pos  Pos
+}
+
+var keywords = map[string]bool{
+	"let": true, "var": true, "if": true, "else": true, "while": true,
+	"and": true, "or": true, "not": true, "true": true, "false": true,
+}
+
+// Two-character operators must be listed before their one-character prefixes.
+var operators = []string{
+	"==", "!=", "<=", ">=", "&&", "||",
+	"+", "-", "*", "/", "%", "<", ">", "=", "!", "(", ")", "[", "]", "{", "}", ",", ";",
+}
+
+func lex(src string) ([]token, *Error) {
+	var toks []token
+	line, col := 1, 1
+	i := 0
+	advance := func(n int) {
+		for k := 0; k < n; k++ {
+			if src[i] == '\n' {
+				line++
+				col = 1
+			} else {
+				col++
+			}
+			i++
+		}
+	}
+
+	for i < len(src) {
+		c := src[i]
+		switch {
+		case c == '\n' || c == ' ' || c == '\t' || c == '\r':
+			advance(1)
+		case c == '#' || strings.HasPrefix(src[i:], "//"):
+			for i < len(src) && src[i] != '\n' {
+				advance(1)
+			}
+		case c >= '0' && c <= '9' || c == '.' && i+1 < len(src) && src[i+1] >= '0' && src[i+1] <= '9':
+			start, pos := i, Pos{line, col}
+			for i < len(src) && (src[i] >= '0' && src[i] <= '9' || src[i] == '.') {
+				advance(1)
+			}
+			n, err := strconv.ParseFloat(src[start:i], 64)
+			if err != nil {
+				return nil, errorf(pos, "invalid number %q", src[start:i])
+			}
+			toks = append(toks, token{kind: tokNumber, text: src[start:i], num: n, pos: pos})
+		case c == '_' || unicode.IsLetter(rune(c)):
+			start, pos := i, Pos{line, col}
+			for i < len(src) && (src[i] == '_' || unicode.IsLetter(rune(src[i])) || unicode.IsDigit(rune(src[i]))) {
+				advance(1)
+			}
+			word := src[start:i]
+			kind := tokIdent
+			if keywords[word] {
+				kind = tokKeyword
+			}
+			toks = append(toks, token{kind: kind, text: word, pos: pos})
+		case c == '"' || c == '\'':
+			pos := Pos{line, col}
+			advance(1)
+			var sb strings.Builder
+			for i < len(src) && src[i] != c {
+				if src[i] == '\n' {
+					return nil, errorf(pos, "unterminated string")
+				}
+				sb.WriteByte(src[i])
+				advance(1)
+			}
+			if i >= len(src) {
+				return nil, errorf(pos, "unterminated string")
+			}
+			advance(1)
+			toks = append(toks, token{kind: tokString, text: sb.String(), pos: pos})
+		default:
+			pos := Pos{line, col}
+			matched := ""
+			for _, op := range operators {
+				if strings.HasPrefix(src[i:], op) {
+					matched = op
+					break
+				}
+			}
+			if matched == "" {
+				return nil, errorf(pos, "unexpected character %q", c)
+			}
+			advance(len(matched))
+			toks = append(toks, token{kind: tokOp, text: matched, pos: pos})
+		}
+	}
+	toks = append(toks, token{kind: tokEOF, pos: Pos{line, col}})
+	return toks, nil
+}
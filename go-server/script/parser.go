@@ -0,0 +1,365 @@
+package script
+
+type parser struct {
+	toks  []token
+	i     int
+	depth int
+}
+
+// maxNesting bounds how deeply brackets, blocks and unary operators nest,
+// so a hostile script cannot exhaust the stack of the parser, the checker
+// or the interpreter, which all recurse over the tree.
+const maxNesting = 100
+
+// enter descends one nesting level; callers defer p.leave().
+func (p *parser) enter() *Error {
+	p.depth++
+	if p.depth > maxNesting {
+		return errorf(p.peek().pos, "nesting is deeper than %d levels", maxNesting)
+	}
+	return nil
+}
+
+func (p *parser) leave() { p.depth-- }
+
+// parse turns source into a statement list. It stops at the first syntax
+// error; semantic checks in check.go report everything else in one pass.
+func parse(src string) ([]Stmt, *Error) {
+	toks, lerr := lex(src)
+	if lerr != nil {
+		return nil, lerr
+	}
+	p := &parser{toks: toks}
+	var stmts []Stmt
+	for p.peek().kind != tokEOF {
+		s, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, s)
+	}
+	return stmts, nil
+}
+
+func (p *parser) peek() token { return p.toks[p.i] }
+
+func (p *parser) next() token {
+	t := p.toks[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) is(kind tokenKind, text string) bool {
+	t := p.peek()
+	return t.kind == kind && t.text == text
+}
+
+func (p *parser) accept(kind tokenKind, text string) bool {
+	if p.is(kind, text) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(kind tokenKind, text string) (token, *Error) {
+	t := p.peek()
+	if t.kind != kind || t.text != text {
+		return t, errorf(t.pos, "expected %q, found %s", text, describe(t))
+	}
+	return p.next(), nil
+}
+
+func describe(t token) string {
+	switch t.kind {
+	case tokEOF:
+		return "end of script"
+	case tokString:
+		return "string"
+	default:
+		return "\"" + t.text + "\""
+	}
+}
+
+func (p *parser) statement() (Stmt, *Error) {
+	t := p.peek()
+	var s Stmt
+	var err *Error
+	switch {
+	case t.kind == tokKeyword && (t.text == "let" || t.text == "var"):
+		s, err = p.letStmt()
+	case t.kind == tokKeyword && t.text == "if":
+		s, err = p.ifStmt()
+	case t.kind == tokKeyword && t.text == "while":
+		s, err = p.whileStmt()
+	case t.kind == tokIdent && p.toks[p.i+1].kind == tokOp && p.toks[p.i+1].text == "=":
+		p.next()
+		p.next()
+		var v Expr
+		v, err = p.expr()
+		s = &AssignStmt{P: t.pos, Name: t.text, Value: v}
+	default:
+		var x Expr
+		x, err = p.expr()
+		s = &ExprStmt{P: t.pos, X: x}
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.accept(tokOp, ";")
+	return s, nil
+}
+
+func (p *parser) letStmt() (Stmt, *Error) {
+	kw := p.next()
+	name := p.next()
+	if name.kind != tokIdent {
+		return nil, errorf(name.pos, "expected variable name after %q, found %s", kw.text, describe(name))
+	}
+	if _, err := p.expect(tokOp, "="); err != nil {
+		return nil, err
+	}
+	v, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	return &LetStmt{P: kw.pos, Name: name.text, Value: v, Persistent: kw.text == "var"}, nil
+}
+
+func (p *parser) block() ([]Stmt, *Error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+	if _, err := p.expect(tokOp, "{"); err != nil {
+		return nil, err
+	}
+	var stmts []Stmt
+	for !p.is(tokOp, "}") {
+		if p.peek().kind == tokEOF {
+			return nil, errorf(p.peek().pos, "missing closing \"}\"")
+		}
+		s, err := p.statement()
+		if err != nil {
+			return nil, err
+		}
+		stmts = append(stmts, s)
+	}
+	p.next()
+	return stmts, nil
+}
+
+func (p *parser) ifStmt() (Stmt, *Error) {
+	kw := p.next()
+	cond, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	then, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	s := &IfStmt{P: kw.pos, Cond: cond, Then: then}
+	if p.accept(tokKeyword, "else") {
+		if p.is(tokKeyword, "if") {
+			// else-if chains nest in the tree like blocks do
+			if err := p.enter(); err != nil {
+				return nil, err
+			}
+			defer p.leave()
+			elif, err := p.ifStmt()
+			if err != nil {
+				return nil, err
+			}
+			s.Else = []Stmt{elif}
+		} else {
+			s.Else, err = p.block()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+	return s, nil
+}
+
+func (p *parser) whileStmt() (Stmt, *Error) {
+	kw := p.next()
+	cond, err := p.expr()
+	if err != nil {
+		return nil, err
+	}
+	body, err := p.block()
+	if err != nil {
+		return nil, err
+	}
+	return &WhileStmt{P: kw.pos, Cond: cond, Body: body}, nil
+}
+
+func (p *parser) expr() (Expr, *Error) {
+	if err := p.enter(); err != nil {
+		return nil, err
+	}
+	defer p.leave()
+	return p.or()
+}
+
+func (p *parser) or() (Expr, *Error) {
+	l, err := p.and()
+	for err == nil && (p.is(tokKeyword, "or") || p.is(tokOp, "||")) {
+		op := p.next()
+		var r Expr
+		r, err = p.and()
+		l = &BinaryExpr{P: op.pos, Op: "or", L: l, R: r}
+	}
+	return l, err
+}
+
+func (p *parser) and() (Expr, *Error) {
+	l, err := p.not()
+	for err == nil && (p.is(tokKeyword, "and") || p.is(tokOp, "&&")) {
+		op := p.next()
+		var r Expr
+		r, err = p.not()
+		l = &BinaryExpr{P: op.pos, Op: "and", L: l, R: r}
+	}
+	return l, err
+}
+
+func (p *parser) not() (Expr, *Error) {
+	if p.is(tokKeyword, "not") || p.is(tokOp, "!") {
+		if err := p.enter(); err != nil {
+			return nil, err
+		}
+		defer p.leave()
+		op := p.next()
+		x, err := p.not()
+		return &UnaryExpr{P: op.pos, Op: "not", X: x}, err
+	}
+	return p.comparison()
+}
+
+func (p *parser) comparison() (Expr, *Error) {
+	l, err := p.additive()
+	for err == nil && p.peek().kind == tokOp {
+		op := p.peek()
+		switch op.text {
+		case "==", "!=", "<", "<=", ">", ">=":
+		default:
+			return l, nil
+		}
+		p.next()
+		var r Expr
+		r, err = p.additive()
+		l = &BinaryExpr{P: op.pos, Op: op.text, L: l, R: r}
+	}
+	return l, err
+}
+
+func (p *parser) additive() (Expr, *Error) {
+	l, err := p.multiplicative()
+	for err == nil && (p.is(tokOp, "+") || p.is(tokOp, "-")) {
+		op := p.next()
+		var r Expr
+		r, err = p.multiplicative()
+		l = &BinaryExpr{P: op.pos, Op: op.text, L: l, R: r}
+	}
+	return l, err
+}
+
+func (p *parser) multiplicative() (Expr, *Error) {
+	l, err := p.unary()
+	for err == nil && (p.is(tokOp, "*") || p.is(tokOp, "/") || p.is(tokOp, "%")) {
+		op := p.next()
+		var r Expr
+		r, err = p.unary()
+		l = &BinaryExpr{P: op.pos, Op: op.text, L: l, R: r}
+	}
+	return l, err
+}
+
+func (p *parser) unary() (Expr, *Error) {
+	if p.is(tokOp, "-") {
+		if err := p.enter(); err != nil {
+			return nil, err
+		}
+		defer p.leave()
+		op := p.next()
+		x, err := p.unary()
+		return &UnaryExpr{P: op.pos, Op: "-", X: x}, err
+	}
+	return p.postfix()
+}
+
+// postfix handles calls and series lookback. Both must start on the same line
+// as the operand so that a new statement beginning with "(" is not swallowed.
+func (p *parser) postfix() (Expr, *Error) {
+	x, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		prev := p.toks[p.i-1].pos.Line
+		switch {
+		case p.is(tokOp, "[") && p.peek().pos.Line == prev:
+			open := p.next()
+			idx, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expect(tokOp, "]"); err != nil {
+				return nil, err
+			}
+			x = &IndexExpr{P: open.pos, X: x, Index: idx}
+		default:
+			return x, nil
+		}
+	}
+}
+
+func (p *parser) primary() (Expr, *Error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		return &NumberLit{P: t.pos, Value: t.num}, nil
+	case tokString:
+		return &StringLit{P: t.pos, Value: t.text}, nil
+	case tokKeyword:
+		if t.text == "true" || t.text == "false" {
+			return &BoolLit{P: t.pos, Value: t.text == "true"}, nil
+		}
+	case tokIdent:
+		if p.is(tokOp, "(") && p.peek().pos.Line == t.pos.Line {
+			p.next()
+			call := &CallExpr{P: t.pos, Name: t.text}
+			for !p.is(tokOp, ")") {
+				arg, err := p.expr()
+				if err != nil {
+					return nil, err
+				}
+				call.Args = append(call.Args, arg)
+				if !p.accept(tokOp, ",") {
+					break
+				}
+			}
+			if _, err := p.expect(tokOp, ")"); err != nil {
+				return nil, err
+			}
+			return call, nil
+		}
+		return &Ident{P: t.pos, Name: t.text}, nil
+	case tokOp:
+		if t.text == "(" {
+			x, err := p.expr()
+			if err != nil {
+				return nil, err
+			}
+			if _, err := p.expect(tokOp, ")"); err != nil {
+				return nil, err
+			}
+			return x, nil
+		}
+	}
+	return nil, errorf(t.pos, "unexpected %s", describe(t))
+}
@@ -0,0 +1,152 @@
+// Package script implements the sandboxed strategy language stored in
+// Strategy.Code. A script is compiled once and then evaluated on every new bar
+// against a Host, which is how the backtester, paper broker and live runner
+// all execute exactly the same logic.
+//
+// Example:
+//
+//	var trades = 0
+//	let fast = sma(close, 10)
+//	let slow = sma(close, 30)
+//	if crossover(fast, slow) and position() == 0 {
+//	    buy(1)
+//	    trades = trades + 1
+//	} else if crossunder(fast, slow) and position() > 0 {
+//	    exit()
+//	}
+package script
+
+import (
+	"context"
+	"time"
+)
+
+// Bar is a single OHLCV candle.
+type Bar struct {
+	Time   time.Time `json:"time"`
+	Open   float64   `json:"open"`
+	High   float64   `json:"high"`
+	Low    float64   `json:"low"`
+	Close  float64   `json:"close"`
+	Volume float64   `json:"volume"`
+}
+
+// Position is the script's current holding in its symbol. Quantity is
+// negative for a short position.
+type Position struct {
+	Quantity float64
+	AvgPrice float64
+}
+
+// OrderRequest is what buy/sell/exit hand to the host. Hosts decide how the
+// request becomes an order: a simulated fill, a paper order or a broker call.
+type OrderRequest struct {
+	Side      string  // BUY or SELL
+	Quantity  float64 // always positive
+	OrderType string  // MARKET or LIMIT
+	Price     float64 // limit price, zero for market orders
+	IsExit    bool
+	Line      int // source line that placed the order, for audit trails
+}
+
+// Host is the restricted API a running script may use. Scripts have no other
+// access to the process: no I/O, no network, no clock beyond the bar times.
+type Host interface {
+	Bars() []Bar
+	Position() Position
+	Equity() float64
+	PlaceOrder(OrderRequest) error
+	CancelAll() error
+	// PositionSize applies the strategy's position sizing rule to an entry
+	// at the current close with the given stop (0 for none).
+	PositionSize(stop float64) (float64, error)
+	Log(line int, msg string)
+}
+
+// Limits bounds the work a single OnBar call may do.
+type Limits struct {
+	MaxSteps  int           // evaluation steps, including indicator work
+	Timeout   time.Duration // wall-clock budget per bar
+	MaxOrders int           // orders a script may place on one bar
+	MaxBars   int           // lookback window passed to indicators
+	MaxString int           // length of any string a script builds
+}
+
+// DefaultLimits are used when a caller passes a zero Limits.
+var DefaultLimits = Limits{
+	MaxSteps:  500000,
+	Timeout:   250 * time.Millisecond,
+	MaxOrders: 10,
+	MaxBars:   500,
+	MaxString: 4096,
+}
+
+// Program is a compiled, validated script. It is immutable and safe to share.
+type Program struct {
+	Source string
+	stmts  []Stmt
+}
+
+// MaxSource is the longest script Compile accepts, in bytes. Every saved
+// version is kept and diffed, so the bound applies before anything is stored.
+const MaxSource = 64 << 10
+
+// Compile parses and checks src. On failure the error is an ErrorList with
+// line and column numbers for every problem found.
+func Compile(src string) (*Program, error) {
+	if len(src) > MaxSource {
+		return nil, ErrorList{errorf(Pos{Line: 1, Col: 1}, "script is longer than %d bytes", MaxSource)}
+	}
+	stmts, perr := parse(src)
+	if perr != nil {
+		return nil, ErrorList{perr}
+	}
+	if errs := check(stmts); len(errs) > 0 {
+		return nil, errs
+	}
+	return &Program{Source: src, stmts: stmts}, nil
+}
+
+// Validate is a convenience for handlers that only need the error list.
+func Validate(src string) ErrorList {
+	if _, err := Compile(src); err != nil {
+		return err.(ErrorList)
+	}
+	return nil
+}
+
+// Instance holds the per-deployment state of a program, i.e. the values of
+// its var declarations between bars.
+type Instance struct {
+	prog  *Program
+	state map[string]Value
+}
+
+// NewInstance returns fresh state for running p.
+func (p *Program) NewInstance() *Instance {
+	return &Instance{prog: p, state: map[string]Value{}}
+}
+
+// OnBar evaluates the script once for the latest bar exposed by host.
+func (in *Instance) OnBar(ctx context.Context, host Host, lim Limits) error {
+	if lim == (Limits{}) {
+		lim = DefaultLimits
+	}
+	bars := host.Bars()
+	if lim.MaxBars > 0 && len(bars) > lim.MaxBars {
+		bars = bars[len(bars)-lim.MaxBars:]
+	}
+	if len(bars) == 0 {
+		return nil
+	}
+	r := &run{
+		ctx:      ctx,
+		host:     host,
+		bars:     bars,
+		limits:   lim,
+		deadline: time.Now().Add(lim.Timeout),
+		scopes:   []map[string]Value{in.state, {}},
+		series:   map[string]Series{},
+	}
+	return r.stmts(in.prog.stmts)
+}
@@ -0,0 +1,99 @@
+package sizing
+
+import (
+	"github.com/google/uuid"
+	"go-backend/marketfeed"
+	"go-backend/models"
+	"go-backend/script"
+	"gorm.io/gorm"
+)
+
+// Service resolves the inputs a calculation needs from the database: the
+// applicable rule, recent bars for the ATR and trade statistics for Kelly.
+type Service struct {
+	DB   *gorm.DB
+	Feed *marketfeed.Hub
+}
+
+func NewService(db *gorm.DB, feed *marketfeed.Hub) *Service {
+	return &Service{DB: db, Feed: feed}
+}
+
+// Rule returns the user's active rule for strategyID, preferring one bound
+// to the strategy over a catch-all. It returns gorm.ErrRecordNotFound when
+// neither exists.
+func (s *Service) Rule(userID, strategyID uuid.UUID) (*models.PositionSizingRule, error) {
+	var rule models.PositionSizingRule
+	q := s.DB.Where("user_id = ? AND is_active = ?", userID, true)
+	if strategyID != uuid.Nil {
+		q = q.Where("strategy_id = ? OR strategy_id IS NULL", strategyID).
+			Order("strategy_id IS NULL") // bound rules first
+	} else {
+		q = q.Where("strategy_id IS NULL")
+	}
+	if err := q.Order("id").First(&rule).Error; err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+// StrategyStats derives win rate and payoff from userID's latest completed
+// backtest of the strategy, or nil if there is none with trades.
+func (s *Service) StrategyStats(userID, strategyID uuid.UUID) *Stats {
+	var bt models.Backtest
+	err := s.DB.Where("user_id = ? AND strategy_id = ? AND status = ? AND trades > 0", userID, strategyID, "completed").
+		Order("created_at DESC").First(&bt).Error
+	if err != nil || bt.WinRate == nil || bt.ProfitFactor == nil {
+		return nil
+	}
+	w := *bt.WinRate / 100
+	if w <= 0 || w >= 1 {
+		return nil
+	}
+	// profit factor = w*avgWin / ((1-w)*avgLoss)
+	return &Stats{WinRate: w, Payoff: *bt.ProfitFactor * (1 - w) / w, Trades: bt.Trades}
+}
+
+// Bars returns enough recent bars for the rule's ATR.
+func (s *Service) Bars(p Params, symbol, timeframe string) ([]script.Bar, error) {
+	if p.Method != MethodVolatility {
+		return nil, nil
+	}
+	period := p.ATRPeriod
+	if period <= 0 {
+		period = DefaultATRPeriod
+	}
+	return marketfeed.Recent(s.DB, symbol, timeframe, period*3+1)
+}
+
+// LastPrice is the feed's last price for symbol, if any.
+func (s *Service) LastPrice(symbol string) (float64, bool) {
+	if s.Feed == nil {
+		return 0, false
+	}
+	return s.Feed.LastPrice(symbol)
+}
+
+// StatsFromPnL builds Kelly statistics from closed trade results.
+func StatsFromPnL(pnls []float64) *Stats {
+	var wins, losses int
+	var won, lost float64
+	for _, p := range pnls {
+		switch {
+		case p > 0:
+			wins++
+			won += p
+		case p < 0:
+			losses++
+			lost -= p
+		}
+	}
+	if wins == 0 || losses == 0 {
+		return nil
+	}
+	return &Stats{
+		WinRate: float64(wins) / float64(wins+losses),
+		Payoff:  (won / float64(wins)) / (lost / float64(losses)),
+		Trades:  wins + losses,
+	}
+}
@@ -0,0 +1,233 @@
+// Package sizing turns a PositionSizingRule, an entry and a stop into an order
+// quantity. The same calculation backs workflow actions, deployed strategies,
+// the backtester and the preview endpoint.
+package sizing
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"go-backend/indicators"
+	"go-backend/models"
+	"go-backend/script"
+)
+
+// Sizing methods. "fixed" is the frontend's name for percent-of-equity and
+// "risk-based" its name for fixed-fractional.
+const (
+	MethodFixedQuantity = "fixed-quantity"
+	MethodFixed         = "fixed"
+	MethodPercentEquity = "percent-equity"
+	MethodRiskBased     = "risk-based"
+	MethodVolatility    = "volatility"
+	MethodKelly         = "kelly"
+)
+
+// Defaults applied when a rule leaves a parameter at zero.
+const (
+	DefaultATRPeriod     = 14
+	DefaultATRMultiplier = 2.0
+	DefaultKellyFraction = 0.5 // half-Kelly
+)
+
+var ErrNoStop = errors.New("a stop price different from the entry is required")
+
+// Params are the rule settings that drive a calculation. Percentages are in
+// percent (1 = 1%).
+type Params struct {
+	Method          string  `json:"method"`
+	RiskPerTrade    float64 `json:"riskPerTrade"`
+	MaxPositionSize float64 `json:"maxPositionSize"` // cap on notional, % of equity; 0 = no cap
+	FixedQuantity   float64 `json:"fixedQuantity"`
+	ATRPeriod       int     `json:"atrPeriod"`
+	ATRMultiplier   float64 `json:"atrMultiplier"`
+	KellyFraction   float64 `json:"kellyFraction"`
+}
+
+// FromRule copies the sizing parameters out of a stored rule.
+func FromRule(r *models.PositionSizingRule) Params {
+	return Params{
+		Method:          r.Method,
+		RiskPerTrade:    r.RiskPerTrade,
+		MaxPositionSize: r.MaxPositionSize,
+		FixedQuantity:   r.FixedQuantity,
+		ATRPeriod:       r.ATRPeriod,
+		ATRMultiplier:   r.ATRMultiplier,
+		KellyFraction:   r.KellyFraction,
+	}
+}
+
+// Stats are the trade statistics the Kelly method needs.
+type Stats struct {
+	WinRate float64 `json:"winRate"` // 0..1
+	Payoff  float64 `json:"payoff"`  // average win / average loss
+	Trades  int     `json:"trades"`
+}
+
+// Market is the trade being sized.
+type Market struct {
+	Equity  float64
+	Entry   float64
+	Stop    float64      // optional for fixed-quantity, percent-of-equity and volatility
+	Bars    []script.Bar // for the ATR; ignored when ATR is set
+	ATR     float64
+	LotSize int
+	Stats   *Stats
+}
+
+// Result explains how a quantity was reached.
+type Result struct {
+	Method      string  `json:"method"`
+	Quantity    int     `json:"quantity"`
+	RawQuantity float64 `json:"rawQuantity"` // before the cap and lot rounding
+	LotSize     int     `json:"lotSize"`
+	Lots        int     `json:"lots"`
+	Notional    float64 `json:"notional"`
+	RiskAmount  float64 `json:"riskAmount"` // loss if the stop is hit; 0 without a stop
+	RiskPercent float64 `json:"riskPercent"`
+	ATR         float64 `json:"atr,omitempty"`
+	Kelly       float64 `json:"kelly,omitempty"` // fraction of equity after KellyFraction
+	CappedBy    string  `json:"cappedBy,omitempty"`
+}
+
+// Size computes the quantity for one entry. The result is always a whole
+// number of lots, rounded down.
+func Size(p Params, m Market) (*Result, error) {
+	if m.Entry <= 0 {
+		return nil, fmt.Errorf("entry price must be positive")
+	}
+	if m.Equity <= 0 && p.Method != MethodFixedQuantity {
+		return nil, fmt.Errorf("equity must be positive")
+	}
+	lot := m.LotSize
+	if lot < 1 {
+		lot = 1
+	}
+	res := &Result{Method: p.Method, LotSize: lot}
+	perUnitRisk := math.Abs(m.Entry - m.Stop)
+	if m.Stop <= 0 {
+		perUnitRisk = 0
+	}
+
+	switch p.Method {
+	case MethodFixedQuantity:
+		if p.FixedQuantity <= 0 {
+			return nil, fmt.Errorf("fixedQuantity must be positive")
+		}
+		res.RawQuantity = p.FixedQuantity
+	case MethodFixed, MethodPercentEquity:
+		res.RawQuantity = m.Equity * p.RiskPerTrade / 100 / m.Entry
+	case MethodRiskBased:
+		if perUnitRisk == 0 {
+			return nil, ErrNoStop
+		}
+		res.RawQuantity = m.Equity * p.RiskPerTrade / 100 / perUnitRisk
+	case MethodVolatility:
+		atr := m.ATR
+		if atr <= 0 {
+			period := p.ATRPeriod
+			if period <= 0 {
+				period = DefaultATRPeriod
+			}
+			atr = lastATR(m.Bars, period)
+		}
+		if !(atr > 0) {
+			return nil, fmt.Errorf("not enough bars to compute the ATR")
+		}
+		mult := p.ATRMultiplier
+		if mult <= 0 {
+			mult = DefaultATRMultiplier
+		}
+		res.ATR = atr
+		res.RawQuantity = m.Equity * p.RiskPerTrade / 100 / (atr * mult)
+		if perUnitRisk == 0 {
+			perUnitRisk = atr * mult // the volatility stop
+		}
+	case MethodKelly:
+		if m.Stats == nil || m.Stats.Trades == 0 || m.Stats.Payoff <= 0 {
+			return nil, fmt.Errorf("kelly sizing needs a win rate and payoff ratio")
+		}
+		frac := p.KellyFraction
+		if frac <= 0 {
+			frac = DefaultKellyFraction
+		}
+		k := (m.Stats.WinRate - (1-m.Stats.WinRate)/m.Stats.Payoff) * frac
+		if k <= 0 {
+			return nil, fmt.Errorf("kelly fraction is %.3f: the strategy has no edge", k)
+		}
+		res.Kelly = k
+		res.RawQuantity = m.Equity * k / m.Entry
+	default:
+		return nil, fmt.Errorf("unknown sizing method %q", p.Method)
+	}
+
+	qty := res.RawQuantity
+	if p.MaxPositionSize > 0 && m.Equity > 0 {
+		if max := m.Equity * p.MaxPositionSize / 100 / m.Entry; qty > max {
+			qty = max
+			res.CappedBy = "maxPositionSize"
+		}
+	}
+	res.Lots = int(math.Floor(qty/float64(lot) + 1e-9))
+	res.Quantity = res.Lots * lot
+	res.Notional = float64(res.Quantity) * m.Entry
+	res.RiskAmount = float64(res.Quantity) * perUnitRisk
+	if m.Equity > 0 {
+		res.RiskPercent = res.RiskAmount / m.Equity * 100
+	}
+	return res, nil
+}
+
+func lastATR(bars []script.Bar, period int) float64 {
+	if len(bars) <= period {
+		return math.NaN()
+	}
+	high := make([]float64, len(bars))
+	low := make([]float64, len(bars))
+	closes := make([]float64, len(bars))
+	for i, b := range bars {
+		high[i], low[i], closes[i] = b.High, b.Low, b.Close
+	}
+	atr := indicators.ATR(high, low, closes, period)
+	return atr[len(atr)-1]
+}
+
+// lotSizes are exchange lot sizes for derivatives underlyings. Cash segments
+// trade in single shares.
+var lotSizes = map[string]map[string]int{
+	"NFO": {"NIFTY": 75, "BANKNIFTY": 35, "FINNIFTY": 65, "MIDCPNIFTY": 140, "NIFTYNXT50": 25},
+	"BFO": {"SENSEX": 20, "BANKEX": 30},
+	"MCX": {"CRUDEOIL": 100, "CRUDEOILM": 10, "NATURALGAS": 1250, "GOLD": 1, "GOLDM": 1, "SILVER": 1, "SILVERM": 1},
+	"CDS": {"USDINR": 1000, "EURINR": 1000, "GBPINR": 1000, "JPYINR": 1000},
+}
+
+// LotSizeFunc resolves the lot size of an instrument. It is a variable so a
+// richer instrument source can replace the built-in table.
+var LotSizeFunc = builtinLotSize
+
+// LotSize returns the tradable lot of instrument on exchange, 1 if unknown.
+func LotSize(exchange, instrument string) int { return LotSizeFunc(exchange, instrument) }
+
+func builtinLotSize(exchange, instrument string) int {
+	ex, sym := strings.ToUpper(exchange), strings.ToUpper(instrument)
+	if i := strings.Index(sym, ":"); i > 0 {
+		if ex == "" {
+			ex = sym[:i]
+		}
+		sym = sym[i+1:]
+	}
+	table, ok := lotSizes[ex]
+	if !ok {
+		return 1
+	}
+	// Longest underlying that prefixes the contract symbol, e.g. NIFTY25JANFUT.
+	best, size := 0, 1
+	for u, n := range table {
+		if strings.HasPrefix(sym, u) && len(u) > best {
+			best, size = len(u), n
+		}
+	}
+	return size
+}
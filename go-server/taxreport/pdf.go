@@ -0,0 +1,103 @@
+package taxreport
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// A4 landscape, in points.
+const (
+	pageWidth  = 842.0
+	pageHeight = 595.0
+	margin     = 36.0
+)
+
+// Fonts are the standard PDF fonts, which need no embedding.
+const (
+	fontHeading = "F1" // Helvetica-Bold
+	fontBody    = "F2" // Courier, so tables line up
+)
+
+// pdfDoc lays out lines of text top to bottom, starting a page when one
+// fills. It is just enough PDF for a statement.
+type pdfDoc struct {
+	pages []*bytes.Buffer
+	y     float64
+}
+
+func (d *pdfDoc) newPage() {
+	d.pages = append(d.pages, &bytes.Buffer{})
+	d.y = pageHeight - margin
+}
+
+// text writes one line in font at size points.
+func (d *pdfDoc) text(font string, size float64, s string) {
+	lead := size * 1.4
+	if len(d.pages) == 0 || d.y-lead < margin {
+		d.newPage()
+	}
+	d.y -= lead
+	fmt.Fprintf(d.pages[len(d.pages)-1], "BT /%s %.1f Tf %.1f %.1f Td (%s) Tj ET\n", font, size, margin, d.y, pdfEscape(s))
+}
+
+func (d *pdfDoc) gap() {
+	d.y -= 8
+}
+
+// pdfEscape makes s a PDF literal string in the fonts' Latin encoding.
+func pdfEscape(s string) string {
+	s = strings.ReplaceAll(s, "₹", "Rs.")
+	var b strings.Builder
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '(' || r == ')':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r < 32 || r > 126:
+			b.WriteByte('?')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// WriteTo writes the document: catalog, page tree, fonts, then a page and
+// content stream per page, and the cross-reference table.
+func (d *pdfDoc) WriteTo(w io.Writer) (int64, error) {
+	if len(d.pages) == 0 {
+		d.newPage()
+	}
+	var out bytes.Buffer
+	var offsets []int
+	obj := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n")
+	kids := make([]string, len(d.pages))
+	for i := range d.pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	obj("<< /Type /Catalog /Pages 2 0 R >>")
+	obj(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	obj("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+	for i, page := range d.pages {
+		obj(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] "+
+			"/Resources << /Font << /%s 3 0 R /%s 4 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, fontHeading, fontBody, 6+2*i))
+		obj(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", page.Len(), page.String()))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.WriteTo(w)
+}
@@ -0,0 +1,139 @@
+package taxreport
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+func money(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+
+func date(t time.Time) string { return t.Format("2006-01-02") }
+
+// lastDay is the last day of the report, whose To is exclusive.
+func (r *Report) lastDay() time.Time { return r.To.AddDate(0, 0, -1) }
+
+var entryHeader = []string{"Category", "Instrument", "Exchange", "Quantity", "Short", "Opened", "Closed",
+	"Holding days", "Buy value", "Sell value", "Cost basis", "FMV 31-Jan-2018", "Charges", "STT", "P&L"}
+
+// WriteCSV writes the report as CSV: a summary per category, the capital
+// gains estimate, every matched trade and the notes, separated by blank
+// lines.
+func (r *Report) WriteCSV(w io.Writer) error {
+	cw := csv.NewWriter(w)
+	write := func(rec ...string) { cw.Write(rec) }
+
+	write("Tax P&L statement", "FY "+r.FinancialYear)
+	write("From", date(r.From), "To", date(r.lastDay()))
+	write("Generated", r.GeneratedAt.Format(time.RFC3339))
+	write()
+	write("Category", "Label", "Trades", "Buy value", "Sell value", "Charges", "STT", "Gains", "Losses", "Net", "Turnover")
+	for _, s := range r.Sections {
+		write(s.Category, s.Label, strconv.Itoa(s.Trades), money(s.BuyValue), money(s.SellValue), money(s.Charges),
+			money(s.STT), money(s.Gains), money(s.Losses), money(s.Net), money(s.Turnover))
+	}
+	write()
+	write("Term", "Transfers from", "Rate %", "Net", "Taxable", "Tax")
+	for _, b := range r.CapitalGains.Buckets {
+		write(b.Term, b.From, strconv.FormatFloat(b.Rate, 'f', -1, 64), money(b.Net), money(b.Taxable), money(b.Tax))
+	}
+	cg := r.CapitalGains
+	write("Section 112A exemption", money(cg.Exemption), "used", money(cg.ExemptionUsed))
+	write("Short-term loss carried forward", money(cg.ShortTermLossCF))
+	write("Long-term loss carried forward", money(cg.LongTermLossCF))
+	write("Estimated capital gains tax", money(cg.EstimatedTax))
+	write()
+	write(entryHeader...)
+	for _, e := range r.Entries {
+		fmv := ""
+		if e.Grandfathered {
+			fmv = money(e.FMV)
+		}
+		write(e.Category, e.Instrument, e.Exchange, strconv.FormatFloat(e.Quantity, 'f', -1, 64),
+			strconv.FormatBool(e.Short), e.OpenedAt.Format(time.RFC3339), e.ClosedAt.Format(time.RFC3339),
+			strconv.Itoa(e.HoldingDays), money(e.BuyValue), money(e.SellValue), money(e.CostBasis), fmv,
+			money(e.Charges), money(e.STT), money(e.PnL))
+	}
+	if len(r.Notes) > 0 {
+		write()
+		for _, n := range r.Notes {
+			write("Note", n)
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// WritePDF writes the report as a printable statement.
+func (r *Report) WritePDF(w io.Writer) error {
+	d := &pdfDoc{}
+	d.text(fontHeading, 16, "Tax P&L statement - FY "+r.FinancialYear)
+	d.text(fontBody, 9, fmt.Sprintf("Period %s to %s    Generated %s", date(r.From), date(r.lastDay()),
+		r.GeneratedAt.Format("2006-01-02 15:04")))
+	d.gap()
+
+	d.text(fontHeading, 11, "Summary")
+	row := "%-46s %6s %16s %16s %12s %14s %14s %16s"
+	d.text(fontBody, 8, fmt.Sprintf(row, "Category", "Trades", "Buy value", "Sell value", "Charges", "Gains", "Losses", "Net"))
+	for _, s := range r.Sections {
+		d.text(fontBody, 8, fmt.Sprintf(row, s.Label, strconv.Itoa(s.Trades), money(s.BuyValue), money(s.SellValue),
+			money(s.Charges), money(s.Gains), money(s.Losses), money(s.Net)))
+	}
+	for _, s := range r.Sections {
+		if s.Category == Speculative || s.Category == NonSpeculative {
+			d.text(fontBody, 8, fmt.Sprintf("%s turnover: %s", s.Label, money(s.Turnover)))
+		}
+	}
+	d.gap()
+
+	cg := r.CapitalGains
+	d.text(fontHeading, 11, "Capital gains tax estimate")
+	row = "%-6s %-16s %8s %16s %16s %14s"
+	d.text(fontBody, 8, fmt.Sprintf(row, "Term", "Transfers from", "Rate %", "Net", "Taxable", "Tax"))
+	for _, b := range cg.Buckets {
+		from := b.From
+		if from == "" {
+			from = date(r.From)
+		}
+		d.text(fontBody, 8, fmt.Sprintf(row, b.Term, from, strconv.FormatFloat(b.Rate, 'f', -1, 64),
+			money(b.Net), money(b.Taxable), money(b.Tax)))
+	}
+	d.text(fontBody, 8, fmt.Sprintf("Section 112A exemption %s, used %s. Losses carried forward: short-term %s, long-term %s.",
+		money(cg.Exemption), money(cg.ExemptionUsed), money(cg.ShortTermLossCF), money(cg.LongTermLossCF)))
+	d.text(fontHeading, 10, "Estimated capital gains tax: "+money(cg.EstimatedTax))
+	d.gap()
+
+	d.text(fontHeading, 11, "Trades")
+	row = "%-6s %-24s %9s %-10s %-10s %5s %14s %14s %14s %10s %12s"
+	d.text(fontBody, 7, fmt.Sprintf(row, "Type", "Instrument", "Qty", "Opened", "Closed", "Days",
+		"Sell value", "Cost basis", "Charges", "STT", "P&L"))
+	for _, e := range r.Entries {
+		typ := map[string]string{Speculative: "SPEC", NonSpeculative: "F&O"}[e.Category]
+		if typ == "" {
+			typ = e.Category
+		}
+		if e.Grandfathered {
+			typ += "*"
+		}
+		d.text(fontBody, 7, fmt.Sprintf(row, typ, e.Instrument, strconv.FormatFloat(e.Quantity, 'f', -1, 64),
+			date(e.OpenedAt), date(e.ClosedAt), strconv.Itoa(e.HoldingDays), money(e.SellValue), money(e.CostBasis),
+			money(e.Charges), money(e.STT), money(e.PnL)))
+	}
+	if len(r.Entries) == 0 {
+		d.text(fontBody, 8, "No trades were closed in this financial year.")
+	} else {
+		d.text(fontBody, 7, "* cost of acquisition grandfathered to the 31 Jan 2018 value")
+	}
+
+	if len(r.Notes) > 0 {
+		d.gap()
+		d.text(fontHeading, 11, "Notes")
+		for _, n := range r.Notes {
+			d.text(fontBody, 8, n)
+		}
+	}
+	_, err := d.WriteTo(w)
+	return err
+}
@@ -0,0 +1,556 @@
+// Package taxreport builds year-end tax statements from the transaction
+// ledger: realised P&L matched lot by lot (first in, first out) and
+// classified under Indian income tax rules into speculative business
+// income, non-speculative business income and short- or long-term capital
+// gains for one financial year.
+package taxreport
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go-backend/calendar"
+	"go-backend/charges"
+	"go-backend/models"
+	"gorm.io/gorm"
+)
+
+// ErrNoYear is returned for financial years that have not started.
+var ErrNoYear = errors.New("financial year has not started")
+
+// Income categories.
+const (
+	Speculative    = "SPECULATIVE"     // intraday equity
+	NonSpeculative = "NON_SPECULATIVE" // futures and options
+	ShortTerm      = "STCG"            // listed equity held up to 12 months
+	LongTerm       = "LTCG"            // listed equity held longer
+)
+
+// Categories lists every category, in statement order.
+var Categories = []string{Speculative, NonSpeculative, ShortTerm, LongTerm}
+
+var labels = map[string]string{
+	Speculative:    "Speculative business income (intraday equity)",
+	NonSpeculative: "Non-speculative business income (F&O)",
+	ShortTerm:      "Short-term capital gains (section 111A)",
+	LongTerm:       "Long-term capital gains (section 112A)",
+}
+
+// Label is the statement heading of a category.
+func Label(category string) string { return labels[category] }
+
+// Rate is a capital gains rate on listed equity for transfers from From.
+type Rate struct {
+	From      time.Time
+	ShortTerm float64 // percent
+	LongTerm  float64 // percent
+}
+
+// Rates are the section 111A and 112A rates by transfer date; Finance Act
+// 2024 raised them for transfers from 23 July 2024. They are variables so a
+// deployment can track budget changes without a release.
+var Rates = []Rate{
+	{ShortTerm: 15, LongTerm: 10},
+	{From: time.Date(2024, 7, 23, 0, 0, 0, 0, ist), ShortTerm: 20, LongTerm: 12.5},
+}
+
+// Exemption is the long-term gains exempt under section 112A in the
+// financial year starting in April of year.
+func Exemption(year int) float64 {
+	if year >= 2024 {
+		return 125000
+	}
+	return 100000
+}
+
+// GrandfatherDate is the day whose highest quoted price caps the cost of
+// equity acquired before it (section 112A, acquisitions up to 31 Jan 2018).
+var GrandfatherDate = time.Date(2018, 1, 31, 0, 0, 0, 0, ist)
+
+var ist = time.FixedZone("IST", 5*3600+1800)
+
+// FinancialYear is the April to March year starting in Start.
+type FinancialYear struct {
+	Start int
+}
+
+// ParseYear reads "2024-25", "FY2024-25" or "2024".
+func ParseYear(s string) (FinancialYear, error) {
+	s = strings.TrimPrefix(strings.ToUpper(strings.TrimSpace(s)), "FY")
+	start, rest, _ := strings.Cut(strings.TrimSpace(s), "-")
+	y, err := strconv.Atoi(start)
+	if err != nil || y < 2000 || y > 2100 {
+		return FinancialYear{}, fmt.Errorf("invalid financial year %q", s)
+	}
+	if rest != "" {
+		end, err := strconv.Atoi(rest)
+		if err != nil || (end != (y+1)%100 && end != y+1) {
+			return FinancialYear{}, fmt.Errorf("invalid financial year %q", s)
+		}
+	}
+	return FinancialYear{Start: y}, nil
+}
+
+// YearOf is the financial year t falls in.
+func YearOf(t time.Time) FinancialYear {
+	if t.Month() < time.April {
+		return FinancialYear{Start: t.Year() - 1}
+	}
+	return FinancialYear{Start: t.Year()}
+}
+
+func (fy FinancialYear) String() string {
+	return fmt.Sprintf("%d-%02d", fy.Start, (fy.Start+1)%100)
+}
+
+// Bounds are the first instant of the year and of the next, in loc.
+func (fy FinancialYear) Bounds(loc *time.Location) (time.Time, time.Time) {
+	return time.Date(fy.Start, time.April, 1, 0, 0, 0, 0, loc), time.Date(fy.Start+1, time.April, 1, 0, 0, 0, 0, loc)
+}
+
+// Entry is one matched quantity: a lot opened by one fill and closed,
+// wholly or partly, by another.
+type Entry struct {
+	Category      string    `json:"category"`
+	Instrument    string    `json:"instrument"`
+	Exchange      string    `json:"exchange"`
+	Quantity      float64   `json:"quantity"`
+	Short         bool      `json:"short,omitempty"` // sold before it was bought
+	OpenedAt      time.Time `json:"openedAt"`
+	ClosedAt      time.Time `json:"closedAt"`
+	HoldingDays   int       `json:"holdingDays"`
+	BuyValue      float64   `json:"buyValue"`
+	SellValue     float64   `json:"sellValue"`
+	CostBasis     float64   `json:"costBasis"`     // buy value, raised by grandfathering
+	FMV           float64   `json:"fmv,omitempty"` // per share on GrandfatherDate
+	Grandfathered bool      `json:"grandfathered,omitempty"`
+	Charges       float64   `json:"charges"` // deductible: STT only for business income
+	STT           float64   `json:"stt"`
+	PnL           float64   `json:"pnl"`
+}
+
+// Section totals the entries of a category.
+type Section struct {
+	Category  string  `json:"category"`
+	Label     string  `json:"label"`
+	Trades    int     `json:"trades"`
+	BuyValue  float64 `json:"buyValue"`
+	SellValue float64 `json:"sellValue"`
+	Charges   float64 `json:"charges"`
+	STT       float64 `json:"stt"`
+	Gains     float64 `json:"gains"`
+	Losses    float64 `json:"losses"`
+	Net       float64 `json:"net"`
+	Turnover  float64 `json:"turnover"` // sum of absolute P&L, for tax audit limits
+}
+
+// Bucket is net capital gain taxed at one rate.
+type Bucket struct {
+	Term    string  `json:"term"` // STCG or LTCG
+	From    string  `json:"from,omitempty"`
+	Rate    float64 `json:"rate"`
+	Net     float64 `json:"net"`     // before set-off
+	Taxable float64 `json:"taxable"` // after set-off and exemption
+	Tax     float64 `json:"tax"`
+}
+
+// CapitalGains estimates the tax on capital gains. Business income is
+// taxed at slab rates and left to the return.
+type CapitalGains struct {
+	Buckets         []Bucket `json:"buckets"`
+	Exemption       float64  `json:"exemption"`     // section 112A allowance
+	ExemptionUsed   float64  `json:"exemptionUsed"` // of it, against this year's gains
+	ShortTermLossCF float64  `json:"shortTermLossCarriedForward"`
+	LongTermLossCF  float64  `json:"longTermLossCarriedForward"`
+	EstimatedTax    float64  `json:"estimatedTax"`
+}
+
+// Report is a financial year's statement.
+type Report struct {
+	UserID        uuid.UUID    `json:"userId"`
+	FinancialYear string       `json:"financialYear"`
+	From          time.Time    `json:"from"`
+	To            time.Time    `json:"to"` // exclusive
+	GeneratedAt   time.Time    `json:"generatedAt"`
+	Sections      []Section    `json:"sections"`
+	CapitalGains  CapitalGains `json:"capitalGains"`
+	Entries       []Entry      `json:"entries"`
+	Notes         []string     `json:"notes,omitempty"`
+}
+
+// Generator builds reports.
+type Generator struct {
+	DB       *gorm.DB
+	Calendar *calendar.Calendar // days are counted in its zone; nil is IST
+	// FMV returns the highest price instrument was quoted at on
+	// GrandfatherDate, unadjusted. It defaults to the stored bars.
+	FMV func(instrument string) (float64, bool)
+}
+
+func NewGenerator(db *gorm.DB, cal *calendar.Calendar) *Generator {
+	g := &Generator{DB: db, Calendar: cal}
+	g.FMV = g.storedFMV
+	return g
+}
+
+func (g *Generator) location() *time.Location {
+	if g.Calendar != nil {
+		return g.Calendar.Location()
+	}
+	return ist
+}
+
+// storedFMV reads the grandfathering price from the bars of that day.
+func (g *Generator) storedFMV(instrument string) (float64, bool) {
+	sym := strings.ToUpper(instrument)
+	if i := strings.Index(sym, ":"); i > 0 {
+		sym = sym[i+1:]
+	}
+	start := time.Date(GrandfatherDate.Year(), GrandfatherDate.Month(), GrandfatherDate.Day(), 0, 0, 0, 0, g.location())
+	var high []*float64 // MAX is NULL without bars
+	err := g.DB.Model(&models.MarketData{}).
+		Where("symbol IN ? AND timestamp >= ? AND timestamp < ?", []string{sym, "NSE:" + sym, "BSE:" + sym}, start, start.AddDate(0, 0, 1)).
+		Pluck("MAX(high)", &high).Error
+	if err != nil || len(high) == 0 || high[0] == nil || *high[0] <= 0 {
+		return 0, false
+	}
+	return *high[0], true
+}
+
+// fill is a transaction with the order fields classification needs.
+type fill struct {
+	Instrument string
+	Exchange   string
+	Side       string
+	Product    string
+	Quantity   float64
+	Price      float64
+	Brokerage  float64
+	Taxes      float64
+	ExecutedAt time.Time
+	Action     string // corporate action that booked an adjustment fill
+}
+
+func (f fill) buy() bool { return !strings.EqualFold(f.Side, "SELL") }
+
+// lot is an open quantity awaiting a closing fill.
+type lot struct {
+	qty    float64
+	price  float64
+	fees   float64 // brokerage and taxes per unit
+	taxes  float64 // of which taxes, per unit
+	at     time.Time
+	buy    bool
+	splits float64 // share multiplier of splits after GrandfatherDate
+	ex     string
+	mis    bool // opened by an intraday (MIS) order
+}
+
+// Generate builds userID's statement for fy from live (not paper) fills.
+// Lots are matched per instrument across strategies, as the account holds
+// them: the day's own trades first, then first in, first out.
+func (g *Generator) Generate(userID uuid.UUID, fy FinancialYear) (*Report, error) {
+	loc := g.location()
+	from, to := fy.Bounds(loc)
+	if from.After(time.Now()) {
+		return nil, ErrNoYear
+	}
+	var fills []fill
+	err := g.DB.Table("transactions").
+		Select("UPPER(transactions.instrument) AS instrument, orders.exchange, orders.side, orders.product, transactions.quantity, "+
+			"transactions.fill_price AS price, transactions.brokerage, transactions.taxes, transactions.executed_at, "+
+			"corporate_action_entries.type AS action").
+		Joins("JOIN orders ON orders.id = transactions.order_id").
+		Joins("LEFT JOIN corporate_action_entries ON corporate_action_entries.order_id = orders.id").
+		Where("orders.user_id = ? AND orders.is_paper = ? AND transactions.executed_at < ?", userID, false, to).
+		Order("transactions.executed_at, transactions.created_at").
+		Scan(&fills).Error
+	if err != nil {
+		return nil, err
+	}
+
+	rep := &Report{UserID: userID, FinancialYear: fy.String(), From: from, To: to, GeneratedAt: time.Now().In(loc)}
+	books := map[string][]*lot{}
+	var order []string
+	unmatched := map[string]float64{}
+	for _, f := range fills {
+		if _, ok := books[f.Instrument]; !ok {
+			order = append(order, f.Instrument)
+		}
+		books[f.Instrument] = g.book(rep, books[f.Instrument], f, from, to, loc)
+	}
+	for _, ins := range order {
+		for _, l := range books[ins] {
+			if !l.buy && charges.SegmentOf(l.ex, ins, "") == charges.EquityDelivery {
+				unmatched[ins] += l.qty
+			}
+		}
+	}
+	for _, ins := range order {
+		if q := unmatched[ins]; q > 0 {
+			rep.Notes = append(rep.Notes, fmt.Sprintf("%s: %g shares sold with no recorded purchase are left out; import the purchase to include them.", ins, q))
+		}
+	}
+
+	sort.SliceStable(rep.Entries, func(i, j int) bool { return rep.Entries[i].ClosedAt.Before(rep.Entries[j].ClosedAt) })
+	rep.Sections = sections(rep.Entries)
+	rep.CapitalGains = capitalGains(rep.Entries, fy)
+	for _, e := range rep.Entries {
+		if e.Category == LongTerm && e.OpenedAt.Before(GrandfatherDate.AddDate(0, 0, 1)) && !e.Grandfathered {
+			rep.Notes = append(rep.Notes, "Some pre-2018 holdings use their actual cost: no quote for 31 Jan 2018 was stored.")
+			break
+		}
+	}
+	rep.Notes = append(rep.Notes, "Capital gains tax is an estimate excluding surcharge, cess, rebates and losses brought forward.")
+	return rep, nil
+}
+
+// book applies f to an instrument's open lots, adding an entry for each
+// quantity it closes within [from, to). Lots opened the same day are closed
+// first, intraday (MIS) ones ahead of the rest, so a day's round trip is
+// speculative and carried holdings keep their dates; carried lots then go
+// first in, first out.
+func (g *Generator) book(rep *Report, lots []*lot, f fill, from, to time.Time, loc *time.Location) []*lot {
+	if f.Quantity <= 0 {
+		return lots
+	}
+	if f.Action == models.CorporateActionSplit {
+		// A split keeps each lot's date and cost; it only has more shares.
+		held := 0.0
+		for _, l := range lots {
+			held += l.qty
+		}
+		if held > 0 {
+			k := (held + f.Quantity) / held
+			for _, l := range lots {
+				l.qty *= k
+				l.price /= k
+				l.fees /= k
+				l.taxes /= k
+				if f.ExecutedAt.After(GrandfatherDate) {
+					l.splits *= k
+				}
+			}
+			return lots
+		}
+	}
+	// Bonus shares are a new lot, acquired on allotment at nil cost.
+	remaining := f.Quantity
+	feeUnit, taxUnit := (f.Brokerage+f.Taxes)/f.Quantity, f.Taxes/f.Quantity
+	today := day(f.ExecutedAt.In(loc))
+	rank := func(l *lot) int {
+		switch {
+		case !day(l.at.In(loc)).Equal(today):
+			return 2
+		case l.mis:
+			return 0
+		}
+		return 1
+	}
+	queue := append([]*lot(nil), lots...)
+	sort.SliceStable(queue, func(i, j int) bool { return rank(queue[i]) < rank(queue[j]) })
+	for _, l := range queue {
+		if remaining <= 1e-9 || l.buy == f.buy() {
+			break
+		}
+		m := math.Min(l.qty, remaining)
+		if !f.ExecutedAt.Before(from) && f.ExecutedAt.Before(to) {
+			rep.Entries = append(rep.Entries, g.match(l, f, m, feeUnit, taxUnit, loc))
+		}
+		l.qty -= m
+		remaining -= m
+	}
+	open := lots[:0]
+	for _, l := range lots {
+		if l.qty > 1e-9 {
+			open = append(open, l)
+		}
+	}
+	lots = open
+	if remaining > 1e-9 {
+		lots = append(lots, &lot{qty: remaining, price: f.Price, fees: feeUnit, taxes: taxUnit,
+			at: f.ExecutedAt, buy: f.buy(), splits: 1, ex: f.Exchange,
+			mis: strings.EqualFold(f.Product, charges.ProductIntraday)})
+	}
+	return lots
+}
+
+// match classifies qty of lot l closed by f.
+func (g *Generator) match(l *lot, f fill, qty, feeUnit, taxUnit float64, loc *time.Location) Entry {
+	e := Entry{Instrument: f.Instrument, Exchange: f.Exchange, Quantity: qty, Short: !l.buy,
+		OpenedAt: l.at.In(loc), ClosedAt: f.ExecutedAt.In(loc)}
+	e.HoldingDays = int(day(e.ClosedAt).Sub(day(e.OpenedAt)).Hours() / 24)
+	buyPrice, sellPrice := l.price, f.Price
+	if !l.buy {
+		buyPrice, sellPrice = f.Price, l.price
+	}
+	e.BuyValue, e.SellValue = buyPrice*qty, sellPrice*qty
+
+	segment := charges.SegmentOf(f.Exchange, f.Instrument, "")
+	switch {
+	case segment != charges.EquityDelivery:
+		e.Category = NonSpeculative
+	case e.HoldingDays == 0:
+		e.Category = Speculative
+		segment = charges.EquityIntraday
+	case l.buy && e.ClosedAt.After(e.OpenedAt.AddDate(1, 0, 0)):
+		e.Category = LongTerm
+	default:
+		e.Category = ShortTerm
+	}
+
+	// Transactions store taxes as one figure; STT is split out at the
+	// statutory rate because capital gains may not deduct it.
+	fees := (l.fees + feeUnit) * qty
+	taxes := (l.taxes + taxUnit) * qty
+	none := charges.Plan{}
+	e.STT = math.Min(taxes, charges.Compute(none, segment, "BUY", qty, buyPrice).STT+
+		charges.Compute(none, segment, "SELL", qty, sellPrice).STT)
+	e.Charges = fees
+	if e.Category == ShortTerm || e.Category == LongTerm {
+		e.Charges -= e.STT
+	}
+
+	e.CostBasis = e.BuyValue
+	if e.Category == LongTerm && l.at.Before(GrandfatherDate.AddDate(0, 0, 1)) && g.FMV != nil {
+		if fmv, ok := g.FMV(f.Instrument); ok {
+			e.FMV = fmv / l.splits
+			if cost := math.Max(buyPrice, math.Min(e.FMV, sellPrice)); cost > buyPrice {
+				e.CostBasis = cost * qty
+			}
+			e.Grandfathered = true
+		}
+	}
+	e.PnL = e.SellValue - e.CostBasis - e.Charges
+	round(&e.BuyValue, &e.SellValue, &e.CostBasis, &e.FMV, &e.Charges, &e.STT, &e.PnL)
+	return e
+}
+
+func day(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func round(vs ...*float64) {
+	for _, v := range vs {
+		*v = math.Round(*v*100) / 100
+	}
+}
+
+func sections(entries []Entry) []Section {
+	out := make([]Section, len(Categories))
+	idx := map[string]int{}
+	for i, c := range Categories {
+		out[i] = Section{Category: c, Label: labels[c]}
+		idx[c] = i
+	}
+	for _, e := range entries {
+		s := &out[idx[e.Category]]
+		s.Trades++
+		s.BuyValue += e.BuyValue
+		s.SellValue += e.SellValue
+		s.Charges += e.Charges
+		s.STT += e.STT
+		if e.PnL >= 0 {
+			s.Gains += e.PnL
+		} else {
+			s.Losses -= e.PnL
+		}
+		s.Turnover += math.Abs(e.PnL)
+	}
+	for i := range out {
+		s := &out[i]
+		s.Net = s.Gains - s.Losses
+		round(&s.BuyValue, &s.SellValue, &s.Charges, &s.STT, &s.Gains, &s.Losses, &s.Net, &s.Turnover)
+	}
+	return out
+}
+
+// rateAt is the index in Rates of the rate for a transfer at t.
+func rateAt(t time.Time) int {
+	i := 0
+	for j, r := range Rates {
+		if !t.Before(r.From) {
+			i = j
+		}
+	}
+	return i
+}
+
+// capitalGains nets the year's gains per rate, sets short-term losses off
+// against any gains and long-term losses against long-term gains (highest
+// rate first), and applies the section 112A exemption.
+func capitalGains(entries []Entry, fy FinancialYear) CapitalGains {
+	from, to := fy.Bounds(ist)
+	var buckets []Bucket
+	index := map[string]int{}
+	// Highest rate first, so set-offs save the most tax.
+	for _, term := range []string{ShortTerm, LongTerm} {
+		for i := len(Rates) - 1; i >= 0; i-- {
+			r := Rates[i]
+			if !r.From.Before(to) || i+1 < len(Rates) && !Rates[i+1].From.After(from) {
+				continue // not in force during the year
+			}
+			b := Bucket{Term: term, Rate: r.ShortTerm}
+			if term == LongTerm {
+				b.Rate = r.LongTerm
+			}
+			if r.From.After(from) {
+				b.From = r.From.Format("2006-01-02")
+			}
+			index[fmt.Sprintf("%s|%d", term, i)] = len(buckets)
+			buckets = append(buckets, b)
+		}
+	}
+	for _, e := range entries {
+		if e.Category != ShortTerm && e.Category != LongTerm {
+			continue
+		}
+		if k, ok := index[fmt.Sprintf("%s|%d", e.Category, rateAt(e.ClosedAt))]; ok {
+			buckets[k].Net += e.PnL
+		}
+	}
+
+	var stLoss, ltLoss float64
+	for i := range buckets {
+		b := &buckets[i]
+		b.Taxable = math.Max(b.Net, 0)
+		if b.Net < 0 && b.Term == ShortTerm {
+			stLoss -= b.Net
+		} else if b.Net < 0 {
+			ltLoss -= b.Net
+		}
+	}
+	setOff := func(loss *float64, term string) {
+		for i := range buckets {
+			b := &buckets[i]
+			if term != "" && b.Term != term {
+				continue
+			}
+			used := math.Min(*loss, b.Taxable)
+			b.Taxable -= used
+			*loss -= used
+		}
+	}
+	setOff(&stLoss, "")
+	setOff(&ltLoss, LongTerm)
+
+	cg := CapitalGains{Exemption: Exemption(fy.Start), ShortTermLossCF: stLoss, LongTermLossCF: ltLoss}
+	exempt := cg.Exemption
+	setOff(&exempt, LongTerm)
+	cg.ExemptionUsed = cg.Exemption - exempt
+	for i := range buckets {
+		b := &buckets[i]
+		b.Tax = b.Taxable * b.Rate / 100
+		cg.EstimatedTax += b.Tax
+		round(&b.Net, &b.Taxable, &b.Tax)
+	}
+	cg.Buckets = buckets
+	round(&cg.ExemptionUsed, &cg.ShortTermLossCF, &cg.LongTermLossCF, &cg.EstimatedTax)
+	return cg
+}
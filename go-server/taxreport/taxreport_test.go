@@ -0,0 +1,197 @@
+package taxreport
+
+import (
+	"math"
+	"testing"
+	"time"
+
+	"go-backend/models"
+)
+
+func TestParseYear(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    int
+		wantErr bool
+	}{
+		{"2024-25", 2024, false},
+		{"FY2024-25", 2024, false},
+		{" fy2024-2025 ", 2024, false},
+		{"2024", 2024, false},
+		{"2024-26", 0, true},
+		{"1999-00", 0, true},
+		{"next", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseYear(tt.in)
+		if (err != nil) != tt.wantErr || got.Start != tt.want {
+			t.Errorf("ParseYear(%q) = %d, %v, want %d, error %v", tt.in, got.Start, err, tt.want, tt.wantErr)
+		}
+	}
+	if got := YearOf(time.Date(2025, 3, 31, 23, 0, 0, 0, ist)).String(); got != "2024-25" {
+		t.Errorf("YearOf(31 Mar 2025) = %s, want 2024-25", got)
+	}
+}
+
+// want is the part of an Entry the matching decides.
+type want struct {
+	category string
+	qty      float64
+	opened   string // 2006-01-02 15:04
+	short    bool
+	pnl      float64
+}
+
+func TestBook(t *testing.T) {
+	at := func(s string) time.Time {
+		v, err := time.ParseInLocation("2006-01-02 15:04", s, ist)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return v
+	}
+	buy := func(when, product string, qty, price float64) fill {
+		return fill{Instrument: "INFY", Exchange: "NSE", Side: "BUY", Product: product, Quantity: qty, Price: price, ExecutedAt: at(when)}
+	}
+	sell := func(when, product string, qty, price float64) fill {
+		f := buy(when, product, qty, price)
+		f.Side = "SELL"
+		return f
+	}
+	withFees := func(f fill, brokerage float64) fill {
+		f.Brokerage = brokerage
+		return f
+	}
+	instrument := func(f fill, ins, ex string) fill {
+		f.Instrument, f.Exchange = ins, ex
+		return f
+	}
+	split := buy("2023-06-01 09:00", "CNC", 10, 0)
+	split.Action = models.CorporateActionSplit
+
+	tests := []struct {
+		name  string
+		fills []fill
+		want  []want
+	}{
+		{
+			name:  "intraday round trip",
+			fills: []fill{buy("2024-06-03 10:00", "MIS", 10, 100), sell("2024-06-03 14:00", "MIS", 10, 110)},
+			want:  []want{{Speculative, 10, "2024-06-03 10:00", false, 100}},
+		},
+		{
+			name:  "fees are deducted",
+			fills: []fill{withFees(buy("2024-06-03 10:00", "MIS", 10, 100), 20), withFees(sell("2024-06-03 14:00", "MIS", 10, 110), 20)},
+			want:  []want{{Speculative, 10, "2024-06-03 10:00", false, 60}},
+		},
+		{
+			name:  "intraday short sale",
+			fills: []fill{sell("2024-06-03 10:00", "MIS", 10, 110), buy("2024-06-03 14:00", "MIS", 10, 100)},
+			want:  []want{{Speculative, 10, "2024-06-03 10:00", true, 100}},
+		},
+		{
+			name:  "short term delivery",
+			fills: []fill{buy("2024-06-03 10:00", "CNC", 10, 100), sell("2024-09-02 10:00", "CNC", 10, 120)},
+			want:  []want{{ShortTerm, 10, "2024-06-03 10:00", false, 200}},
+		},
+		{
+			name:  "long term delivery",
+			fills: []fill{buy("2023-01-02 10:00", "CNC", 10, 100), sell("2024-06-03 10:00", "CNC", 10, 150)},
+			want:  []want{{LongTerm, 10, "2023-01-02 10:00", false, 500}},
+		},
+		{
+			name: "carried lots first in, first out",
+			fills: []fill{buy("2024-05-01 10:00", "CNC", 5, 100), buy("2024-05-02 10:00", "CNC", 5, 200),
+				sell("2024-06-03 10:00", "CNC", 7, 300)},
+			want: []want{{ShortTerm, 5, "2024-05-01 10:00", false, 1000}, {ShortTerm, 2, "2024-05-02 10:00", false, 200}},
+		},
+		{
+			name: "the day's own lots close before carried ones",
+			fills: []fill{buy("2024-05-01 10:00", "CNC", 10, 100), buy("2024-06-03 10:00", "CNC", 10, 150),
+				sell("2024-06-03 14:00", "CNC", 10, 160), sell("2024-06-04 10:00", "CNC", 10, 170)},
+			want: []want{{Speculative, 10, "2024-06-03 10:00", false, 100}, {ShortTerm, 10, "2024-05-01 10:00", false, 700}},
+		},
+		{
+			name: "intraday lots close before same-day delivery",
+			fills: []fill{buy("2024-06-03 09:30", "CNC", 10, 100), buy("2024-06-03 10:00", "MIS", 10, 120),
+				sell("2024-06-03 14:00", "MIS", 10, 130)},
+			want: []want{{Speculative, 10, "2024-06-03 10:00", false, 100}},
+		},
+		{
+			name: "futures are business income",
+			fills: []fill{instrument(buy("2024-06-03 10:00", "NRML", 50, 22000), "NIFTY24JUNFUT", "NFO"),
+				instrument(sell("2024-06-04 10:00", "NRML", 50, 22100), "NIFTY24JUNFUT", "NFO")},
+			want: []want{{NonSpeculative, 50, "2024-06-03 10:00", false, 5000}},
+		},
+		{
+			name:  "closed before the year",
+			fills: []fill{buy("2024-01-02 10:00", "CNC", 10, 100), sell("2024-03-01 10:00", "CNC", 10, 120)},
+		},
+		{
+			name:  "split keeps the lot's date and cost",
+			fills: []fill{buy("2023-01-02 10:00", "CNC", 10, 100), split, sell("2024-06-03 10:00", "CNC", 20, 60)},
+			want:  []want{{LongTerm, 20, "2023-01-02 10:00", false, 200}},
+		},
+		{
+			// cost is raised to the 31 Jan 2018 price of 200
+			name:  "grandfathered",
+			fills: []fill{buy("2017-06-01 10:00", "CNC", 10, 100), sell("2024-06-03 10:00", "CNC", 10, 300)},
+			want:  []want{{LongTerm, 10, "2017-06-01 10:00", false, 1000}},
+		},
+	}
+	g := &Generator{FMV: func(string) (float64, bool) { return 200, true }}
+	from, to := FinancialYear{Start: 2024}.Bounds(ist)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rep := &Report{}
+			books := map[string][]*lot{}
+			for _, f := range tt.fills {
+				books[f.Instrument] = g.book(rep, books[f.Instrument], f, from, to, ist)
+			}
+			if len(rep.Entries) != len(tt.want) {
+				t.Fatalf("got %d entries %+v, want %d", len(rep.Entries), rep.Entries, len(tt.want))
+			}
+			for i, e := range rep.Entries {
+				got := want{e.Category, e.Quantity, e.OpenedAt.Format("2006-01-02 15:04"), e.Short, e.PnL}
+				if got.category != tt.want[i].category || math.Abs(got.qty-tt.want[i].qty) > 1e-9 ||
+					got.opened != tt.want[i].opened || got.short != tt.want[i].short || math.Abs(got.pnl-tt.want[i].pnl) > 1e-9 {
+					t.Errorf("entry %d = %+v, want %+v", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+// Short-term losses set off any gains, the section 112A exemption only
+// long-term ones, and gains are taxed at the rate in force when realised.
+func TestCapitalGains(t *testing.T) {
+	closed := func(s string) time.Time {
+		v, _ := time.ParseInLocation("2006-01-02", s, ist)
+		return v
+	}
+	entries := []Entry{
+		{Category: ShortTerm, ClosedAt: closed("2024-06-01"), PnL: 1000},
+		{Category: LongTerm, ClosedAt: closed("2024-08-01"), PnL: 200000},
+		{Category: ShortTerm, ClosedAt: closed("2024-09-01"), PnL: -300},
+		{Category: Speculative, ClosedAt: closed("2024-09-01"), PnL: 5000},
+	}
+	cg := capitalGains(entries, FinancialYear{Start: 2024})
+
+	wantBuckets := []Bucket{
+		{Term: ShortTerm, From: "2024-07-23", Rate: 20, Net: -300},
+		{Term: ShortTerm, Rate: 15, Net: 1000, Taxable: 700, Tax: 105},
+		{Term: LongTerm, From: "2024-07-23", Rate: 12.5, Net: 200000, Taxable: 75000, Tax: 9375},
+		{Term: LongTerm, Rate: 10},
+	}
+	if len(cg.Buckets) != len(wantBuckets) {
+		t.Fatalf("got buckets %+v", cg.Buckets)
+	}
+	for i, b := range cg.Buckets {
+		if b != wantBuckets[i] {
+			t.Errorf("bucket %d = %+v, want %+v", i, b, wantBuckets[i])
+		}
+	}
+	if cg.Exemption != 125000 || cg.ExemptionUsed != 125000 || cg.ShortTermLossCF != 0 || cg.EstimatedTax != 9480 {
+		t.Errorf("got %+v", cg)
+	}
+}
@@ -0,0 +1,185 @@
+// Package textdiff produces unified diffs of small text documents such as
+// strategy code.
+package textdiff
+
+import (
+	"fmt"
+	"strings"
+)
+
+const contextLines = 3
+
+// maxCells bounds the LCS table. Past it the changed middle of the two
+// documents is reported as one deletion followed by one insertion.
+const maxCells = 4 << 20
+
+type opKind int
+
+const (
+	opEqual opKind = iota
+	opDelete
+	opInsert
+)
+
+type op struct {
+	kind opKind
+	a, b int // line index in a (delete/equal) and b (insert/equal)
+}
+
+func splitLines(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
+
+// lineOps computes an edit script from a to b. Lines shared at both ends are
+// matched directly; the rest uses the longest common subsequence of lines,
+// or a plain replacement when its O(n*m) table would exceed maxCells.
+func lineOps(a, b []string) []op {
+	pre := 0
+	for pre < len(a) && pre < len(b) && a[pre] == b[pre] {
+		pre++
+	}
+	suf := 0
+	for suf < len(a)-pre && suf < len(b)-pre && a[len(a)-1-suf] == b[len(b)-1-suf] {
+		suf++
+	}
+	ops := make([]op, 0, len(a)+len(b)-pre-suf)
+	for k := 0; k < pre; k++ {
+		ops = append(ops, op{opEqual, k, k})
+	}
+	am, bm := a[pre:len(a)-suf], b[pre:len(b)-suf]
+	var mid []op
+	if len(am)*len(bm) > maxCells {
+		mid = replaceOps(len(am), len(bm))
+	} else {
+		mid = lcsOps(am, bm)
+	}
+	for _, o := range mid {
+		ops = append(ops, op{o.kind, o.a + pre, o.b + pre})
+	}
+	for k := 0; k < suf; k++ {
+		ops = append(ops, op{opEqual, len(a) - suf + k, len(b) - suf + k})
+	}
+	return ops
+}
+
+// replaceOps deletes all n lines of a and then inserts all m lines of b.
+func replaceOps(n, m int) []op {
+	ops := make([]op, 0, n+m)
+	for i := 0; i < n; i++ {
+		ops = append(ops, op{opDelete, i, 0})
+	}
+	for j := 0; j < m; j++ {
+		ops = append(ops, op{opInsert, n, j})
+	}
+	return ops
+}
+
+// lcsOps computes an edit script from a to b using the longest common
+// subsequence of lines.
+func lcsOps(a, b []string) []op {
+	n, m := len(a), len(b)
+	lcs := make([][]int, n+1)
+	for i := range lcs {
+		lcs[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+	var ops []op
+	i, j := 0, 0
+	for i < n || j < m {
+		switch {
+		case i < n && j < m && a[i] == b[j]:
+			ops = append(ops, op{opEqual, i, j})
+			i++
+			j++
+		case j < m && (i == n || lcs[i][j+1] > lcs[i+1][j]):
+			ops = append(ops, op{opInsert, i, j})
+			j++
+		default:
+			ops = append(ops, op{opDelete, i, j})
+			i++
+		}
+	}
+	return ops
+}
+
+// Unified returns a unified diff between a and b, or "" when they are equal.
+func Unified(fromName, toName, a, b string) string {
+	al, bl := splitLines(a), splitLines(b)
+	ops := lineOps(al, bl)
+
+	var sb strings.Builder
+	for start := 0; start < len(ops); {
+		// Find the next change.
+		for start < len(ops) && ops[start].kind == opEqual {
+			start++
+		}
+		if start == len(ops) {
+			break
+		}
+		// Extend the hunk while changes are within 2*context of each other.
+		end := start
+		for k := start; k < len(ops); k++ {
+			if ops[k].kind != opEqual {
+				end = k
+			} else if k-end > 2*contextLines {
+				break
+			}
+		}
+		lo := start - contextLines
+		if lo < 0 {
+			lo = 0
+		}
+		hi := end + contextLines + 1
+		if hi > len(ops) {
+			hi = len(ops)
+		}
+
+		if sb.Len() == 0 {
+			fmt.Fprintf(&sb, "--- %s\n+++ %s\n", fromName, toName)
+		}
+		aStart, bStart := ops[lo].a, ops[lo].b
+		aCount, bCount := 0, 0
+		var body strings.Builder
+		for _, o := range ops[lo:hi] {
+			switch o.kind {
+			case opEqual:
+				aCount++
+				bCount++
+				body.WriteString(" " + al[o.a] + "\n")
+			case opDelete:
+				aCount++
+				body.WriteString("-" + al[o.a] + "\n")
+			case opInsert:
+				bCount++
+				body.WriteString("+" + bl[o.b] + "\n")
+			}
+		}
+		fmt.Fprintf(&sb, "@@ -%s +%s @@\n", hunkRange(aStart, aCount), hunkRange(bStart, bCount))
+		sb.WriteString(body.String())
+		start = hi
+	}
+	return sb.String()
+}
+
+func hunkRange(start, count int) string {
+	if count == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if count == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
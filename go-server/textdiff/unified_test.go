@@ -0,0 +1,55 @@
+package textdiff
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnified(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+		want string
+	}{
+		{"equal", "a\nb\n", "a\nb\n", ""},
+		{"insert", "a\nc\n", "a\nb\nc\n", "--- x\n+++ y\n@@ -1,2 +1,3 @@\n a\n+b\n c\n"},
+		{"delete", "a\nb\nc\n", "a\nc\n", "--- x\n+++ y\n@@ -1,3 +1,2 @@\n a\n-b\n c\n"},
+		{"replace", "a\nb\nc\n", "a\nB\nc\n", "--- x\n+++ y\n@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n"},
+		{"from empty", "", "a\n", "--- x\n+++ y\n@@ -0,0 +1 @@\n+a\n"},
+		{"to empty", "a\n", "", "--- x\n+++ y\n@@ -1 +0,0 @@\n-a\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Unified("x", "y", tt.a, tt.b); got != tt.want {
+				t.Errorf("Unified(%q, %q) =\n%s\nwant\n%s", tt.a, tt.b, got, tt.want)
+			}
+		})
+	}
+}
+
+// Past maxCells the changed middle is replaced wholesale, keeping the lines
+// shared at both ends as context.
+func TestUnifiedLarge(t *testing.T) {
+	var a, b []string
+	for i := 0; i < 3000; i++ {
+		a = append(a, "a"+strings.Repeat("x", i%7))
+		b = append(b, "b"+strings.Repeat("x", i%7))
+	}
+	head, tail := []string{"head"}, []string{"tail"}
+	from := strings.Join(append(append(head, a...), tail...), "\n")
+	to := strings.Join(append(append(head, b...), tail...), "\n")
+
+	ops := lineOps(splitLines(from), splitLines(to))
+	if len(ops) != 2+len(a)+len(b) {
+		t.Fatalf("got %d ops, want %d", len(ops), 2+len(a)+len(b))
+	}
+	if ops[0] != (op{opEqual, 0, 0}) || ops[len(ops)-1] != (op{opEqual, len(a) + 1, len(b) + 1}) {
+		t.Errorf("shared ends not matched: first %v, last %v", ops[0], ops[len(ops)-1])
+	}
+	if ops[1].kind != opDelete || ops[1+len(a)].kind != opInsert {
+		t.Errorf("middle is not a deletion followed by an insertion")
+	}
+	if d := Unified("x", "y", from, to); !strings.HasPrefix(d, "--- x\n+++ y\n@@ -1,3002 +1,3002 @@\n head\n-a\n") {
+		t.Errorf("unexpected diff header: %q", d[:60])
+	}
+}
@@ -0,0 +1,443 @@
+package tradebook
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"go-backend/calendar"
+	"go-backend/charges"
+	"go-backend/instruments"
+	"go-backend/ledger"
+	"go-backend/models"
+	"gorm.io/gorm"
+)
+
+// Importer books tradebook trades into the ledger.
+type Importer struct {
+	DB          *gorm.DB
+	Instruments *instruments.Resolver // nil keeps symbols as exported
+	Charges     *charges.Service      // nil leaves costs as exported
+	Calendar    *calendar.Calendar    // zone of exported times; nil is time.Local
+}
+
+func NewImporter(db *gorm.DB, res *instruments.Resolver, chg *charges.Service, cal *calendar.Calendar) *Importer {
+	return &Importer{DB: db, Instruments: res, Charges: chg, Calendar: cal}
+}
+
+// Options are the caller's choices for one import.
+type Options struct {
+	UserID     uuid.UUID
+	StrategyID uuid.UUID // strategy new orders are filed under; uuid.Nil leaves them unassigned
+	BrokerID   *uint
+	Product    string // for rows that do not name one
+	DryRun     bool   // report what would be imported without writing
+}
+
+// Result summarises an import.
+type Result struct {
+	Format        string     `json:"format"`
+	Rows          int        `json:"rows"`
+	Imported      int        `json:"imported"`
+	Duplicates    int        `json:"duplicates"` // trades already in the ledger
+	Failed        int        `json:"failed"`
+	OrdersCreated int        `json:"ordersCreated"`
+	OrdersLinked  int        `json:"ordersLinked"` // existing orders that received fills
+	Summaries     int        `json:"summaries"`    // round trips rebuilt from the earliest imported trade on
+	DryRun        bool       `json:"dryRun,omitempty"`
+	Errors        []RowError `json:"errors,omitempty"`
+	Trades        []Trade    `json:"trades,omitempty"` // dry runs: what would be imported
+}
+
+func (res *Result) fail(t Trade, err error) {
+	res.Failed++
+	res.Errors = append(res.Errors, RowError{Row: t.Row, TradeID: t.TradeID, Error: err.Error()})
+}
+
+// errDryRun rolls a dry run back once everything has been checked.
+var errDryRun = errors.New("dry run")
+
+// Import parses an export and books its trades. Trades already recorded,
+// by an earlier import or by a live broker adapter under the same trade id,
+// are skipped. Fills of one broker order share a parent: the user's order
+// with that broker order id, or a synthetic IMPORTED order. Rows that fail
+// are reported and do not stop the rest.
+func (im *Importer) Import(data []byte, format string, mapping Mapping, opts Options) (*Result, error) {
+	loc := time.Local
+	if im.Calendar != nil {
+		loc = im.Calendar.Location()
+	}
+	trades, format, rowErrs, err := Parse(data, format, mapping, loc)
+	res := &Result{Format: format, Rows: len(trades) + len(rowErrs), Errors: rowErrs, Failed: len(rowErrs), DryRun: opts.DryRun}
+	if err != nil {
+		return res, err
+	}
+
+	trades = im.normalize(trades, opts, res)
+	err = im.DB.Transaction(func(tx *gorm.DB) error {
+		fresh, err := dedupe(tx, trades, opts.UserID, res)
+		if err != nil {
+			return err
+		}
+		if len(fresh) == 0 {
+			return nil
+		}
+		if err := im.book(tx, fresh, opts, res); err != nil {
+			return err
+		}
+		res.Imported = len(fresh)
+		if opts.DryRun {
+			res.Trades = fresh
+			return errDryRun
+		}
+		return nil
+	})
+	if errors.Is(err, errDryRun) {
+		err = nil
+	}
+	sort.Slice(res.Errors, func(i, j int) bool { return res.Errors[i].Row < res.Errors[j].Row })
+	return res, err
+}
+
+// normalize canonicalises symbols and fills in what rows left out, failing
+// rows whose symbol the instrument master does not list.
+func (im *Importer) normalize(trades []Trade, opts Options, res *Result) []Trade {
+	out := trades[:0]
+	for _, t := range trades {
+		if im.Instruments != nil {
+			sym, ex, err := im.Instruments.Normalize(t.Symbol, t.Exchange)
+			if err != nil {
+				res.fail(t, err)
+				continue
+			}
+			t.Symbol = sym
+			if ex != "" {
+				t.Exchange = ex
+			}
+		}
+		if t.Exchange == "" {
+			t.Exchange = calendar.DefaultExchange
+		}
+		if t.Product == "" {
+			t.Product = strings.ToUpper(opts.Product)
+		}
+		if t.TradeID == "" {
+			t.TradeID = syntheticID(t)
+		}
+		out = append(out, t)
+	}
+	return out
+}
+
+// syntheticID identifies a trade exported without a trade id by its
+// contents, so importing the same file twice still de-duplicates.
+func syntheticID(t Trade) string {
+	sum := sha1.Sum([]byte(fmt.Sprintf("%s|%s|%s|%s|%d|%g|%s", t.OrderRef, t.Exchange, t.Symbol,
+		t.Side, t.Quantity, t.Price, t.ExecutedAt.UTC().Format(time.RFC3339))))
+	return "IMP-" + hex.EncodeToString(sum[:10])
+}
+
+// dedupe drops trades whose id the ledger already has, or that appear
+// earlier in the file. Ids are unique across users, so an id another user
+// holds fails the row rather than being skipped.
+func dedupe(db *gorm.DB, trades []Trade, userID uuid.UUID, res *Result) ([]Trade, error) {
+	ids := make([]string, 0, len(trades))
+	for _, t := range trades {
+		ids = append(ids, t.TradeID)
+	}
+	owner := map[string]uuid.UUID{}
+	for start := 0; start < len(ids); start += 500 {
+		end := min(start+500, len(ids))
+		var rows []struct {
+			TxID   string
+			UserID uuid.UUID
+		}
+		err := db.Table("transactions").Select("transactions.tx_id, orders.user_id").
+			Joins("LEFT JOIN orders ON orders.id = transactions.order_id").
+			Where("transactions.tx_id IN ?", ids[start:end]).Scan(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rows {
+			owner[r.TxID] = r.UserID
+		}
+	}
+
+	seen := map[string]bool{}
+	var fresh []Trade
+	for _, t := range trades {
+		u, exists := owner[t.TradeID]
+		switch {
+		case exists && u != userID:
+			res.fail(t, fmt.Errorf("trade id %s is recorded under another account", t.TradeID))
+		case exists || seen[t.TradeID]:
+			res.Duplicates++
+		default:
+			seen[t.TradeID] = true
+			fresh = append(fresh, t)
+		}
+	}
+	return fresh, nil
+}
+
+// group is the trades of one parent order.
+type group struct {
+	ref    string
+	trades []*Trade
+	order  *models.Order
+}
+
+// imported is a fill booked by this import, with its transaction.
+type imported struct {
+	fill ledger.Fill
+	tx   *models.Transaction
+}
+
+// book files trades under parent orders, writes their transactions and
+// rebuilds the round trip summaries they change.
+func (im *Importer) book(db *gorm.DB, trades []Trade, opts Options, res *Result) error {
+	groups := map[string]*group{}
+	var keys []string
+	for i := range trades {
+		t := &trades[i]
+		k := strings.Join([]string{t.OrderRef, t.Exchange, t.Symbol, t.Side}, "|")
+		if t.OrderRef == "" {
+			k = "trade|" + t.TradeID // a parent per trade
+		}
+		g, ok := groups[k]
+		if !ok {
+			g = &group{ref: t.OrderRef}
+			groups[k] = g
+			keys = append(keys, k)
+		}
+		g.trades = append(g.trades, t)
+	}
+
+	var refs []string
+	for _, k := range keys {
+		if groups[k].ref != "" {
+			refs = append(refs, groups[k].ref)
+		}
+	}
+	existing := map[string]*models.Order{}
+	if len(refs) > 0 {
+		var found []models.Order
+		if err := db.Where("user_id = ? AND broker_order_id IN ?", opts.UserID, refs).Find(&found).Error; err != nil {
+			return err
+		}
+		for i := range found {
+			o := &found[i]
+			existing[strings.Join([]string{o.BrokerOrderID, o.Exchange, o.Instrument, o.Side}, "|")] = o
+		}
+	}
+
+	var out []imported
+	for _, k := range keys {
+		g := groups[k]
+		if o, ok := existing[k]; ok {
+			g.order = o
+			res.OrdersLinked++
+		} else {
+			g.order = newOrder(g, opts)
+			if err := db.Create(g.order).Error; err != nil {
+				return err
+			}
+			res.OrdersCreated++
+		}
+
+		filled := 0
+		for _, t := range g.trades {
+			tx := &models.Transaction{
+				ID:         uuid.New(),
+				TxID:       t.TradeID,
+				OrderID:    g.order.ID,
+				FillPrice:  t.Price,
+				Quantity:   t.Quantity,
+				ExecutedAt: t.ExecutedAt,
+				Brokerage:  t.Brokerage,
+				Taxes:      t.Taxes,
+				StrategyID: g.order.StrategyID,
+				Instrument: g.order.Instrument,
+			}
+			if im.Charges != nil {
+				im.Charges.Apply(g.order, tx)
+			}
+			t.Brokerage, t.Taxes = tx.Brokerage, tx.Taxes
+			filled += t.Quantity
+			out = append(out, imported{tx: tx, fill: ledger.Fill{
+				OrderID:      g.order.ID,
+				UserID:       opts.UserID,
+				StrategyID:   g.order.StrategyID,
+				DeploymentID: g.order.DeploymentID,
+				Instrument:   g.order.Instrument,
+				Exchange:     g.order.Exchange,
+				Side:         g.order.Side,
+				Quantity:     float64(t.Quantity),
+				Price:        t.Price,
+				Fees:         tx.Brokerage + tx.Taxes,
+				ExecutedAt:   t.ExecutedAt,
+			}})
+		}
+		if _, ok := existing[k]; ok {
+			// Fills the live adapter missed complete the order.
+			g.order.FilledQty += filled
+			if g.order.FilledQty >= g.order.Quantity {
+				g.order.Status = models.OrderStatusFilled
+			}
+			if err := db.Model(g.order).Updates(map[string]interface{}{
+				"filled_qty": g.order.FilledQty,
+				"status":     g.order.Status,
+			}).Error; err != nil {
+				return err
+			}
+		}
+	}
+
+	summaries, since, err := replay(db, out, opts.UserID)
+	if err != nil {
+		return err
+	}
+	for k, from := range since {
+		if err := db.Where("user_id = ? AND strategy_id = ? AND UPPER(instrument) = ? AND exit_time >= ?",
+			opts.UserID, k.strategy, k.instrument, from).Delete(&models.TradeSummary{}).Error; err != nil {
+			return err
+		}
+	}
+	txs := make([]*models.Transaction, len(out))
+	for i := range out {
+		txs[i] = out[i].tx
+	}
+	if err := db.CreateInBatches(txs, 500).Error; err != nil {
+		return err
+	}
+	res.Summaries = len(summaries)
+	if len(summaries) > 0 {
+		return db.CreateInBatches(summaries, 500).Error
+	}
+	return nil
+}
+
+// newOrder is the synthetic, already filled parent of a group: its size is
+// the group's total and its price the volume-weighted average.
+func newOrder(g *group, opts Options) *models.Order {
+	first := g.trades[0]
+	qty, notional := 0, 0.0
+	placed := first.ExecutedAt
+	for _, t := range g.trades {
+		qty += t.Quantity
+		notional += float64(t.Quantity) * t.Price
+		if t.ExecutedAt.Before(placed) {
+			placed = t.ExecutedAt
+		}
+	}
+	return &models.Order{
+		ID:            uuid.New(),
+		OrderID:       "IMP-" + uuid.NewString(),
+		UserID:        opts.UserID,
+		Instrument:    first.Symbol,
+		Exchange:      first.Exchange,
+		Quantity:      qty,
+		Price:         math.Round(notional/float64(qty)*10000) / 10000,
+		OrderType:     models.OrderTypeImported,
+		Side:          first.Side,
+		Status:        models.OrderStatusFilled,
+		StrategyID:    opts.StrategyID,
+		PlacedAt:      placed,
+		BrokerID:      opts.BrokerID,
+		BrokerOrderID: g.ref,
+		FilledQty:     qty,
+		Product:       first.Product,
+	}
+}
+
+type bookKey struct {
+	strategy   uuid.UUID
+	instrument string
+}
+
+// replay books new fills in execution order among the ledger's fills for
+// the same strategy and instrument. It marks fills that open or add to a
+// position as entries and returns a TradeSummary for every round trip,
+// flat to flat, that closes at or after the earliest new fill of its book:
+// an older fill slotted in earlier changes every later trip. since holds
+// that earliest time per book, from which stored summaries are replaced.
+func replay(db *gorm.DB, fills []imported, userID uuid.UUID) ([]models.TradeSummary, map[bookKey]time.Time, error) {
+	mine := map[bookKey][]*imported{}
+	since := map[bookKey]time.Time{}
+	var keys []bookKey
+	for i := range fills {
+		f := &fills[i]
+		k := bookKey{strategy: f.fill.StrategyID, instrument: strings.ToUpper(f.fill.Instrument)}
+		if _, ok := mine[k]; !ok {
+			keys = append(keys, k)
+		}
+		mine[k] = append(mine[k], f)
+		if t, ok := since[k]; !ok || f.fill.ExecutedAt.Before(t) {
+			since[k] = f.fill.ExecutedAt
+		}
+	}
+
+	var summaries []models.TradeSummary
+	for _, k := range keys {
+		old, err := ledger.LoadFills(db, func(q *gorm.DB) *gorm.DB {
+			return q.Where("orders.user_id = ? AND orders.strategy_id = ? AND UPPER(transactions.instrument) = ?",
+				userID, k.strategy, k.instrument)
+		})
+		if err != nil {
+			return nil, nil, err
+		}
+		// Ledger fills go first on equal times.
+		book := make([]imported, 0, len(old)+len(mine[k]))
+		for _, f := range old {
+			book = append(book, imported{fill: f})
+		}
+		for _, f := range mine[k] {
+			book = append(book, *f)
+		}
+		sort.SliceStable(book, func(a, b int) bool { return book[a].fill.ExecutedAt.Before(book[b].fill.ExecutedAt) })
+
+		pos := &ledger.Position{}
+		var trip *models.TradeSummary
+		realizedAt := 0.0
+		open := func(f ledger.Fill) {
+			trip = &models.TradeSummary{UserID: userID, StrategyID: k.strategy, Instrument: f.Instrument, EntryTime: f.ExecutedAt}
+			realizedAt = pos.Realized
+		}
+		for _, f := range book {
+			if trip == nil {
+				open(f.fill)
+			}
+			before := pos.Quantity
+			pos.Apply(f.fill)
+			trip.TotalTrades++
+			trip.TotalFees += f.fill.Fees
+			if f.tx != nil {
+				f.tx.IsEntry = before == 0 || (before > 0) == (f.fill.Signed() > 0)
+			}
+			flipped := before != 0 && pos.Quantity != 0 && (before > 0) != (pos.Quantity > 0)
+			if pos.Quantity != 0 && !flipped {
+				continue
+			}
+			if !f.fill.ExecutedAt.Before(since[k]) {
+				trip.ID = uuid.New()
+				trip.ExitTime = f.fill.ExecutedAt
+				trip.NetPnL = math.Round((pos.Realized-realizedAt)*10000) / 10000
+				trip.TotalFees = math.Round(trip.TotalFees*10000) / 10000
+				summaries = append(summaries, *trip)
+			}
+			trip = nil
+			if flipped {
+				// The rest of the fill opens the next trip.
+				open(f.fill)
+				trip.TotalTrades = 1
+			}
+		}
+	}
+	return summaries, since, nil
+}
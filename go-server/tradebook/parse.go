@@ -0,0 +1,441 @@
+// Package tradebook imports executions from broker tradebook exports (CSV or
+// XLSX) into the transaction ledger, for trades placed outside the platform.
+package tradebook
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-backend/options"
+)
+
+// Export formats Parse understands.
+const (
+	FormatZerodha = "zerodha" // Console tradebook
+	FormatUpstox  = "upstox"  // Upstox trade report
+	FormatGeneric = "generic" // any layout, described by a Mapping
+)
+
+// Trade is one execution read from a tradebook.
+type Trade struct {
+	Row        int       `json:"row"` // 1-based row in the file
+	TradeID    string    `json:"tradeId,omitempty"`
+	OrderRef   string    `json:"orderRef,omitempty"` // the broker's order id
+	Symbol     string    `json:"symbol"`
+	Exchange   string    `json:"exchange"`
+	Side       string    `json:"side"`
+	Quantity   int       `json:"quantity"`
+	Price      float64   `json:"price"`
+	ExecutedAt time.Time `json:"executedAt"`
+	Brokerage  float64   `json:"brokerage,omitempty"`
+	Taxes      float64   `json:"taxes,omitempty"`
+	Product    string    `json:"product,omitempty"`
+}
+
+// RowError is a row that could not be imported.
+type RowError struct {
+	Row     int    `json:"row"`
+	TradeID string `json:"tradeId,omitempty"`
+	Error   string `json:"error"`
+}
+
+// Mapping names the columns of a generic export, keyed by field: symbol,
+// exchange, side, quantity, price, tradeId, orderId, time, date, brokerage,
+// taxes and product. Fields left out are looked up under their own name.
+type Mapping map[string]string
+
+// mappingFields are the fields a Mapping may name.
+var mappingFields = []string{"symbol", "exchange", "side", "quantity", "price", "tradeId",
+	"orderId", "time", "date", "brokerage", "taxes", "product"}
+
+// Validate rejects mappings naming unknown fields.
+func (m Mapping) Validate() error {
+	for field := range m {
+		known := false
+		for _, f := range mappingFields {
+			known = known || f == field
+		}
+		if !known {
+			return fmt.Errorf("unknown mapping field %q", field)
+		}
+	}
+	return nil
+}
+
+func (m Mapping) column(field string) string {
+	if c, ok := m[field]; ok && strings.TrimSpace(c) != "" {
+		return key(c)
+	}
+	return key(field)
+}
+
+// headerScan is how many leading rows may precede the header; XLSX exports
+// open with the account holder's details.
+const headerScan = 30
+
+// Parse reads the trades of an export. format may be empty to detect it
+// from the header; mapping is only used by generic exports. Times without a
+// zone are read in loc. Rows that cannot be read are returned as errors
+// alongside the rest.
+func Parse(data []byte, format string, mapping Mapping, loc *time.Location) ([]Trade, string, []RowError, error) {
+	if _, ok := parsers[format]; format != "" && !ok {
+		return nil, format, nil, fmt.Errorf("unknown format %q", format)
+	}
+	rows, err := readRows(data)
+	if err != nil {
+		return nil, format, nil, err
+	}
+	header := -1
+	var cols map[string]int
+	for i := 0; i < len(rows) && i < headerScan; i++ {
+		c := columns(rows[i])
+		f := format
+		if f == "" {
+			f = detect(c)
+		}
+		if matches(f, c, mapping) {
+			header, cols, format = i, c, f
+			break
+		}
+	}
+	if header < 0 {
+		if format == "" {
+			return nil, format, nil, errors.New("no tradebook header found; pass format and, for generic files, a column mapping")
+		}
+		return nil, format, nil, fmt.Errorf("no %s tradebook header found", format)
+	}
+	parse := parsers[format]
+
+	var trades []Trade
+	var rowErrs []RowError
+	for i := header + 1; i < len(rows); i++ {
+		rec := rows[i]
+		if blank(rec) {
+			continue
+		}
+		get := func(name string) string {
+			if j, ok := cols[name]; ok && j < len(rec) {
+				return strings.TrimSpace(rec[j])
+			}
+			return ""
+		}
+		t, err := parse(get, mapping, loc)
+		t.Row = i + 1
+		if err == nil {
+			err = t.validate()
+		}
+		if err != nil {
+			rowErrs = append(rowErrs, RowError{Row: t.Row, TradeID: t.TradeID, Error: err.Error()})
+			continue
+		}
+		trades = append(trades, t)
+	}
+	return trades, format, rowErrs, nil
+}
+
+func readRows(data []byte) ([][]string, error) {
+	if isZip(data) {
+		return readXLSX(data)
+	}
+	cr := csv.NewReader(bytes.NewReader(bytes.TrimPrefix(data, []byte("\ufeff"))))
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.LazyQuotes = true
+	rows, err := cr.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("read csv: %w", err)
+	}
+	return rows, nil
+}
+
+// key normalises a column name: "Trade Num" and "trade_num" are the same.
+func key(s string) string {
+	s = strings.ToLower(strings.TrimSpace(s))
+	return strings.NewReplacer(" ", "_", "-", "_", ".", "").Replace(s)
+}
+
+func columns(rec []string) map[string]int {
+	cols := map[string]int{}
+	for i, h := range rec {
+		if k := key(h); k != "" {
+			if _, dup := cols[k]; !dup {
+				cols[k] = i
+			}
+		}
+	}
+	return cols
+}
+
+func blank(rec []string) bool {
+	for _, c := range rec {
+		if strings.TrimSpace(c) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+func detect(cols map[string]int) string {
+	has := func(name string) bool { _, ok := cols[name]; return ok }
+	switch {
+	case has("trade_id") && has("trade_type") && has("symbol"):
+		return FormatZerodha
+	case has("trade_num") && has("scrip_code"):
+		return FormatUpstox
+	}
+	return ""
+}
+
+// matches reports whether cols is a header format can read.
+func matches(format string, cols map[string]int, mapping Mapping) bool {
+	has := func(name string) bool { _, ok := cols[name]; return ok }
+	switch format {
+	case FormatZerodha:
+		return has("symbol") && has("trade_type") && has("quantity") && has("price")
+	case FormatUpstox:
+		return has("scrip_code") && has("side") && has("quantity") && has("price")
+	case FormatGeneric:
+		for _, f := range []string{"symbol", "side", "quantity", "price"} {
+			if !has(mapping.column(f)) {
+				return false
+			}
+		}
+		return has(mapping.column("time")) || has(mapping.column("date"))
+	}
+	return false
+}
+
+var parsers = map[string]func(get func(string) string, m Mapping, loc *time.Location) (Trade, error){
+	FormatZerodha: parseZerodha,
+	FormatUpstox:  parseUpstox,
+	FormatGeneric: parseGeneric,
+}
+
+// parseZerodha reads a Console tradebook row. Derivative rows carry the
+// cash exchange with an FO, CDS or COM segment.
+func parseZerodha(get func(string) string, _ Mapping, loc *time.Location) (Trade, error) {
+	t := Trade{
+		TradeID:  get("trade_id"),
+		OrderRef: get("order_id"),
+		Symbol:   strings.ToUpper(get("symbol")),
+		Exchange: exchangeFor(get("exchange"), get("segment")),
+	}
+	var err error
+	if t.Side, err = side(get("trade_type")); err != nil {
+		return t, err
+	}
+	if err = numbers(&t, get("quantity"), get("price")); err != nil {
+		return t, err
+	}
+	t.ExecutedAt, err = parseTime(get("trade_date"), get("order_execution_time"), loc)
+	return t, err
+}
+
+// parseUpstox reads an Upstox trade report row. Derivatives are listed by
+// underlying, expiry and strike, which are formatted into the monthly
+// trading symbol.
+func parseUpstox(get func(string) string, _ Mapping, loc *time.Location) (Trade, error) {
+	t := Trade{
+		TradeID:  get("trade_num"),
+		OrderRef: get("order_num"),
+		Symbol:   strings.ToUpper(get("scrip_code")),
+		Exchange: exchangeFor(get("exchange"), get("segment")),
+	}
+	if t.Symbol == "" {
+		t.Symbol = strings.ToUpper(get("symbol"))
+	}
+	var err error
+	if t.Side, err = side(get("side")); err != nil {
+		return t, err
+	}
+	if err = numbers(&t, get("quantity"), get("price")); err != nil {
+		return t, err
+	}
+	if t.ExecutedAt, err = parseTime(get("date"), get("trade_time"), loc); err != nil {
+		return t, err
+	}
+
+	typ := strings.ToUpper(get("instrument_type"))
+	if !strings.HasPrefix(typ, "FUT") && !strings.HasPrefix(typ, "OPT") && typ != "CE" && typ != "PE" {
+		return t, nil
+	}
+	expiry, err := parseTime(get("expiry"), "", loc)
+	if err != nil {
+		return t, fmt.Errorf("invalid expiry %q", get("expiry"))
+	}
+	if strings.HasPrefix(typ, "FUT") {
+		t.Symbol = options.FutureSymbol(t.Symbol, expiry)
+		return t, nil
+	}
+	optType := strings.ToUpper(get("option_type"))
+	if typ == "CE" || typ == "PE" {
+		optType = typ
+	}
+	strike, err := strconv.ParseFloat(number(get("strike_price")), 64)
+	if err != nil || (optType != "CE" && optType != "PE") {
+		return t, errors.New("option rows need a strike price and option type")
+	}
+	t.Symbol = options.OptionSymbol(t.Symbol, expiry, strike, optType)
+	return t, nil
+}
+
+// parseGeneric reads a row through the caller's column mapping.
+func parseGeneric(get func(string) string, m Mapping, loc *time.Location) (Trade, error) {
+	col := func(field string) string { return get(m.column(field)) }
+	t := Trade{
+		TradeID:  col("tradeId"),
+		OrderRef: col("orderId"),
+		Symbol:   strings.ToUpper(col("symbol")),
+		Exchange: strings.ToUpper(col("exchange")),
+		Product:  strings.ToUpper(col("product")),
+	}
+	var err error
+	if t.Side, err = side(col("side")); err != nil {
+		return t, err
+	}
+	if err = numbers(&t, col("quantity"), col("price")); err != nil {
+		return t, err
+	}
+	for field, v := range map[string]*float64{"brokerage": &t.Brokerage, "taxes": &t.Taxes} {
+		if s := number(col(field)); s != "" {
+			if *v, err = strconv.ParseFloat(s, 64); err != nil || *v < 0 {
+				return t, fmt.Errorf("invalid %s %q", field, col(field))
+			}
+		}
+	}
+	t.ExecutedAt, err = parseTime(col("date"), col("time"), loc)
+	return t, err
+}
+
+// exchangeFor maps a cash exchange and segment to the exchange the
+// platform files the contract under.
+func exchangeFor(exchange, segment string) string {
+	ex, seg := strings.ToUpper(strings.TrimSpace(exchange)), strings.ToUpper(strings.TrimSpace(segment))
+	switch seg {
+	case "FO", "F&O", "NFO", "BFO", "DERIVATIVES":
+		if ex == "BSE" {
+			return "BFO"
+		}
+		return "NFO"
+	case "CDS", "CD", "CURRENCY":
+		if ex == "BSE" {
+			return "BCD"
+		}
+		return "CDS"
+	case "COM", "MCX", "COMMODITY":
+		if ex == "" || ex == "NSE" || ex == "BSE" {
+			return "MCX"
+		}
+	}
+	return ex
+}
+
+func side(s string) (string, error) {
+	switch strings.ToUpper(strings.TrimSpace(s)) {
+	case "BUY", "B":
+		return "BUY", nil
+	case "SELL", "S":
+		return "SELL", nil
+	}
+	return "", fmt.Errorf("invalid side %q", s)
+}
+
+// number strips thousands separators and a currency sign.
+func number(s string) string {
+	return strings.TrimSpace(strings.NewReplacer(",", "", "₹", "", "Rs.", "").Replace(s))
+}
+
+func numbers(t *Trade, qty, price string) error {
+	q, err := strconv.ParseFloat(number(qty), 64)
+	if err != nil || q != float64(int(q)) {
+		return fmt.Errorf("invalid quantity %q", qty)
+	}
+	t.Quantity = int(q)
+	if t.Price, err = strconv.ParseFloat(number(price), 64); err != nil {
+		return fmt.Errorf("invalid price %q", price)
+	}
+	return nil
+}
+
+func (t *Trade) validate() error {
+	switch {
+	case t.Symbol == "":
+		return errors.New("symbol is required")
+	case t.Quantity <= 0:
+		return errors.New("quantity must be positive")
+	case t.Price < 0:
+		return errors.New("price must not be negative")
+	}
+	return nil
+}
+
+var (
+	dateTimeLayouts = []string{time.RFC3339, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02 15:04",
+		"02-01-2006 15:04:05", "02/01/2006 15:04:05", "02-Jan-2006 15:04:05", "02 Jan 2006 15:04:05"}
+	dateLayouts = []string{"2006-01-02", "02-01-2006", "02/01/2006", "02-Jan-2006", "02 Jan 2006", "02-Jan-06"}
+	timeLayouts = []string{"15:04:05", "15:04", "03:04:05 PM", "03:04 PM"}
+)
+
+// parseTime reads an execution time from a date column, a time column, or
+// both; either may already be a full timestamp or an Excel serial number.
+func parseTime(date, clock string, loc *time.Location) (time.Time, error) {
+	date, clock = strings.TrimSpace(date), strings.TrimSpace(clock)
+	for _, s := range []string{clock, date} {
+		if t, ok := fullTime(s, loc); ok {
+			return t, nil
+		}
+	}
+	var day time.Time
+	if n, err := strconv.ParseFloat(date, 64); err == nil && n > 1 {
+		day = excelTime(n, loc)
+	} else {
+		for _, layout := range dateLayouts {
+			if t, err := time.ParseInLocation(layout, date, loc); err == nil {
+				day = t
+				break
+			}
+		}
+	}
+	if day.IsZero() {
+		if date == "" {
+			return time.Time{}, errors.New("trade date is required")
+		}
+		return time.Time{}, fmt.Errorf("invalid trade date %q", date)
+	}
+	if clock == "" {
+		return day, nil
+	}
+	if n, err := strconv.ParseFloat(clock, 64); err == nil && n < 1 {
+		return day.Add(time.Duration(n * 24 * float64(time.Hour))).Round(time.Second), nil
+	}
+	for _, layout := range timeLayouts {
+		if c, err := time.Parse(layout, clock); err == nil {
+			return time.Date(day.Year(), day.Month(), day.Day(), c.Hour(), c.Minute(), c.Second(), 0, loc), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid trade time %q", clock)
+}
+
+// fullTime parses s when it holds both a date and a time.
+func fullTime(s string, loc *time.Location) (time.Time, bool) {
+	if s == "" {
+		return time.Time{}, false
+	}
+	if n, err := strconv.ParseFloat(s, 64); err == nil {
+		if n > 1 && n != float64(int(n)) {
+			return excelTime(n, loc), true
+		}
+		return time.Time{}, false
+	}
+	for _, layout := range dateTimeLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,209 @@
+package tradebook
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// readXLSX returns the cells of the workbook's first sheet as rows of
+// strings. It understands what broker exports contain — shared and inline
+// strings, numbers and booleans — not formulas or styles.
+func readXLSX(data []byte) ([][]string, error) {
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return nil, fmt.Errorf("not an xlsx file: %w", err)
+	}
+	files := map[string]*zip.File{}
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+
+	var shared []string
+	if f, ok := files["xl/sharedStrings.xml"]; ok {
+		if shared, err = sharedStrings(f); err != nil {
+			return nil, err
+		}
+	}
+	sheet, err := firstSheet(files)
+	if err != nil {
+		return nil, err
+	}
+	return sheetRows(sheet, shared)
+}
+
+func openXML(f *zip.File, v interface{}) error {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(rc).Decode(v)
+}
+
+type xlsxText struct {
+	T    string `xml:"t"`
+	Runs []struct {
+		T string `xml:"t"`
+	} `xml:"r"`
+}
+
+func (t xlsxText) String() string {
+	if len(t.Runs) == 0 {
+		return t.T
+	}
+	var b strings.Builder
+	for _, r := range t.Runs {
+		b.WriteString(r.T)
+	}
+	return b.String()
+}
+
+func sharedStrings(f *zip.File) ([]string, error) {
+	var sst struct {
+		Items []xlsxText `xml:"si"`
+	}
+	if err := openXML(f, &sst); err != nil {
+		return nil, fmt.Errorf("shared strings: %w", err)
+	}
+	out := make([]string, len(sst.Items))
+	for i, si := range sst.Items {
+		out[i] = si.String()
+	}
+	return out, nil
+}
+
+// firstSheet finds the first sheet listed in the workbook, falling back to
+// the first worksheet part by name.
+func firstSheet(files map[string]*zip.File) (*zip.File, error) {
+	if wb, ok := files["xl/workbook.xml"]; ok {
+		var book struct {
+			Sheets []struct {
+				ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+			} `xml:"sheets>sheet"`
+		}
+		var rels struct {
+			Rels []struct {
+				ID     string `xml:"Id,attr"`
+				Target string `xml:"Target,attr"`
+			} `xml:"Relationship"`
+		}
+		if rf, ok := files["xl/_rels/workbook.xml.rels"]; ok && openXML(wb, &book) == nil && openXML(rf, &rels) == nil && len(book.Sheets) > 0 {
+			for _, r := range rels.Rels {
+				if r.ID != book.Sheets[0].ID {
+					continue
+				}
+				target := strings.TrimPrefix(r.Target, "/")
+				if !strings.HasPrefix(target, "xl/") {
+					target = path.Join("xl", target)
+				}
+				if f, ok := files[target]; ok {
+					return f, nil
+				}
+			}
+		}
+	}
+	var names []string
+	for name := range files {
+		if strings.HasPrefix(name, "xl/worksheets/") && strings.HasSuffix(name, ".xml") {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		return nil, errors.New("workbook has no worksheets")
+	}
+	sort.Strings(names)
+	return files[names[0]], nil
+}
+
+func sheetRows(f *zip.File, shared []string) ([][]string, error) {
+	var ws struct {
+		Rows []struct {
+			R     int `xml:"r,attr"`
+			Cells []struct {
+				Ref    string   `xml:"r,attr"`
+				Type   string   `xml:"t,attr"`
+				Value  string   `xml:"v"`
+				Inline xlsxText `xml:"is"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := openXML(f, &ws); err != nil {
+		return nil, fmt.Errorf("worksheet: %w", err)
+	}
+
+	var rows [][]string
+	for _, row := range ws.Rows {
+		// Rows and cells may skip blanks; keep the sheet's positions.
+		idx := row.R - 1
+		if idx < len(rows) {
+			idx = len(rows)
+		}
+		for len(rows) < idx {
+			rows = append(rows, nil)
+		}
+		var cells []string
+		for i, c := range row.Cells {
+			col := i
+			if c.Ref != "" {
+				col = column(c.Ref)
+			}
+			for len(cells) < col {
+				cells = append(cells, "")
+			}
+			var v string
+			switch c.Type {
+			case "s":
+				n, err := strconv.Atoi(c.Value)
+				if err != nil || n < 0 || n >= len(shared) {
+					return nil, fmt.Errorf("cell %s: bad shared string index", c.Ref)
+				}
+				v = shared[n]
+			case "inlineStr":
+				v = c.Inline.String()
+			case "b":
+				v = map[string]string{"1": "TRUE", "0": "FALSE"}[c.Value]
+			default:
+				v = c.Value
+			}
+			cells = append(cells, v)
+		}
+		rows = append(rows, cells)
+	}
+	return rows, nil
+}
+
+// column is the zero-based column of a cell reference such as "AB12".
+func column(ref string) int {
+	n := 0
+	for _, r := range ref {
+		if r < 'A' || r > 'Z' {
+			break
+		}
+		n = n*26 + int(r-'A'+1)
+	}
+	return n - 1
+}
+
+// excelEpoch is day zero of Excel's 1900 date system, allowing for its
+// fictitious 29 Feb 1900.
+var excelEpoch = time.Date(1899, 12, 30, 0, 0, 0, 0, time.UTC)
+
+// excelTime converts a serial date such as 45306.3875 to a wall-clock time
+// in loc.
+func excelTime(serial float64, loc *time.Location) time.Time {
+	t := excelEpoch.Add(time.Duration(serial * 24 * float64(time.Hour))).Round(time.Second)
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, loc)
+}
+
+// isZip reports whether data starts like a zip archive, as XLSX files do.
+func isZip(data []byte) bool {
+	return len(data) >= 4 && bytes.Equal(data[:4], []byte("PK\x03\x04"))
+}